@@ -0,0 +1,324 @@
+// Package admin provides an HTTP API to inspect and manage a cache in production,
+// e.g. to delete or refresh poisoned entries without a deploy
+//
+// All the requests must be authenticated by the bearer token in Config.Token.
+// Keys are given by the "key" query parameter, and parsed by Config.ParseKey.
+//
+//	GET    /keys?prefix=user:&limit=100  list the keys in order, the next page is listed by after=<the last key>
+//	GET    /entry?key=user:42            entry info
+//	DELETE /entry?key=user:42            delete the key
+//	POST   /expire?key=user:42           expire the key, its stale value is served until it's refreshed
+//	POST   /refresh?key=user:42          refresh the key by Config.Refresh, regardless of its ttl
+//	POST   /purge                        delete all the keys
+//	GET    /invalidations                pending invalidations scheduled by DeleteAfter and ExpireAfter
+//	DELETE /invalidations?key=user:42    cancel the pending invalidation of the key
+//	GET    /stats                        cache statistics
+//
+// The handler can be mounted on any mux:
+//
+//	mux.Handle("/admin/", http.StripPrefix("/admin", admin.New(cache, admin.Config{Token: token})))
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+const defaultLimit = 1000
+
+// ErrNoToken is returned by New when Config.Token is not set
+var ErrNoToken = errors.New("admin: Config.Token must be set")
+
+// Config of the admin API
+type Config struct {
+	// Token bearer token which authenticates the requests
+	Token string
+
+	// ParseKey returns the cache key of the "key" query parameter
+	// Default returns the parameter as string
+	ParseKey func(s string) (any, error)
+
+	// Refresh is called to refresh a key by the refresh endpoint, which is disabled if it's not set
+	Refresh lastcache.AsyncCallback
+
+	// ShowValues enables returning the cached values in the entry info, which is disabled by default
+	// since the values might be sensitive
+	ShowValues bool
+}
+
+// KeyInfo a key as it's listed by the keys endpoint
+type KeyInfo struct {
+	Key       string    `json:"key"`
+	Stale     bool      `json:"stale"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Version   uint64    `json:"version"`
+	// Error last refresh error of the stale key
+	Error string `json:"error,omitempty"`
+}
+
+// EntryInfo an entry as it's returned by the entry and refresh endpoints
+type EntryInfo struct {
+	Key     string        `json:"key"`
+	Value   any           `json:"value,omitempty"`
+	Stale   bool          `json:"stale"`
+	TTL     time.Duration `json:"ttl"`
+	Version uint64        `json:"version"`
+	// Stats per-key statistics, if Config.KeyStats of the cache is enabled
+	Stats *lastcache.KeyStats `json:"stats,omitempty"`
+	// Error error of the refresh endpoint
+	Error string `json:"error,omitempty"`
+}
+
+// InvalidationInfo a pending invalidation as it's listed by the invalidations endpoint
+type InvalidationInfo struct {
+	Key    string    `json:"key"`
+	At     time.Time `json:"at"`
+	Delete bool      `json:"delete"`
+}
+
+type handler struct {
+	cache  *lastcache.Cache
+	config Config
+	mux    *http.ServeMux
+}
+
+// New returns the admin API handler of the cache
+func New(cache *lastcache.Cache, config Config) (http.Handler, error) {
+	if config.Token == "" {
+		return nil, ErrNoToken
+	}
+	if config.ParseKey == nil {
+		config.ParseKey = func(s string) (any, error) {
+			return s, nil
+		}
+	}
+
+	h := &handler{cache: cache, config: config, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/keys", h.method(http.MethodGet, h.keys))
+	h.mux.HandleFunc("/entry", h.entry)
+	h.mux.HandleFunc("/expire", h.method(http.MethodPost, h.expire))
+	h.mux.HandleFunc("/refresh", h.method(http.MethodPost, h.refresh))
+	h.mux.HandleFunc("/purge", h.method(http.MethodPost, h.purge))
+	h.mux.HandleFunc("/invalidations", h.invalidations)
+	h.mux.HandleFunc("/stats", h.method(http.MethodGet, h.stats))
+	return h, nil
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	want := []byte("Bearer " + h.config.Token)
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+		writeError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// method returns a handler which allows only the method
+func (h *handler) method(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (h *handler) keys(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	after := r.URL.Query().Get("after")
+	limit := defaultLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", s))
+			return
+		}
+	}
+
+	keys := []KeyInfo{}
+	h.cache.RangeEntries(func(key any, e lastcache.Entry, expiresAt time.Time) bool {
+		name := fmt.Sprint(key)
+		if !strings.HasPrefix(name, prefix) || name <= after {
+			return true
+		}
+		info := KeyInfo{Key: name, Stale: e.Stale, ExpiresAt: expiresAt, Version: e.Version}
+		if e.Err != nil {
+			info.Error = e.Err.Error()
+		}
+		keys = append(keys, info)
+		return true
+	})
+	// all the keys are sorted before the limit, so the pages are consistent
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Key < keys[j].Key
+	})
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+func (h *handler) entry(w http.ResponseWriter, r *http.Request) {
+	key, ok := h.key(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		entry, err := h.cache.Get(key)
+		if errors.Is(err, lastcache.ErrNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, h.entryInfo(key, entry))
+	case http.MethodDelete:
+		h.cache.Delete(key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+	}
+}
+
+func (h *handler) expire(w http.ResponseWriter, r *http.Request) {
+	key, ok := h.key(w, r)
+	if !ok {
+		return
+	}
+	if !h.cache.Expire(key) {
+		writeError(w, http.StatusNotFound, lastcache.ErrNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refresh forces the refresh of the key and waits for it
+func (h *handler) refresh(w http.ResponseWriter, r *http.Request) {
+	if h.config.Refresh == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("refresh is not configured"))
+		return
+	}
+	key, ok := h.key(w, r)
+	if !ok {
+		return
+	}
+
+	entry, refresh, err := h.cache.AsyncLoadOrStoreWithCtx(r.Context(), key, h.config.Refresh, lastcache.WithForceRefresh())
+	if err == nil && refresh != nil {
+		entry, err = refresh.Result()
+	}
+
+	info := h.entryInfo(key, entry)
+	status := http.StatusOK
+	if err != nil {
+		info.Error = err.Error()
+		status = refreshStatus(err)
+	}
+	writeJSON(w, status, info)
+}
+
+// refreshStatus returns the response status of the refresh error
+func refreshStatus(err error) int {
+	switch {
+	case errors.Is(err, lastcache.ErrNoTenant):
+		// the keys of a cache with TenantFunc are scoped by the tenant of the context, which the request doesn't have
+		return http.StatusBadRequest
+	case errors.Is(err, lastcache.ErrClosed):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, lastcache.ErrNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func (h *handler) purge(w http.ResponseWriter, r *http.Request) {
+	n := 0
+	h.cache.RangeEntries(func(key any, e lastcache.Entry, expiresAt time.Time) bool {
+		h.cache.Delete(key)
+		n++
+		return true
+	})
+	writeJSON(w, http.StatusOK, map[string]int{"deleted": n})
+}
+
+func (h *handler) invalidations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list := []InvalidationInfo{}
+		for _, inv := range h.cache.PendingInvalidations() {
+			list = append(list, InvalidationInfo{Key: fmt.Sprint(inv.Key), At: inv.At, Delete: inv.Delete})
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].At.Before(list[j].At)
+		})
+		writeJSON(w, http.StatusOK, list)
+	case http.MethodDelete:
+		key, ok := h.key(w, r)
+		if !ok {
+			return
+		}
+		if !h.cache.CancelInvalidation(key) {
+			writeError(w, http.StatusNotFound, errors.New("no pending invalidation"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+	}
+}
+
+func (h *handler) stats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.cache.Stats())
+}
+
+// key returns the parsed key of the request, the error response is written if it's invalid
+func (h *handler) key(w http.ResponseWriter, r *http.Request) (any, bool) {
+	s := r.URL.Query().Get("key")
+	if s == "" {
+		writeError(w, http.StatusBadRequest, errors.New("key is required"))
+		return nil, false
+	}
+	key, err := h.config.ParseKey(s)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	return key, true
+}
+
+func (h *handler) entryInfo(key any, entry lastcache.Entry) EntryInfo {
+	info := EntryInfo{
+		Key:     fmt.Sprint(key),
+		Stale:   entry.Stale,
+		TTL:     h.cache.TTL(key),
+		Version: entry.Version,
+	}
+	if h.config.ShowValues {
+		info.Value = entry.Value
+	}
+	if stats, ok := h.cache.KeyStats(key); ok {
+		info.Stats = &stats
+	}
+	return info
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
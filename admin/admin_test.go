@@ -0,0 +1,231 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+func newAdmin(t *testing.T, config Config) (*lastcache.Cache, http.Handler) {
+	t.Helper()
+	return newAdminOf(t, lastcache.Config{GlobalTTL: time.Minute, KeyStats: true}, config)
+}
+
+func newAdminOf(t *testing.T, cacheConfig lastcache.Config, config Config) (*lastcache.Cache, http.Handler) {
+	t.Helper()
+	cache := lastcache.New(cacheConfig)
+	config.Token = "secret"
+	h, err := New(cache, config)
+	if err != nil {
+		t.Fatalf("New() failed with err: %v", err)
+	}
+	return cache, h
+}
+
+func do(h http.Handler, method, target string, v any) int {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if v != nil {
+		json.NewDecoder(rec.Body).Decode(v)
+	}
+	return rec.Code
+}
+
+func TestAdmin_Keys(t *testing.T) {
+	cache, h := newAdmin(t, Config{})
+	cache.Set("user:1", "a")
+	cache.Set("user:2", "b")
+	cache.Set("order:1", "c")
+	cache.Expire("user:2")
+
+	var keys []KeyInfo
+	if status := do(h, http.MethodGet, "/keys?prefix=user:", &keys); status != http.StatusOK {
+		t.Fatalf("GET /keys got status %v", status)
+	}
+	if len(keys) != 2 || keys[0].Key != "user:1" || keys[0].Stale || !keys[1].Stale {
+		t.Errorf("GET /keys got %+v, want user:1 fresh and user:2 stale", keys)
+	}
+
+	// the pages are listed in order
+	var names []string
+	for after := ""; len(names) < 10; {
+		if status := do(h, http.MethodGet, "/keys?limit=1&after="+after, &keys); status != http.StatusOK || len(keys) > 1 {
+			t.Fatalf("GET /keys?limit=1 got %+v with status %v, want 1 key", keys, status)
+		}
+		if len(keys) == 0 {
+			break
+		}
+		after = keys[0].Key
+		names = append(names, after)
+	}
+	if want := []string{"order:1", "user:1", "user:2"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("GET /keys?limit=1 pages got %v, want %v", names, want)
+	}
+	if status := do(h, http.MethodGet, "/keys?limit=x", nil); status != http.StatusBadRequest {
+		t.Errorf("GET /keys?limit=x got status %v, want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestAdmin_Entry(t *testing.T) {
+	cache, h := newAdmin(t, Config{ShowValues: true})
+	cache.Set("key", "value")
+
+	var info EntryInfo
+	if status := do(h, http.MethodGet, "/entry?key=key", &info); status != http.StatusOK {
+		t.Fatalf("GET /entry got status %v", status)
+	}
+	if info.Value != "value" || info.Stale || info.TTL <= 0 || info.Stats == nil {
+		t.Errorf("GET /entry got %+v", info)
+	}
+
+	if status := do(h, http.MethodPost, "/expire?key=key", nil); status != http.StatusNoContent {
+		t.Errorf("POST /expire got status %v", status)
+	}
+	if _, err := cache.Get("key"); !errors.Is(err, lastcache.ErrExpired) {
+		t.Errorf("Get() err got %v, want %v", err, lastcache.ErrExpired)
+	}
+
+	if status := do(h, http.MethodDelete, "/entry?key=key", nil); status != http.StatusNoContent {
+		t.Errorf("DELETE /entry got status %v", status)
+	}
+	if status := do(h, http.MethodGet, "/entry?key=key", nil); status != http.StatusNotFound {
+		t.Errorf("GET /entry of deleted key got status %v, want %v", status, http.StatusNotFound)
+	}
+	if status := do(h, http.MethodPost, "/expire?key=key", nil); status != http.StatusNotFound {
+		t.Errorf("POST /expire of deleted key got status %v, want %v", status, http.StatusNotFound)
+	}
+	if status := do(h, http.MethodGet, "/entry", nil); status != http.StatusBadRequest {
+		t.Errorf("GET /entry without key got status %v, want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestAdmin_Refresh(t *testing.T) {
+	_, disabled := newAdmin(t, Config{})
+	if status := do(disabled, http.MethodPost, "/refresh?key=key", nil); status != http.StatusNotImplemented {
+		t.Errorf("POST /refresh got status %v, want %v", status, http.StatusNotImplemented)
+	}
+
+	fail := false
+	cache, h := newAdmin(t, Config{
+		ShowValues: true,
+		Refresh: func(ctx context.Context, key any, prev *lastcache.Entry) (any, error) {
+			if fail {
+				return nil, errors.New("origin is down")
+			}
+			return "refreshed", nil
+		},
+	})
+	cache.Set("key", "poisoned")
+
+	var info EntryInfo
+	if status := do(h, http.MethodPost, "/refresh?key=key", &info); status != http.StatusOK || info.Value != "refreshed" {
+		t.Errorf("POST /refresh got %+v with status %v, want refreshed", info, status)
+	}
+
+	fail = true
+	if status := do(h, http.MethodPost, "/refresh?key=key", &info); status != http.StatusBadGateway || info.Error == "" {
+		t.Errorf("POST /refresh got %+v with status %v, want the error", info, status)
+	}
+}
+
+func TestAdmin_RefreshJitter(t *testing.T) {
+	cache, h := newAdminOf(t, lastcache.Config{GlobalTTL: time.Minute, RefreshJitter: time.Minute}, Config{
+		ShowValues: true,
+		Refresh: func(ctx context.Context, key any, prev *lastcache.Entry) (any, error) {
+			return "refreshed", nil
+		},
+	})
+	cache.Set("key", "poisoned")
+
+	var info EntryInfo
+	if status := do(h, http.MethodPost, "/refresh?key=key", &info); status != http.StatusOK || info.Value != "refreshed" {
+		t.Errorf("POST /refresh got %+v with status %v, want refreshed", info, status)
+	}
+	if entry, _ := cache.Get("key"); entry.Value != "refreshed" {
+		t.Errorf("Get() got %+v, want refreshed", entry)
+	}
+}
+
+func TestAdmin_RefreshTenant(t *testing.T) {
+	_, h := newAdminOf(t, lastcache.Config{GlobalTTL: time.Minute, TenantFunc: func(ctx context.Context) string {
+		return ""
+	}}, Config{
+		Refresh: func(ctx context.Context, key any, prev *lastcache.Entry) (any, error) {
+			return "refreshed", nil
+		},
+	})
+
+	var info EntryInfo
+	if status := do(h, http.MethodPost, "/refresh?key=key", &info); status != http.StatusBadRequest || info.Error == "" {
+		t.Errorf("POST /refresh got %+v with status %v, want %v", info, status, http.StatusBadRequest)
+	}
+}
+
+func TestAdmin_Purge(t *testing.T) {
+	cache, h := newAdmin(t, Config{})
+	cache.Set("key1", "value1")
+	cache.Set("key2", "value2")
+
+	var result map[string]int
+	if status := do(h, http.MethodPost, "/purge", &result); status != http.StatusOK || result["deleted"] != 2 {
+		t.Errorf("POST /purge got %v with status %v, want 2 deleted", result, status)
+	}
+	if status := do(h, http.MethodGet, "/purge", nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET /purge got status %v, want %v", status, http.StatusMethodNotAllowed)
+	}
+
+	var stats lastcache.Stats
+	if status := do(h, http.MethodGet, "/stats", &stats); status != http.StatusOK {
+		t.Errorf("GET /stats got status %v", status)
+	}
+}
+
+func TestAdmin_Unauthorized(t *testing.T) {
+	if _, err := New(lastcache.New(lastcache.Config{}), Config{}); !errors.Is(err, ErrNoToken) {
+		t.Errorf("New() err got %v, want %v", err, ErrNoToken)
+	}
+
+	_, h := newAdmin(t, Config{})
+	req := httptest.NewRequest(http.MethodGet, "/keys", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status got %v, want %v", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAdmin_Invalidations(t *testing.T) {
+	cache, h := newAdmin(t, Config{})
+	defer cache.Close()
+	cache.Set("user:1", "a")
+	cache.DeleteAfter("user:1", time.Hour)
+	cache.ExpireAfter("user:2", 2*time.Hour)
+
+	var list []InvalidationInfo
+	if status := do(h, http.MethodGet, "/invalidations", &list); status != http.StatusOK {
+		t.Fatalf("GET /invalidations got status %v", status)
+	}
+	if len(list) != 2 || list[0].Key != "user:1" || !list[0].Delete || list[1].Delete {
+		t.Errorf("GET /invalidations got %+v", list)
+	}
+
+	if status := do(h, http.MethodDelete, "/invalidations?key=user:1", nil); status != http.StatusNoContent {
+		t.Errorf("DELETE /invalidations got status %v", status)
+	}
+	if status := do(h, http.MethodDelete, "/invalidations?key=user:1", nil); status != http.StatusNotFound {
+		t.Errorf("DELETE /invalidations again got status %v", status)
+	}
+	if pending := cache.PendingInvalidations(); len(pending) != 1 {
+		t.Errorf("PendingInvalidations() got %+v, want user:2", pending)
+	}
+}
@@ -0,0 +1,167 @@
+package lastcache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultBatchWindow = 10 * time.Millisecond
+
+// BatchRefreshFunc given the expired keys, should return their new values
+// Keys missing in the returned map are considered as failed refreshes with ErrNotFound, and an error value
+// as the failed refresh of its key, e.g. ErrTombstone deletes the key
+// The failures count for Config.MaxConsecutiveFailures and Config.DeleteAfterFailures like AsyncCallback errors
+type BatchRefreshFunc func(ctx context.Context, keys []any) (map[any]any, error)
+
+type batchItem struct {
+	ctx     context.Context
+	refresh *Refresh
+	// o options of the call which started the refresh
+	o callOptions
+}
+
+// batcher collects the keys to be refreshed within Config.BatchWindow
+type batcher struct {
+	mu      sync.Mutex
+	pending map[any]batchItem
+}
+
+// enqueueBatch adds the key to the pending batch, the batch is flushed after Config.BatchWindow
+func (c *Cache) enqueueBatch(ctx context.Context, key any, refresh *Refresh, o callOptions) {
+	c.batcher.mu.Lock()
+	defer c.batcher.mu.Unlock()
+
+	if c.batcher.pending == nil {
+		c.batcher.pending = make(map[any]batchItem)
+		window := c.config.BatchWindow
+		if window <= 0 {
+			window = defaultBatchWindow
+		}
+		time.AfterFunc(window, c.flushBatch)
+	}
+	c.batcher.pending[key] = batchItem{ctx: ctx, refresh: refresh, o: o}
+}
+
+func (c *Cache) flushBatch() {
+	c.batcher.mu.Lock()
+	pending := c.batcher.pending
+	c.batcher.pending = nil
+	c.batcher.mu.Unlock()
+
+	c.refreshBatch(pending, c.config.BatchRefresh)
+}
+
+// batchContext is the context of a batch callback, which is canceled when the contexts of all the refreshed keys are
+// done, e.g. by Refresh.Cancel, and looks up the values in their contexts in order
+type batchContext struct {
+	context.Context
+	contexts []context.Context
+}
+
+func newBatchContext(contexts []context.Context) (context.Context, context.CancelFunc) {
+	if len(contexts) == 1 {
+		return contexts[0], func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for _, c := range contexts {
+			select {
+			case <-c.Done():
+			case <-ctx.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+	return batchContext{Context: ctx, contexts: contexts}, cancel
+}
+
+func (b batchContext) Value(key any) any {
+	for _, ctx := range b.contexts {
+		if v := ctx.Value(key); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// refreshBatch refreshes the pending keys which are still expired by a single callback call,
+// and completes their refreshes
+// The context of the callback is derived from the contexts of the refreshes, see batchContext
+func (c *Cache) refreshBatch(pending map[any]batchItem, callback BatchRefreshFunc) {
+	c.lazyInit()
+	c.semaphore.acquire(nil)
+	defer c.semaphore.release()
+
+	results := make(map[any]Entry, len(pending))
+	errs := make(map[any]error, len(pending))
+	defer func() {
+		for key, item := range pending {
+			c.untrackRefresh(key, item.refresh)
+			item.refresh.complete(results[key], errs[key])
+		}
+	}()
+
+	keys := make([]any, 0, len(pending))
+	contexts := make([]context.Context, 0, len(pending))
+	for key, item := range pending {
+		if err := item.ctx.Err(); err != nil {
+			errs[key] = err
+			continue
+		}
+		// only refresh the keys which are still expired, unless they're forced by WithForceRefresh
+		if !item.o.forceRefresh && !c.checkIfExpired(key) {
+			var entry Entry
+			entry.Value, entry.Version, _ = c.loadWithVersion(key)
+			results[key] = entry
+			continue
+		}
+		// extend stale cache ttl
+		if !item.o.noExtend {
+			c.extendStale(key)
+		}
+
+		release, acquired := c.acquireLease(item.ctx, key)
+		if !acquired {
+			entry := Entry{Stale: true, Source: SourceStaleFallback}
+			entry.Value, entry.Version, _ = c.loadWithVersion(key)
+			results[key] = entry
+			errs[key] = ErrLeaseHeld
+			continue
+		}
+		defer release()
+		keys = append(keys, key)
+		contexts = append(contexts, item.ctx)
+	}
+	if len(keys) == 0 {
+		return
+	}
+	ctx, cancel := newBatchContext(contexts)
+	defer cancel()
+
+	start := time.Now()
+	values, err := callback(ctx, keys)
+	c.recordCallback(nil, CallbackAsync, time.Since(start), err)
+
+	for _, key := range keys {
+		keyErr := err
+		if keyErr == nil {
+			value, ok := values[key]
+			if !ok {
+				keyErr = ErrNotFound
+			} else if valueErr, isErr := value.(error); isErr {
+				keyErr = valueErr
+			} else {
+				results[key] = c.storeFor(key, value, pending[key].o.ttl)
+				continue
+			}
+		}
+
+		// the failures are recorded like the refreshes of AsyncCallback, see updateCache
+		if !c.isTombstone(key, keyErr) {
+			c.storeErr(key, keyErr)
+		}
+		errs[key] = callbackError(key, keyErr)
+	}
+}
@@ -0,0 +1,224 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache_BatchRefresh(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]any
+	cache := New(Config{
+		GlobalTTL:   10 * time.Millisecond,
+		BatchWindow: 5 * time.Millisecond,
+		BatchRefresh: func(ctx context.Context, keys []any) (map[any]any, error) {
+			mu.Lock()
+			batches = append(batches, keys)
+			mu.Unlock()
+
+			values := make(map[any]any)
+			for _, key := range keys {
+				if key != "missing" {
+					values[key] = "new_" + key.(string)
+				}
+			}
+			return values, nil
+		},
+	})
+
+	now = func() time.Time { return fixedTime() }
+	for _, key := range []string{"key1", "key2", "missing"} {
+		cache.Set(key, "value")
+	}
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	callback := func(ctx context.Context, key any, prev *Entry) (any, error) {
+		t.Errorf("AsyncCallback should not be called for key %v", key)
+		return nil, nil
+	}
+
+	refreshes := make(map[string]*Refresh)
+	for _, key := range []string{"key1", "key2", "missing"} {
+		_, refreshes[key], _ = cache.AsyncLoadOrStore(key, callback)
+	}
+
+	for _, key := range []string{"key1", "key2"} {
+		entry, err := refreshes[key].Result()
+		if err != nil || entry.Value != "new_"+key {
+			t.Errorf("Result() of %v got %+v, %v, want new_%v", key, entry, err, key)
+		}
+	}
+	if _, err := refreshes["missing"].Result(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Result() of missing key err got %v, want %v", err, ErrNotFound)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != 1 {
+		t.Fatalf("BatchRefresh calls got %v, want 1", len(batches))
+	}
+	sort.Slice(batches[0], func(i, j int) bool { return batches[0][i].(string) < batches[0][j].(string) })
+	if want := []any{"key1", "key2", "missing"}; !reflect.DeepEqual(batches[0], want) {
+		t.Errorf("BatchRefresh keys got %v, want %v", batches[0], want)
+	}
+}
+
+func TestCache_BatchRefreshError(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+		BatchRefresh: func(ctx context.Context, keys []any) (map[any]any, error) {
+			return nil, errors.New("unavailable")
+		},
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	_, refresh, _ := cache.AsyncLoadOrStore("key", nil)
+	if _, err := refresh.Result(); !errors.Is(err, ErrCallbackFailed) {
+		t.Errorf("Result() err got %v, want %v", err, ErrCallbackFailed)
+	}
+
+	if entry, _ := cache.Get("key"); entry.Value != "value" {
+		t.Errorf("Get() got %+v, want stale value", entry)
+	}
+}
+
+func TestCache_BatchRefreshOptions(t *testing.T) {
+	var fail bool
+	cache := New(Config{
+		GlobalTTL:   time.Minute,
+		ExtendTTL:   time.Minute,
+		BatchWindow: time.Millisecond,
+		BatchRefresh: func(ctx context.Context, keys []any) (map[any]any, error) {
+			if fail {
+				return nil, errors.New("unavailable")
+			}
+			values := make(map[any]any)
+			for _, key := range keys {
+				values[key] = "new"
+			}
+			return values, nil
+		},
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+
+	// the fresh key is refreshed by WithForceRefresh, and stored by the ttl of WithTTL
+	_, refresh, _ := cache.AsyncLoadOrStore("key", nil, WithForceRefresh(), WithTTL(time.Hour))
+	if entry, err := refresh.Result(); err != nil || entry.Value != "new" {
+		t.Errorf("Result() got %+v, %v, want the forced refresh", entry, err)
+	}
+	if ttl := cache.TTL("key"); ttl != time.Hour {
+		t.Errorf("TTL() got %v, want the ttl of WithTTL", ttl)
+	}
+
+	// the ttl of the expired key is not extended by WithNoExtend
+	fail = true
+	now = func() time.Time { return fixedTime().Add(2 * time.Hour) }
+	_, refresh, _ = cache.AsyncLoadOrStore("key", nil, WithNoExtend())
+	refresh.Result()
+	if ttl := cache.TTL("key"); ttl > 0 {
+		t.Errorf("TTL() got %v, want not extended by WithNoExtend", ttl)
+	}
+}
+
+func TestCache_BatchRefreshContext(t *testing.T) {
+	type traceKey struct{}
+	started := make(chan context.Context, 1)
+	cache := New(Config{
+		GlobalTTL:   10 * time.Millisecond,
+		BatchWindow: 5 * time.Millisecond,
+		BatchRefresh: func(ctx context.Context, keys []any) (map[any]any, error) {
+			started <- ctx
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key1", "value")
+	cache.Set("key2", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "trace")
+	_, refresh1, _ := cache.AsyncLoadOrStoreWithCtx(ctx, "key1", nil)
+	_, refresh2, _ := cache.AsyncLoadOrStoreWithCtx(ctx, "key2", nil)
+
+	batchCtx := <-started
+	if got := batchCtx.Value(traceKey{}); got != "trace" {
+		t.Errorf("Value() of the batch context got %v, want the value of the refresh context", got)
+	}
+
+	// the batch is canceled only when all of its refreshes are canceled
+	refresh1.Cancel()
+	select {
+	case <-batchCtx.Done():
+		t.Fatalf("batch context expected not to be canceled by one of the refreshes")
+	case <-time.After(10 * time.Millisecond):
+	}
+	refresh2.Cancel()
+	select {
+	case <-batchCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("batch context expected to be canceled when all the refreshes are canceled")
+	}
+	refresh1.Result()
+	refresh2.Result()
+}
+
+func TestCache_BatchRefreshFailures(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL:              10 * time.Millisecond,
+		BatchWindow:            time.Millisecond,
+		MaxConsecutiveFailures: 1,
+		DeleteAfterFailures:    2,
+		BatchRefresh: func(ctx context.Context, keys []any) (map[any]any, error) {
+			return map[any]any{
+				"tombstone": ErrTombstone,
+				"failing":   errors.New("unavailable"),
+			}, nil
+		},
+	})
+
+	now = func() time.Time { return fixedTime() }
+	keys := []string{"tombstone", "failing", "missing"}
+	for _, key := range keys {
+		cache.Set(key, "value")
+	}
+
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+	for _, key := range keys {
+		if _, refresh, _ := cache.AsyncLoadOrStore(key, nil); refresh != nil {
+			refresh.Result()
+		}
+	}
+
+	if _, err := cache.Get("tombstone"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of the tombstone key got err %v, want %v", err, ErrNotFound)
+	}
+	for _, key := range []string{"failing", "missing"} {
+		if info, err := cache.Info(key); err != nil || info.FailedAttempts != 1 {
+			t.Errorf("Info() of %s got %+v, %v, want 1 failed attempt", key, info, err)
+		}
+		// the stale value is not served after MaxConsecutiveFailures, and the key is deleted by the second failure
+		// after DeleteAfterFailures
+		_, refresh, err := cache.AsyncLoadOrStore(key, nil)
+		if err == nil {
+			t.Errorf("AsyncLoadOrStore() of %s got no error, want MaxConsecutiveFailures exceeded", key)
+		}
+		if refresh != nil {
+			refresh.Result()
+		}
+		if _, err := cache.Get(key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get() of %s got err %v, want %v", key, err, ErrNotFound)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package lastcache
+
+// CompareAndSwap swaps the old and new values for key if the value stored in the cache is equal to old
+// The ttl of the key will be reset as in Set, either the stored value is stale or not
+// The old value must be of a comparable type
+func (c *Cache) CompareAndSwap(key, old, new any) bool {
+	mu := c.lock(key)
+	mu.Lock()
+	if !c.equal(key, old) {
+		mu.Unlock()
+		return false
+	}
+	storedValue, version := c.set(key, new)
+	evicted := c.trackSet(key, storedValue)
+	mu.Unlock()
+
+	c.afterSet(key, new, version, EventSet, evicted)
+	return true
+}
+
+// CompareAndDelete deletes the key if its value is equal to old
+// The old value must be of a comparable type
+func (c *Cache) CompareAndDelete(key, old any) bool {
+	mu := c.lock(key)
+	mu.Lock()
+	if !c.equal(key, old) {
+		mu.Unlock()
+		return false
+	}
+	c.delete(key)
+	mu.Unlock()
+
+	c.afterDelete(key, EventDelete)
+	return true
+}
+
+// equal reports whether the key exists and its value is equal to v
+func (c *Cache) equal(key, v any) bool {
+	stored, ok := c.loadStored(key)
+	return ok && stored == v
+}
+
+// Swap sets the value and ttl for a key and returns the previous entry if any
+// previous.Stale reports whether the previous value was already expired
+func (c *Cache) Swap(key, value any) (previous Entry, loaded bool) {
+	mu := c.lock(key)
+	mu.Lock()
+	if it, ok := c.loadItem(key); ok {
+		if prev, err := c.decompress(it.value); err == nil {
+			previous = Entry{Value: prev, Stale: c.now().After(it.expiresAt), Version: it.version}
+			loaded = true
+		}
+	}
+	storedValue, version := c.set(key, value)
+	evicted := c.trackSet(key, storedValue)
+	mu.Unlock()
+
+	c.afterSet(key, value, version, EventSet, evicted)
+	return previous, loaded
+}
+
+// GetOrSet returns the existing entry for the key if it's not expired, and loaded will be true
+// Otherwise, the given value will be stored and returned with loaded false
+func (c *Cache) GetOrSet(key, value any) (entry Entry, loaded bool) {
+	mu := c.lock(key)
+	mu.Lock()
+	if !c.checkIfExpired(key) {
+		if v, version, ok := c.loadWithVersion(key); ok {
+			mu.Unlock()
+			return Entry{Value: v, Version: version}, true
+		}
+	}
+	storedValue, version := c.set(key, value)
+	evicted := c.trackSet(key, storedValue)
+	mu.Unlock()
+
+	c.afterSet(key, value, version, EventSet, evicted)
+	return Entry{Value: c.clone(value), Version: version}, false
+}
+
+// SetIfVersion sets the value and ttl for a key only if the current version of the key is equal to version
+// Version 0 can be used to set the value only if the key doesn't exist
+// Returns false if the version doesn't match, which means the key is updated concurrently
+func (c *Cache) SetIfVersion(key, value any, version uint64) bool {
+	mu := c.lock(key)
+	mu.Lock()
+	if c.loadVersion(key) != version {
+		mu.Unlock()
+		return false
+	}
+	storedValue, newVersion := c.set(key, value)
+	evicted := c.trackSet(key, storedValue)
+	mu.Unlock()
+
+	c.afterSet(key, value, newVersion, EventSet, evicted)
+	return true
+}
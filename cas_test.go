@@ -0,0 +1,164 @@
+package lastcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_CompareAndSwap(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	now = func() time.Time { return fixedTime() }
+
+	if cache.CompareAndSwap("key", nil, "value") {
+		t.Errorf("CompareAndSwap() on missing key got true, want false")
+	}
+
+	cache.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	if cache.CompareAndSwap("key", "other", "new_value") {
+		t.Errorf("CompareAndSwap() with different old value got true, want false")
+	}
+	if !cache.CompareAndSwap("key", "value", "new_value") {
+		t.Errorf("CompareAndSwap() got false, want true")
+	}
+	if v, _ := storedValue(cache, "key"); v != "new_value" {
+		t.Errorf("stored value got %v, want new_value", v)
+	}
+	if ttl := cache.TTL("key"); ttl != 10*time.Millisecond {
+		t.Errorf("TTL() got %v, want %v", ttl, 10*time.Millisecond)
+	}
+}
+
+func TestCache_CompareAndDelete(t *testing.T) {
+	cache := New(Config{})
+
+	cache.Set("key", "value")
+
+	if cache.CompareAndDelete("key", "other") {
+		t.Errorf("CompareAndDelete() with different old value got true, want false")
+	}
+	if !cache.CompareAndDelete("key", "value") {
+		t.Errorf("CompareAndDelete() got false, want true")
+	}
+	if _, ok := storedValue(cache, "key"); ok {
+		t.Errorf("key expected to be deleted")
+	}
+	if _, ok := storedValue(cache, "key"); ok {
+		t.Errorf("key ttl expected to be deleted")
+	}
+}
+
+func TestCache_Swap(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	now = func() time.Time { return fixedTime() }
+
+	if _, loaded := cache.Swap("key", "value"); loaded {
+		t.Errorf("Swap() on missing key got loaded true, want false")
+	}
+
+	previous, loaded := cache.Swap("key", "value2")
+	if !loaded || previous.Value != "value" || previous.Stale {
+		t.Errorf("Swap() got %+v, %v, want fresh value", previous, loaded)
+	}
+
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	previous, loaded = cache.Swap("key", "value3")
+	if !loaded || previous.Value != "value2" || !previous.Stale {
+		t.Errorf("Swap() got %+v, %v, want stale value2", previous, loaded)
+	}
+	if v, _ := storedValue(cache, "key"); v != "value3" {
+		t.Errorf("stored value got %v, want value3", v)
+	}
+}
+
+func TestCache_GetOrSet(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	now = func() time.Time { return fixedTime() }
+
+	entry, loaded := cache.GetOrSet("key", "value")
+	if loaded || entry.Value != "value" {
+		t.Errorf("GetOrSet() got %+v, %v, want stored value", entry, loaded)
+	}
+
+	entry, loaded = cache.GetOrSet("key", "value2")
+	if !loaded || entry.Value != "value" {
+		t.Errorf("GetOrSet() got %+v, %v, want loaded value", entry, loaded)
+	}
+
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	entry, loaded = cache.GetOrSet("key", "value3")
+	if loaded || entry.Value != "value3" {
+		t.Errorf("GetOrSet() on expired key got %+v, %v, want stored value3", entry, loaded)
+	}
+}
+
+func TestCache_SetIfVersion(t *testing.T) {
+	cache := New(Config{})
+
+	if !cache.SetIfVersion("key", "value", 0) {
+		t.Errorf("SetIfVersion() on missing key with version 0 got false, want true")
+	}
+
+	entry, _ := cache.GetOrSet("key", nil)
+	if entry.Version == 0 {
+		t.Fatalf("entry Version expected to be set")
+	}
+
+	cache.Set("key", "concurrent_value")
+
+	if cache.SetIfVersion("key", "value2", entry.Version) {
+		t.Errorf("SetIfVersion() with outdated version got true, want false")
+	}
+
+	entry, _ = cache.GetOrSet("key", nil)
+	if !cache.SetIfVersion("key", "value2", entry.Version) {
+		t.Errorf("SetIfVersion() got false, want true")
+	}
+
+	got, _ := cache.GetOrSet("key", nil)
+	if got.Value != "value2" || got.Version <= entry.Version {
+		t.Errorf("GetOrSet() got %+v, want value2 with increased version", got)
+	}
+}
+
+func TestCache_CompareAndSwapPointerKey(t *testing.T) {
+	type user struct {
+		Name string
+	}
+	cache := New(Config{GlobalTTL: time.Minute, RefreshJitter: time.Minute})
+	defer cache.Close()
+
+	key := &user{Name: "a"}
+	cache.Set(key, "value")
+	mu := cache.lock(key)
+	it, _ := cache.loadItem(key)
+	now = func() time.Time { return it.expiresAt.Add(30 * time.Second) }
+	due := cache.refreshDue(key, it)
+
+	// the stripe and the refresh jitter of a pointer key don't change with the pointed value
+	key.Name = "b"
+	if cache.lock(key) != mu {
+		t.Errorf("lock() of the pointer key changed with the pointed value")
+	}
+	if cache.refreshDue(key, it) != due {
+		t.Errorf("refreshDue() of the pointer key changed with the pointed value")
+	}
+	if !cache.CompareAndSwap(key, "value", "new") {
+		t.Errorf("CompareAndSwap() of the pointer key failed")
+	}
+	if !cache.SetIfVersion(key, "newer", cache.loadVersion(key)) {
+		t.Errorf("SetIfVersion() of the pointer key failed")
+	}
+}
@@ -0,0 +1,34 @@
+// Package cborcodec provides a lastcache.Codec using CBOR (RFC 8949), which is compact and readable by most languages
+//
+// Importing the package registers the codec as "cbor", so it can be used in snapshots
+//
+//	import _ "github.com/mbrostami/lastcache/cborcodec"
+//
+//	err := cache.Snapshot(file, "cbor")
+package cborcodec
+
+import (
+	"github.com/fxamacker/cbor/v2"
+	"github.com/mbrostami/lastcache"
+)
+
+// Name the codec is registered by
+const Name = "cbor"
+
+func init() {
+	lastcache.RegisterCodec(Name, Codec{})
+}
+
+// Codec lastcache.Codec implementation using CBOR
+// Values stored as `any` will be decoded to their CBOR representation (e.g. map[any]any, uint64)
+type Codec struct{}
+
+// Marshal encodes v as CBOR
+func (Codec) Marshal(v any) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+// Unmarshal decodes CBOR data into v
+func (Codec) Unmarshal(data []byte, v any) error {
+	return cbor.Unmarshal(data, v)
+}
@@ -0,0 +1,55 @@
+package cborcodec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+func TestCodec(t *testing.T) {
+	type user struct {
+		Name  string
+		Roles []string
+	}
+
+	data, err := Codec{}.Marshal(user{Name: "name", Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatalf("Marshal() failed with err: %v", err)
+	}
+
+	var got user
+	if err = (Codec{}).Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() failed with err: %v", err)
+	}
+	if got.Name != "name" || len(got.Roles) != 1 || got.Roles[0] != "admin" {
+		t.Errorf("Unmarshal() got %+v", got)
+	}
+}
+
+func TestCodec_Snapshot(t *testing.T) {
+	if _, ok := lastcache.LookupCodec(Name); !ok {
+		t.Fatalf("codec is not registered")
+	}
+
+	cache := lastcache.New(lastcache.Config{GlobalTTL: time.Minute})
+	cache.Set("key", "value")
+
+	var buf bytes.Buffer
+	if err := cache.Snapshot(&buf, Name); err != nil {
+		t.Fatalf("Snapshot() failed with err: %v", err)
+	}
+
+	restored := lastcache.New(lastcache.Config{GlobalTTL: time.Minute})
+	if n, err := restored.Restore(&buf); err != nil || n != 1 {
+		t.Fatalf("Restore() got %v, %v, want 1 entry", n, err)
+	}
+	if entry, err := restored.Get("key"); err != nil || entry.Value != "value" {
+		t.Errorf("Get() got %+v, %v, want value", entry, err)
+	}
+	if _, err := restored.Get("missing"); !errors.Is(err, lastcache.ErrNotFound) {
+		t.Errorf("Get() err got %v, want %v", err, lastcache.ErrNotFound)
+	}
+}
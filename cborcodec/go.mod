@@ -0,0 +1,12 @@
+module github.com/mbrostami/lastcache/cborcodec
+
+go 1.18
+
+require (
+	github.com/fxamacker/cbor/v2 v2.9.2
+	github.com/mbrostami/lastcache v0.0.0
+)
+
+require github.com/x448/float16 v0.8.4 // indirect
+
+replace github.com/mbrostami/lastcache => ../
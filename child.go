@@ -0,0 +1,44 @@
+package lastcache
+
+// Child returns a scoped cache, e.g. per request or per tenant, which checks itself first and falls back to c on miss
+// The fresh entries of c are served by the child without calling the callback, and if config.PromoteFromParent is set
+// they're stored in the child with the ttl remaining in c, capped by the ttl of the child
+// The writes to the child are not propagated to c, and the child stops with c if config.Context is not set
+func (c *Cache) Child(config Config) *Cache {
+	if config.Context == nil {
+		config.Context = c.context()
+	}
+	return newCache(&Cache{config: config, parent: c})
+}
+
+// loadParent returns the fresh entry of the key from the parent cache, see Child
+func (c *Cache) loadParent(key any) (Entry, bool) {
+	if c.parent == nil {
+		return Entry{}, false
+	}
+	entry, err := c.parent.Get(key)
+	if err != nil {
+		return Entry{}, false
+	}
+	entry.Source = SourceCached
+	if !c.config.PromoteFromParent {
+		return entry, true
+	}
+
+	ttl := c.parent.TTL(key)
+	if ttl <= 0 {
+		return entry, true
+	}
+	if ttl > c.ttl() {
+		ttl = c.ttl()
+	}
+	mu := c.lock(key)
+	mu.Lock()
+	storedValue, version := c.setUntil(key, entry.Value, c.now().Add(ttl))
+	evicted := c.trackSet(key, storedValue)
+	mu.Unlock()
+
+	c.afterSet(key, entry.Value, version, EventSet, evicted)
+	entry.Version = version
+	return entry, true
+}
@@ -0,0 +1,63 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCache_Child(t *testing.T) {
+	parent := New(Config{GlobalTTL: time.Minute})
+	child := parent.Child(Config{GlobalTTL: time.Hour})
+	var calls int
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		calls++
+		return "child value", false, nil
+	}
+
+	now = func() time.Time { return fixedTime() }
+	parent.Set("shared", "parent value")
+
+	entry, err := child.LoadOrStore("shared", callback)
+	if err != nil || entry.Value != "parent value" || calls != 0 {
+		t.Errorf("LoadOrStore() got %+v, %v, want the value of the parent", entry, err)
+	}
+	if _, ok := storedValue(child, "shared"); ok {
+		t.Error("the value of the parent is stored in the child, want not promoted")
+	}
+
+	entry, err = child.LoadOrStore("scoped", callback)
+	if err != nil || entry.Value != "child value" || calls != 1 {
+		t.Errorf("LoadOrStore() got %+v, %v, want the value of the callback", entry, err)
+	}
+	if _, err = parent.Get("scoped"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("parent Get() err got %v, want %v", err, ErrNotFound)
+	}
+
+	// expired entries of the parent are not served
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+	if entry, _ = child.LoadOrStore("shared", callback); entry.Value != "child value" {
+		t.Errorf("LoadOrStore() got %+v, want the value of the callback", entry)
+	}
+}
+
+func TestCache_Child_PromoteFromParent(t *testing.T) {
+	parent := New(Config{GlobalTTL: time.Minute})
+	child := parent.Child(Config{GlobalTTL: time.Hour, PromoteFromParent: true})
+
+	now = func() time.Time { return fixedTime() }
+	parent.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(10 * time.Second) }
+
+	if entry, err := child.Get("key"); err != nil || entry.Value != "value" {
+		t.Fatalf("Get() got %+v, %v, want the value of the parent", entry, err)
+	}
+	parent.Delete("key")
+	if v, ok := storedValue(child, "key"); !ok || v != "value" {
+		t.Errorf("child value got %v, %v, want the promoted value", v, ok)
+	}
+	if ttl := child.TTL("key"); ttl != 50*time.Second {
+		t.Errorf("child TTL() got %v, want the ttl remaining in the parent", ttl)
+	}
+}
@@ -0,0 +1,163 @@
+// Package clusterstats aggregates the statistics of the cache instances of a fleet,
+// so operators can see fleet-level hit and stale-serving rates instead of per-instance numbers
+//
+// The statistics are fetched as JSON from the "/stats" endpoint of the peers,
+// which is served by the replication handler and the admin API.
+//
+//	collector := clusterstats.New(cache, clusterstats.Config{Peers: []string{"http://cache-1:8080/replication"}})
+//	agg := collector.Collect(ctx)
+//	fmt.Println(agg.StaleRatio(), agg.Errors)
+package clusterstats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+const (
+	defaultPath    = "/stats"
+	defaultTimeout = 5 * time.Second
+
+	// Local name of the local instance in Aggregate.Instances
+	Local = "local"
+)
+
+// Config of the Collector
+type Config struct {
+	// Peers base URLs of the handlers which serve the statistics of the peers
+	Peers []string
+
+	// Client used to fetch the statistics
+	// Default is http.DefaultClient
+	Client *http.Client
+
+	// Token if set, the requests are authenticated by this bearer token
+	Token string
+
+	// Path of the statistics endpoint relative to the peer base URLs
+	// Default is "/stats"
+	Path string
+
+	// Timeout of fetching the statistics of each peer
+	// Default is 5s
+	Timeout time.Duration
+}
+
+// Aggregate statistics of the fleet
+type Aggregate struct {
+	// Total sum of the statistics of the instances which could be fetched
+	Total lastcache.Stats
+	// Instances statistics by the peer base URL, the local instance is named Local
+	Instances map[string]lastcache.Stats
+	// Errors of the peers whose statistics could not be fetched
+	Errors map[string]error
+}
+
+// HitRatio returns the fraction of the loads served fresh across the fleet
+func (a Aggregate) HitRatio() float64 {
+	return ratio(a.Total.Hits, requests(a.Total))
+}
+
+// StaleRatio returns the fraction of the loads served stale across the fleet
+func (a Aggregate) StaleRatio() float64 {
+	return ratio(a.Total.StaleServes, requests(a.Total))
+}
+
+func requests(s lastcache.Stats) uint64 {
+	return s.Hits + s.Misses + s.StaleServes
+}
+
+func ratio(n, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// Collector collects the statistics of the local cache and its peers
+type Collector struct {
+	local  *lastcache.Cache
+	config Config
+}
+
+// New returns a Collector, local can be nil if the collector doesn't run next to a cache
+func New(local *lastcache.Cache, config Config) *Collector {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.Path == "" {
+		config.Path = defaultPath
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+
+	return &Collector{local: local, config: config}
+}
+
+// Collect fetches the statistics of the peers concurrently and returns the aggregate
+// Peers which can't be reached are reported in Aggregate.Errors and excluded from the total
+func (c *Collector) Collect(ctx context.Context) Aggregate {
+	agg := Aggregate{
+		Instances: make(map[string]lastcache.Stats, len(c.config.Peers)+1),
+		Errors:    make(map[string]error),
+	}
+	if c.local != nil {
+		agg.Instances[Local] = c.local.Stats()
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, peer := range c.config.Peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			stats, err := c.fetch(ctx, peer)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				agg.Errors[peer] = err
+				return
+			}
+			agg.Instances[peer] = stats
+		}(peer)
+	}
+	wg.Wait()
+
+	for _, stats := range agg.Instances {
+		agg.Total = agg.Total.Add(stats)
+	}
+	return agg
+}
+
+func (c *Collector) fetch(ctx context.Context, peer string) (lastcache.Stats, error) {
+	var stats lastcache.Stats
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer+c.config.Path, nil)
+	if err != nil {
+		return stats, err
+	}
+	if c.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	}
+
+	resp, err := c.config.Client.Do(req)
+	if err != nil {
+		return stats, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return stats, fmt.Errorf("clusterstats: unexpected status %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	return stats, err
+}
@@ -0,0 +1,48 @@
+package clusterstats
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mbrostami/lastcache"
+)
+
+func statsServer(t *testing.T, stats lastcache.Stats) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != defaultPath || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(stats)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestCollector_Collect(t *testing.T) {
+	local := lastcache.New(lastcache.Config{})
+	local.Set("key", "value")
+	local.LoadOrStore("key", nil)
+
+	peer1 := statsServer(t, lastcache.Stats{Hits: 5, StaleServes: 4})
+	peer2 := statsServer(t, lastcache.Stats{Hits: 3, Misses: 2, StaleServes: 1})
+	collector := New(local, Config{Peers: []string{peer1, peer2, "http://127.0.0.1:1"}, Token: "secret"})
+
+	agg := collector.Collect(context.Background())
+	if agg.Total.Hits != 9 || agg.Total.Misses != 2 || agg.Total.StaleServes != 5 {
+		t.Errorf("Total got %+v, want 9 hits, 2 misses and 5 stale serves", agg.Total)
+	}
+	if len(agg.Instances) != 3 || agg.Instances[peer1].Hits != 5 || agg.Instances[Local].Hits != 1 {
+		t.Errorf("Instances got %+v", agg.Instances)
+	}
+	if len(agg.Errors) != 1 || agg.Errors["http://127.0.0.1:1"] == nil {
+		t.Errorf("Errors got %v, want the unreachable peer", agg.Errors)
+	}
+	if ratio := agg.StaleRatio(); ratio != 5.0/16 {
+		t.Errorf("StaleRatio() got %v, want %v", ratio, 5.0/16)
+	}
+}
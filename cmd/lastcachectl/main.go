@@ -0,0 +1,244 @@
+// Command lastcachectl inspects and diffs snapshot files, and calls the admin API of a running cache
+//
+//	lastcachectl snapshot inspect [-key hex] FILE
+//	lastcachectl snapshot diff [-key hex] OLD NEW
+//	lastcachectl admin [-url URL] [-token TOKEN] keys [PREFIX]
+//	lastcachectl admin [-url URL] [-token TOKEN] entry|delete|expire|refresh KEY
+//	lastcachectl admin [-url URL] [-token TOKEN] purge|stats
+//
+// The admin URL and token can be set by the LASTCACHE_URL and LASTCACHE_TOKEN environment variables as well.
+// Snapshots encoded by gob can only be decoded if their value types are registered, JSON snapshots are always readable.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+const usage = `usage:
+  lastcachectl snapshot inspect [-key hex] FILE
+  lastcachectl snapshot diff [-key hex] OLD NEW
+  lastcachectl admin [-url URL] [-token TOKEN] keys [PREFIX]
+  lastcachectl admin [-url URL] [-token TOKEN] entry|delete|expire|refresh KEY
+  lastcachectl admin [-url URL] [-token TOKEN] purge|stats
+`
+
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, http.DefaultClient); err != nil {
+		fmt.Fprintln(os.Stderr, "lastcachectl:", err)
+		if errors.Is(err, errUsage) {
+			fmt.Fprint(os.Stderr, usage)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer, client *http.Client) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "snapshot":
+		return runSnapshot(args[1:], out)
+	case "admin":
+		return runAdmin(args[1:], out, client)
+	}
+	return errUsage
+}
+
+func runSnapshot(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	flags := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	key := flags.String("key", "", "hex encoded AES key of encrypted snapshots")
+	if err := flags.Parse(args[1:]); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	config := lastcache.Config{}
+	if *key != "" {
+		k, err := hex.DecodeString(*key)
+		if err != nil {
+			return fmt.Errorf("invalid key: %w", err)
+		}
+		config.Encryption = lastcache.StaticKey(k)
+	}
+
+	switch {
+	case args[0] == "inspect" && flags.NArg() == 1:
+		records, err := readSnapshot(flags.Arg(0), config)
+		if err != nil {
+			return err
+		}
+		return inspect(out, records)
+	case args[0] == "diff" && flags.NArg() == 2:
+		old, err := readSnapshot(flags.Arg(0), config)
+		if err != nil {
+			return err
+		}
+		updated, err := readSnapshot(flags.Arg(1), config)
+		if err != nil {
+			return err
+		}
+		return diff(out, old, updated)
+	}
+	return errUsage
+}
+
+// readSnapshot returns the records of the snapshot file by their keys
+func readSnapshot(path string, config lastcache.Config) (map[string]lastcache.SnapshotRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cache := lastcache.New(config)
+	defer cache.Close()
+	if _, err = cache.Restore(f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	records := make(map[string]lastcache.SnapshotRecord)
+	cache.RangeEntries(func(key any, e lastcache.Entry, expiresAt time.Time) bool {
+		records[fmt.Sprint(key)] = lastcache.SnapshotRecord{Key: key, Value: e.Value, ExpiresAt: expiresAt}
+		return true
+	})
+	return records, nil
+}
+
+func inspect(out io.Writer, records map[string]lastcache.SnapshotRecord) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tEXPIRES AT\tSTALE\tVALUE")
+	now := time.Now()
+	for _, key := range sortedKeys(records) {
+		r := records[key]
+		fmt.Fprintf(w, "%s\t%s\t%v\t%s\n", key, r.ExpiresAt.Format(time.RFC3339), now.After(r.ExpiresAt), formatValue(r.Value))
+	}
+	fmt.Fprintf(w, "%d entries\n", len(records))
+	return w.Flush()
+}
+
+func diff(out io.Writer, old, updated map[string]lastcache.SnapshotRecord) error {
+	for _, key := range sortedKeys(old) {
+		if _, ok := updated[key]; !ok {
+			fmt.Fprintf(out, "- %s %s\n", key, formatValue(old[key].Value))
+		}
+	}
+	for _, key := range sortedKeys(updated) {
+		n := updated[key]
+		o, ok := old[key]
+		switch {
+		case !ok:
+			fmt.Fprintf(out, "+ %s %s\n", key, formatValue(n.Value))
+		case !reflect.DeepEqual(o.Value, n.Value):
+			fmt.Fprintf(out, "~ %s %s -> %s\n", key, formatValue(o.Value), formatValue(n.Value))
+		case !o.ExpiresAt.Equal(n.ExpiresAt):
+			fmt.Fprintf(out, "~ %s expires %s -> %s\n", key, o.ExpiresAt.Format(time.RFC3339), n.ExpiresAt.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+func runAdmin(args []string, out io.Writer, client *http.Client) error {
+	flags := flag.NewFlagSet("admin", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	baseURL := flags.String("url", os.Getenv("LASTCACHE_URL"), "base URL of the admin API")
+	token := flags.String("token", os.Getenv("LASTCACHE_TOKEN"), "token of the admin API")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if *baseURL == "" || flags.NArg() == 0 {
+		return errUsage
+	}
+
+	command, rest := flags.Arg(0), flags.Args()[1:]
+	var method, path string
+	query := url.Values{}
+	switch {
+	case command == "keys" && len(rest) <= 1:
+		method, path = http.MethodGet, "/keys"
+		if len(rest) == 1 {
+			query.Set("prefix", rest[0])
+		}
+	case command == "entry" && len(rest) == 1:
+		method, path = http.MethodGet, "/entry"
+	case command == "delete" && len(rest) == 1:
+		method, path = http.MethodDelete, "/entry"
+	case (command == "expire" || command == "refresh") && len(rest) == 1:
+		method, path = http.MethodPost, "/"+command
+	case command == "purge" && len(rest) == 0:
+		method, path = http.MethodPost, "/purge"
+	case command == "stats" && len(rest) == 0:
+		method, path = http.MethodGet, "/stats"
+	default:
+		return errUsage
+	}
+	if path != "/keys" && len(rest) == 1 {
+		query.Set("key", rest[0])
+	}
+
+	target := strings.TrimSuffix(*baseURL, "/") + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+*token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if len(body) == 0 {
+		fmt.Fprintln(out, "ok")
+		return nil
+	}
+	_, err = out.Write(body)
+	return err
+}
+
+func sortedKeys(records map[string]lastcache.SnapshotRecord) []string {
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatValue returns the value truncated to fit in a line
+func formatValue(v any) string {
+	s := fmt.Sprintf("%v", v)
+	if len(s) > 80 {
+		s = s[:77] + "..."
+	}
+	return strings.ReplaceAll(s, "\n", " ")
+}
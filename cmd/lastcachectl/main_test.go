@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+	"github.com/mbrostami/lastcache/admin"
+)
+
+func writeSnapshot(t *testing.T, config lastcache.Config, values map[string]string) string {
+	t.Helper()
+	cache := lastcache.New(config)
+	defer cache.Close()
+	for key, value := range values {
+		cache.Set(key, value)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err = cache.Snapshot(f, "json"); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSnapshotInspect(t *testing.T) {
+	config := lastcache.Config{GlobalTTL: time.Hour}
+	path := writeSnapshot(t, config, map[string]string{"a": "1", "b": "2"})
+
+	var out bytes.Buffer
+	if err := run([]string{"snapshot", "inspect", path}, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[1], "a ") || !strings.HasPrefix(lines[2], "b ") || lines[3] != "2 entries" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	if !strings.Contains(lines[1], "false") {
+		t.Errorf("expected fresh entry, got %q", lines[1])
+	}
+}
+
+func TestSnapshotInspect_Encrypted(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	config := lastcache.Config{GlobalTTL: time.Hour, Encryption: lastcache.StaticKey(key)}
+	path := writeSnapshot(t, config, map[string]string{"a": "1"})
+
+	if err := run([]string{"snapshot", "inspect", path}, &bytes.Buffer{}, nil); err == nil {
+		t.Error("expected error without key")
+	}
+	var out bytes.Buffer
+	if err := run([]string{"snapshot", "inspect", "-key", hex.EncodeToString(key), path}, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "1 entries") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	config := lastcache.Config{GlobalTTL: time.Hour}
+	old := writeSnapshot(t, config, map[string]string{"a": "1", "b": "2"})
+	updated := writeSnapshot(t, config, map[string]string{"b": "3", "c": "4"})
+
+	var out bytes.Buffer
+	if err := run([]string{"snapshot", "diff", old, updated}, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "- a 1\n~ b 2 -> 3\n+ c 4\n"
+	if out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	cache := lastcache.New(lastcache.Config{GlobalTTL: time.Hour})
+	defer cache.Close()
+	cache.Set("user:1", "a")
+	cache.Set("user:2", "b")
+
+	h, err := admin.New(cache, admin.Config{Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	call := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := run(append([]string{"admin", "-url", server.URL, "-token", "secret"}, args...), &out, server.Client())
+		return out.String(), err
+	}
+
+	out, err := call("keys", "user:")
+	if err != nil || !strings.Contains(out, `"user:1"`) || !strings.Contains(out, `"user:2"`) {
+		t.Errorf("unexpected keys %q, %v", out, err)
+	}
+	if out, err = call("delete", "user:1"); err != nil || out != "ok\n" {
+		t.Errorf("unexpected delete %q, %v", out, err)
+	}
+	if _, err = cache.Get("user:1"); !errors.Is(err, lastcache.ErrNotFound) {
+		t.Errorf("expected deleted key, got %v", err)
+	}
+	if _, err = call("expire", "user:1"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if _, err = call("refresh", "user:2"); err == nil || !strings.Contains(err.Error(), "501") {
+		t.Errorf("expected not implemented, got %v", err)
+	}
+
+	err = run([]string{"admin", "-url", server.URL, "-token", "wrong", "stats"}, &bytes.Buffer{}, server.Client())
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected unauthorized, got %v", err)
+	}
+}
+
+func TestRun_Usage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"unknown"},
+		{"snapshot", "inspect"},
+		{"snapshot", "diff", "a"},
+		{"admin", "-url", "http://localhost", "delete"},
+		{"admin", "stats"},
+	} {
+		t.Setenv("LASTCACHE_URL", "")
+		if err := run(args, &bytes.Buffer{}, nil); !errors.Is(err, errUsage) {
+			t.Errorf("%v: expected usage error, got %v", args, err)
+		}
+	}
+}
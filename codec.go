@@ -0,0 +1,73 @@
+package lastcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"sync"
+)
+
+// Codec encodes and decodes values whenever they cross the process boundary (e.g. persistence or remote peers)
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		"json": JSONCodec{},
+		"gob":  GobCodec{},
+	}
+)
+
+// RegisterCodec registers the codec by name, so it can be used in snapshots
+// The name is stored in the snapshots, so snapshots can be restored by any process which registered the same codec
+// "json" and "gob" are registered by default, registering an existing name replaces the codec
+func RegisterCodec(name string, codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[name] = codec
+}
+
+// LookupCodec returns the codec registered by name
+func LookupCodec(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	codec, ok := codecs[name]
+	return codec, ok
+}
+
+// JSONCodec Codec implementation using encoding/json
+// Values stored as `any` will be decoded to their JSON representation (e.g. map[string]any, float64)
+type JSONCodec struct{}
+
+// Marshal encodes v as JSON
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON data into v
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec Codec implementation using encoding/gob
+// Concrete types of the values stored as `any` must be registered by gob.Register
+type GobCodec struct{}
+
+// Marshal encodes v using gob
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes gob data into v
+func (GobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
@@ -0,0 +1,46 @@
+package lastcache
+
+import (
+	"reflect"
+	"testing"
+)
+
+type codecValue struct {
+	Name  string
+	Items []int
+}
+
+func TestCodec(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec Codec
+	}{
+		{
+			name:  "json",
+			codec: JSONCodec{},
+		},
+		{
+			name:  "gob",
+			codec: GobCodec{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := codecValue{Name: "value", Items: []int{1, 2, 3}}
+
+			data, err := tt.codec.Marshal(want)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+
+			var got codecValue
+			if err = tt.codec.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Unmarshal() got = %v, want %v", got, want)
+			}
+		})
+	}
+}
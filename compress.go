@@ -0,0 +1,110 @@
+package lastcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// Compressor compresses and decompresses cached values
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// GzipCompressor Compressor implementation using compress/gzip
+type GzipCompressor struct {
+	// Level gzip compression level, zero value uses gzip.DefaultCompression
+	Level int
+}
+
+// Compress compresses data using gzip
+func (g GzipCompressor) Compress(data []byte) ([]byte, error) {
+	level := g.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress decompresses gzip data
+func (g GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// compressed holds the compressed form of a []byte or string value in the storage
+type compressed struct {
+	data     []byte
+	isString bool
+}
+
+// compress compresses []byte and string values bigger than Config.CompressThreshold
+// The value will be stored as is if compression is disabled or fails
+func (c *Cache) compress(value any) any {
+	if c.config.CompressThreshold <= 0 {
+		return value
+	}
+
+	var data []byte
+	var isString bool
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+		isString = true
+	default:
+		return value
+	}
+
+	if len(data) < c.config.CompressThreshold {
+		return value
+	}
+
+	out, err := c.compressor().Compress(data)
+	if err != nil {
+		return value
+	}
+	return compressed{data: out, isString: isString}
+}
+
+// decompress returns the original value of the stored value
+func (c *Cache) decompress(value any) (any, error) {
+	v, ok := value.(compressed)
+	if !ok {
+		return value, nil
+	}
+
+	data, err := c.compressor().Decompress(v.data)
+	if err != nil {
+		return nil, err
+	}
+	if v.isString {
+		return string(data), nil
+	}
+	return data, nil
+}
+
+func (c *Cache) compressor() Compressor {
+	if c.config.Compressor != nil {
+		return c.config.Compressor
+	}
+	return GzipCompressor{}
+}
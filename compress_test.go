@@ -0,0 +1,55 @@
+package lastcache
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCache_Compress(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL:         10 * time.Millisecond,
+		CompressThreshold: 100,
+	})
+
+	now = func() time.Time { return fixedTime() }
+
+	large := strings.Repeat("value", 100)
+	cache.Set("string", large)
+	cache.Set("bytes", []byte(large))
+	cache.Set("small", "value")
+	cache.Set("int", 100)
+
+	if v, _ := storedValue(cache, "string"); len(v.(compressed).data) >= len(large) {
+		t.Errorf("large string expected to be compressed")
+	}
+	if _, ok := storedValue(cache, "bytes"); !ok {
+		t.Errorf("bytes expected to be stored")
+	}
+	if v, _ := storedValue(cache, "small"); v != "value" {
+		t.Errorf("small value expected to be stored as is, got %v", v)
+	}
+
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, false, nil
+	}
+
+	if entry, _ := cache.LoadOrStore("string", callback); entry.Value != large {
+		t.Errorf("LoadOrStore() got %v, want decompressed string", entry.Value)
+	}
+	if entry, _ := cache.LoadOrStore("bytes", callback); !bytes.Equal(entry.Value.([]byte), []byte(large)) {
+		t.Errorf("LoadOrStore() got %v, want decompressed bytes", entry.Value)
+	}
+	if entry, _ := cache.LoadOrStore("int", callback); entry.Value != 100 {
+		t.Errorf("LoadOrStore() got %v, want 100", entry.Value)
+	}
+
+	cache.Range(func(key, value any, ttl time.Duration) bool {
+		if key == "string" && value != large {
+			t.Errorf("Range() got %v, want decompressed string", value)
+		}
+		return true
+	})
+}
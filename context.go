@@ -0,0 +1,57 @@
+package lastcache
+
+import "context"
+
+// RefreshContextMode defines how the context of the caller is passed to the background refreshes
+type RefreshContextMode int
+
+const (
+	// RefreshContextDetach the background refresh gets the values of the caller context (e.g. trace ids),
+	// but it's not canceled when the caller context is done, only when the cache Context is done
+	// This is the default mode, so a refresh started by an http request is not aborted when the request ends
+	RefreshContextDetach RefreshContextMode = iota
+	// RefreshContextInherit the background refresh gets the caller context as is, including its cancellation and deadline
+	RefreshContextInherit
+)
+
+func (m RefreshContextMode) String() string {
+	switch m {
+	case RefreshContextDetach:
+		return "detach"
+	case RefreshContextInherit:
+		return "inherit"
+	default:
+		return "unknown"
+	}
+}
+
+type refreshContextModeKey struct{}
+
+// WithRefreshContextMode returns a copy of ctx which overrides Config.RefreshContextMode for the calls it's passed to
+//
+//	cache.AsyncLoadOrStoreWithCtx(lastcache.WithRefreshContextMode(ctx, lastcache.RefreshContextInherit), key, callback)
+func WithRefreshContextMode(ctx context.Context, mode RefreshContextMode) context.Context {
+	return context.WithValue(ctx, refreshContextModeKey{}, mode)
+}
+
+// detachedContext carries the values of the caller context, and the cancellation and deadline of the cache context
+type detachedContext struct {
+	context.Context
+	values context.Context
+}
+
+func (d detachedContext) Value(key any) any {
+	return d.values.Value(key)
+}
+
+// refreshContext returns the context of a background refresh started by ctx, see RefreshContextMode
+func (c *Cache) refreshContext(ctx context.Context) context.Context {
+	mode := c.config.RefreshContextMode
+	if m, ok := ctx.Value(refreshContextModeKey{}).(RefreshContextMode); ok {
+		mode = m
+	}
+	if mode == RefreshContextInherit || ctx == c.context() {
+		return ctx
+	}
+	return detachedContext{Context: c.context(), values: ctx}
+}
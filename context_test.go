@@ -0,0 +1,63 @@
+package lastcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type testCtxKey struct{}
+
+func TestCache_RefreshContextMode(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		config   RefreshContextMode
+		call     *RefreshContextMode
+		canceled bool
+	}{
+		{name: "detach by default"},
+		{name: "inherit by config", config: RefreshContextInherit, canceled: true},
+		{name: "inherit by call", call: refreshContextMode(RefreshContextInherit), canceled: true},
+		{name: "detach by call", config: RefreshContextInherit, call: refreshContextMode(RefreshContextDetach)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cache := New(Config{GlobalTTL: time.Minute, RefreshContextMode: tc.config})
+
+			now = func() time.Time { return fixedTime() }
+			cache.Set("key", "old")
+			now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+
+			ctx, cancel := context.WithCancel(context.WithValue(context.Background(), testCtxKey{}, "trace"))
+			if tc.call != nil {
+				ctx = WithRefreshContextMode(ctx, *tc.call)
+			}
+			started := make(chan struct{})
+			_, refresh, err := cache.AsyncLoadOrStoreWithCtx(ctx, "key", func(ctx context.Context, key any, prev *Entry) (any, error) {
+				close(started)
+				if ctx.Value(testCtxKey{}) != "trace" {
+					t.Errorf("ctx value got %v, want trace", ctx.Value(testCtxKey{}))
+				}
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(50 * time.Millisecond):
+					return "new", nil
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			<-started
+			cancel()
+			entry, err := refresh.Result()
+			if canceled := err != nil; canceled != tc.canceled {
+				t.Errorf("Result() got %+v, %v, want canceled %v", entry, err, tc.canceled)
+			}
+		})
+	}
+}
+
+func refreshContextMode(m RefreshContextMode) *RefreshContextMode {
+	return &m
+}
@@ -0,0 +1,192 @@
+// Package dataloader batches and coalesces the key lookups of a request, e.g. GraphQL resolvers,
+// on top of a long-lived lastcache.Cache
+//
+// A Loader is request scoped: the lookups of the same key within a request are coalesced,
+// and the lookups missing in the cache within Wait are fetched by a single BatchFunc call.
+// Fresh entries are served from the cache, expired entries are refreshed in the batch,
+// and served stale if the batch fails.
+//
+//	loader := dataloader.New(cache, fetchUsers, dataloader.Options{})
+//	user, err := loader.Load(ctx, userID)
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+const defaultWait = time.Millisecond
+
+// BatchFunc returns the values of the keys, keys missing in the returned map are reported as lastcache.ErrNotFound
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// Options of the Loader
+type Options struct {
+	// Wait time to collect the keys before calling BatchFunc
+	// Default is 1ms
+	Wait time.Duration
+
+	// MaxBatch maximum number of keys passed to BatchFunc, the batch is dispatched immediately when it's full
+	// If set to 0 there is no limit
+	MaxBatch int
+}
+
+// Loader batches the lookups of a request, see the package doc
+type Loader[K comparable, V any] struct {
+	cache   *lastcache.Cache
+	batch   BatchFunc[K, V]
+	options Options
+
+	mu      sync.Mutex
+	calls   map[K]*call[V]
+	pending *pendingBatch[K, V]
+}
+
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+type pendingBatch[K comparable, V any] struct {
+	// ctx of the first Load in the batch, which is passed to BatchFunc
+	ctx   context.Context
+	keys  []K
+	calls []*call[V]
+	// stale holds the expired values in the cache, to be served if the batch fails
+	stale map[K]V
+	timer *time.Timer
+}
+
+// New returns a request scoped Loader, the cache is shared between the requests
+func New[K comparable, V any](cache *lastcache.Cache, batch BatchFunc[K, V], options Options) *Loader[K, V] {
+	if options.Wait <= 0 {
+		options.Wait = defaultWait
+	}
+	return &Loader[K, V]{
+		cache:   cache,
+		batch:   batch,
+		options: options,
+		calls:   make(map[K]*call[V]),
+	}
+}
+
+// Load returns the value of the key
+// The lookups of the same key are coalesced, and the keys which are not fresh in the cache are fetched in batch
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	c := l.load(ctx, key)
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// LoadMany returns the values of the keys in the same order, errs is nil if all the keys are loaded
+func (l *Loader[K, V]) LoadMany(ctx context.Context, keys []K) (values []V, errs []error) {
+	calls := make([]*call[V], len(keys))
+	for i, key := range keys {
+		calls[i] = l.load(ctx, key)
+	}
+
+	values = make([]V, len(keys))
+	for i, c := range calls {
+		var err error
+		select {
+		case <-c.done:
+			values[i], err = c.value, c.err
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			if errs == nil {
+				errs = make([]error, len(keys))
+			}
+			errs[i] = err
+		}
+	}
+	return values, errs
+}
+
+// Clear forgets the result of the key in this Loader, so the next Load looks up the cache again
+func (l *Loader[K, V]) Clear(key K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.calls, key)
+}
+
+func (l *Loader[K, V]) load(ctx context.Context, key K) *call[V] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if c, ok := l.calls[key]; ok {
+		return c
+	}
+
+	c := &call[V]{done: make(chan struct{})}
+	l.calls[key] = c
+
+	entry, err := l.cache.Get(key)
+	if err == nil {
+		c.value, _ = entry.Value.(V)
+		close(c.done)
+		return c
+	}
+
+	if l.pending == nil {
+		l.pending = &pendingBatch[K, V]{ctx: ctx, stale: make(map[K]V)}
+		pending := l.pending
+		pending.timer = time.AfterFunc(l.options.Wait, func() {
+			l.dispatch(pending)
+		})
+	}
+	l.pending.keys = append(l.pending.keys, key)
+	l.pending.calls = append(l.pending.calls, c)
+	if errors.Is(err, lastcache.ErrExpired) {
+		l.pending.stale[key], _ = entry.Value.(V)
+	}
+
+	if l.options.MaxBatch > 0 && len(l.pending.keys) >= l.options.MaxBatch {
+		pending := l.pending
+		l.pending = nil
+		// if the timer is already fired, the batch is being dispatched
+		if pending.timer.Stop() {
+			go l.dispatch(pending)
+		}
+	}
+	return c
+}
+
+func (l *Loader[K, V]) dispatch(pending *pendingBatch[K, V]) {
+	l.mu.Lock()
+	if l.pending == pending {
+		l.pending = nil
+	}
+	l.mu.Unlock()
+
+	values, err := l.batch(pending.ctx, pending.keys)
+	for i, key := range pending.keys {
+		c := pending.calls[i]
+		switch value, ok := values[key]; {
+		case err != nil:
+			if stale, ok := pending.stale[key]; ok {
+				c.value = stale
+			} else {
+				c.err = err
+			}
+		case ok:
+			l.cache.Set(key, value)
+			c.value = value
+		default:
+			c.err = lastcache.ErrNotFound
+		}
+		close(c.done)
+	}
+}
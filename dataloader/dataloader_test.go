@@ -0,0 +1,117 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+	"github.com/mbrostami/lastcache/lastcachetest"
+)
+
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]int
+	err     error
+}
+
+func (r *batchRecorder) fetch(_ context.Context, keys []int) (map[int]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	batch := append([]int(nil), keys...)
+	sort.Ints(batch)
+	r.batches = append(r.batches, batch)
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	values := make(map[int]string, len(keys))
+	for _, key := range keys {
+		if key >= 0 {
+			values[key] = fmt.Sprintf("value_%d", key)
+		}
+	}
+	return values, nil
+}
+
+func TestLoader_Load(t *testing.T) {
+	cache := lastcache.New(lastcache.Config{GlobalTTL: time.Minute})
+	cache.Set(1, "cached_1")
+	rec := &batchRecorder{}
+	loader := New(cache, rec.fetch, Options{})
+
+	var wg sync.WaitGroup
+	results := make([]string, 4)
+	for i, key := range []int{1, 2, 3, 2} {
+		wg.Add(1)
+		go func(i, key int) {
+			defer wg.Done()
+			value, err := loader.Load(context.Background(), key)
+			if err != nil {
+				t.Errorf("Load(%v) failed with err: %v", key, err)
+			}
+			results[i] = value
+		}(i, key)
+	}
+	wg.Wait()
+
+	want := []string{"cached_1", "value_2", "value_3", "value_2"}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("Load() got = %v, want %v", results[i], want[i])
+		}
+	}
+	if len(rec.batches) != 1 || len(rec.batches[0]) != 2 {
+		t.Errorf("batches got = %v, want [[2 3]]", rec.batches)
+	}
+
+	// next request is served by the cache
+	if value, _ := New(cache, rec.fetch, Options{}).Load(context.Background(), 2); value != "value_2" || len(rec.batches) != 1 {
+		t.Errorf("Load() got = %v with %v batches, want cached value_2", value, len(rec.batches))
+	}
+}
+
+func TestLoader_LoadMany(t *testing.T) {
+	cache := lastcache.New(lastcache.Config{GlobalTTL: time.Minute})
+	rec := &batchRecorder{}
+	loader := New(cache, rec.fetch, Options{MaxBatch: 2})
+
+	values, errs := loader.LoadMany(context.Background(), []int{1, 2, 3, -1})
+	if want := []string{"value_1", "value_2", "value_3", ""}; fmt.Sprint(values) != fmt.Sprint(want) {
+		t.Errorf("LoadMany() got = %v, want %v", values, want)
+	}
+	if len(errs) != 4 || errs[0] != nil || !errors.Is(errs[3], lastcache.ErrNotFound) {
+		t.Errorf("LoadMany() errs got = %v, want ErrNotFound for the last key", errs)
+	}
+	if len(rec.batches) != 2 {
+		t.Errorf("batches got = %v, want 2 batches of MaxBatch", rec.batches)
+	}
+}
+
+func TestLoader_StaleIfError(t *testing.T) {
+	clock := lastcachetest.NewClock(time.Now())
+	cache := lastcache.New(lastcache.Config{GlobalTTL: time.Minute, Clock: clock})
+	cache.Set(1, "stale_1")
+	clock.Advance(2 * time.Minute)
+
+	rec := &batchRecorder{err: errors.New("unavailable")}
+	loader := New(cache, rec.fetch, Options{})
+
+	if value, err := loader.Load(context.Background(), 1); err != nil || value != "stale_1" {
+		t.Errorf("Load() got = %v, %v, want stale_1", value, err)
+	}
+	if _, err := loader.Load(context.Background(), 2); !errors.Is(err, rec.err) {
+		t.Errorf("Load() err got = %v, want %v", err, rec.err)
+	}
+
+	rec.err = nil
+	loader.Clear(1)
+	if value, err := loader.Load(context.Background(), 1); err != nil || value != "value_1" {
+		t.Errorf("Load() got = %v, %v, want value_1", value, err)
+	}
+}
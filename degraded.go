@@ -0,0 +1,55 @@
+package lastcache
+
+import "sync/atomic"
+
+// SetDegraded switches the cache to always serve whatever is cached regardless of the ttl, e.g. during a planned
+// maintenance window of the upstream
+// While it's on, LoadOrStore, AsyncLoadOrStore and AsyncLoadOrStoreMulti don't call the callbacks, expired entries are
+// served as stale without a refresh, missing keys return ErrNotFound (or Config.DefaultValue), and scheduled refreshes
+// are skipped. Switching it off resumes the normal behavior
+func (c *Cache) SetDegraded(on bool) {
+	var state int32
+	if on {
+		state = 1
+	}
+	atomic.StoreInt32(&c.forcedDegraded, state)
+}
+
+// IsDegraded reports whether the cache is switched to serve stale by SetDegraded
+func (c *Cache) IsDegraded() bool {
+	return atomic.LoadInt32(&c.forcedDegraded) == 1
+}
+
+// loadDegraded returns the cached entry of the key regardless of the ttl, see SetDegraded
+// ErrExpired is returned for the expired keys if the call refuses stale entries by WithNoStale
+func (c *Cache) loadDegraded(key any, o callOptions) (Entry, error) {
+	it, ok := c.loadItem(key)
+	if !ok {
+		c.recordMiss(key)
+		if def, ok := c.defaultEntry(key, ErrNotFound); ok {
+			def.CallbackInvoked = false
+			return def, nil
+		}
+		return Entry{}, ErrNotFound
+	}
+
+	entry := Entry{Version: it.version, Err: it.err}
+	entry.Value, _ = c.itemValue(key, it)
+	if !c.now().After(it.expiresAt) {
+		entry.Err = nil
+		c.recordHit(key)
+		return entry, nil
+	}
+
+	if o.noStale {
+		c.recordMiss(key)
+		return Entry{}, ErrExpired
+	}
+	entry.Stale = true
+	entry.Source = SourceStaleFallback
+	entry.RefreshStatus = RefreshSkipped
+	c.recordStaleServe(key, c.now().Sub(it.expiresAt))
+	c.logStaleServe(key, c.now().Sub(it.expiresAt), it.err)
+	c.emit(EventStaleServe, key, entry.Value, nil)
+	return entry, nil
+}
@@ -0,0 +1,61 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCache_SetDegraded(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute})
+	var calls int
+	callback := func(ctx context.Context, key any, prev *Entry) (any, error) {
+		calls++
+		return "new", nil
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("stale", "old")
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+	cache.Set("fresh", "old")
+
+	cache.SetDegraded(true)
+	if !cache.IsDegraded() {
+		t.Fatal("IsDegraded() got false, want true")
+	}
+
+	entry, refresh, err := cache.AsyncLoadOrStore("stale", callback)
+	if err != nil || entry.Value != "old" || !entry.Stale || refresh != nil {
+		t.Errorf("AsyncLoadOrStore(stale) got %+v, %v, %v, want the stale value without refresh", entry, refresh, err)
+	}
+	entry, err = cache.LoadOrStore("fresh", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		calls++
+		return "new", false, nil
+	})
+	if err != nil || entry.Value != "old" || entry.Stale {
+		t.Errorf("LoadOrStore(fresh) got %+v, %v, want the fresh value", entry, err)
+	}
+	if _, _, err = cache.AsyncLoadOrStore("missing", callback); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AsyncLoadOrStore(missing) err got %v, want %v", err, ErrNotFound)
+	}
+	entries, multi, err := cache.AsyncLoadOrStoreMulti([]any{"stale", "missing"}, func(ctx context.Context, keys []any) (map[any]any, error) {
+		calls++
+		return nil, nil
+	})
+	if err != nil || multi != nil || len(entries) != 1 || !entries["stale"].Stale {
+		t.Errorf("AsyncLoadOrStoreMulti() got %+v, %v, %v, want the stale entry", entries, multi, err)
+	}
+	if calls != 0 {
+		t.Errorf("callbacks got %d calls, want 0", calls)
+	}
+
+	cache.SetDegraded(false)
+	_, refresh, _ = cache.AsyncLoadOrStore("stale", callback)
+	if refresh == nil {
+		t.Fatal("AsyncLoadOrStore() got nil refresh, want the refresh to be resumed")
+	}
+	if entry, err = refresh.Result(); err != nil || entry.Value != "new" {
+		t.Errorf("Result() got %+v, %v, want the new value", entry, err)
+	}
+}
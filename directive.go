@@ -0,0 +1,65 @@
+package lastcache
+
+import (
+	"errors"
+	"time"
+)
+
+type noStore struct {
+	value any
+}
+
+// NoStore wraps the value returned by a callback, so it is returned to the caller but not stored in the cache
+// This can be used for partial or degraded responses which should not be served to subsequent calls
+//
+//	return lastcache.NoStore(partialValue), false, nil
+func NoStore(value any) any {
+	return noStore{value: value}
+}
+
+// store sets the value returned by a callback, unless it's wrapped by NoStore
+// returns the entry of the unwrapped value, cloned by Config.CloneFunc if it's stored
+func (c *Cache) store(key, value any) Entry {
+	return c.storeFor(key, value, 0)
+}
+
+// storeFor is store with ttl instead of Config.GlobalTTL, if it's set
+func (c *Cache) storeFor(key, value any, ttl time.Duration) Entry {
+	if v, ok := value.(noStore); ok {
+		return Entry{Value: v.value, Source: SourceFreshFromCallback, CallbackInvoked: true}
+	}
+	if ttl <= 0 {
+		ttl = c.ttl()
+	}
+
+	mu := c.lock(key)
+	mu.Lock()
+	storedValue, version := c.setUntil(key, value, c.now().Add(ttl))
+	evicted := c.trackSet(key, storedValue)
+	mu.Unlock()
+
+	c.afterSet(key, value, version, EventRefresh, evicted)
+	return Entry{Value: c.clone(value), Version: version, Source: SourceFreshFromCallback, CallbackInvoked: true}
+}
+
+// isTombstone deletes the key if callback error is ErrTombstone
+func (c *Cache) isTombstone(key any, err error) bool {
+	if !errors.Is(err, ErrTombstone) {
+		return false
+	}
+
+	c.Delete(key)
+	return true
+}
+
+// defaultEntry returns the entry of Config.DefaultValue for the missing key whose callback failed by err
+func (c *Cache) defaultEntry(key any, err error) (Entry, bool) {
+	if c.config.DefaultValue == nil || errors.Is(err, ErrTombstone) {
+		return Entry{}, false
+	}
+	value, ok := c.config.DefaultValue(key)
+	if !ok {
+		return Entry{}, false
+	}
+	return Entry{Value: value, Err: err, Source: SourceDefaultValue, CallbackInvoked: true}, true
+}
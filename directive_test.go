@@ -0,0 +1,129 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCache_NoStore(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	now = func() time.Time { return fixedTime() }
+
+	entry, err := cache.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return NoStore("partial"), false, nil
+	})
+	if err != nil || entry.Value != "partial" {
+		t.Errorf("LoadOrStore() got %+v, %v, want partial", entry, err)
+	}
+	if _, ok := storedValue(cache, "key"); ok {
+		t.Errorf("NoStore value should not be stored")
+	}
+
+	cache.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	entry, err = cache.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return NoStore("partial"), false, nil
+	})
+	if err != nil || entry.Value != "partial" {
+		t.Errorf("LoadOrStore() got %+v, %v, want partial", entry, err)
+	}
+	if v, _ := storedValue(cache, "key"); v != "value" {
+		t.Errorf("stored value got %v, want value", v)
+	}
+
+	_, refresh, _ := cache.AsyncLoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return NoStore("partial"), nil
+	})
+	entry, err = refresh.Result()
+	if err != nil || entry.Value != "partial" {
+		t.Errorf("Result() got %+v, %v, want partial", entry, err)
+	}
+	if v, _ := storedValue(cache, "key"); v != "value" {
+		t.Errorf("stored value got %v, want value", v)
+	}
+}
+
+func TestCache_Tombstone(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+	cache.Set("key2", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	_, err := cache.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, true, fmt.Errorf("gone: %w", ErrTombstone)
+	})
+	if !errors.Is(err, ErrTombstone) {
+		t.Errorf("LoadOrStore() err got %v, want %v", err, ErrTombstone)
+	}
+	if _, ok := storedValue(cache, "key"); ok {
+		t.Errorf("key expected to be deleted")
+	}
+
+	_, refresh, _ := cache.AsyncLoadOrStore("key2", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return nil, ErrTombstone
+	})
+	if _, err = refresh.Result(); !errors.Is(err, ErrTombstone) {
+		t.Errorf("Result() err got %v, want %v", err, ErrTombstone)
+	}
+	if _, ok := storedValue(cache, "key2"); ok {
+		t.Errorf("key2 expected to be deleted")
+	}
+}
+
+func TestCache_DefaultValue(t *testing.T) {
+	callbackErr := errors.New("failed")
+	cache := New(Config{
+		DefaultValue: func(key any) (any, bool) {
+			return "default", key != "no-default"
+		},
+	})
+
+	entry, err := cache.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, false, callbackErr
+	})
+	if err != nil || entry.Value != "default" || !errors.Is(entry.Err, callbackErr) {
+		t.Errorf("LoadOrStore() got %+v, %v, want the default value with the callback error", entry, err)
+	}
+	if _, err = cache.Get("key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() got %v, want the default value not stored", err)
+	}
+
+	entry, _, err = cache.AsyncLoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return nil, callbackErr
+	})
+	if err != nil || entry.Value != "default" {
+		t.Errorf("AsyncLoadOrStore() got %+v, %v, want the default value", entry, err)
+	}
+
+	_, err = cache.LoadOrStore("no-default", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, false, callbackErr
+	})
+	if !errors.Is(err, callbackErr) {
+		t.Errorf("LoadOrStore() without default got %v, want the callback error", err)
+	}
+	_, err = cache.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, false, ErrTombstone
+	})
+	if !errors.Is(err, ErrTombstone) {
+		t.Errorf("LoadOrStore() with tombstone got %v, want ErrTombstone", err)
+	}
+
+	entries, _, err := cache.AsyncLoadOrStoreMulti([]any{"key", "no-default"}, func(ctx context.Context, keys []any) (map[any]any, error) {
+		return nil, callbackErr
+	})
+	var cbErr *CallbackError
+	if !errors.As(err, &cbErr) || len(cbErr.Key.([]any)) != 1 || entries["key"].Value != "default" {
+		t.Errorf("AsyncLoadOrStoreMulti() got %+v, %v, want the default of key and the error of no-default", entries, err)
+	}
+}
@@ -0,0 +1,107 @@
+package lastcache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// KeyProvider provides the AES keys to encrypt the persisted data (e.g. snapshots), see Config.Encryption
+// Keys are identified by ids which are stored with the encrypted data, so the keys can be rotated
+type KeyProvider interface {
+	// CurrentKey returns the key to be used for encryption, and its id
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key by id, to decrypt the data encrypted by it
+	Key(id string) ([]byte, error)
+}
+
+// StaticKey KeyProvider with a single AES key, which must be 16, 24 or 32 bytes to select AES-128, AES-192, or AES-256
+type StaticKey []byte
+
+// CurrentKey returns the key with an empty id
+func (k StaticKey) CurrentKey() (string, []byte, error) {
+	return "", k, nil
+}
+
+// Key returns the key if id is empty
+func (k StaticKey) Key(id string) ([]byte, error) {
+	if id != "" {
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrDecrypt, id)
+	}
+	return k, nil
+}
+
+// frameCipher encrypts the frames by AES-GCM, each frame with a random nonce
+// The frame index is authenticated as well, so the frames can't be reordered, dropped or replayed from another position
+// The header and the number of frames are not authenticated, so dropping the trailing frames isn't detected,
+// the data cut at a frame boundary decrypts as its leading frames, like a WAL with a truncated tail
+type frameCipher struct {
+	aead  cipher.AEAD
+	index uint64
+}
+
+func newFrameCipher(key []byte) (*frameCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &frameCipher{aead: aead}, nil
+}
+
+// encryptionCipher returns the cipher of the current key and its id
+func encryptionCipher(keys KeyProvider) (string, *frameCipher, error) {
+	id, key, err := keys.CurrentKey()
+	if err != nil {
+		return "", nil, err
+	}
+	fc, err := newFrameCipher(key)
+	return id, fc, err
+}
+
+// decryptionCipher returns the cipher of the key id
+func decryptionCipher(keys KeyProvider, id string) (*frameCipher, error) {
+	if keys == nil {
+		return nil, fmt.Errorf("%w: data is encrypted but Config.Encryption is not set", ErrDecrypt)
+	}
+	key, err := keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	return newFrameCipher(key)
+}
+
+func (f *frameCipher) additionalData() []byte {
+	var ad [8]byte
+	binary.BigEndian.PutUint64(ad[:], f.index)
+	f.index++
+	return ad[:]
+}
+
+// seal returns the nonce followed by the encrypted data
+func (f *frameCipher) seal(data []byte) ([]byte, error) {
+	nonce := make([]byte, f.aead.NonceSize(), f.aead.NonceSize()+len(data)+f.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return f.aead.Seal(nonce, nonce, data, f.additionalData()), nil
+}
+
+// open decrypts the data sealed by seal
+func (f *frameCipher) open(data []byte) ([]byte, error) {
+	if len(data) < f.aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := data[:f.aead.NonceSize()], data[f.aead.NonceSize():]
+	plaintext, err := f.aead.Open(nil, nonce, ciphertext, f.additionalData())
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
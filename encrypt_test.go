@@ -0,0 +1,91 @@
+package lastcache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type rotatingKeys map[string][]byte
+
+func (k rotatingKeys) CurrentKey() (string, []byte, error) {
+	return "v2", k["v2"], nil
+}
+
+func (k rotatingKeys) Key(id string) ([]byte, error) {
+	key, ok := k[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return key, nil
+}
+
+func encryptedSnapshot(t *testing.T, keys KeyProvider) []byte {
+	t.Helper()
+	cache := New(Config{GlobalTTL: time.Minute, Encryption: keys})
+	cache.Set("key1", "secret_value1")
+	cache.Set("key2", "secret_value2")
+
+	var buf bytes.Buffer
+	if err := cache.Snapshot(&buf, "json"); err != nil {
+		t.Fatalf("Snapshot() failed with err: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestCache_EncryptedSnapshot(t *testing.T) {
+	key := StaticKey(bytes.Repeat([]byte{1}, 32))
+	data := encryptedSnapshot(t, key)
+	if bytes.Contains(data, []byte("secret_value")) {
+		t.Fatalf("snapshot is not encrypted")
+	}
+
+	restored := New(Config{GlobalTTL: time.Minute, Encryption: key})
+	if n, err := restored.Restore(bytes.NewReader(data)); err != nil || n != 2 {
+		t.Fatalf("Restore() got %v, %v, want 2 entries", n, err)
+	}
+	if entry, err := restored.Get("key1"); err != nil || entry.Value != "secret_value1" {
+		t.Errorf("Get() got %+v, %v, want secret_value1", entry, err)
+	}
+}
+
+func TestCache_EncryptedSnapshotRotatedKey(t *testing.T) {
+	keys := rotatingKeys{
+		"v1": bytes.Repeat([]byte{1}, 16),
+		"v2": bytes.Repeat([]byte{2}, 16),
+	}
+	data := encryptedSnapshot(t, keys)
+
+	restored := New(Config{Encryption: keys})
+	if n, err := restored.Restore(bytes.NewReader(data)); err != nil || n != 2 {
+		t.Errorf("Restore() got %v, %v, want 2 entries", n, err)
+	}
+}
+
+func TestCache_EncryptedSnapshotErrors(t *testing.T) {
+	key := StaticKey(bytes.Repeat([]byte{1}, 32))
+	data := encryptedSnapshot(t, key)
+
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name string
+		keys KeyProvider
+		data []byte
+	}{
+		{name: "missing key", keys: nil, data: data},
+		{name: "wrong key", keys: StaticKey(bytes.Repeat([]byte{2}, 32)), data: data},
+		{name: "tampered", keys: key, data: tampered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restored := New(Config{Encryption: tt.keys})
+			if _, err := restored.Restore(bytes.NewReader(tt.data)); !errors.Is(err, ErrDecrypt) {
+				t.Errorf("Restore() err got %v, want %v", err, ErrDecrypt)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package lastcache
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when the key doesn't exist in the cache
+	ErrNotFound = errors.New("lastcache: key not found")
+
+	// ErrExpired is returned by Get when the key exists but it's expired, along with the stale entry
+	ErrExpired = errors.New("lastcache: key expired")
+
+	// ErrCallbackFailed is matched by the errors returned when a callback fails, see CallbackError
+	ErrCallbackFailed = errors.New("lastcache: callback failed")
+
+	// ErrMaxStaleExceeded is returned when a stale value can not be served anymore
+	ErrMaxStaleExceeded = errors.New("lastcache: max stale exceeded")
+
+	// ErrClosed is returned when the cache is used after Close
+	ErrClosed = errors.New("lastcache: cache closed")
+
+	// ErrTombstone can be returned (or wrapped) by a callback to signal that the key no longer exists upstream
+	// The key including its stale value will be deleted from the cache, and the error will be returned to the caller
+	//
+	//	return nil, false, fmt.Errorf("user %v: %w", key, lastcache.ErrTombstone)
+	ErrTombstone = errors.New("lastcache: key no longer exists")
+
+	// ErrUnknownCodec is returned when a codec name is not registered by RegisterCodec
+	ErrUnknownCodec = errors.New("lastcache: unknown codec")
+
+	// ErrInvalidSnapshot is returned when restoring data which is not a snapshot
+	ErrInvalidSnapshot = errors.New("lastcache: invalid snapshot")
+
+	// ErrLeaseHeld is returned by Refresh.Result when the refresh is skipped, since the lease of the key is held by another instance
+	ErrLeaseHeld = errors.New("lastcache: refresh lease is held by another instance")
+
+	// ErrDecrypt is returned when the persisted data can not be decrypted, e.g. by a wrong key or because it's tampered
+	ErrDecrypt = errors.New("lastcache: decryption failed")
+
+	// ErrNoTenant is returned when Config.TenantFunc is set but the context has no tenant
+	ErrNoTenant = errors.New("lastcache: no tenant in context")
+)
+
+// CallbackError wraps the error returned by a callback
+// errors.Is(err, ErrCallbackFailed) reports true, and the callback error can be retrieved by errors.Unwrap
+type CallbackError struct {
+	Key any
+	Err error
+}
+
+func (e *CallbackError) Error() string {
+	return fmt.Sprintf("lastcache: callback failed for key %v: %v", e.Key, e.Err)
+}
+
+// Unwrap returns the callback error
+func (e *CallbackError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrCallbackFailed
+func (e *CallbackError) Is(target error) bool {
+	return target == ErrCallbackFailed
+}
+
+// maxStaleError matches ErrMaxStaleExceeded by errors.Is, and unwraps to the last callback error
+type maxStaleError struct {
+	err error
+}
+
+func (e *maxStaleError) Error() string {
+	return ErrMaxStaleExceeded.Error() + ": " + e.err.Error()
+}
+
+func (e *maxStaleError) Unwrap() error {
+	return e.err
+}
+
+func (e *maxStaleError) Is(target error) bool {
+	return target == ErrMaxStaleExceeded
+}
+
+func callbackError(key any, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &CallbackError{Key: key, Err: err}
+}
+
+// callbackCause returns the callback error wrapped by CallbackError
+func callbackCause(err error) error {
+	var cbErr *CallbackError
+	if errors.As(err, &cbErr) {
+		return cbErr.Err
+	}
+	return err
+}
+
+// PrefetchError aggregates the errors of the keys failed in Prefetch
+// errors.Is reports true if any of the errors matches the target
+type PrefetchError struct {
+	Errors []error
+}
+
+func (e *PrefetchError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("lastcache: prefetch failed for %d keys, first error: %v", len(e.Errors), e.Errors[0])
+}
+
+// Is reports whether any of the errors matches target
+func (e *PrefetchError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
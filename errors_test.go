@@ -0,0 +1,167 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCallbackError(t *testing.T) {
+	cause := errors.New("unavailable")
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	now = func() time.Time { return fixedTime() }
+
+	_, err := cache.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, false, cause
+	})
+	if !errors.Is(err, ErrCallbackFailed) || !errors.Is(err, cause) {
+		t.Errorf("LoadOrStore() err got %v, want %v wrapping %v", err, ErrCallbackFailed, cause)
+	}
+
+	var cbErr *CallbackError
+	if !errors.As(err, &cbErr) || cbErr.Key != "key" {
+		t.Errorf("LoadOrStore() err got %v, want CallbackError for key", err)
+	}
+
+	cache.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	_, refresh, _ := cache.AsyncLoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return nil, cause
+	})
+	if _, err = refresh.Result(); !errors.Is(err, ErrCallbackFailed) || !errors.Is(err, cause) {
+		t.Errorf("Result() err got %v, want %v wrapping %v", err, ErrCallbackFailed, cause)
+	}
+}
+
+func TestCache_Get(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	if _, err := cache.Get("key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() err got %v, want %v", err, ErrNotFound)
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+
+	entry, err := cache.Get("key")
+	if err != nil || entry.Value != "value" || entry.Stale {
+		t.Errorf("Get() got %+v, %v, want fresh value", entry, err)
+	}
+
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	entry, err = cache.Get("key")
+	if !errors.Is(err, ErrExpired) || entry.Value != "value" || !entry.Stale {
+		t.Errorf("Get() got %+v, %v, want stale value with %v", entry, err, ErrExpired)
+	}
+}
+
+func TestCache_Close(t *testing.T) {
+	cache := New(Config{})
+	cache.Close()
+
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return "value", false, nil
+	}
+	if _, err := cache.LoadOrStore("key", callback); !errors.Is(err, ErrClosed) {
+		t.Errorf("LoadOrStore() err got %v, want %v", err, ErrClosed)
+	}
+
+	asyncCallback := func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return "value", nil
+	}
+	if _, _, err := cache.AsyncLoadOrStore("key", asyncCallback); !errors.Is(err, ErrClosed) {
+		t.Errorf("AsyncLoadOrStore() err got %v, want %v", err, ErrClosed)
+	}
+
+	if cache.context().Err() == nil {
+		t.Errorf("cache context expected to be canceled")
+	}
+}
+
+func TestCache_MaxConsecutiveFailures(t *testing.T) {
+	cause := errors.New("unavailable")
+	cache := New(Config{
+		GlobalTTL:              10 * time.Millisecond,
+		ExtendTTL:              10 * time.Millisecond,
+		MaxConsecutiveFailures: 2,
+	})
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, true, cause
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+	entry, err := cache.LoadOrStore("key", callback)
+	if err != nil || entry.Value != "value" || !entry.Stale {
+		t.Fatalf("LoadOrStore() got %+v, %v, want the stale value", entry, err)
+	}
+
+	now = func() time.Time { return fixedTime().Add(22 * time.Millisecond) }
+	entry, err = cache.LoadOrStore("key", callback)
+	if !errors.Is(err, ErrMaxStaleExceeded) || !errors.Is(err, cause) || !errors.Is(err, ErrCallbackFailed) || entry.Value != nil {
+		t.Fatalf("LoadOrStore() got %+v, %v, want %v wrapping %v", entry, err, ErrMaxStaleExceeded, cause)
+	}
+
+	// the ttl is not extended anymore
+	if it, _ := cache.loadItem("key"); !it.expiresAt.Equal(fixedTime().Add(21 * time.Millisecond)) {
+		t.Errorf("expiresAt got %v, want the last extended expiry", it.expiresAt)
+	}
+
+	entry, refresh, err := cache.AsyncLoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return "new value", nil
+	})
+	if !errors.Is(err, ErrMaxStaleExceeded) || entry.Value != nil || refresh == nil {
+		t.Fatalf("AsyncLoadOrStore() got %+v, %v, %v, want %v with a refresh", entry, refresh, err, ErrMaxStaleExceeded)
+	}
+
+	// a successful refresh resets the failures
+	if entry, err = refresh.Result(); err != nil || entry.Value != "new value" {
+		t.Errorf("Result() got %+v, %v, want the new value", entry, err)
+	}
+	if it, _ := cache.loadItem("key"); it.failures != 0 {
+		t.Errorf("failures got %d, want 0", it.failures)
+	}
+}
+
+func TestCache_DeleteAfterFailures(t *testing.T) {
+	cause := errors.New("unavailable")
+	cache := New(Config{
+		GlobalTTL:             10 * time.Millisecond,
+		ExtendTTL:             10 * time.Millisecond,
+		DeleteAfterFailures:   2,
+		DeleteAfterFailingFor: 20 * time.Millisecond,
+	})
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, true, cause
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+
+	for _, d := range []time.Duration{11, 22} {
+		now = func() time.Time { return fixedTime().Add(d * time.Millisecond) }
+		if entry, err := cache.LoadOrStore("key", callback); err != nil || !entry.Stale {
+			t.Fatalf("LoadOrStore() at %v got %+v, %v, want the stale value", d, entry, err)
+		}
+	}
+
+	// failed 3 times over 22ms
+	now = func() time.Time { return fixedTime().Add(33 * time.Millisecond) }
+	entry, err := cache.LoadOrStore("key", callback)
+	if !errors.Is(err, cause) || entry.Value != nil {
+		t.Fatalf("LoadOrStore() got %+v, %v, want %v", entry, err, cause)
+	}
+	if _, err = cache.Get("key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() err got %v, want %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,80 @@
+package lastcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// EventType type of the cache lifecycle event
+type EventType int
+
+const (
+	// EventSet a value is stored by Set or one of the write methods (e.g. Swap, CompareAndSwap)
+	EventSet EventType = iota
+	// EventRefresh a value returned by a callback is stored
+	EventRefresh
+	// EventStaleServe a stale value is served
+	EventStaleServe
+	// EventEvict a key is evicted because of memory limits
+	EventEvict
+	// EventDelete a key is deleted
+	EventDelete
+	// EventRestore a value is restored with its original expiry, e.g. from a snapshot, the WAL or a peer
+	EventRestore
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventRefresh:
+		return "refresh"
+	case EventStaleServe:
+		return "stale_serve"
+	case EventEvict:
+		return "evict"
+	case EventDelete:
+		return "delete"
+	case EventRestore:
+		return "restore"
+	default:
+		return "unknown"
+	}
+}
+
+// Event cache lifecycle event, see Cache.Events
+type Event struct {
+	Type EventType
+	Key  any
+	// Value stored value for EventSet, EventRefresh and EventRestore, and served value for EventStaleServe
+	Value any
+	// Err callback error which caused EventStaleServe, if any
+	Err  error
+	Time time.Time
+}
+
+// Events returns the channel of the cache lifecycle events
+// Config.EventsBuffer must be set, otherwise nil will be returned
+// Events are dropped if the buffer is full, number of the dropped events is reported by DroppedEvents
+func (c *Cache) Events() <-chan Event {
+	c.lazyInit()
+	return c.events
+}
+
+// DroppedEvents returns number of the events dropped because the events buffer was full
+func (c *Cache) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&c.droppedEvents)
+}
+
+func (c *Cache) emit(eventType EventType, key, value any, err error) {
+	c.lazyInit()
+	if c.events == nil {
+		return
+	}
+
+	select {
+	case c.events <- Event{Type: eventType, Key: key, Value: value, Err: err, Time: c.now()}:
+	default:
+		atomic.AddUint64(&c.droppedEvents, 1)
+	}
+}
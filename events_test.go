@@ -0,0 +1,72 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCache_Events(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL:      10 * time.Millisecond,
+		EventsBuffer:   10,
+		MaxMemoryBytes: 2,
+		SizeFunc: func(key, value any) int64 {
+			return 1
+		},
+	})
+
+	now = func() time.Time { return fixedTime() }
+
+	cache.Set("key", "value")
+	cache.LoadOrStore("key2", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return "value2", false, nil
+	})
+	cache.Set("key3", "value3") // evicts key
+
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+	cache.LoadOrStore("key2", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, true, errors.New("unavailable")
+	})
+	cache.Delete("key3")
+
+	want := []Event{
+		{Type: EventSet, Key: "key", Value: "value"},
+		{Type: EventRefresh, Key: "key2", Value: "value2"},
+		{Type: EventSet, Key: "key3", Value: "value3"},
+		{Type: EventEvict, Key: "key"},
+		{Type: EventStaleServe, Key: "key2", Value: "value2", Err: errors.New("unavailable")},
+		{Type: EventDelete, Key: "key3"},
+	}
+
+	events := cache.Events()
+	var got []Event
+	for len(events) > 0 {
+		event := <-events
+		event.Time = time.Time{}
+		got = append(got, event)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Events() got = %+v, want %+v", got, want)
+	}
+}
+
+func TestCache_DroppedEvents(t *testing.T) {
+	cache := New(Config{
+		EventsBuffer: 1,
+	})
+
+	cache.Set("key", "value")
+	cache.Set("key", "value")
+	cache.Set("key", "value")
+
+	if got := cache.DroppedEvents(); got != 2 {
+		t.Errorf("DroppedEvents() got = %v, want 2", got)
+	}
+
+	if New(Config{}).Events() != nil {
+		t.Errorf("Events() expected to be nil when EventsBuffer is not set")
+	}
+}
@@ -0,0 +1,174 @@
+// Package fasthttpcache caches fasthttp responses by lastcache, with stale-while-revalidate
+// and stale-if-error behavior
+//
+//	cache := lastcache.New(lastcache.Config{GlobalTTL: time.Minute})
+//	handler := fasthttpcache.New(cache, fasthttpcache.Config{Mode: fasthttpcache.StaleWhileRevalidate}, handler)
+//	fasthttp.ListenAndServe(":8080", handler)
+package fasthttpcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	"github.com/mbrostami/lastcache"
+	"github.com/valyala/fasthttp"
+)
+
+// HeaderCache response header which reports how the response is served, HIT, STALE or MISS
+const HeaderCache = "X-Cache"
+
+// Mode how the expired responses are served
+type Mode int
+
+const (
+	// StaleIfError calls the handler when the response is expired, and serves the stale response only if the handler fails
+	StaleIfError Mode = iota
+	// StaleWhileRevalidate serves the stale response immediately and calls the handler in background
+	StaleWhileRevalidate
+)
+
+// Config of the handler wrapper
+type Config struct {
+	Mode Mode
+
+	// KeyFunc returns the cache key of the request
+	// Default is the method and the full uri of the request
+	KeyFunc func(ctx *fasthttp.RequestCtx) string
+
+	// Cacheable reports whether the request can be served from the cache
+	// Default allows GET and HEAD requests
+	Cacheable func(ctx *fasthttp.RequestCtx) bool
+
+	// Failed reports whether the response is a failure, which is not stored,
+	// and the stale response will be served instead if there is one
+	// Default treats 5xx status codes as failures
+	Failed func(resp *fasthttp.Response) bool
+
+	// Store reports whether a successful response should be stored
+	// Default stores 200 responses only, other responses are served but not stored
+	Store func(resp *fasthttp.Response) bool
+}
+
+// ResponseError is returned by the callback when the handler response is a failure
+type ResponseError struct {
+	StatusCode int
+	resp       *fasthttp.Response
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("fasthttpcache: handler responded with status %d", e.StatusCode)
+}
+
+// New wraps the handler, so its responses are cached in cache
+func New(cache *lastcache.Cache, config Config, handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	if config.KeyFunc == nil {
+		config.KeyFunc = defaultKey
+	}
+	if config.Cacheable == nil {
+		config.Cacheable = defaultCacheable
+	}
+	if config.Failed == nil {
+		config.Failed = defaultFailed
+	}
+	if config.Store == nil {
+		config.Store = defaultStore
+	}
+
+	h := &cachedHandler{cache: cache, config: config, handler: handler}
+	return h.serve
+}
+
+type cachedHandler struct {
+	cache   *lastcache.Cache
+	config  Config
+	handler fasthttp.RequestHandler
+}
+
+func (h *cachedHandler) serve(ctx *fasthttp.RequestCtx) {
+	if !h.config.Cacheable(ctx) {
+		h.handler(ctx)
+		return
+	}
+
+	key := h.config.KeyFunc(ctx)
+	// the request is copied, since ctx is reused after serve returns and the refresh may run in background
+	req := &fasthttp.Request{}
+	ctx.Request.CopyTo(req)
+	remoteAddr := ctx.RemoteAddr()
+
+	// called is set when the handler is called, either for this request or in background
+	var called int32
+	var entry lastcache.Entry
+	var err error
+	if h.config.Mode == StaleWhileRevalidate {
+		entry, _, err = h.cache.AsyncLoadOrStore(key, func(_ context.Context, _ any, _ *lastcache.Entry) (any, error) {
+			atomic.StoreInt32(&called, 1)
+			return h.call(req, remoteAddr)
+		})
+	} else {
+		entry, err = h.cache.LoadOrStoreWithCtx(ctx, key, func(_ context.Context, _ any, prev *lastcache.Entry) (any, bool, error) {
+			atomic.StoreInt32(&called, 1)
+			resp, err := h.call(req, remoteAddr)
+			return resp, prev != nil, err
+		})
+	}
+
+	var respErr *ResponseError
+	switch {
+	case errors.As(err, &respErr):
+		respErr.resp.CopyTo(&ctx.Response)
+		ctx.Response.Header.Set(HeaderCache, "MISS")
+		return
+	case err != nil:
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusBadGateway), fasthttp.StatusBadGateway)
+		return
+	}
+
+	entry.Value.(*fasthttp.Response).CopyTo(&ctx.Response)
+	switch {
+	case entry.Stale:
+		ctx.Response.Header.Set(HeaderCache, "STALE")
+	case atomic.LoadInt32(&called) == 1:
+		ctx.Response.Header.Set(HeaderCache, "MISS")
+	default:
+		ctx.Response.Header.Set(HeaderCache, "HIT")
+	}
+}
+
+// call runs the handler for the copied request, and returns its response
+func (h *cachedHandler) call(req *fasthttp.Request, remoteAddr net.Addr) (any, error) {
+	var ctx fasthttp.RequestCtx
+	ctx.Init(req, remoteAddr, nil)
+	h.handler(&ctx)
+
+	resp := &fasthttp.Response{}
+	ctx.Response.CopyTo(resp)
+	resp.Header.Del(HeaderCache)
+
+	if h.config.Failed(resp) {
+		return nil, &ResponseError{StatusCode: resp.StatusCode(), resp: resp}
+	}
+	if !h.config.Store(resp) {
+		return lastcache.NoStore(resp), nil
+	}
+	return resp, nil
+}
+
+func defaultKey(ctx *fasthttp.RequestCtx) string {
+	return string(ctx.Method()) + " " + string(ctx.URI().FullURI())
+}
+
+func defaultCacheable(ctx *fasthttp.RequestCtx) bool {
+	return ctx.IsGet() || ctx.IsHead()
+}
+
+func defaultFailed(resp *fasthttp.Response) bool {
+	return resp.StatusCode() >= fasthttp.StatusInternalServerError
+}
+
+func defaultStore(resp *fasthttp.Response) bool {
+	return resp.StatusCode() == fasthttp.StatusOK
+}
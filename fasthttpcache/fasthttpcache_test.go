@@ -0,0 +1,117 @@
+package fasthttpcache
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+	"github.com/mbrostami/lastcache/lastcachetest"
+	"github.com/valyala/fasthttp"
+)
+
+func request(handler fasthttp.RequestHandler, method, uri string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.SetRequestURI(uri)
+	handler(ctx)
+	return ctx
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       Mode
+		failAfter  int32
+		wantBodies []string
+		wantCache  []string
+	}{
+		{
+			name:       "stale if error",
+			mode:       StaleIfError,
+			failAfter:  1,
+			wantBodies: []string{"response 1", "response 1", "response 1"},
+			wantCache:  []string{"MISS", "HIT", "STALE"},
+		},
+		{
+			name:       "stale if error refreshes",
+			mode:       StaleIfError,
+			failAfter:  10,
+			wantBodies: []string{"response 1", "response 1", "response 2"},
+			wantCache:  []string{"MISS", "HIT", "MISS"},
+		},
+		{
+			name:       "stale while revalidate",
+			mode:       StaleWhileRevalidate,
+			failAfter:  10,
+			wantBodies: []string{"response 1", "response 1", "response 1"},
+			wantCache:  []string{"MISS", "HIT", "STALE"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := lastcachetest.NewClock(time.Now())
+			cache := lastcache.New(lastcache.Config{GlobalTTL: time.Minute, Clock: clock})
+
+			var calls int32
+			handler := New(cache, Config{Mode: tt.mode}, func(ctx *fasthttp.RequestCtx) {
+				n := atomic.AddInt32(&calls, 1)
+				if n > tt.failAfter {
+					ctx.Error("unavailable", fasthttp.StatusServiceUnavailable)
+					return
+				}
+				fmt.Fprintf(ctx, "response %d", n)
+			})
+
+			for i := range tt.wantBodies {
+				if i == 2 {
+					clock.Advance(2 * time.Minute)
+				}
+				ctx := request(handler, fasthttp.MethodGet, "/resource")
+				if got := string(ctx.Response.Body()); got != tt.wantBodies[i] {
+					t.Errorf("request %d body got = %q, want %q", i, got, tt.wantBodies[i])
+				}
+				if got := string(ctx.Response.Header.Peek(HeaderCache)); got != tt.wantCache[i] {
+					t.Errorf("request %d %s got = %q, want %q", i, HeaderCache, got, tt.wantCache[i])
+				}
+			}
+			lastcachetest.WaitForRefreshes(t, cache)
+		})
+	}
+}
+
+func TestNew_NotStored(t *testing.T) {
+	cache := lastcache.New(lastcache.Config{GlobalTTL: time.Minute})
+
+	var calls int32
+	handler := New(cache, Config{}, func(ctx *fasthttp.RequestCtx) {
+		atomic.AddInt32(&calls, 1)
+		if ctx.IsPost() {
+			ctx.SetStatusCode(fasthttp.StatusCreated)
+			return
+		}
+		switch string(ctx.Path()) {
+		case "/missing":
+			ctx.Error("not found", fasthttp.StatusNotFound)
+		case "/failing":
+			ctx.Error("unavailable", fasthttp.StatusServiceUnavailable)
+		}
+	})
+
+	for i := 0; i < 2; i++ {
+		if ctx := request(handler, fasthttp.MethodGet, "/missing"); ctx.Response.StatusCode() != fasthttp.StatusNotFound {
+			t.Errorf("status got = %v, want %v", ctx.Response.StatusCode(), fasthttp.StatusNotFound)
+		}
+		if ctx := request(handler, fasthttp.MethodGet, "/failing"); ctx.Response.StatusCode() != fasthttp.StatusServiceUnavailable {
+			t.Errorf("status got = %v, want %v", ctx.Response.StatusCode(), fasthttp.StatusServiceUnavailable)
+		}
+		if ctx := request(handler, fasthttp.MethodPost, "/resource"); ctx.Response.StatusCode() != fasthttp.StatusCreated {
+			t.Errorf("status got = %v, want %v", ctx.Response.StatusCode(), fasthttp.StatusCreated)
+		}
+	}
+
+	if calls != 6 {
+		t.Errorf("handler calls got = %v, want 6", calls)
+	}
+}
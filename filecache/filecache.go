@@ -0,0 +1,175 @@
+// Package filecache caches the parsed contents of files (certificates, templates, config) keyed by path
+//
+// The files are parsed on the first Get, and parsed again when they change on the disk, which is detected by fsnotify.
+// If reading or parsing fails, the last good parse is served and the error is reported to Config.OnError.
+//
+//	certs, err := filecache.New(parseCert, filecache.Config{})
+//	cert, err := certs.Get("/etc/tls/tls.crt")
+package filecache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mbrostami/lastcache"
+)
+
+// ParseFunc parses the content of the file
+type ParseFunc[T any] func(path string, data []byte) (T, error)
+
+// Config of the file Cache
+type Config struct {
+	// TTL the files are parsed again after TTL, in case a change notification is missed
+	// Default is lastcache default ttl
+	TTL time.Duration
+
+	// OnError if set, is called when a file can not be read or parsed, while the last good parse is served
+	OnError func(path string, err error)
+}
+
+// Cache of the parsed files
+type Cache[T any] struct {
+	cache   *lastcache.Cache
+	parse   ParseFunc[T]
+	config  Config
+	watcher *fsnotify.Watcher
+
+	mu sync.Mutex
+	// dirs watched directories and the paths of the cached files in them
+	dirs map[string]map[string]struct{}
+
+	done chan struct{}
+}
+
+// New starts watching the file changes, Close must be called to stop watching
+func New[T any](parse ParseFunc[T], config Config) (*Cache[T], error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache[T]{
+		cache:   lastcache.New(lastcache.Config{GlobalTTL: config.TTL}),
+		parse:   parse,
+		config:  config,
+		watcher: watcher,
+		dirs:    make(map[string]map[string]struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.watch()
+	return c, nil
+}
+
+// Get returns the parsed content of the file
+// The last good parse is returned if the file can not be read or parsed anymore
+func (c *Cache[T]) Get(path string) (T, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	entry, err := c.cache.LoadOrStore(path, func(_ context.Context, key any, prev *lastcache.Entry) (any, bool, error) {
+		value, err := c.load(path)
+		if err != nil {
+			c.reportError(path, err)
+			return nil, prev != nil, err
+		}
+		return value, false, nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	if err := c.watchPath(path); err != nil {
+		c.reportError(path, err)
+	}
+	value, _ := entry.Value.(T)
+	return value, nil
+}
+
+// Close stops watching the files
+func (c *Cache[T]) Close() error {
+	err := c.watcher.Close()
+	<-c.done
+	c.cache.Close()
+	return err
+}
+
+func (c *Cache[T]) load(path string) (T, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return c.parse(path, data)
+}
+
+// watchPath watches the directory of the file, so atomic replaces (rename or symlink swap) are detected as well
+func (c *Cache[T]) watchPath(path string) error {
+	dir := filepath.Dir(path)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	paths, ok := c.dirs[dir]
+	if !ok {
+		if err := c.watcher.Add(dir); err != nil {
+			return err
+		}
+		paths = make(map[string]struct{})
+		c.dirs[dir] = paths
+	}
+	paths[path] = struct{}{}
+	return nil
+}
+
+func (c *Cache[T]) watch() {
+	defer close(c.done)
+	for {
+		select {
+		case event, ok := <-c.watcher.Events:
+			if !ok {
+				return
+			}
+			c.reloadDir(filepath.Dir(event.Name))
+		case err, ok := <-c.watcher.Errors:
+			if !ok {
+				return
+			}
+			c.reportError("", err)
+		}
+	}
+}
+
+// reloadDir parses the cached files of the directory again, since any change in the directory
+// (e.g. a symlink swap) might change their content
+// The cached value is only replaced if the file is parsed successfully
+func (c *Cache[T]) reloadDir(dir string) {
+	c.mu.Lock()
+	paths := make([]string, 0, len(c.dirs[dir]))
+	for path := range c.dirs[dir] {
+		paths = append(paths, path)
+	}
+	c.mu.Unlock()
+
+	for _, path := range paths {
+		value, err := c.load(path)
+		if err != nil {
+			c.reportError(path, err)
+			continue
+		}
+		c.cache.Set(path, value)
+	}
+}
+
+func (c *Cache[T]) reportError(path string, err error) {
+	if c.config.OnError != nil {
+		c.config.OnError(path, err)
+	}
+}
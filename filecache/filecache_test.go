@@ -0,0 +1,85 @@
+package filecache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func parseInt(_ string, data []byte) (int, error) {
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition is not met")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCache_Get(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "value")
+	if err := os.WriteFile(path, []byte("1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	files, err := New(parseInt, Config{OnError: func(_ string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer files.Close()
+
+	if value, err := files.Get(path); err != nil || value != 1 {
+		t.Fatalf("Get() got %v, %v, want 1", value, err)
+	}
+
+	// changes are picked up by the watcher
+	if err := os.WriteFile(path, []byte("2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		value, _ := files.Get(path)
+		return value == 2
+	})
+
+	// broken content keeps the last good parse
+	if err := os.WriteFile(path, []byte("broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(errs) > 0
+	})
+	if value, err := files.Get(path); err != nil || value != 2 {
+		t.Errorf("Get() got %v, %v, want last good parse 2", value, err)
+	}
+}
+
+func TestCache_GetMissingFile(t *testing.T) {
+	files, err := New(parseInt, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer files.Close()
+
+	if _, err := files.Get(filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Get() err got %v, want %v", err, os.ErrNotExist)
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/mbrostami/lastcache/filecache
+
+go 1.18
+
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/mbrostami/lastcache v0.0.0
+)
+
+require golang.org/x/sys v0.13.0 // indirect
+
+replace github.com/mbrostami/lastcache => ../
@@ -0,0 +1,33 @@
+package lastcache
+
+import "context"
+
+// Func returns fn cached by a new Cache of config, the argument of fn is the cache key
+// Expired values are served stale while fn refreshes them in background, see AsyncLoadOrStore
+// The errors of fn are returned as CallbackError, and the cache lives as long as the returned function,
+// Config.Context can be canceled to stop its background processes
+//
+//	getUser := lastcache.Func(lastcache.Config{GlobalTTL: time.Minute}, fetchUser)
+//	user, err := getUser(ctx, userID)
+func Func[A comparable, V any](config Config, fn func(ctx context.Context, arg A) (V, error)) func(ctx context.Context, arg A) (V, error) {
+	return FuncWithKey(config, func(arg A) any { return arg }, fn)
+}
+
+// FuncWithKey is Func for the functions whose argument is not comparable or has multiple fields,
+// the cache key of the argument is derived by key
+//
+//	search := lastcache.FuncWithKey(config, func(q Query) any { return q.Term + "/" + strconv.Itoa(q.Page) }, fetchSearch)
+func FuncWithKey[A, V any](config Config, key func(arg A) any, fn func(ctx context.Context, arg A) (V, error)) func(ctx context.Context, arg A) (V, error) {
+	cache := New(config)
+	return func(ctx context.Context, arg A) (V, error) {
+		entry, _, err := cache.AsyncLoadOrStoreWithCtx(ctx, key(arg), func(ctx context.Context, _ any, _ *Entry) (any, error) {
+			return fn(ctx, arg)
+		})
+		if err != nil {
+			var zero V
+			return zero, err
+		}
+		value, _ := entry.Value.(V)
+		return value, nil
+	}
+}
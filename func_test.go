@@ -0,0 +1,58 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFunc(t *testing.T) {
+	now = func() time.Time { return fixedTime() }
+	calls := 0
+	double := Func(Config{GlobalTTL: time.Minute}, func(ctx context.Context, n int) (int, error) {
+		calls++
+		if n < 0 {
+			return 0, errors.New("negative")
+		}
+		return n * 2, nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if v, err := double(context.Background(), 21); err != nil || v != 42 {
+			t.Errorf("double(21) got %v, %v, want 42", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+
+	if _, err := double(context.Background(), -1); !errors.Is(err, ErrCallbackFailed) {
+		t.Errorf("double(-1) got err %v, want ErrCallbackFailed", err)
+	}
+}
+
+func TestFuncWithKey(t *testing.T) {
+	now = func() time.Time { return fixedTime() }
+	type query struct {
+		term string
+		page []int
+	}
+	calls := 0
+	search := FuncWithKey(Config{GlobalTTL: time.Minute}, func(q query) any {
+		return fmt.Sprint(q.term, q.page)
+	}, func(ctx context.Context, q query) (string, error) {
+		calls++
+		return q.term + "!", nil
+	})
+
+	search(context.Background(), query{term: "go", page: []int{1}})
+	if v, err := search(context.Background(), query{term: "go", page: []int{1}}); err != nil || v != "go!" {
+		t.Errorf("search() got %v, %v, want go!", v, err)
+	}
+	search(context.Background(), query{term: "go", page: []int{2}})
+	if calls != 2 {
+		t.Errorf("fn called %d times, want 2", calls)
+	}
+}
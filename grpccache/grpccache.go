@@ -0,0 +1,146 @@
+// Package grpccache caches the responses of idempotent unary gRPC methods by lastcache,
+// serving stale responses when the handler fails
+//
+//	cache := lastcache.New(lastcache.Config{GlobalTTL: time.Minute})
+//	server := grpc.NewServer(grpc.UnaryInterceptor(grpccache.UnaryServerInterceptor(cache, grpccache.Config{
+//		Methods: map[string]grpccache.MethodConfig{
+//			"/catalog.Catalog/GetProduct": {Mode: grpccache.StaleWhileRevalidate},
+//		},
+//	})))
+package grpccache
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mbrostami/lastcache"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Mode how the expired responses are served
+type Mode int
+
+const (
+	// StaleIfError calls the handler when the response is expired, and serves the stale response only if the handler fails
+	StaleIfError Mode = iota
+	// StaleWhileRevalidate serves the stale response immediately and calls the handler in background
+	StaleWhileRevalidate
+)
+
+// ErrNotProto is returned by the default KeyFunc when the request is not a proto message
+var ErrNotProto = errors.New("grpccache: request is not a proto message")
+
+// DefaultStaleCodes the status codes of the handler errors which are considered as dependency failures,
+// when a stale response is served instead of the error
+var DefaultStaleCodes = []codes.Code{codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown}
+
+// MethodConfig caching config of a method
+type MethodConfig struct {
+	Mode Mode
+
+	// Cache overrides the cache of the interceptor for this method, e.g. to use a different TTL
+	Cache *lastcache.Cache
+
+	// StaleCodes overrides Config.StaleCodes for this method
+	StaleCodes []codes.Code
+}
+
+// Config of the interceptor
+type Config struct {
+	// Methods full method names (e.g. "/package.Service/Method") of the idempotent methods to be cached
+	// The other methods are not cached
+	Methods map[string]MethodConfig
+
+	// KeyFunc returns the cache key of the request, if it fails the request is not cached
+	// Default is the method name and the deterministic proto encoding of the request
+	KeyFunc func(ctx context.Context, method string, req any) (string, error)
+
+	// StaleCodes the status codes which serve the stale response instead of the error
+	// Default is DefaultStaleCodes
+	StaleCodes []codes.Code
+}
+
+// UnaryServerInterceptor returns an interceptor which caches the responses of the configured methods in cache
+func UnaryServerInterceptor(cache *lastcache.Cache, config Config) grpc.UnaryServerInterceptor {
+	if config.KeyFunc == nil {
+		config.KeyFunc = DefaultKey
+	}
+	if config.StaleCodes == nil {
+		config.StaleCodes = DefaultStaleCodes
+	}
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		method, ok := config.Methods[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		key, err := config.KeyFunc(ctx, info.FullMethod, req)
+		if err != nil {
+			return handler(ctx, req)
+		}
+
+		c := cache
+		if method.Cache != nil {
+			c = method.Cache
+		}
+		staleCodes := config.StaleCodes
+		if method.StaleCodes != nil {
+			staleCodes = method.StaleCodes
+		}
+
+		var entry lastcache.Entry
+		if method.Mode == StaleWhileRevalidate {
+			// the handler might run in background after the request is finished
+			entry, _, err = c.AsyncLoadOrStoreWithCtx(context.WithoutCancel(ctx), key, func(ctx context.Context, _ any, _ *lastcache.Entry) (any, error) {
+				return handler(ctx, req)
+			})
+		} else {
+			entry, err = c.LoadOrStoreWithCtx(ctx, key, func(ctx context.Context, _ any, prev *lastcache.Entry) (any, bool, error) {
+				resp, err := handler(ctx, req)
+				return resp, prev != nil && staleCode(err, staleCodes), err
+			})
+		}
+		if err != nil {
+			// the handler error is returned as is, so its status is preserved
+			var cbErr *lastcache.CallbackError
+			if errors.As(err, &cbErr) {
+				return nil, cbErr.Err
+			}
+			return nil, err
+		}
+
+		// responses are shared between the callers, so they are cloned before the other interceptors can modify them
+		if msg, ok := entry.Value.(proto.Message); ok {
+			return proto.Clone(msg), nil
+		}
+		return entry.Value, nil
+	}
+}
+
+// DefaultKey returns the method name and the deterministic proto encoding of the request
+func DefaultKey(_ context.Context, method string, req any) (string, error) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return "", ErrNotProto
+	}
+
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	return method + "\x00" + string(data), nil
+}
+
+func staleCode(err error, staleCodes []codes.Code) bool {
+	code := status.Code(err)
+	for _, c := range staleCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
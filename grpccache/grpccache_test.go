@@ -0,0 +1,121 @@
+package grpccache
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+	"github.com/mbrostami/lastcache/lastcachetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const method = "/test.Service/Get"
+
+type fakeHandler struct {
+	calls int32
+	err   atomic.Value
+}
+
+func (h *fakeHandler) handle(_ context.Context, req any) (any, error) {
+	n := atomic.AddInt32(&h.calls, 1)
+	if err, _ := h.err.Load().(error); err != nil {
+		return nil, err
+	}
+	return wrapperspb.String(fmt.Sprintf("%s_%d", req.(*wrapperspb.StringValue).Value, n)), nil
+}
+
+func call(t *testing.T, interceptor grpc.UnaryServerInterceptor, h *fakeHandler, fullMethod, req string) (string, error) {
+	t.Helper()
+	resp, err := interceptor(context.Background(), wrapperspb.String(req), &grpc.UnaryServerInfo{FullMethod: fullMethod}, h.handle)
+	if err != nil {
+		return "", err
+	}
+	return resp.(*wrapperspb.StringValue).Value, nil
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      Mode
+		err       error
+		want      string
+		wantCode  codes.Code
+		wantCalls int32
+	}{
+		{
+			name:      "stale if error on unavailable",
+			mode:      StaleIfError,
+			err:       status.Error(codes.Unavailable, "down"),
+			want:      "req_1",
+			wantCalls: 2,
+		},
+		{
+			name:      "stale if error returns client errors",
+			mode:      StaleIfError,
+			err:       status.Error(codes.NotFound, "gone"),
+			wantCode:  codes.NotFound,
+			wantCalls: 2,
+		},
+		{
+			name:      "stale while revalidate",
+			mode:      StaleWhileRevalidate,
+			want:      "req_1",
+			wantCalls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := lastcachetest.NewClock(time.Now())
+			cache := lastcache.New(lastcache.Config{GlobalTTL: time.Minute, Clock: clock})
+			interceptor := UnaryServerInterceptor(cache, Config{Methods: map[string]MethodConfig{method: {Mode: tt.mode}}})
+			h := &fakeHandler{}
+
+			for i := 0; i < 2; i++ {
+				if got, err := call(t, interceptor, h, method, "req"); err != nil || got != "req_1" {
+					t.Fatalf("call %d got %v, %v, want req_1", i, got, err)
+				}
+			}
+
+			clock.Advance(2 * time.Minute)
+			if tt.err != nil {
+				h.err.Store(tt.err)
+			}
+			got, err := call(t, interceptor, h, method, "req")
+			if status.Code(err) != tt.wantCode || got != tt.want {
+				t.Errorf("expired call got %v, %v, want %v, %v", got, err, tt.want, tt.wantCode)
+			}
+			lastcachetest.WaitForRefreshes(t, cache)
+
+			if calls := atomic.LoadInt32(&h.calls); calls != tt.wantCalls {
+				t.Errorf("handler calls got = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptor_NotConfigured(t *testing.T) {
+	cache := lastcache.New(lastcache.Config{GlobalTTL: time.Minute})
+	interceptor := UnaryServerInterceptor(cache, Config{Methods: map[string]MethodConfig{method: {}}})
+	h := &fakeHandler{}
+
+	call(t, interceptor, h, "/test.Service/Update", "req")
+	got, _ := call(t, interceptor, h, "/test.Service/Update", "req")
+	if got != "req_2" {
+		t.Errorf("not configured method got %v, want req_2", got)
+	}
+
+	// different requests have different keys
+	call(t, interceptor, h, method, "a")
+	if got, _ = call(t, interceptor, h, method, "b"); got != "b_4" {
+		t.Errorf("call got %v, want b_4", got)
+	}
+	if got, _ = call(t, interceptor, h, method, "a"); got != "a_3" {
+		t.Errorf("call got %v, want cached a_3", got)
+	}
+}
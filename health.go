@@ -0,0 +1,141 @@
+package lastcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// HealthWindow window of the rates reported by Health
+const HealthWindow = time.Minute
+
+const defaultDegradedCheckInterval = 10 * time.Second
+
+// degradedRecovery fraction of the degraded thresholds below which the cache recovers
+const degradedRecovery = 0.5
+
+// Health report of the cache, see Cache.Health
+type Health struct {
+	// Entries number of the entries in the cache
+	Entries int
+	// StaleEntries number of the expired entries, which are served stale until they are refreshed
+	StaleEntries int
+	// FailingEntries number of the expired entries whose last refresh failed
+	FailingEntries int
+	// StaleFraction fraction of the entries which are expired
+	StaleFraction float64
+	// OldestStaleAge time since the oldest expired entry has expired
+	OldestStaleAge time.Duration
+
+	// StaleServeRatio fraction of the loads served stale in the last HealthWindow
+	StaleServeRatio float64
+	// RefreshErrorRate fraction of the callback calls which failed in the last HealthWindow
+	RefreshErrorRate float64
+
+	// AsyncSaturation fraction of the Config.AsyncSemaphore slots in use
+	AsyncSaturation float64
+	// SyncSaturation fraction of the Config.SyncSemaphore slots in use, 0 if it's not set
+	SyncSaturation float64
+
+	// Degraded whether the cache is degraded, see Config.OnDegraded
+	Degraded bool
+
+	// StaleAge sum of the ages of the stale values served, see Stats.StaleAge
+	StaleAge time.Duration
+	// StaleBudgetRemaining Config.StaleBudget minus StaleAge, negative if the budget is exceeded
+	// It's 0 if Config.StaleBudget is not set
+	StaleBudgetRemaining time.Duration
+}
+
+// Health returns the health report of the cache, e.g. to be exposed by /healthz or readiness probes
+// All the entries are visited to build the report, so it should not be called on the hot path
+func (c *Cache) Health() Health {
+	c.lazyInit()
+
+	var h Health
+	t := c.now()
+	c.storage().Range(func(key any, it *item) bool {
+		h.Entries++
+		if !t.After(it.expiresAt) {
+			return true
+		}
+		h.StaleEntries++
+		if it.err != nil {
+			h.FailingEntries++
+		}
+		if age := t.Sub(it.expiresAt); age > h.OldestStaleAge {
+			h.OldestStaleAge = age
+		}
+		return true
+	})
+	h.StaleFraction = ratio(uint64(h.StaleEntries), uint64(h.Entries))
+
+	w := c.stats.window.stats(t, HealthWindow)
+	h.StaleServeRatio = w.StaleRatio()
+	h.RefreshErrorRate = w.CallbackErrorRatio()
+
+	h.AsyncSaturation = saturation(c.semaphore.usage())
+	h.SyncSaturation = saturation(len(c.syncSemaphore), cap(c.syncSemaphore))
+	h.Degraded = atomic.LoadInt32(&c.degraded) == 1
+
+	h.StaleAge = time.Duration(atomic.LoadInt64(&c.stats.staleAge))
+	if c.config.StaleBudget > 0 {
+		h.StaleBudgetRemaining = c.config.StaleBudget - h.StaleAge
+	}
+	return h
+}
+
+// watchDegraded checks the degraded state every Config.DegradedCheckInterval until the cache context is done
+func (c *Cache) watchDegraded() {
+	interval := c.config.DegradedCheckInterval
+	if interval <= 0 {
+		interval = defaultDegradedCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.checkDegraded()
+		}
+	}
+}
+
+// checkDegraded updates the degraded state, Config.OnDegraded is called if it's changed
+func (c *Cache) checkDegraded() {
+	h := c.Health()
+	degraded := h.Degraded
+	if !degraded && c.exceedsDegraded(h, 1) {
+		degraded = true
+	} else if degraded && !c.exceedsDegraded(h, degradedRecovery) {
+		degraded = false
+	}
+	if degraded == h.Degraded {
+		return
+	}
+
+	var state int32
+	if degraded {
+		state = 1
+	}
+	atomic.StoreInt32(&c.degraded, state)
+	h.Degraded = degraded
+	c.config.OnDegraded(h)
+}
+
+// exceedsDegraded returns true if any of the degraded thresholds multiplied by factor is reached
+func (c *Cache) exceedsDegraded(h Health, factor float64) bool {
+	if c.config.DegradedStaleRatio > 0 && h.StaleServeRatio >= c.config.DegradedStaleRatio*factor {
+		return true
+	}
+	return c.config.DegradedStaleEntries > 0 && float64(h.StaleEntries) >= float64(c.config.DegradedStaleEntries)*factor
+}
+
+func saturation(held, size int) float64 {
+	if size == 0 {
+		return 0
+	}
+	return float64(held) / float64(size)
+}
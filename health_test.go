@@ -0,0 +1,126 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCache_Health(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL:      time.Minute,
+		AsyncSemaphore: 4,
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("fresh", "value")
+	cache.Set("stale", "value")
+	cache.Set("failing", "value")
+
+	now = func() time.Time { return fixedTime().Add(90 * time.Second) }
+	cache.Set("fresh", "value")
+	failing := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, true, errors.New("failed")
+	}
+	if entry, _ := cache.LoadOrStore("failing", failing); entry.Err == nil {
+		t.Fatal("expected the stale value with the error")
+	}
+	cache.LoadOrStore("fresh", failing)
+
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+	cache.semaphore.acquire(nil)
+
+	h := cache.Health()
+	if h.Entries != 3 || h.StaleEntries != 2 || h.FailingEntries != 1 {
+		t.Errorf("entries got %+v, want 3 entries, 2 stale and 1 failing", h)
+	}
+	if h.StaleFraction < 0.66 || h.StaleFraction > 0.67 {
+		t.Errorf("StaleFraction got %v, want 2/3", h.StaleFraction)
+	}
+	if h.OldestStaleAge != time.Minute {
+		t.Errorf("OldestStaleAge got %v, want 1m", h.OldestStaleAge)
+	}
+	// the stale serve is counted as a miss as well
+	if h.StaleServeRatio != 1.0/3 || h.RefreshErrorRate != 1 {
+		t.Errorf("rates got %v stale serves and %v errors, want 1/3 and 1", h.StaleServeRatio, h.RefreshErrorRate)
+	}
+	if h.AsyncSaturation != 0.25 || h.SyncSaturation != 0 {
+		t.Errorf("saturation got %v async and %v sync, want 0.25 and 0", h.AsyncSaturation, h.SyncSaturation)
+	}
+	cache.semaphore.release()
+}
+
+func TestCache_CheckDegraded(t *testing.T) {
+	var reports []Health
+	cache := New(Config{
+		GlobalTTL:             time.Minute,
+		DegradedStaleEntries:  4,
+		DegradedCheckInterval: time.Hour,
+		OnDegraded: func(h Health) {
+			reports = append(reports, h)
+		},
+	})
+	defer cache.Close()
+
+	now = func() time.Time { return fixedTime() }
+	for _, key := range []string{"a", "b", "c", "d"} {
+		cache.Set(key, "value")
+	}
+	cache.checkDegraded()
+
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+	cache.checkDegraded()
+	if len(reports) != 1 || !reports[0].Degraded || reports[0].StaleEntries != 4 || !cache.Health().Degraded {
+		t.Fatalf("reports got %+v, want degraded with 4 stale entries", reports)
+	}
+
+	// recovers below half of the threshold
+	cache.Set("a", "value")
+	cache.checkDegraded()
+	if len(reports) != 1 {
+		t.Fatalf("reports got %+v, want still degraded with 3 stale entries", reports)
+	}
+	cache.Set("b", "value")
+	cache.Set("c", "value")
+	cache.checkDegraded()
+	if len(reports) != 2 || reports[1].Degraded || cache.Health().Degraded {
+		t.Errorf("reports got %+v, want recovered", reports)
+	}
+}
+
+func TestCache_StaleBudget(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL:      time.Minute,
+		KeyStats:       true,
+		StaleBudget:    time.Minute,
+		KeyStaleBudget: 30 * time.Second,
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("a", "value")
+	cache.Set("b", "value")
+
+	now = func() time.Time { return fixedTime().Add(80 * time.Second) }
+	failing := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, true, errors.New("failed")
+	}
+	cache.LoadOrStore("a", failing)
+	cache.LoadOrStore("a", failing)
+	cache.LoadOrStore("b", failing)
+
+	if got := cache.Stats().StaleAge; got != time.Minute {
+		t.Errorf("Stats().StaleAge got %v, want 1m", got)
+	}
+	if h := cache.Health(); h.StaleAge != time.Minute || h.StaleBudgetRemaining != 0 {
+		t.Errorf("Health() got %v stale age and %v remaining, want 1m and 0", h.StaleAge, h.StaleBudgetRemaining)
+	}
+	if s, _ := cache.KeyStats("a"); s.StaleAge != 40*time.Second || s.StaleBudgetRemaining != -10*time.Second {
+		t.Errorf("KeyStats(a) got %v stale age and %v remaining, want 40s and -10s", s.StaleAge, s.StaleBudgetRemaining)
+	}
+
+	cache.ResetStats()
+	if h := cache.Health(); h.StaleBudgetRemaining != time.Minute {
+		t.Errorf("Health().StaleBudgetRemaining after reset got %v, want 1m", h.StaleBudgetRemaining)
+	}
+}
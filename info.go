@@ -0,0 +1,46 @@
+package lastcache
+
+import "time"
+
+// EntryInfo the entry of a key with its refresh diagnostics, e.g. to report how degraded a stale response is
+type EntryInfo struct {
+	Entry
+	// ExpiresAt time the entry expires, or expired
+	ExpiresAt time.Time
+	// RefreshedAt time of the last successful refresh, i.e. the time the value is stored
+	// It's zero if it's unknown, e.g. the value is restored from a snapshot
+	RefreshedAt time.Time
+	// FailedAttempts number of the consecutive failed refreshes since the value is stored
+	FailedAttempts int
+	// FailingSince time of the first of the failed attempts, zero if there is none
+	FailingSince time.Time
+	// LastCallbackDuration duration of the last callback call of the key, it's 0 if Config.KeyStats is not enabled
+	LastCallbackDuration time.Duration
+}
+
+// Info returns the entry of the key with its refresh diagnostics without calling any callback
+// Entry.Err holds the last callback error since the value is stored
+// ErrNotFound will be returned if the key doesn't exist
+func (c *Cache) Info(key any) (EntryInfo, error) {
+	it, ok := c.loadItem(key)
+	if !ok {
+		return EntryInfo{}, ErrNotFound
+	}
+
+	info := EntryInfo{
+		Entry:          Entry{Version: it.version, Err: it.err},
+		ExpiresAt:      it.expiresAt,
+		RefreshedAt:    it.storedAt,
+		FailedAttempts: it.failures,
+		FailingSince:   it.failingSince,
+	}
+	info.Value, _ = c.itemValue(key, it)
+	if c.now().After(it.expiresAt) {
+		info.Stale = true
+		info.Source = SourceStaleFallback
+	}
+	if s, ok := c.KeyStats(key); ok {
+		info.LastCallbackDuration = s.LastRefreshDuration
+	}
+	return info, nil
+}
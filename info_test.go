@@ -0,0 +1,45 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCache_Info(t *testing.T) {
+	cause := errors.New("unavailable")
+	cache := New(Config{GlobalTTL: time.Minute, KeyStats: true})
+
+	if _, err := cache.Info("key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Info() err got %v, want %v", err, ErrNotFound)
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+
+	for i := 0; i < 2; i++ {
+		now = func() time.Time { return fixedTime().Add(time.Duration(2+i) * time.Minute) }
+		cache.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+			time.Sleep(time.Millisecond)
+			return nil, true, cause
+		})
+	}
+
+	info, err := cache.Info("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Value != "value" || !info.Stale || !errors.Is(info.Err, cause) {
+		t.Errorf("Info() entry got %+v, want the stale value with the callback error", info.Entry)
+	}
+	if !info.RefreshedAt.Equal(fixedTime()) || !info.ExpiresAt.Equal(fixedTime().Add(time.Minute)) {
+		t.Errorf("Info() got refreshed at %v, expires at %v", info.RefreshedAt, info.ExpiresAt)
+	}
+	if info.FailedAttempts != 2 || !info.FailingSince.Equal(fixedTime().Add(2*time.Minute)) {
+		t.Errorf("Info() got %d failed attempts since %v, want 2 since the first failure", info.FailedAttempts, info.FailingSince)
+	}
+	if info.LastCallbackDuration < time.Millisecond {
+		t.Errorf("Info() last callback duration got %v, want at least 1ms", info.LastCallbackDuration)
+	}
+}
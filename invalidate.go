@@ -0,0 +1,114 @@
+package lastcache
+
+import (
+	"sync"
+	"time"
+)
+
+// Invalidation a pending invalidation scheduled by DeleteAfter or ExpireAfter
+type Invalidation struct {
+	Key any
+	// At time the key will be invalidated
+	At time.Time
+	// Delete whether the key will be deleted (DeleteAfter) or expired (ExpireAfter)
+	Delete bool
+}
+
+type pendingInvalidation struct {
+	Invalidation
+	timer *time.Timer
+}
+
+// invalidations the pending invalidations by key
+type invalidations struct {
+	mu      sync.Mutex
+	pending map[any]*pendingInvalidation
+}
+
+// DeleteAfter schedules the key to be deleted after d, e.g. after the replication lag window of the source of truth
+// Scheduling the key again replaces its pending invalidation, so repeated writes are debounced
+// The pending invalidation can be canceled by CancelInvalidation
+func (c *Cache) DeleteAfter(key any, d time.Duration) {
+	c.scheduleInvalidation(key, d, true)
+}
+
+// ExpireAfter schedules the key to be expired after d, see Expire and DeleteAfter
+// Unlike DeleteAfter the stale value is still served until the key is refreshed
+func (c *Cache) ExpireAfter(key any, d time.Duration) {
+	c.scheduleInvalidation(key, d, false)
+}
+
+// CancelInvalidation cancels the pending invalidation of the key, false is returned if there is none
+func (c *Cache) CancelInvalidation(key any) bool {
+	c.invalidations.mu.Lock()
+	defer c.invalidations.mu.Unlock()
+
+	p, ok := c.invalidations.pending[key]
+	if !ok {
+		return false
+	}
+	p.timer.Stop()
+	delete(c.invalidations.pending, key)
+	return true
+}
+
+// PendingInvalidations returns the invalidations which are scheduled but not done yet
+func (c *Cache) PendingInvalidations() []Invalidation {
+	c.invalidations.mu.Lock()
+	defer c.invalidations.mu.Unlock()
+
+	list := make([]Invalidation, 0, len(c.invalidations.pending))
+	for _, p := range c.invalidations.pending {
+		list = append(list, p.Invalidation)
+	}
+	return list
+}
+
+func (c *Cache) scheduleInvalidation(key any, d time.Duration, del bool) {
+	c.invalidations.mu.Lock()
+	defer c.invalidations.mu.Unlock()
+
+	if p, ok := c.invalidations.pending[key]; ok {
+		p.timer.Stop()
+	}
+	if c.invalidations.pending == nil {
+		c.invalidations.pending = make(map[any]*pendingInvalidation)
+	}
+
+	p := &pendingInvalidation{Invalidation: Invalidation{Key: key, At: c.now().Add(d), Delete: del}}
+	p.timer = time.AfterFunc(d, func() {
+		c.invalidate(p)
+	})
+	c.invalidations.pending[key] = p
+}
+
+// invalidate deletes or expires the key of p, unless it's canceled or replaced
+func (c *Cache) invalidate(p *pendingInvalidation) {
+	c.invalidations.mu.Lock()
+	if c.invalidations.pending[p.Key] != p {
+		c.invalidations.mu.Unlock()
+		return
+	}
+	delete(c.invalidations.pending, p.Key)
+	c.invalidations.mu.Unlock()
+
+	if c.isClosed() {
+		return
+	}
+	if p.Delete {
+		c.Delete(p.Key)
+	} else {
+		c.Expire(p.Key)
+	}
+}
+
+// stopInvalidations cancels all the pending invalidations
+func (c *Cache) stopInvalidations() {
+	c.invalidations.mu.Lock()
+	defer c.invalidations.mu.Unlock()
+
+	for key, p := range c.invalidations.pending {
+		p.timer.Stop()
+		delete(c.invalidations.pending, key)
+	}
+}
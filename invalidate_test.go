@@ -0,0 +1,66 @@
+package lastcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCache_DeleteAfter(t *testing.T) {
+	now = time.Now
+	cache := New(Config{GlobalTTL: time.Hour})
+	defer cache.Close()
+	cache.Set("deleted", "value")
+	cache.Set("expired", "value")
+	cache.Set("canceled", "value")
+
+	cache.DeleteAfter("deleted", 10*time.Millisecond)
+	cache.ExpireAfter("expired", 10*time.Millisecond)
+	cache.DeleteAfter("canceled", 10*time.Millisecond)
+
+	pending := cache.PendingInvalidations()
+	if len(pending) != 3 {
+		t.Fatalf("PendingInvalidations() got %+v, want 3", pending)
+	}
+	for _, inv := range pending {
+		if inv.Delete != (inv.Key != "expired") || inv.At.IsZero() {
+			t.Errorf("invalidation got %+v", inv)
+		}
+	}
+	if !cache.CancelInvalidation("canceled") || cache.CancelInvalidation("canceled") {
+		t.Error("CancelInvalidation() should cancel the pending invalidation once")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := cache.Get("deleted"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(deleted) got %v, want ErrNotFound", err)
+	}
+	if entry, err := cache.Get("expired"); !errors.Is(err, ErrExpired) || !entry.Stale {
+		t.Errorf("Get(expired) got %+v, %v, want the stale entry", entry, err)
+	}
+	if entry, err := cache.Get("canceled"); err != nil || entry.Stale {
+		t.Errorf("Get(canceled) got %+v, %v, want the fresh entry", entry, err)
+	}
+	if pending := cache.PendingInvalidations(); len(pending) != 0 {
+		t.Errorf("PendingInvalidations() got %+v, want none", pending)
+	}
+}
+
+func TestCache_DeleteAfter_Debounce(t *testing.T) {
+	now = time.Now
+	cache := New(Config{GlobalTTL: time.Hour})
+	defer cache.Close()
+	cache.Set("key", "value")
+
+	cache.DeleteAfter("key", 20*time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	cache.DeleteAfter("key", time.Hour)
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := cache.Get("key"); err != nil {
+		t.Errorf("Get() got %v, want the key since the invalidation is rescheduled", err)
+	}
+	if pending := cache.PendingInvalidations(); len(pending) != 1 {
+		t.Errorf("PendingInvalidations() got %+v, want the rescheduled one", pending)
+	}
+}
@@ -0,0 +1,241 @@
+// Package jwks caches the signing keys of a JWKS endpoint
+//
+// The key set is refreshed in background once it's older than Config.RefreshInterval, while the cached keys are served,
+// and the cached keys are kept when the identity provider is down.
+// An unknown kid forces a refresh, at most once per Config.MinRefreshInterval, so rotated keys are picked up immediately.
+//
+//	keys := jwks.New(jwks.Config{URL: "https://idp.example.com/.well-known/jwks.json"})
+//	key, err := keys.Key(ctx, token.Header["kid"])
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+const (
+	defaultRefreshInterval    = time.Hour
+	defaultMinRefreshInterval = time.Minute
+)
+
+// ErrKeyNotFound is returned when the kid is not in the key set, even after a forced refresh
+var ErrKeyNotFound = errors.New("jwks: key not found")
+
+// Config of the KeySet
+type Config struct {
+	// URL of the JWKS endpoint
+	URL string
+
+	// Client used to fetch the key set
+	// Default is http.DefaultClient
+	Client *http.Client
+
+	// RefreshInterval the key set is refreshed in background after this interval
+	// Default is 1h
+	RefreshInterval time.Duration
+
+	// MinRefreshInterval minimum interval between the refreshes forced by unknown kids,
+	// which protects the endpoint from tokens with random kids
+	// Default is 1m
+	MinRefreshInterval time.Duration
+}
+
+// KeySet cached signing keys of a JWKS endpoint
+type KeySet struct {
+	config Config
+	cache  *lastcache.Cache
+
+	mu sync.Mutex
+	// lastForced time of the last forced refresh, guarded by mu
+	lastForced time.Time
+}
+
+// New returns a KeySet, the keys are fetched on the first call
+func New(config Config) *KeySet {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = defaultRefreshInterval
+	}
+	if config.MinRefreshInterval <= 0 {
+		config.MinRefreshInterval = defaultMinRefreshInterval
+	}
+
+	return &KeySet{
+		config: config,
+		cache:  lastcache.New(lastcache.Config{GlobalTTL: config.RefreshInterval, AsyncSemaphore: 1}),
+	}
+}
+
+// Key returns the public key of the kid, which is *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey
+// If the kid is unknown, the key set is fetched again, unless it's fetched within MinRefreshInterval
+func (s *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	keys, err := s.Keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+
+	if keys, err = s.forceRefresh(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: kid %q", ErrKeyNotFound, kid)
+}
+
+// Keys returns the cached keys by kid
+func (s *KeySet) Keys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	entry, _, err := s.cache.AsyncLoadOrStoreWithCtx(ctx, s.config.URL, func(ctx context.Context, _ any, _ *lastcache.Entry) (any, error) {
+		return s.fetch(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry.Value.(map[string]crypto.PublicKey), nil
+}
+
+// Close stops the background refreshes
+func (s *KeySet) Close() {
+	s.cache.Close()
+}
+
+func (s *KeySet) forceRefresh(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// concurrent callers with the same unknown kid wait for the first forced refresh
+	if time.Since(s.lastForced) < s.config.MinRefreshInterval {
+		return s.Keys(ctx)
+	}
+	s.lastForced = time.Now()
+
+	keys, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Set(s.config.URL, keys)
+	return keys, nil
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (s *KeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: unexpected status %d from %s", resp.StatusCode, s.config.URL)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("jwks: decode key set: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// unsupported keys are skipped, so a new key type doesn't break the other keys
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("jwks: unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("jwks: unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("jwks: invalid ed25519 key size %d", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("jwks: unsupported key type %q", k.Kty)
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,155 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type jwksServer struct {
+	mu       sync.Mutex
+	keys     []jsonWebKey
+	down     bool
+	requests int32
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&s.requests, 1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"keys": s.keys})
+}
+
+func (s *jwksServer) set(down bool, keys ...jsonWebKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.down = down
+	s.keys = keys
+}
+
+func rsaJWK(t *testing.T, kid string) (jsonWebKey, *rsa.PublicKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jsonWebKey{
+		Kid: kid,
+		Kty: "RSA",
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}, &key.PublicKey
+}
+
+func ed25519JWK(t *testing.T, kid string) (jsonWebKey, ed25519.PublicKey) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jsonWebKey{
+		Kid: kid,
+		Kty: "OKP",
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(pub),
+	}, pub
+}
+
+func TestKeySet_Key(t *testing.T) {
+	rsaKey, rsaPub := rsaJWK(t, "rsa")
+	edKey, edPub := ed25519JWK(t, "ed")
+	encKey, _ := rsaJWK(t, "enc")
+	encKey.Use = "enc"
+
+	server := &jwksServer{}
+	server.set(false, rsaKey, edKey, encKey)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	keys := New(Config{URL: ts.URL, MinRefreshInterval: time.Hour})
+	defer keys.Close()
+
+	key, err := keys.Key(context.Background(), "rsa")
+	if err != nil || !rsaPub.Equal(key) {
+		t.Errorf("Key(rsa) got %v, %v", key, err)
+	}
+	key, err = keys.Key(context.Background(), "ed")
+	if err != nil || !edPub.Equal(key) {
+		t.Errorf("Key(ed) got %v, %v", key, err)
+	}
+	if _, err = keys.Key(context.Background(), "enc"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Key(enc) err got %v, want %v", err, ErrKeyNotFound)
+	}
+	// the first unknown kid forced a refresh, the next ones are rate limited
+	if _, err = keys.Key(context.Background(), "unknown"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Key(unknown) err got %v, want %v", err, ErrKeyNotFound)
+	}
+	if n := atomic.LoadInt32(&server.requests); n != 2 {
+		t.Errorf("requests got = %v, want 2", n)
+	}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	oldKey, _ := rsaJWK(t, "old")
+	newKey, newPub := rsaJWK(t, "new")
+
+	server := &jwksServer{}
+	server.set(false, oldKey)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	keys := New(Config{URL: ts.URL})
+	defer keys.Close()
+
+	if _, err := keys.Key(context.Background(), "old"); err != nil {
+		t.Fatalf("failed with err: %v", err)
+	}
+
+	// rotated key is fetched on the first unknown kid
+	server.set(false, oldKey, newKey)
+	key, err := keys.Key(context.Background(), "new")
+	if err != nil || !newPub.Equal(key) {
+		t.Errorf("Key(new) got %v, %v", key, err)
+	}
+}
+
+func TestKeySet_StaleIfError(t *testing.T) {
+	rsaKey, rsaPub := rsaJWK(t, "rsa")
+
+	server := &jwksServer{}
+	server.set(false, rsaKey)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	keys := New(Config{URL: ts.URL, RefreshInterval: time.Millisecond})
+	defer keys.Close()
+
+	if _, err := keys.Key(context.Background(), "rsa"); err != nil {
+		t.Fatalf("failed with err: %v", err)
+	}
+
+	server.set(true)
+	time.Sleep(2 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		key, err := keys.Key(context.Background(), "rsa")
+		if err != nil || !rsaPub.Equal(key) {
+			t.Errorf("Key(rsa) got %v, %v, want the cached key", key, err)
+		}
+	}
+}
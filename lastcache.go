@@ -11,7 +11,11 @@ package lastcache
 
 import (
 	"context"
+	"errors"
+	"io"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,13 +25,25 @@ const defaultSemaphore int = 1
 
 var now = time.Now
 
+// NeverExpires expiry of the keys stored by SetForever
+// It's the last second which can be encoded by all the codecs, e.g. JSON supports the years up to 9999
+var NeverExpires = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+// Clock provides the current time, it can be replaced in tests to control the expiry of the keys
+type Clock interface {
+	Now() time.Time
+}
+
 // SyncCallback given key, should return the value
 // true useStale can be used to retrieve the stale cache
-type SyncCallback func(ctx context.Context, key any) (value any, useStale bool, err error)
+// prev holds the stale cache entry if the key is expired, and it's nil if the key doesn't exist
+// which can be used for conditional fetches (e.g. ETag or If-Modified-Since), returning prev.Value if it's not modified
+type SyncCallback func(ctx context.Context, key any, prev *Entry) (value any, useStale bool, err error)
 
 // AsyncCallback given a key, should return the value
 // This will be called in a goroutine, considering the AsyncSemaphore
-type AsyncCallback func(ctx context.Context, key any) (value any, err error)
+// prev holds the stale cache entry if the key is expired, and it's nil if the key doesn't exist
+type AsyncCallback func(ctx context.Context, key any, prev *Entry) (value any, err error)
 
 // Config configuration to construct LastCache
 type Config struct {
@@ -42,16 +58,266 @@ type Config struct {
 	// Unless the GlobalTTL is too high, or the callback is expensive to be called
 	ExtendTTL time.Duration
 
+	// StaleTimeout if set, LoadOrStore of an expired key waits up to this duration for the callback,
+	// then the stale entry is returned while the callback continues in background and updates the cache
+	// The callback context is derived by RefreshContextMode, so it's not canceled when LoadOrStore returns
+	// It can be set per call by LoadOrStoreWithTimeout
+	// If set to 0 LoadOrStore waits for the callback
+	StaleTimeout time.Duration
+
+	// HedgeDelay if set, AsyncLoadOrStore of an expired key waits up to this duration for the background refresh,
+	// so the fresh entry is returned when the upstream is fast, and the stale entry when it's slow, see LoadOrStoreWithin
+	// If set to 0 AsyncLoadOrStore returns the stale entry immediately
+	HedgeDelay time.Duration
+
 	// Number of background callbacks allowed in AsyncLoadOrStore
 	// If set to 0 the default value defaultSemaphore will be used
 	// If you want to use AsyncLoadOrStore this will limit the number of callback calls while cache is expired
 	// If callback is too expensive to run, it's better to set to low value (e.g. 1)
 	// If you are using different callback processes for different keys, you might want to optimize this value or use another instance of LastCache
+	// It can be changed at runtime by SetAsyncSemaphore
 	AsyncSemaphore int
 
+	// Storage the map implementation which holds the entries
+	// Default is StorageSyncMap, StorageSharded can be used for write heavy workloads with millions of keys
+	Storage StorageType
+
+	// Shards number of the shards of StorageSharded, and the number of the striped locks which serialize the writes
+	// Higher values reduce the contention with many cores and keys, at the cost of memory per cache
+	// Default is 256
+	Shards int
+
+	// SyncSemaphore limits the number of concurrent callback calls which the caller waits for,
+	// i.e. SyncCallback and the AsyncCallback of a missing key, across all the keys
+	// Callers wait for a free slot until their context is done
+	// If set to 0 there is no limit
+	SyncSemaphore int
+
 	// Context to be used in lifetime of the Cache instance
 	// Default is context.TODO()
 	Context context.Context
+
+	// RefreshContextMode defines how the context passed to AsyncLoadOrStoreWithCtx is passed to the background refresh
+	// It can be overridden per call by WithRefreshContextMode
+	// Default is RefreshContextDetach, the refresh keeps the values of the context but not its cancellation
+	RefreshContextMode RefreshContextMode
+
+	// CloneFunc if set, will be applied to the cached values before returning them to the caller
+	// This prevents callers from mutating the shared cached value (e.g. slices, maps or pointers)
+	CloneFunc func(value any) any
+
+	// CompressThreshold if set, []byte and string values with this size (in bytes) or bigger will be stored compressed
+	// and decompressed on read, which reduces heap usage for large values at the cost of CPU
+	// If set to 0 compression is disabled
+	CompressThreshold int
+
+	// Compressor to be used when CompressThreshold is set
+	// Default is GzipCompressor
+	Compressor Compressor
+
+	// MaxMemoryBytes if set, the least recently used keys will be evicted when the estimated memory
+	// used by keys and values exceeds this limit
+	// A single value bigger than this limit will not be cached
+	// If set to 0 memory is not limited
+	MaxMemoryBytes int64
+
+	// SizeFunc returns the size of the key and value in bytes, used by MaxMemoryBytes
+	// Value is given as it's stored, which is compressed if CompressThreshold is set
+	// Default is EstimateSize(key) + EstimateSize(value)
+	SizeFunc func(key, value any) int64
+
+	// PriorityFunc if set, returns the eviction priority of the key every time it's stored
+	// Lower priority entries are evicted first by MaxMemoryBytes and memory pressure, see also Cache.SetPriority
+	// Default is PriorityNormal for the new keys
+	PriorityFunc func(key any) Priority
+
+	// Metrics if set, will be called to export cache hits, misses, stale serves and callback latencies
+	Metrics Metrics
+
+	// LatencyBuckets upper bounds of the callback latency histogram buckets in Stats
+	// Default is DefaultLatencyBuckets
+	LatencyBuckets []time.Duration
+
+	// KeyStats enables per-key statistics, which can be retrieved by Cache.KeyStats
+	KeyStats bool
+
+	// BatchRefresh if set, background refreshes of AsyncLoadOrStore are grouped within BatchWindow
+	// and refreshed by a single call to BatchRefresh instead of the AsyncCallback
+	// This reduces the upstream calls when many keys expire around the same time
+	// AsyncCallback is still used when the key doesn't exist
+	// The context of BatchRefresh carries the values of the refresh contexts, and is canceled when all of them are done
+	BatchRefresh BatchRefreshFunc
+
+	// BatchWindow time to wait for more expired keys before calling BatchRefresh
+	// Default is 10ms
+	BatchWindow time.Duration
+
+	// EventsBuffer size of the buffer of Cache.Events channel
+	// If set to 0 events are disabled
+	EventsBuffer int
+
+	// Clock to be used to calculate the expiry of the keys
+	// Default is the system clock, lastcachetest.Clock can be used in tests
+	Clock Clock
+
+	// MemoryCheckInterval if set, heap usage will be checked in this interval in background,
+	// and when it reaches MemoryPressureThreshold of the MemoryLimit, expired entries will be evicted
+	// least recently used first. If there is no expired entry, the least recently used entries will be evicted
+	// The background check stops when Context is done
+	// If set to 0 memory pressure is not checked
+	MemoryCheckInterval time.Duration
+
+	// MemoryLimit in bytes, used to detect memory pressure
+	// If set to 0 the Go runtime memory limit (debug.SetMemoryLimit) will be used, which requires go1.19
+	MemoryLimit int64
+
+	// MemoryPressureThreshold fraction of MemoryLimit considered as memory pressure
+	// If not set or not in (0, 1] range 0.9 will be used
+	MemoryPressureThreshold float64
+
+	// CallbackMiddleware wraps every SyncCallback, e.g. to apply logging, metrics or auth-token injection uniformly
+	// The first middleware is the outermost one, they are applied on every call of the callback
+	CallbackMiddleware []func(next SyncCallback) SyncCallback
+
+	// AsyncCallbackMiddleware wraps every AsyncCallback, including the ones which are called for the missing keys
+	// and the retries of RefreshRetries, see CallbackMiddleware
+	AsyncCallbackMiddleware []func(next AsyncCallback) AsyncCallback
+
+	// RefreshRetries number of times a failed AsyncCallback is retried in background refresh
+	// before the refresh is reported as failed, ErrTombstone and context errors are not retried
+	// The semaphore slot is held while waiting between the attempts
+	RefreshRetries int
+
+	// RefreshRetryBackoff wait before the first retry, doubled on each retry with a random jitter
+	// Default is 100ms
+	RefreshRetryBackoff time.Duration
+
+	// RefreshRetryMaxBackoff upper bound of the wait between retries
+	// Default is 10s
+	RefreshRetryMaxBackoff time.Duration
+
+	// MaxConsecutiveFailures if set, after this many consecutive failed refreshes of a key its stale value is not served
+	// and its ttl is not extended anymore, so permanently broken keys don't hide behind stale data forever
+	// LoadOrStore and AsyncLoadOrStore return the last callback error matching ErrMaxStaleExceeded instead,
+	// AsyncLoadOrStoreMulti leaves such keys out of the entries, and they are still refreshed to recover
+	// The count is reset when a value is stored for the key
+	// If set to 0 the stale values are served regardless of the failures
+	MaxConsecutiveFailures int
+
+	// DeleteAfterFailures if set, the key is deleted after this many consecutive failed refreshes
+	// which span at least DeleteAfterFailingFor, freeing the memory of the keys which will never succeed again
+	// e.g. the resources deleted upstream without the callback returning ErrTombstone
+	// LoadOrStore returns the callback error of the deleted key, and the next load calls the callback as a missing key
+	// If set to 0 the keys are not deleted regardless of the failures
+	DeleteAfterFailures int
+
+	// DeleteAfterFailingFor the minimum duration between the first and the last of the DeleteAfterFailures failures
+	// If set to 0 the key is deleted as soon as it has failed DeleteAfterFailures times
+	DeleteAfterFailingFor time.Duration
+
+	// RefreshJitter if set, the background refresh of each expired entry is delayed by a random offset up to RefreshJitter,
+	// which is fixed per stored value, so the refreshes of the entries stored at the same time are spread out
+	// The entry is served as fresh by AsyncLoadOrStore until its refresh is due, the other methods are not affected
+	RefreshJitter time.Duration
+
+	// Lease if set, is acquired before the background refresh of a stale key (AsyncLoadOrStore, BatchRefresh and Schedule),
+	// so in a multi-instance deployment only one instance refreshes a key at a time, while the others keep serving stale
+	// If the lease is held by another instance the refresh is skipped, and Refresh.Result returns ErrLeaseHeld
+	// If the lease can't be checked (TryAcquire fails), the refresh runs anyway
+	Lease Lease
+
+	// LeaseTTL ttl of the leases, which should be longer than the refreshes take
+	// Default is 30s
+	LeaseTTL time.Duration
+
+	// Encryption if set, the persisted data (snapshots and WAL) is encrypted by AES-GCM with the keys it provides
+	// StaticKey can be used for a single key
+	Encryption KeyProvider
+
+	// WarmFunc if set, will be called by New in background to load the initial key/value pairs
+	// Cache.Warm can be used to wait for the warmup
+	WarmFunc WarmFunc
+
+	// WarmTimeout deadline of the context passed to WarmFunc
+	// If set to 0 there is no deadline other than Context
+	WarmTimeout time.Duration
+
+	// WarmProgress if set, will be called after each warmed up key is stored
+	WarmProgress WarmProgressFunc
+
+	// Watcher if set, is watched in background until Context is done, and its updates replace or invalidate the entries
+	// as soon as they're pushed by the upstream, instead of waiting for their ttl
+	Watcher Watcher
+
+	// OnDegraded if set, is called when the cache becomes degraded or recovers, reported by Health.Degraded
+	// The state is checked every DegradedCheckInterval in background until Context is done
+	// The cache is degraded when the stale serve ratio reaches DegradedStaleRatio or the stale entries reach DegradedStaleEntries,
+	// and recovers when both are below half of their thresholds, so it doesn't flap around the thresholds
+	OnDegraded func(h Health)
+
+	// DegradedStaleRatio stale serve ratio of the last HealthWindow which makes the cache degraded
+	// If set to 0 the ratio is not checked
+	DegradedStaleRatio float64
+
+	// DegradedStaleEntries number of the stale entries which makes the cache degraded
+	// If set to 0 the stale entries are not checked
+	DegradedStaleEntries int
+
+	// DegradedCheckInterval interval of checking the degraded state
+	// Default is 10s
+	DegradedCheckInterval time.Duration
+
+	// StaleBudget staleness budget of the cache, i.e. the sum of the ages of the stale values which can be served
+	// since the cache is created or the statistics are reset, e.g. per SLO period by ResetStats
+	// The remaining budget is reported by Health.StaleBudgetRemaining, it's only reported and not enforced
+	StaleBudget time.Duration
+
+	// KeyStaleBudget staleness budget of each key, reported by KeyStats.StaleBudgetRemaining if KeyStats is enabled
+	KeyStaleBudget time.Duration
+
+	// StaleLogger if set, is called when a stale value is served because the refresh of the key failed,
+	// i.e. by LoadOrStore after a failed callback, or by AsyncLoadOrStore while the last refresh has failed
+	// It's called synchronously, so it should not block
+	StaleLogger func(l StaleLog)
+
+	// StaleLogSampling only the first of every StaleLogSampling stale serves of each key is passed to StaleLogger,
+	// so the logs are not flooded during an upstream outage
+	// Default is 1, i.e. all of them
+	StaleLogSampling int
+
+	// DefaultValue if set, is consulted when the callback of a missing key fails, i.e. there is no stale value to serve
+	// e.g. on a cold start during an outage. If it returns true, its value is returned instead of the error
+	// with the callback error in Entry.Err, and it's not stored so the next call tries the callback again
+	// It's not consulted for ErrTombstone
+	DefaultValue func(key any) (value any, ok bool)
+
+	// PromoteFromParent if set, the entries of the parent served by a child cache are stored in the child, see Cache.Child
+	PromoteFromParent bool
+
+	// TenantFunc if set, returns the tenant of the context, which is combined with the keys passed with a context
+	// (LoadOrStoreWithCtx, AsyncLoadOrStoreWithCtx, ...) as TenantKey, so the tenants sharing the cache can't see each other's entries
+	// The callbacks still receive the keys of the callers. The calls without a tenant fail by ErrNoTenant,
+	// and the calls without a context use Context, see Cache.TenantScope for the other APIs
+	TenantFunc func(ctx context.Context) string
+
+	// TenantQuota if set, returns the quota of the tenant, and the least recently used entries of the tenant which exceed it
+	// are evicted, so a noisy tenant can't evict the entries of the others, lower priority entries are evicted first
+	TenantQuota func(tenant string) Quota
+
+	// StatsNamespace if set, returns the namespace of the key (e.g. its prefix), and the statistics are broken down by
+	// namespace in Stats.Namespaces and NamespaceMetrics. If it's not set the statistics are broken down by tenant if
+	// TenantFunc is set
+	StatsNamespace func(key any) string
+
+	// ShadowRate fraction of the fresh hits (0 to 1) which the callback is also called for in background, to compare
+	// its value with the cached one, so the ttl can be justified by how often the cached values differ from the upstream
+	// The values are compared by ShadowEqual, and the results are reported by Stats.ShadowChecks and Stats.ShadowMismatches
+	// The callbacks are called only if a slot of AsyncSemaphore is free, and their values are not stored
+	ShadowRate float64
+
+	// ShadowEqual reports whether the cached value equals the value of the callback, see ShadowRate
+	// Default is reflect.DeepEqual
+	ShadowEqual func(cached, actual any) bool
 }
 
 // Entry cache entry
@@ -62,55 +328,321 @@ type Entry struct {
 	// Either the cache entry is stale or not
 	Stale bool
 
-	// Holds the underlying error if stale cache is used when using LoadOrStore
-	// In case of using AsyncLoadOrStore this always will be nil and the underlying error will be returned in channel
+	// Version of the cached value, it's increased every time a value is stored in the cache
+	// and can be used with SetIfVersion for optimistic concurrency
+	Version uint64
+
+	// Holds the underlying error if stale cache is used when using LoadOrStore, or Config.DefaultValue is served
+	// In case of using AsyncLoadOrStore this always will be nil and the underlying error will be returned by Refresh.Result
 	Err error
+
+	// Source where the value of the entry comes from
+	Source Source
+
+	// CallbackInvoked whether the callback was called for this call, e.g. false for the stale entries returned by
+	// AsyncLoadOrStore while the callback runs in background
+	CallbackInvoked bool
+
+	// RefreshStatus what happened to the background refresh of the entry by the call of AsyncLoadOrStore,
+	// e.g. whether the call started a new refresh or joined an in-progress one
+	RefreshStatus RefreshStatus
+
+	// Age time since the value is stored, it's set for the prev entry passed to the callbacks,
+	// so they can fetch only the changes since then instead of the whole value (delta fetches)
+	// It's 0 if the time the value is stored is unknown, e.g. restored from a snapshot
+	Age time.Duration
+}
+
+// Source where the value of an Entry comes from
+type Source int
+
+const (
+	// SourceCached the value is served from the cache
+	SourceCached Source = iota
+	// SourceFreshFromCallback the value is returned by the callback
+	SourceFreshFromCallback
+	// SourceStaleFallback the expired value is served from the cache, see Entry.Stale
+	SourceStaleFallback
+	// SourceDefaultValue the value is provided by Config.DefaultValue
+	SourceDefaultValue
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceCached:
+		return "cached"
+	case SourceFreshFromCallback:
+		return "fresh_from_callback"
+	case SourceStaleFallback:
+		return "stale_fallback"
+	case SourceDefaultValue:
+		return "default_value"
+	default:
+		return "unknown"
+	}
 }
 
 // Cache use New function to construct a new Cache
+// The zero value is also ready to use with default Config
 // Must not be copied after first use
 type Cache struct {
-	config      Config
-	ctx         context.Context
-	mapStorage  sync.Map
-	timeStorage sync.Map
-	semaphore   chan bool
+	config        Config
+	initOnce      sync.Once
+	ctx           context.Context
+	cancel        context.CancelFunc
+	closed        int32
+	items         storage
+	semaphore     *limiter
+	syncSemaphore chan bool
+
+	// locks serialize the writes of the keys which need to be atomic with reads (e.g. CompareAndSwap)
+	locks []sync.Mutex
+	// version last assigned version
+	version uint64
+
+	inflightMu sync.Mutex
+	inflight   map[any]*Refresh
+
+	subscribersMu sync.Mutex
+	subscribers   map[any]map[*subscriber]struct{}
+
+	memory memoryTracker
+	// tenants the entries of the tenants with a quota, see Config.TenantQuota
+	tenants tenantTrackers
+
+	stats    *stats
+	keyStats sync.Map
+	// namespaceStats statistics per namespace, see Config.StatsNamespace
+	namespaceStats sync.Map
+
+	events        chan Event
+	droppedEvents uint64
+
+	batcher batcher
+
+	warm warmer
+
+	walMu sync.RWMutex
+	wal   *WAL
+
+	// degraded 1 if the cache is degraded, see Config.OnDegraded
+	degraded int32
+	// forcedDegraded 1 if the cache is switched to serve stale, see SetDegraded
+	forcedDegraded int32
+	// refreshPaused 1 if the background refreshes are paused, see PauseRefresh
+	refreshPaused int32
+
+	// staleLogs number of the stale serves because of errors per key, see Config.StaleLogSampling
+	staleLogs sync.Map
+
+	invalidations invalidations
+
+	// parent the cache to fall back to on miss, see Child
+	parent *Cache
 }
 
 // New returns new Cache, zero value Config can be passed to use default values
 func New(config Config) *Cache {
-	if config.GlobalTTL <= 0 {
-		config.GlobalTTL = defaultTTL
+	return newCache(&Cache{config: config})
+}
+
+// newCache initializes c, its entries are stored in the storage of Config.Storage unless c.items is set
+func newCache(c *Cache) *Cache {
+	if c.config.GlobalTTL <= 0 {
+		c.config.GlobalTTL = defaultTTL
 	}
 
-	c := Cache{
-		config: config,
+	c.lazyInit()
+	if c.config.WarmFunc != nil {
+		c.startWarm()
 	}
 
+	return c
+}
+
+// lazyInit initializes the internals, so zero value Cache is usable as well
+func (c *Cache) lazyInit() {
+	c.initOnce.Do(c.init)
+}
+
+func (c *Cache) init() {
 	c.ctx = context.TODO()
-	if config.Context != nil {
-		c.ctx = config.Context
+	if c.config.Context != nil {
+		c.ctx = c.config.Context
 	}
+	c.ctx, c.cancel = context.WithCancel(c.ctx)
+
+	shards := defaultShards
+	if c.config.Shards > 0 {
+		shards = c.config.Shards
+	}
+	if c.items == nil {
+		c.items = newStorage(c.config.Storage, shards)
+	}
+	c.locks = make([]sync.Mutex, shards)
 
 	semaphore := defaultSemaphore
-	if config.AsyncSemaphore > 0 {
-		semaphore = config.AsyncSemaphore
+	if c.config.AsyncSemaphore > 0 {
+		semaphore = c.config.AsyncSemaphore
+	}
+	c.semaphore = newLimiter(semaphore)
+
+	if c.config.SyncSemaphore > 0 {
+		c.syncSemaphore = make(chan bool, c.config.SyncSemaphore)
+	}
+
+	c.stats = newStats(c.config.LatencyBuckets)
+
+	if c.config.EventsBuffer > 0 {
+		c.events = make(chan Event, c.config.EventsBuffer)
+	}
+
+	if c.config.MemoryCheckInterval > 0 {
+		go c.watchMemoryPressure()
+	}
+
+	if c.config.OnDegraded != nil {
+		go c.watchDegraded()
 	}
-	c.semaphore = make(chan bool, semaphore)
 
-	return &c
+	if c.config.Watcher != nil {
+		go c.watch(c.config.Watcher.Watch(c.ctx))
+	}
 }
 
 // Set sets the value and ttl for a key.
-func (c *Cache) Set(key, value any) {
-	c.mapStorage.Store(key, value)
-	c.timeStorage.Store(key, now().Add(c.config.GlobalTTL))
+// Returns the displaced value and true if the key already existed, either stale or not,
+// so the resources associated with the previous value can be released
+func (c *Cache) Set(key, value any) (prev any, replaced bool) {
+	mu := c.lock(key)
+	mu.Lock()
+	prev, replaced = c.loadStored(key)
+	storedValue, version := c.set(key, value)
+	evicted := c.trackSet(key, storedValue)
+	mu.Unlock()
+
+	c.afterSet(key, value, version, EventSet, evicted)
+	return prev, replaced
+}
+
+// SetForever sets the value for a key which never expires, its expiry is NeverExpires
+// The key is still deleted by Delete, expired by Expire and evicted by the memory limits like the other keys,
+// and is stored with the regular ttl if it's set again by Set or a callback
+func (c *Cache) SetForever(key, value any) (prev any, replaced bool) {
+	mu := c.lock(key)
+	mu.Lock()
+	prev, replaced = c.loadStored(key)
+	storedValue, version := c.setUntil(key, value, NeverExpires)
+	evicted := c.trackSet(key, storedValue)
+	mu.Unlock()
+
+	c.afterSet(key, value, version, EventSet, evicted)
+	return prev, replaced
+}
+
+// Writer persists the value of the key to the source of truth, used by SetThrough
+type Writer func(ctx context.Context, key, value any) error
+
+// SetThrough persists the value by writer first, and sets the value and ttl for the key only if writer succeeds
+// This keeps the cache consistent with the source of truth, the writer error will be returned as is
+func (c *Cache) SetThrough(ctx context.Context, key, value any, writer Writer) error {
+	scoped, err := c.TenantScope(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := writer(ctx, key, value); err != nil {
+		return err
+	}
+
+	c.Set(scoped, value)
+	return nil
 }
 
 // Delete deletes the value for a key.
 func (c *Cache) Delete(key any) {
-	c.mapStorage.Delete(key)
-	c.timeStorage.Delete(key)
+	mu := c.lock(key)
+	mu.Lock()
+	c.delete(key)
+	mu.Unlock()
+
+	c.afterDelete(key, EventDelete)
+}
+
+// Expire expires the key now, so the next load refreshes it while the stale value can still be served
+// Returns false if the key doesn't exist
+func (c *Cache) Expire(key any) bool {
+	mu := c.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	_, ok := c.loadItem(key)
+	c.updateItem(key, func(it *item) {
+		it.expiresAt = c.now().Add(-time.Nanosecond)
+	})
+	return ok
+}
+
+// evict deletes the key because of memory limits
+func (c *Cache) evict(key any) {
+	mu := c.lock(key)
+	mu.Lock()
+	c.delete(key)
+	mu.Unlock()
+
+	c.afterDelete(key, EventEvict)
+}
+
+// set stores the value and ttl with a new version, the lock of the key must be held
+// returns the value as it's stored and its version
+func (c *Cache) set(key, value any) (any, uint64) {
+	return c.setUntil(key, value, c.now().Add(c.ttl()))
+}
+
+// setUntil stores the value with the given expiry and a new version, the lock of the key must be held
+func (c *Cache) setUntil(key, value any, expiresAt time.Time) (any, uint64) {
+	it := &item{
+		value:     c.compress(value),
+		expiresAt: expiresAt,
+		version:   atomic.AddUint64(&c.version, 1),
+		storedAt:  c.now(),
+	}
+	c.storage().Store(key, it)
+	c.logStore(key, value, it.expiresAt)
+	return it.value, it.version
+}
+
+// trackSet tracks the stored value of the key, the lock of the key must be held so a concurrent delete of the key
+// can't untrack it before
+// Returns the keys exceeding the memory limits, which are evicted by afterSet
+func (c *Cache) trackSet(key, storedValue any) []any {
+	c.trackKeyStats(key)
+	evicted := c.trackMemory(key, storedValue)
+	return append(evicted, c.trackQuota(key, storedValue)...)
+}
+
+// afterSet must be called after set and trackSet without holding the lock of the key
+func (c *Cache) afterSet(key, value any, version uint64, eventType EventType, evicted []any) {
+	c.emit(eventType, key, value, nil)
+	c.notify(key, Entry{Value: value, Version: version})
+	for _, k := range evicted {
+		c.evict(k)
+	}
+}
+
+// delete deletes the record of the key and untracks it, the lock of the key must be held
+func (c *Cache) delete(key any) {
+	c.storage().Delete(key)
+	c.logDelete(key)
+	c.memory.remove(key)
+	c.tenants.remove(key)
+	c.keyStats.Delete(key)
+	c.staleLogs.Delete(key)
+}
+
+// afterDelete must be called after delete without holding the lock of the key
+func (c *Cache) afterDelete(key any, eventType EventType) {
+	c.emit(eventType, key, nil, nil)
+	c.notify(key, Entry{Err: ErrNotFound})
 }
 
 // Range calls f sequentially for each key and value and ttl present in the map.
@@ -125,17 +657,110 @@ func (c *Cache) Delete(key any) {
 // Range may be O(N) with the number of elements in the map even if f returns
 // false after a constant number of calls.
 func (c *Cache) Range(f func(key, value any, ttl time.Duration) bool) {
-	c.mapStorage.Range(func(key, value any) bool {
-		return f(key, value, c.TTL(key))
+	c.storage().Range(func(key any, it *item) bool {
+		value, err := c.decompress(it.value)
+		if err != nil {
+			return true
+		}
+		return f(key, c.clone(value), it.expiresAt.Sub(c.now()))
 	})
 }
 
+// RangeEntries calls f sequentially for each key present in the cache with its entry and expiry time
+// Entry.Stale reports whether the key is expired, and Entry.Err holds the last callback error
+// since the value is stored, which is set when the stale value is being served because of failed refreshes
+// If f returns false, range stops the iteration.
+//
+// Range consistency guarantees apply to RangeEntries as well.
+func (c *Cache) RangeEntries(f func(key any, e Entry, expiresAt time.Time) bool) {
+	c.storage().Range(func(key any, it *item) bool {
+		value, err := c.decompress(it.value)
+		if err != nil {
+			return true
+		}
+
+		entry := Entry{
+			Value:   c.clone(value),
+			Stale:   c.now().After(it.expiresAt),
+			Version: it.version,
+			Err:     it.err,
+		}
+		return f(key, entry, it.expiresAt)
+	})
+}
+
+// ExpiringWithin returns the keys which expire within d, including the keys which are already expired
+// This can be used by a warming job to refresh the keys proactively before they expire
+func (c *Cache) ExpiringWithin(d time.Duration) []any {
+	deadline := c.now().Add(d)
+
+	var keys []any
+	c.storage().Range(func(key any, it *item) bool {
+		if !it.expiresAt.After(deadline) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+// SortedKeys returns the keys present in the cache sorted by less function
+// This can be used to iterate the entries in a deterministic order, e.g. for snapshots or paginated listings
+func (c *Cache) SortedKeys(less func(a, b any) bool) []any {
+	var keys []any
+	c.storage().Range(func(key any, _ *item) bool {
+		keys = append(keys, key)
+		return true
+	})
+
+	sort.Slice(keys, func(i, j int) bool {
+		return less(keys[i], keys[j])
+	})
+	return keys
+}
+
+// Get returns the cached entry of the key without calling any callback
+// ErrNotFound will be returned if the key doesn't exist, neither fresh in the parent of a Child cache
+// ErrExpired will be returned with the stale entry if the key is expired
+func (c *Cache) Get(key any) (Entry, error) {
+	v, version, ok := c.loadWithVersion(key)
+	if !ok {
+		if entry, ok := c.loadParent(key); ok {
+			return entry, nil
+		}
+		return Entry{}, ErrNotFound
+	}
+
+	entry := Entry{Value: v, Version: version}
+	if c.checkIfExpired(key) {
+		entry.Stale = true
+		entry.Source = SourceStaleFallback
+		return entry, ErrExpired
+	}
+	return entry, nil
+}
+
+// Close stops the background processes of the cache, and cancels the Context
+// LoadOrStore and AsyncLoadOrStore will return ErrClosed after Close
+func (c *Cache) Close() {
+	c.lazyInit()
+	atomic.StoreInt32(&c.closed, 1)
+	c.cancel()
+	c.stopInvalidations()
+	if closer, ok := c.items.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+func (c *Cache) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
 // TTL returns ttl in duration format. The returned value can be negative as well, which in that case
 // means item is already expired. Positive values are valid items in the cache.
 func (c *Cache) TTL(key any) time.Duration {
-	if v, ok := c.timeStorage.Load(key); ok {
-		d, _ := v.(time.Time)
-		return d.Sub(now())
+	if it, ok := c.loadItem(key); ok {
+		return it.expiresAt.Sub(c.now())
 	}
 	return 0
 }
@@ -157,13 +782,35 @@ func (c *Cache) TTL(key any) time.Duration {
 //			   	entry and nil will be returned
 //	       3.3 if SyncCallback returns error with false useStale,
 //				error will be returned
-func (c *Cache) LoadOrStore(key any, callback SyncCallback) (Entry, error) {
-	return c.loadOrStore(c.context(), key, callback)
+//
+//		SyncCallback errors are returned as CallbackError which matches ErrCallbackFailed by errors.Is
+//	       3.4 if SyncCallback returns ErrTombstone, key will be deleted and error will be returned
+//	       3.5 if SyncCallback doesn't return within Config.StaleTimeout, the stale entry will be returned
+//				and SyncCallback continues in background
+//
+//		The behavior can be overridden per call by CallOption, e.g. WithForceRefresh or WithNoStale
+func (c *Cache) LoadOrStore(key any, callback SyncCallback, opts ...CallOption) (Entry, error) {
+	return c.LoadOrStoreWithCtx(c.context(), key, callback, opts...)
 }
 
 // LoadOrStoreWithCtx check LoadOrStore
-func (c *Cache) LoadOrStoreWithCtx(ctx context.Context, key any, callback SyncCallback) (Entry, error) {
-	return c.loadOrStore(ctx, key, callback)
+func (c *Cache) LoadOrStoreWithCtx(ctx context.Context, key any, callback SyncCallback, opts ...CallOption) (Entry, error) {
+	key, callback, err := c.tenantSync(ctx, key, callback)
+	if err != nil {
+		return Entry{}, err
+	}
+	return c.loadOrStore(ctx, key, callback, newCallOptions(opts))
+}
+
+// LoadOrStoreWithTimeout is LoadOrStore with timeout instead of Config.StaleTimeout
+// If the key is expired and the callback doesn't return within timeout or ctx is done, the stale entry is returned
+// while the callback continues in background and updates the cache
+func (c *Cache) LoadOrStoreWithTimeout(ctx context.Context, key any, timeout time.Duration, callback SyncCallback, opts ...CallOption) (Entry, error) {
+	key, callback, err := c.tenantSync(ctx, key, callback)
+	if err != nil {
+		return Entry{}, err
+	}
+	return c.loadOrStoreTimeout(ctx, key, timeout, callback, newCallOptions(opts))
 }
 
 // AsyncLoadOrStore loads the key from cache with respect to the ttl and runs the callback in background
@@ -176,136 +823,548 @@ func (c *Cache) LoadOrStoreWithCtx(ctx context.Context, key any, callback SyncCa
 //		   2.2 If SyncCallback returns no error, the value will be stored and returned
 //		3. If key is expired, callback will be called in background to replace the value,
 //		   and existing cache will be returned immediately
-//		   a buffered error channel size 1 will be returned if cache is stale,
-//	       nil or error will be sent to the error channel
-func (c *Cache) AsyncLoadOrStore(key any, callback AsyncCallback) (Entry, chan error, error) {
-	return c.asyncLoadOrStore(c.context(), key, callback)
+//		   a Refresh handle will be returned if cache is stale, otherwise it will be nil
+//	       Refresh.Done can be used to wait for the background callback and Refresh.Result to get the outcome
+//	       If a refresh is already in progress for the key, the same Refresh is returned to all callers
+//	       and callback will not be called again
+//	       If Config.HedgeDelay is set, the refresh is waited for up to HedgeDelay, see LoadOrStoreWithin
+//
+//		The behavior can be overridden per call by CallOption, e.g. WithForceRefresh or WithNoStale
+func (c *Cache) AsyncLoadOrStore(key any, callback AsyncCallback, opts ...CallOption) (Entry, *Refresh, error) {
+	return c.LoadOrStoreWithin(c.context(), key, c.config.HedgeDelay, callback, opts...)
 }
 
 // AsyncLoadOrStoreWithCtx check AsyncLoadOrStore
-func (c *Cache) AsyncLoadOrStoreWithCtx(ctx context.Context, key any, callback AsyncCallback) (Entry, chan error, error) {
-	return c.asyncLoadOrStore(ctx, key, callback)
+func (c *Cache) AsyncLoadOrStoreWithCtx(ctx context.Context, key any, callback AsyncCallback, opts ...CallOption) (Entry, *Refresh, error) {
+	return c.LoadOrStoreWithin(ctx, key, c.config.HedgeDelay, callback, opts...)
+}
+
+// LoadOrStoreWithin loads the key from cache with respect to the ttl and waits up to maxWait for fresh data
+//
+//	It behaves like AsyncLoadOrStore, but if the cache is stale:
+//
+//	1. If the background refresh is completed within maxWait, the fresh entry will be returned
+//	   1.1 If the callback returns error, stale entry will be returned with the callback error in entry.Err
+//	2. If maxWait passes or ctx is done, the stale entry will be returned with the Refresh handle
+//	   and the refresh continues in background
+func (c *Cache) LoadOrStoreWithin(ctx context.Context, key any, maxWait time.Duration, callback AsyncCallback, opts ...CallOption) (Entry, *Refresh, error) {
+	key, callback, err := c.tenantAsync(ctx, key, callback)
+	if err != nil {
+		return Entry{}, nil, err
+	}
+	return c.loadOrStoreWithin(ctx, key, maxWait, callback, newCallOptions(opts))
+}
+
+func (c *Cache) loadOrStoreWithin(ctx context.Context, key any, maxWait time.Duration, callback AsyncCallback, o callOptions) (Entry, *Refresh, error) {
+	entry, refresh, err := c.asyncLoadOrStore(ctx, key, callback, o)
+	if err != nil || refresh == nil {
+		return entry, refresh, err
+	}
+	if o.noStale && entry.Stale {
+		select {
+		case <-refresh.Done():
+		case <-ctx.Done():
+			return Entry{}, refresh, ctx.Err()
+		}
+		fresh, err := refresh.Result()
+		if err != nil {
+			return Entry{}, nil, err
+		}
+		fresh.RefreshStatus = entry.RefreshStatus
+		return fresh, nil, nil
+	}
+	if maxWait <= 0 {
+		return entry, refresh, nil
+	}
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	select {
+	case <-refresh.Done():
+		fresh, err := refresh.Result()
+		if err != nil {
+			entry.Err = callbackCause(err)
+			entry.CallbackInvoked = true
+			return entry, nil, nil
+		}
+		fresh.RefreshStatus = entry.RefreshStatus
+		return fresh, nil, nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	return entry, refresh, nil
 }
 
-func (c *Cache) asyncLoadOrStore(ctx context.Context, key any, callback AsyncCallback) (Entry, chan error, error) {
+func (c *Cache) asyncLoadOrStore(ctx context.Context, key any, callback AsyncCallback, o callOptions) (Entry, *Refresh, error) {
 	var err error
 	var entry Entry
 
-	v, ok := c.timeStorage.Load(key)
+	if c.isClosed() {
+		return entry, nil, ErrClosed
+	}
+	if c.IsDegraded() {
+		entry, err = c.loadDegraded(key, o)
+		return entry, nil, err
+	}
+
+	it, ok := c.loadItem(key)
 	if !ok {
+		if entry, ok := c.loadParent(key); ok {
+			c.recordHit(key)
+			return entry, nil, nil
+		}
 		var newValue any
 		// first time miss
-		newValue, err = callback(ctx, key)
+		c.recordMiss(key)
+		newValue, err = c.callAsync(ctx, key, nil, callback, CallbackSync)
 		if err != nil {
-			return entry, nil, err
+			if def, ok := c.defaultEntry(key, err); ok {
+				return def, nil, nil
+			}
+			return entry, nil, callbackError(key, err)
 		}
 
 		// store cache
-		c.Set(key, newValue)
-		entry.Value = newValue
+		entry = c.storeFor(key, newValue, o.ttl)
+		c.recordStoredMiss(key)
 		return entry, nil, nil
 	}
 
-	d, _ := v.(time.Time)
-	var ch chan error
-	if now().After(d) { // expired
-		ch = make(chan error, 1)
-		go c.updateCache(ctx, key, callback, ch)
+	var refresh *Refresh
+	if o.forceRefresh || c.refreshDue(key, it) { // expired, considering the refresh jitter
+		if !c.RefreshPaused() {
+			var refreshCtx context.Context
+			var started bool
+			// concurrent callers of the same key share the in-progress refresh
+			refresh, refreshCtx, started = c.startRefresh(ctx, key)
+			entry.RefreshStatus = c.refreshStatus(started)
+			if started && c.config.BatchRefresh != nil {
+				c.enqueueBatch(refreshCtx, key, refresh, o)
+			} else if started {
+				go c.updateCache(refreshCtx, key, callback, refresh, o)
+			}
+		} else {
+			entry.RefreshStatus = RefreshSkipped
+		}
+		if it.failures > 0 && c.exhausted(key) {
+			c.recordMiss(key)
+			return entry, refresh, callbackError(key, &maxStaleError{err: it.err})
+		}
 		entry.Stale = true
+		entry.Source = SourceStaleFallback
+		c.recordStaleServe(key, c.now().Sub(it.expiresAt))
+		c.logStaleServe(key, c.now().Sub(it.expiresAt), it.err)
+	} else {
+		c.recordHit(key)
 	}
 
-	v, _ = c.mapStorage.Load(key)
-	entry.Value = v
-	return entry, ch, nil
+	// the record loaded above is used, so a fresh hit is served by a single lookup
+	entry.Value, _ = c.itemValue(key, it)
+	entry.Version = it.version
+	if entry.Stale {
+		c.emit(EventStaleServe, key, entry.Value, nil)
+	} else if c.shadowSampled() {
+		c.shadowAsync(ctx, key, entry.Value, callback)
+	}
+	return entry, refresh, nil
+}
+
+func (c *Cache) loadOrStore(ctx context.Context, key any, callback SyncCallback, o callOptions) (Entry, error) {
+	return c.loadOrStoreTimeout(ctx, key, c.config.StaleTimeout, callback, o)
 }
 
-func (c *Cache) loadOrStore(ctx context.Context, key any, callback SyncCallback) (Entry, error) {
+func (c *Cache) loadOrStoreTimeout(ctx context.Context, key any, timeout time.Duration, callback SyncCallback, o callOptions) (Entry, error) {
 	var newValue any
 	var err error
 	var entry Entry
 
-	v, ok := c.timeStorage.Load(key)
+	if c.isClosed() {
+		return entry, ErrClosed
+	}
+	if c.IsDegraded() {
+		return c.loadDegraded(key, o)
+	}
+
+	it, ok := c.loadItem(key)
 	if !ok {
+		if entry, ok := c.loadParent(key); ok {
+			c.recordHit(key)
+			return entry, nil
+		}
 		// first time miss
-		newValue, _, err = callback(ctx, key)
+		c.recordMiss(key)
+		newValue, _, err = c.callSync(ctx, key, nil, callback)
 		if err != nil {
-			return entry, err
+			if def, ok := c.defaultEntry(key, err); ok {
+				return def, nil
+			}
+			return entry, callbackError(key, err)
 		}
 
 		// store cache
-		c.Set(key, newValue)
-		entry.Value = newValue
+		entry = c.storeFor(key, newValue, o.ttl)
+		c.recordStoredMiss(key)
 		return entry, nil
 	}
 
-	d, _ := v.(time.Time)
-	if now().After(d) { // expired
-		var useStale bool
-		newValue, useStale, err = callback(ctx, key)
-		if err == nil {
-			// store cache and set new ttl
-			c.Set(key, newValue)
-			entry.Value = newValue
-			return entry, nil
+	if o.forceRefresh || c.now().After(it.expiresAt) { // expired
+		c.recordMiss(key)
+		if o.noStale {
+			timeout = 0
+		}
+		// the refresh of the key which is in progress, either in background or by another LoadOrStore, is joined
+		// instead of calling the callback again
+		if refresh := c.inflightRefresh(key); refresh != nil && !o.forceRefresh {
+			return c.joinRefresh(ctx, key, refresh, timeout, o)
 		}
+		return c.loadExpired(ctx, key, it, timeout, callback, o)
+	}
+
+	c.recordHit(key)
+	// the record loaded above is used, so a fresh hit is served by a single lookup
+	entry.Value, _ = c.itemValue(key, it)
+	entry.Version = it.version
+	if c.shadowSampled() {
+		c.shadowSync(ctx, key, entry.Value, callback)
+	}
+	return entry, nil
+}
+
+// loadExpired calls the callback of the expired key, and serves the stale entry if it fails and useStale is returned
+// The call is registered as the refresh of the key, so the concurrent loads of the key join it
+// The callback gets the refresh context (see RefreshContextMode), so the cancellation of the caller doesn't fail
+// the loads which joined it
+// If timeout is set and the callback doesn't return within it, the stale entry is served while the callback
+// continues in background and updates the cache
+func (c *Cache) loadExpired(ctx context.Context, key any, it *item, timeout time.Duration, callback SyncCallback, o callOptions) (Entry, error) {
+	refresh, callbackCtx, started := c.startRefresh(ctx, key)
+	if !started {
+		return c.joinRefresh(ctx, key, refresh, timeout, o)
+	}
+	if timeout <= 0 {
+		newValue, useStale, err := c.callSync(callbackCtx, key, c.prevEntry(key), callback)
+		entry, resultErr := c.expiredResult(key, it, newValue, useStale, err, o)
+		c.completeSync(key, refresh, entry, useStale, err)
+		return entry, resultErr
+	}
+
+	type result struct {
+		value    any
+		useStale bool
+		err      error
+	}
+	results := make(chan result, 1)
+	go func() {
+		value, useStale, err := c.callSync(callbackCtx, key, c.prevEntry(key), callback)
+		results <- result{value: value, useStale: useStale, err: err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		entry, err := c.expiredResult(key, it, r.value, r.useStale, r.err, o)
+		c.completeSync(key, refresh, entry, r.useStale, r.err)
+		return entry, err
+	case <-timer.C:
+	case <-ctx.Done():
+	}
 
-		if !useStale {
-			return entry, err
+	go func() {
+		r := <-results
+		var entry Entry
+		if r.err == nil {
+			entry = c.storeFor(key, r.value, o.ttl)
+		} else if !c.isTombstone(key, r.err) {
+			c.storeErr(key, r.err)
 		}
+		c.completeSync(key, refresh, entry, r.useStale, r.err)
+	}()
 
-		entry.Stale = true
-		entry.Err = err
+	if it.failures > 0 && c.exhausted(key) {
+		return Entry{}, callbackError(key, &maxStaleError{err: it.err})
+	}
+	entry := Entry{Stale: true, Source: SourceStaleFallback, CallbackInvoked: true, Version: it.version, Err: it.err}
+	entry.Value, _ = c.itemValue(key, it)
+	c.recordStaleServe(key, c.now().Sub(it.expiresAt))
+	c.logStaleServe(key, c.now().Sub(it.expiresAt), it.err)
+	c.emit(EventStaleServe, key, entry.Value, entry.Err)
+	return entry, nil
+}
+
+// completeSync completes the refresh registered by loadExpired with the stored entry or the callback error
+func (c *Cache) completeSync(key any, refresh *Refresh, entry Entry, useStale bool, err error) {
+	c.untrackRefresh(key, refresh)
+	if err != nil {
+		refresh.noStale = !useStale
+		refresh.complete(Entry{}, callbackError(key, err))
+		return
+	}
+	refresh.complete(entry, nil)
+}
+
+// joinRefresh waits for the refresh of the expired key which is already in progress instead of calling the callback
+// The stale entry is served if the refresh fails, or it's not completed within timeout or ctx is done
+func (c *Cache) joinRefresh(ctx context.Context, key any, refresh *Refresh, timeout time.Duration, o callOptions) (Entry, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
 	}
 
+	var err error
+	select {
+	case <-refresh.Done():
+		var fresh Entry
+		if fresh, err = refresh.Result(); err == nil {
+			fresh.CallbackInvoked = false
+			fresh.RefreshStatus = RefreshCoalesced
+			return fresh, nil
+		}
+		if !errors.Is(err, ErrLeaseHeld) {
+			err = callbackCause(err)
+		}
+	case <-expired:
+	case <-ctx.Done():
+		if o.noStale {
+			return Entry{}, ctx.Err()
+		}
+	}
+
+	it, ok := c.loadItem(key)
+	if !ok || o.noStale || refresh.noStale {
+		if err == nil {
+			err = ErrNotFound
+		}
+		return Entry{}, callbackError(key, err)
+	}
+	if it.failures > 0 && c.exhausted(key) {
+		return Entry{}, callbackError(key, &maxStaleError{err: it.err})
+	}
+	if err == nil {
+		err = it.err
+	}
+	entry := Entry{Stale: true, Source: SourceStaleFallback, RefreshStatus: RefreshCoalesced, Version: it.version, Err: err}
+	entry.Value, _ = c.itemValue(key, it)
+	c.recordStaleServe(key, c.now().Sub(it.expiresAt))
+	c.logStaleServe(key, c.now().Sub(it.expiresAt), err)
+	c.emit(EventStaleServe, key, entry.Value, entry.Err)
+	return entry, nil
+}
+
+// expiredResult stores the outcome of the callback of the expired key, see LoadOrStore
+func (c *Cache) expiredResult(key any, it *item, newValue any, useStale bool, err error, o callOptions) (Entry, error) {
+	var entry Entry
+	if err == nil {
+		// store cache and set new ttl
+		return c.storeFor(key, newValue, o.ttl), nil
+	}
+
+	if c.isTombstone(key, err) {
+		return entry, callbackError(key, err)
+	}
+
+	if c.storeErr(key, err) {
+		return entry, callbackError(key, err)
+	}
+	if c.exhausted(key) {
+		return entry, callbackError(key, &maxStaleError{err: err})
+	}
+	if !useStale || o.noStale {
+		return entry, callbackError(key, err)
+	}
+
+	entry.Stale = true
+	entry.Source = SourceStaleFallback
+	entry.CallbackInvoked = true
+	entry.Err = err
+	c.recordStaleServe(key, c.now().Sub(it.expiresAt))
+	c.logStaleServe(key, c.now().Sub(it.expiresAt), err)
+
 	// extend stale cache ttl
-	if entry.Stale && c.config.ExtendTTL > 0 {
+	if c.config.ExtendTTL > 0 && !o.noExtend {
 		c.updateTTL(key, c.config.ExtendTTL)
 	}
 
-	v, _ = c.mapStorage.Load(key)
-	entry.Value = v
+	// the key might be updated while the callback was running, so the latest stale value is served
+	if latest, ok := c.loadItem(key); ok {
+		it = latest
+	}
+	entry.Value, _ = c.itemValue(key, it)
+	entry.Version = it.version
+	c.emit(EventStaleServe, key, entry.Value, entry.Err)
 	return entry, nil
 }
 
 func (c *Cache) checkIfExpired(key any) bool {
-	v, ok := c.timeStorage.Load(key)
+	it, ok := c.loadItem(key)
 	if !ok {
 		return true
 	}
-
-	d, _ := v.(time.Time)
-	return now().After(d)
+	return c.now().After(it.expiresAt)
 }
 
-func (c *Cache) updateCache(ctx context.Context, key any, callback AsyncCallback, errChan chan error) {
-	c.semaphore <- true
+func (c *Cache) updateCache(ctx context.Context, key any, callback AsyncCallback, refresh *Refresh, o callOptions) {
+	c.lazyInit()
+	// wait for a free slot unless the refresh is canceled meanwhile
+	if !c.semaphore.acquire(ctx.Done()) {
+		c.untrackRefresh(key, refresh)
+		refresh.complete(Entry{}, ctx.Err())
+		return
+	}
+
+	var entry Entry
 	var err error
 	defer func() {
-		<-c.semaphore
-		errChan <- err
+		c.semaphore.release()
+		c.untrackRefresh(key, refresh)
+		if !errors.Is(err, ErrLeaseHeld) {
+			err = callbackError(key, err)
+		}
+		refresh.complete(entry, err)
 	}()
 
 	// only execute callback if cache is expired
-	if !c.checkIfExpired(key) {
+	if !o.forceRefresh && !c.checkIfExpired(key) {
+		entry.Value, entry.Version, _ = c.loadWithVersion(key)
 		return
 	}
 
 	// extend stale cache ttl
-	if c.config.ExtendTTL > 0 {
-		c.updateTTL(key, c.config.ExtendTTL)
+	if !o.noExtend {
+		c.extendStale(key)
+	}
+
+	release, acquired := c.acquireLease(ctx, key)
+	if !acquired {
+		entry.Value, entry.Version, _ = c.loadWithVersion(key)
+		entry.Stale = true
+		entry.Source = SourceStaleFallback
+		err = ErrLeaseHeld
+		return
 	}
+	defer release()
 
-	newValue, err := callback(ctx, key)
+	newValue, err := c.callAsyncWithRetry(ctx, key, callback)
 	if err == nil {
 		// store cache and set new ttl
-		c.Set(key, newValue)
+		entry = c.storeFor(key, newValue, o.ttl)
+		return
+	}
+
+	if !c.isTombstone(key, err) {
+		c.storeErr(key, err)
+	}
+}
+
+// prevEntry returns the stale entry to be passed to callbacks, with the age of its value
+func (c *Cache) prevEntry(key any) *Entry {
+	it, ok := c.loadItem(key)
+	if !ok {
+		return nil
+	}
+	v, ok := c.itemValue(key, it)
+	if !ok {
+		return nil
+	}
+	prev := &Entry{Value: v, Stale: true, Version: it.version}
+	if !it.storedAt.IsZero() {
+		prev.Age = c.now().Sub(it.storedAt)
+	}
+	return prev
+}
+
+// loadWithVersion returns the cached value as in load, with its version
+func (c *Cache) loadWithVersion(key any) (any, uint64, bool) {
+	it, ok := c.loadItem(key)
+	if !ok {
+		return nil, 0, false
+	}
+
+	v, ok := c.itemValue(key, it)
+	return v, it.version, ok
+}
+
+// itemValue returns the value of the loaded record, decompressed and cloned by Config.CloneFunc if it's set
+func (c *Cache) itemValue(key any, it *item) (any, bool) {
+	v, err := c.decompress(it.value)
+	if err != nil {
+		return nil, false
+	}
+
+	if c.memoryTracked() {
+		c.memory.touch(key)
+	}
+	c.touchQuota(key)
+	return c.clone(v), true
+}
+
+func (c *Cache) loadVersion(key any) uint64 {
+	if it, ok := c.loadItem(key); ok {
+		return it.version
+	}
+	return 0
+}
+
+// loadStored returns the decompressed stored value without cloning
+func (c *Cache) loadStored(key any) (any, bool) {
+	it, ok := c.loadItem(key)
+	if !ok {
+		return nil, false
+	}
+
+	v, err := c.decompress(it.value)
+	if err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+func (c *Cache) clone(value any) any {
+	if c.config.CloneFunc == nil || value == nil {
+		return value
+	}
+	return c.config.CloneFunc(value)
+}
+
+// acquireSync waits for a free SyncSemaphore slot unless ctx is done
+func (c *Cache) acquireSync(ctx context.Context) error {
+	if c.syncSemaphore == nil {
+		return nil
+	}
+	select {
+	case c.syncSemaphore <- true:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Cache) releaseSync() {
+	if c.syncSemaphore != nil {
+		<-c.syncSemaphore
 	}
 }
 
 func (c *Cache) context() context.Context {
+	c.lazyInit()
 	return c.ctx
 }
 
-func (c *Cache) updateTTL(key any, ttl time.Duration) {
-	c.timeStorage.Store(key, now().Add(ttl))
+func (c *Cache) now() time.Time {
+	if c.config.Clock != nil {
+		return c.config.Clock.Now()
+	}
+	return now()
+}
+
+// ttl returns Config.GlobalTTL, or defaultTTL if it's not set
+func (c *Cache) ttl() time.Duration {
+	if c.config.GlobalTTL <= 0 {
+		return defaultTTL
+	}
+	return c.config.GlobalTTL
 }
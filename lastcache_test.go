@@ -1,9 +1,11 @@
 package lastcache
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"reflect"
+	"sort"
 	"sync"
 	"testing"
 	"time"
@@ -111,7 +113,7 @@ func TestCache_Set_LoadOrStore_Expired(t *testing.T) {
 				value:      "value",
 				beforeTime: func() time.Time { return fixedTime() },
 				afterTime:  func() time.Time { return fixedTime().Add(10 * time.Millisecond) },
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					return nil, true, errors.New("unavailable")
 				},
 			},
@@ -130,7 +132,7 @@ func TestCache_Set_LoadOrStore_Expired(t *testing.T) {
 				value:      "value",
 				beforeTime: func() time.Time { return fixedTime() },
 				afterTime:  func() time.Time { return fixedTime().Add(10 * time.Millisecond) },
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					return "value2", false, nil
 				},
 			},
@@ -149,7 +151,7 @@ func TestCache_Set_LoadOrStore_Expired(t *testing.T) {
 				value:      "value",
 				beforeTime: func() time.Time { return fixedTime() },
 				afterTime:  func() time.Time { return fixedTime().Add(10 * time.Millisecond) },
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					return "value2", false, nil
 				},
 			},
@@ -169,7 +171,7 @@ func TestCache_Set_LoadOrStore_Expired(t *testing.T) {
 				value:      "value",
 				beforeTime: func() time.Time { return fixedTime() },
 				afterTime:  func() time.Time { return fixedTime().Add(10 * time.Millisecond) },
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					return "value2", false, nil
 				},
 			},
@@ -226,7 +228,7 @@ func TestCache_Set_LoadOrStore_NonExpired(t *testing.T) {
 			args: args{
 				key:   "storeKey",
 				value: "value",
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					return nil, true, errors.New("unavailable")
 				},
 			},
@@ -243,7 +245,7 @@ func TestCache_Set_LoadOrStore_NonExpired(t *testing.T) {
 			args: args{
 				key:   "storeKey",
 				value: "value",
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					return nil, false, errors.New("unavailable")
 				},
 			},
@@ -260,7 +262,7 @@ func TestCache_Set_LoadOrStore_NonExpired(t *testing.T) {
 			args: args{
 				key:   "storeKey",
 				value: "value",
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					return "value", false, nil
 				},
 			},
@@ -318,7 +320,7 @@ func TestCache_Set_LoadOrStore_InvalidKey(t *testing.T) {
 				storeKey:  "storeKey",
 				lookupKey: "key2",
 				value:     "value",
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					return nil, false, errors.New("unavailable")
 				},
 			},
@@ -335,11 +337,11 @@ func TestCache_Set_LoadOrStore_InvalidKey(t *testing.T) {
 				storeKey:  "storeKey",
 				lookupKey: "key2",
 				value:     "value",
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					return "value for key2", false, nil
 				},
 			},
-			want:    Entry{Value: "value for key2"},
+			want:    Entry{Value: "value for key2", Version: 2, Source: SourceFreshFromCallback, CallbackInvoked: true},
 			wantErr: false,
 		},
 		{
@@ -353,11 +355,11 @@ func TestCache_Set_LoadOrStore_InvalidKey(t *testing.T) {
 				storeKey:  "key",
 				lookupKey: "key",
 				value:     "value",
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					return nil, true, errors.New("unavailable")
 				},
 			},
-			want:    Entry{Value: "value", Stale: true, Err: errors.New("unavailable")},
+			want:    Entry{Value: "value", Stale: true, Version: 1, Err: errors.New("unavailable"), Source: SourceStaleFallback, CallbackInvoked: true},
 			wantErr: false,
 		},
 	}
@@ -410,7 +412,7 @@ func TestCache_LoadOrStore(t *testing.T) {
 			},
 			args: args{
 				key: "storeKey",
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					return nil, false, errors.New("unavailable")
 				},
 			},
@@ -426,7 +428,7 @@ func TestCache_LoadOrStore(t *testing.T) {
 			},
 			args: args{
 				key: "storeKey",
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					return "value", false, nil
 				},
 			},
@@ -484,7 +486,7 @@ func TestCache_LoadOrStore_NrCalls(t *testing.T) {
 				value:      "value",
 				beforeTime: func() time.Time { return fixedTime() },
 				firstTime:  func() time.Time { return fixedTime().Add(10 * time.Millisecond) },
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					nrCalls++
 					return nil, true, errors.New("unavailable")
 				},
@@ -506,7 +508,7 @@ func TestCache_LoadOrStore_NrCalls(t *testing.T) {
 				value:      "value",
 				beforeTime: func() time.Time { return fixedTime() },
 				firstTime:  func() time.Time { return fixedTime().Add(10 * time.Millisecond) },
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					nrCalls++
 					return nil, true, errors.New("unavailable")
 				},
@@ -529,7 +531,7 @@ func TestCache_LoadOrStore_NrCalls(t *testing.T) {
 				beforeTime: func() time.Time { return fixedTime() },
 				firstTime:  func() time.Time { return fixedTime().Add(10 * time.Millisecond) },
 				secondTime: func() time.Time { return fixedTime().Add(16 * time.Millisecond) },
-				callback: func(ctx context.Context, key any) (any, bool, error) {
+				callback: func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					nrCalls++
 					return nil, true, errors.New("unavailable")
 				},
@@ -675,6 +677,64 @@ func TestCache_Expiry(t *testing.T) {
 	}
 }
 
+func TestCache_Expire(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute})
+	cache.Set("key", "value")
+
+	if !cache.Expire("key") {
+		t.Errorf("Expire() got false, want true")
+	}
+	if entry, err := cache.Get("key"); !errors.Is(err, ErrExpired) || entry.Value != "value" {
+		t.Errorf("Get() got %+v, %v, want stale value", entry, err)
+	}
+	if cache.Expire("missing") {
+		t.Errorf("Expire() of missing key got true, want false")
+	}
+}
+
+func TestCache_SetForever(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute})
+
+	now = func() time.Time { return fixedTime() }
+	if _, replaced := cache.SetForever("key", "value"); replaced {
+		t.Errorf("SetForever() got replaced, want new key")
+	}
+
+	now = func() time.Time { return fixedTime().Add(100 * 365 * 24 * time.Hour) }
+	entry, err := cache.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		t.Error("callback must not be called")
+		return nil, false, nil
+	})
+	if err != nil || entry.Value != "value" || entry.Stale {
+		t.Errorf("LoadOrStore() got %+v, %v, want the fresh value", entry, err)
+	}
+
+	var buf bytes.Buffer
+	if err = cache.Snapshot(&buf, "json"); err != nil {
+		t.Fatal(err)
+	}
+	restored := New(Config{})
+	if _, err = restored.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored.RangeEntries(func(key any, e Entry, expiresAt time.Time) bool {
+		if !expiresAt.Equal(NeverExpires) {
+			t.Errorf("restored expiry got %v, want NeverExpires", expiresAt)
+		}
+		return true
+	})
+
+	cache.Set("key", "value")
+	if ttl := cache.TTL("key"); ttl != time.Minute {
+		t.Errorf("TTL() after Set got %v, want the regular ttl", ttl)
+	}
+	cache.SetForever("key", "value")
+	cache.Delete("key")
+	if _, err = cache.Get("key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete got %v, want ErrNotFound", err)
+	}
+}
+
 func TestCache_Delete(t *testing.T) {
 	type fields struct {
 		config Config
@@ -714,11 +774,11 @@ func TestCache_Delete(t *testing.T) {
 
 			c.Delete(tt.args.key)
 
-			_, ok := c.mapStorage.Load(tt.args.key)
+			_, ok := storedValue(c, tt.args.key)
 			if !reflect.DeepEqual(ok, tt.want) {
 				t.Errorf("LoadOrStore() got = %v, want %v", ok, tt.want)
 			}
-			_, ok = c.timeStorage.Load(tt.args.key)
+			_, ok = storedValue(c, tt.args.key)
 			if !reflect.DeepEqual(ok, tt.want) {
 				t.Errorf("LoadOrStore() got = %v, want %v", ok, tt.want)
 			}
@@ -786,7 +846,7 @@ func TestCache_LoadOrStore_Race(t *testing.T) {
 		for i := 0; i < 100; i++ {
 			go func() {
 				c.Set(key, value)
-				c.LoadOrStore(key, func(ctx context.Context, key any) (any, bool, error) {
+				c.LoadOrStore(key, func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 					return value, false, nil
 				})
 				c.TTL(key)
@@ -802,7 +862,7 @@ func TestCache_AsyncLoadOrStoreNonExistingKey(t *testing.T) {
 	key := "key"
 	val := "value"
 
-	callback := func(_ context.Context, key any) (value any, err error) {
+	callback := func(_ context.Context, key any, prev *Entry) (value any, err error) {
 		return val, nil
 	}
 
@@ -829,7 +889,7 @@ func TestCache_AsyncLoadOrStoreNonExistingKey(t *testing.T) {
 func TestCache_AsyncLoadOrStoreNonExistingKeyWithError(t *testing.T) {
 	key := "key"
 
-	callback := func(_ context.Context, key any) (value any, err error) {
+	callback := func(_ context.Context, key any, prev *Entry) (value any, err error) {
 		return nil, errors.New("not found")
 	}
 
@@ -853,7 +913,7 @@ func TestCache_AsyncLoadOrStore(t *testing.T) {
 	key := "key"
 	val := "value"
 
-	callback := func(_ context.Context, key any) (value any, err error) {
+	callback := func(_ context.Context, key any, prev *Entry) (value any, err error) {
 		time.Sleep(5 * time.Millisecond)
 		return "new_value", nil
 	}
@@ -873,7 +933,7 @@ func TestCache_AsyncLoadOrStore(t *testing.T) {
 	// GlobalTTL + 1 makes cache expired
 	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
 
-	entry, ch, err := cache.AsyncLoadOrStore(key, callback)
+	entry, refresh, err := cache.AsyncLoadOrStore(key, callback)
 	if err != nil {
 		t.Errorf("failed with err: %v", err)
 	}
@@ -888,7 +948,7 @@ func TestCache_AsyncLoadOrStore(t *testing.T) {
 
 	//////////// time 2
 	// 11 + 5(callback time) + 1
-	<-ch
+	<-refresh.Done()
 	now = func() time.Time { return fixedTime().Add(17 * time.Millisecond) }
 
 	entry, _, err = cache.AsyncLoadOrStore(key, callback)
@@ -909,7 +969,7 @@ func TestCache_AsyncLoadOrStoreWithContext(t *testing.T) {
 	key := "key"
 	val := "value"
 
-	callback := func(ctx context.Context, key any) (value any, err error) {
+	callback := func(ctx context.Context, key any, prev *Entry) (value any, err error) {
 		select {
 		case <-ctx.Done():
 			return nil, errors.New("context canceled")
@@ -938,7 +998,7 @@ func TestCache_AsyncLoadOrStoreWithContext(t *testing.T) {
 
 	cancel() // cancel the context, so callback will return error
 
-	entry, ch, err := cache.AsyncLoadOrStore(key, callback)
+	entry, refresh, err := cache.AsyncLoadOrStore(key, callback)
 	if err != nil {
 		t.Errorf("failed with err: %v", err)
 	}
@@ -952,8 +1012,8 @@ func TestCache_AsyncLoadOrStoreWithContext(t *testing.T) {
 	}
 
 	//////////// time 2
-	if ch != nil {
-		if err := <-ch; err == nil {
+	if refresh != nil {
+		if _, err := refresh.Result(); err == nil {
 			t.Errorf("err is nil")
 		}
 	}
@@ -978,11 +1038,11 @@ func TestCache_AsyncLoadOrStoreConcurrentOneSemaphore(t *testing.T) {
 	key := "key"
 	val := "value"
 
-	callbackFirst := func(_ context.Context, key any) (value any, err error) {
+	callbackFirst := func(_ context.Context, key any, prev *Entry) (value any, err error) {
 		return "new_value_1", nil
 	}
 
-	callbackSecond := func(_ context.Context, key any) (value any, err error) {
+	callbackSecond := func(_ context.Context, key any, prev *Entry) (value any, err error) {
 		return "new_value_2", nil
 	}
 
@@ -1002,7 +1062,7 @@ func TestCache_AsyncLoadOrStoreConcurrentOneSemaphore(t *testing.T) {
 	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
 
 	// first call
-	entry, ch1, err := cache.AsyncLoadOrStore(key, callbackFirst)
+	entry, r1, err := cache.AsyncLoadOrStore(key, callbackFirst)
 	if err != nil {
 		t.Errorf("failed with err: %v", err)
 	}
@@ -1016,8 +1076,8 @@ func TestCache_AsyncLoadOrStoreConcurrentOneSemaphore(t *testing.T) {
 	}
 
 	// second call
-	var ch2 chan error
-	entry, ch2, err = cache.AsyncLoadOrStore(key, callbackSecond)
+	var r2 *Refresh
+	entry, r2, err = cache.AsyncLoadOrStore(key, callbackSecond)
 	if err != nil {
 		t.Errorf("failed with err: %v", err)
 	}
@@ -1032,8 +1092,8 @@ func TestCache_AsyncLoadOrStoreConcurrentOneSemaphore(t *testing.T) {
 
 	//////////// time 2
 	// 11 + 5(callback time) + 1
-	<-ch1
-	<-ch2 // to avoid rc in tests because of `now`
+	<-r1.Done()
+	<-r2.Done() // to avoid rc in tests because of `now`
 	now = func() time.Time { return fixedTime().Add(17 * time.Millisecond) }
 
 	entry, _, err = cache.AsyncLoadOrStore(key, callbackFirst)
@@ -1054,11 +1114,11 @@ func TestCache_AsyncLoadOrStoreConcurrentTwoSemaphore(t *testing.T) {
 	key := "key"
 	val := "value"
 
-	callbackFirst := func(_ context.Context, key any) (value any, err error) {
+	callbackFirst := func(_ context.Context, key any, prev *Entry) (value any, err error) {
 		return "new_value_1", nil
 	}
 
-	callbackSecond := func(_ context.Context, key any) (value any, err error) {
+	callbackSecond := func(_ context.Context, key any, prev *Entry) (value any, err error) {
 		return "new_value_2", nil
 	}
 
@@ -1077,7 +1137,7 @@ func TestCache_AsyncLoadOrStoreConcurrentTwoSemaphore(t *testing.T) {
 	// GlobalTTL + 1 makes cache expired
 	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
 
-	entry, ch1, err := cache.AsyncLoadOrStore(key, callbackFirst)
+	entry, r1, err := cache.AsyncLoadOrStore(key, callbackFirst)
 	if err != nil {
 		t.Errorf("failed with err: %v", err)
 	}
@@ -1091,8 +1151,8 @@ func TestCache_AsyncLoadOrStoreConcurrentTwoSemaphore(t *testing.T) {
 	}
 
 	// second call
-	var ch2 chan error
-	entry, ch2, err = cache.AsyncLoadOrStore(key, callbackSecond)
+	var r2 *Refresh
+	entry, r2, err = cache.AsyncLoadOrStore(key, callbackSecond)
 	if err != nil {
 		t.Errorf("failed with err: %v", err)
 	}
@@ -1107,8 +1167,8 @@ func TestCache_AsyncLoadOrStoreConcurrentTwoSemaphore(t *testing.T) {
 
 	//////////// time 2
 	// 11 + 5(callback time) + 1
-	<-ch2 // wait for second call
-	<-ch1 // wait for first call
+	<-r2.Done() // wait for second call
+	<-r1.Done() // wait for first call
 	now = func() time.Time { return fixedTime().Add(17 * time.Millisecond) }
 
 	entry, _, err = cache.AsyncLoadOrStore(key, callbackFirst)
@@ -1129,7 +1189,7 @@ func BenchmarkLoadOrStore(b *testing.B) {
 	c := New(Config{GlobalTTL: 1 * time.Millisecond})
 	c.Set("key", "value")
 	for i := 0; i < b.N; i++ {
-		g, _ := c.LoadOrStore("key", func(ctx context.Context, key any) (any, bool, error) {
+		g, _ := c.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
 			return "value", false, nil
 		})
 		if g.Value != "value" {
@@ -1142,7 +1202,7 @@ func BenchmarkAsyncLoadOrStore(b *testing.B) {
 	c := New(Config{GlobalTTL: 1 * time.Millisecond})
 	c.Set("key", "value")
 	for i := 0; i < b.N; i++ {
-		g, _, _ := c.AsyncLoadOrStore("key", func(_ context.Context, key any) (any, error) {
+		g, _, _ := c.AsyncLoadOrStore("key", func(_ context.Context, key any, prev *Entry) (any, error) {
 			return "value", nil
 		})
 		if g.Value != "value" {
@@ -1150,3 +1210,567 @@ func BenchmarkAsyncLoadOrStore(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkLoadOrStoreFreshHit(b *testing.B) {
+	c := New(Config{GlobalTTL: time.Hour})
+	c.Set("key", "value")
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return "new_value", false, nil
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g, _ := c.LoadOrStore("key", callback)
+		if g.Value != "value" {
+			b.Errorf("got %v, want %v", g, "value")
+		}
+	}
+}
+
+func BenchmarkAsyncLoadOrStoreFreshHit(b *testing.B) {
+	c := New(Config{GlobalTTL: time.Hour})
+	c.Set("key", "value")
+	callback := func(_ context.Context, key any, prev *Entry) (any, error) {
+		return "new_value", nil
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g, _, _ := c.AsyncLoadOrStore("key", callback)
+		if g.Value != "value" {
+			b.Errorf("got %v, want %v", g, "value")
+		}
+	}
+}
+
+func TestCache_FreshHitAllocations(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{name: "default", config: Config{GlobalTTL: time.Hour}},
+		{name: "sharded storage", config: Config{GlobalTTL: time.Hour, Storage: StorageSharded}},
+		{name: "key stats", config: Config{GlobalTTL: time.Hour, KeyStats: true}},
+		{name: "memory tracking", config: Config{GlobalTTL: time.Hour, MaxMemoryBytes: 1 << 20}},
+		{name: "events", config: Config{GlobalTTL: time.Hour, EventsBuffer: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = time.Now
+			c := New(tt.config)
+			c.Set("key", "value")
+
+			syncCallback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+				return "new_value", false, nil
+			}
+			asyncCallback := func(_ context.Context, key any, prev *Entry) (any, error) {
+				return "new_value", nil
+			}
+
+			if n := testing.AllocsPerRun(100, func() { c.LoadOrStore("key", syncCallback) }); n != 0 {
+				t.Errorf("LoadOrStore() allocations got = %v, want 0", n)
+			}
+			if n := testing.AllocsPerRun(100, func() { c.AsyncLoadOrStore("key", asyncCallback) }); n != 0 {
+				t.Errorf("AsyncLoadOrStore() allocations got = %v, want 0", n)
+			}
+			if n := testing.AllocsPerRun(100, func() { c.Get("key") }); n != 0 {
+				t.Errorf("Get() allocations got = %v, want 0", n)
+			}
+		})
+	}
+}
+
+// TestCache_StaleServeAllocations serves a stale value while the refresh is in progress,
+// which shares the refresh of the key and should not allocate
+func TestCache_StaleServeAllocations(t *testing.T) {
+	c := New(Config{GlobalTTL: time.Millisecond})
+	now = func() time.Time { return fixedTime() }
+	c.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(time.Second) }
+
+	release := make(chan struct{})
+	callback := func(_ context.Context, key any, prev *Entry) (any, error) {
+		<-release
+		return "new_value", nil
+	}
+	_, refresh, _ := c.AsyncLoadOrStore("key", callback)
+	defer func() {
+		close(release)
+		<-refresh.Done()
+	}()
+
+	n := testing.AllocsPerRun(100, func() {
+		if entry, _, _ := c.AsyncLoadOrStore("key", callback); !entry.Stale || entry.RefreshStatus != RefreshCoalesced {
+			t.Errorf("AsyncLoadOrStore() got %+v, want stale coalesced entry", entry)
+		}
+	})
+	if n != 0 {
+		t.Errorf("AsyncLoadOrStore() allocations got = %v, want 0", n)
+	}
+}
+
+func TestCache_LoadOrStoreWithin(t *testing.T) {
+	tests := []struct {
+		name        string
+		delay       time.Duration
+		callbackErr error
+		want        Entry
+		wantRefresh bool
+	}{
+		{
+			name: "fresh value within max wait",
+			want: Entry{Value: "new_value", Version: 2, Source: SourceFreshFromCallback, CallbackInvoked: true, RefreshStatus: RefreshStarted},
+		},
+		{
+			name:        "callback error within max wait",
+			callbackErr: errors.New("unavailable"),
+			want:        Entry{Value: "value", Stale: true, Version: 1, Err: errors.New("unavailable"), Source: SourceStaleFallback, CallbackInvoked: true, RefreshStatus: RefreshStarted},
+		},
+		{
+			name:        "max wait exceeded",
+			delay:       50 * time.Millisecond,
+			want:        Entry{Value: "value", Stale: true, Version: 1, Source: SourceStaleFallback, RefreshStatus: RefreshStarted},
+			wantRefresh: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := New(Config{
+				GlobalTTL: 10 * time.Millisecond,
+			})
+
+			now = func() time.Time { return fixedTime() }
+			cache.Set("key", "value")
+			now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+			got, refresh, err := cache.LoadOrStoreWithin(context.Background(), "key", 20*time.Millisecond, func(_ context.Context, key any, prev *Entry) (any, error) {
+				time.Sleep(tt.delay)
+				return "new_value", tt.callbackErr
+			})
+			if err != nil {
+				t.Errorf("LoadOrStoreWithin() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadOrStoreWithin() got = %+v, want %+v", got, tt.want)
+			}
+			if (refresh != nil) != tt.wantRefresh {
+				t.Errorf("LoadOrStoreWithin() refresh = %v, wantRefresh %v", refresh, tt.wantRefresh)
+			}
+			if refresh != nil {
+				if entry, _ := refresh.Result(); entry.Value != "new_value" {
+					t.Errorf("Result() got = %+v, want new_value", entry)
+				}
+			}
+		})
+	}
+}
+
+func TestCache_HedgeDelay(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL:  10 * time.Millisecond,
+		HedgeDelay: 20 * time.Millisecond,
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	got, refresh, err := cache.AsyncLoadOrStore("key", func(_ context.Context, key any, prev *Entry) (any, error) {
+		return "new_value", nil
+	})
+	if err != nil || refresh != nil || got.Value != "new_value" || got.Stale {
+		t.Errorf("AsyncLoadOrStore() got = %+v, %v, %v, want the fresh value", got, refresh, err)
+	}
+
+	now = func() time.Time { return fixedTime().Add(22 * time.Millisecond) }
+	got, refresh, err = cache.AsyncLoadOrStore("key", func(_ context.Context, key any, prev *Entry) (any, error) {
+		time.Sleep(50 * time.Millisecond)
+		return "newer_value", nil
+	})
+	if err != nil || refresh == nil || got.Value != "new_value" || !got.Stale {
+		t.Fatalf("AsyncLoadOrStore() got = %+v, %v, %v, want the stale value", got, refresh, err)
+	}
+	if entry, _ := refresh.Result(); entry.Value != "newer_value" {
+		t.Errorf("Result() got = %+v, want newer_value", entry)
+	}
+}
+
+func TestCache_CallbackPrevEntry(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	now = func() time.Time { return fixedTime() }
+
+	var gotPrev []*Entry
+	syncCallback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		gotPrev = append(gotPrev, prev)
+		if prev != nil {
+			return prev.Value, false, nil // not modified
+		}
+		return "value", false, nil
+	}
+	asyncCallback := func(ctx context.Context, key any, prev *Entry) (any, error) {
+		gotPrev = append(gotPrev, prev)
+		return "new_value", nil
+	}
+
+	cache.LoadOrStore("key", syncCallback)
+
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+	entry, _ := cache.LoadOrStore("key", syncCallback)
+	if entry.Value != "value" || entry.Stale {
+		t.Errorf("LoadOrStore() got %+v, want fresh value", entry)
+	}
+
+	now = func() time.Time { return fixedTime().Add(22 * time.Millisecond) }
+	_, refresh, _ := cache.AsyncLoadOrStore("key", asyncCallback)
+	<-refresh.Done()
+
+	want := []*Entry{
+		nil,
+		{Value: "value", Stale: true, Version: 1, Age: 11 * time.Millisecond},
+		{Value: "value", Stale: true, Version: 2, Age: 11 * time.Millisecond},
+	}
+	if !reflect.DeepEqual(gotPrev, want) {
+		t.Errorf("callback prev got %+v, want %+v", gotPrev, want)
+	}
+}
+
+func TestCache_CloneFunc(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+		CloneFunc: func(value any) any {
+			return append([]string(nil), value.([]string)...)
+		},
+	})
+
+	now = func() time.Time { return fixedTime() }
+
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return []string{"a", "b"}, false, nil
+	}
+
+	entry, _ := cache.LoadOrStore("key", callback)
+	entry.Value.([]string)[0] = "mutated"
+
+	entry, _ = cache.LoadOrStore("key", callback)
+	entry.Value.([]string)[1] = "mutated"
+
+	cache.Range(func(key, value any, ttl time.Duration) bool {
+		value.([]string)[0] = "mutated"
+		return true
+	})
+
+	entry, _ = cache.LoadOrStore("key", callback)
+	if !reflect.DeepEqual(entry.Value, []string{"a", "b"}) {
+		t.Errorf("LoadOrStore() got %v, want [a b]", entry.Value)
+	}
+}
+
+func TestCache_SetReplaced(t *testing.T) {
+	cache := New(Config{})
+
+	if prev, replaced := cache.Set("key", "value"); replaced || prev != nil {
+		t.Errorf("Set() got %v, %v, want nil, false", prev, replaced)
+	}
+
+	if prev, replaced := cache.Set("key", "value2"); !replaced || prev != "value" {
+		t.Errorf("Set() got %v, %v, want value, true", prev, replaced)
+	}
+}
+
+func TestCache_RangeEntries(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key1", "value1")
+	cache.Set("key2", "value2")
+
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+	cache.LoadOrStore("key1", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, true, errors.New("unavailable")
+	})
+
+	got := make(map[any]Entry)
+	gotExpiresAt := make(map[any]time.Time)
+	cache.RangeEntries(func(key any, e Entry, expiresAt time.Time) bool {
+		got[key] = e
+		gotExpiresAt[key] = expiresAt
+		return true
+	})
+
+	want := map[any]Entry{
+		"key1": {Value: "value1", Stale: true, Version: 1, Err: errors.New("unavailable")},
+		"key2": {Value: "value2", Stale: true, Version: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RangeEntries() got = %+v, want %+v", got, want)
+	}
+
+	wantExpiresAt := map[any]time.Time{
+		"key1": fixedTime().Add(10 * time.Millisecond),
+		"key2": fixedTime().Add(10 * time.Millisecond),
+	}
+	if !reflect.DeepEqual(gotExpiresAt, wantExpiresAt) {
+		t.Errorf("RangeEntries() expiresAt got = %v, want %v", gotExpiresAt, wantExpiresAt)
+	}
+}
+
+func TestCache_SortedKeys(t *testing.T) {
+	cache := New(Config{})
+	for _, key := range []string{"c", "a", "d", "b"} {
+		cache.Set(key, "value")
+	}
+
+	got := cache.SortedKeys(func(a, b any) bool {
+		return a.(string) < b.(string)
+	})
+
+	want := []any{"a", "b", "c", "d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SortedKeys() got = %v, want %v", got, want)
+	}
+}
+
+func TestCache_ZeroValue(t *testing.T) {
+	var cache Cache
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+	if ttl := cache.TTL("key"); ttl != defaultTTL {
+		t.Errorf("TTL() got %v, want %v", ttl, defaultTTL)
+	}
+
+	now = func() time.Time { return fixedTime().Add(defaultTTL + 1) }
+	entry, refresh, err := cache.AsyncLoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return "new_value", nil
+	})
+	if err != nil || !entry.Stale || refresh == nil {
+		t.Fatalf("AsyncLoadOrStore() got %+v, %v, %v, want stale entry with refresh", entry, refresh, err)
+	}
+
+	select {
+	case <-refresh.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("refresh of zero value cache is blocked")
+	}
+
+	if entry, err = refresh.Result(); err != nil || entry.Value != "new_value" {
+		t.Errorf("Result() got %+v, %v, want new_value", entry, err)
+	}
+
+	cache.Close()
+}
+
+func TestCache_ExpiringWithin(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("expired", "value")
+	now = func() time.Time { return fixedTime().Add(5 * time.Millisecond) }
+	cache.Set("soon", "value")
+	now = func() time.Time { return fixedTime().Add(10 * time.Millisecond) }
+	cache.Set("later", "value")
+
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+	got := cache.ExpiringWithin(5 * time.Millisecond)
+	sort.Slice(got, func(i, j int) bool { return got[i].(string) < got[j].(string) })
+
+	want := []any{"expired", "soon"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpiringWithin() got = %v, want %v", got, want)
+	}
+}
+
+func TestCache_SetThrough(t *testing.T) {
+	cache := New(Config{})
+	upstream := map[any]any{}
+
+	writer := func(ctx context.Context, key, value any) error {
+		if value == "invalid" {
+			return errors.New("rejected")
+		}
+		upstream[key] = value
+		return nil
+	}
+
+	if err := cache.SetThrough(context.Background(), "key", "value", writer); err != nil {
+		t.Errorf("SetThrough() error = %v", err)
+	}
+	if err := cache.SetThrough(context.Background(), "key", "invalid", writer); err == nil {
+		t.Errorf("SetThrough() want error, got nil")
+	}
+
+	entry, _ := cache.Get("key")
+	if entry.Value != "value" || upstream["key"] != "value" {
+		t.Errorf("SetThrough() cache %v, upstream %v, want value", entry.Value, upstream["key"])
+	}
+}
+
+func TestCache_SyncSemaphore(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL:     time.Hour,
+		SyncSemaphore: 2,
+	})
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	callback := func(_ context.Context, key any, prev *Entry) (any, bool, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return "value", false, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := cache.LoadOrStore(i, callback); err != nil {
+				t.Errorf("failed with err: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if maxRunning > 2 {
+		t.Errorf("concurrent callbacks got = %v, want at most 2", maxRunning)
+	}
+}
+
+func TestCache_SyncSemaphoreContextDone(t *testing.T) {
+	cache := New(Config{
+		SyncSemaphore: 1,
+	})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.LoadOrStore("key1", func(_ context.Context, key any, prev *Entry) (any, bool, error) {
+			close(started)
+			<-release
+			return "value", false, nil
+		})
+	}()
+	<-started
+	defer func() {
+		close(release)
+		<-done
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err := cache.LoadOrStoreWithCtx(ctx, "key2", func(_ context.Context, key any, prev *Entry) (any, bool, error) {
+		t.Errorf("callback should not be called")
+		return "value", false, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("LoadOrStoreWithCtx() err got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// storedValue returns the value of the key as it's stored, e.g. compressed
+func storedValue(c *Cache, key any) (any, bool) {
+	it, ok := c.loadItem(key)
+	if !ok {
+		return nil, false
+	}
+	return it.value, true
+}
+
+func TestCache_LoadOrStoreWithTimeout(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "old")
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	entry, err := cache.LoadOrStoreWithTimeout(context.Background(), "key", 10*time.Millisecond, func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		defer close(done)
+		<-release
+		return "new", false, nil
+	})
+	if err != nil || entry.Value != "old" || !entry.Stale {
+		t.Fatalf("LoadOrStoreWithTimeout() got %+v, %v, want the stale value", entry, err)
+	}
+
+	close(release)
+	<-done
+	for i := 0; ; i++ {
+		if v, _ := storedValue(cache, "key"); v == "new" {
+			break
+		}
+		if i == 100 {
+			t.Fatal("the background callback didn't update the cache")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// fast callbacks are waited for
+	now = func() time.Time { return fixedTime().Add(4 * time.Minute) }
+	entry, err = cache.LoadOrStoreWithTimeout(context.Background(), "key", time.Second, func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return "newer", false, nil
+	})
+	if err != nil || entry.Value != "newer" || entry.Stale {
+		t.Errorf("LoadOrStoreWithTimeout() got %+v, %v, want the new value", entry, err)
+	}
+}
+
+func TestCache_EntrySource(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: time.Minute,
+		DefaultValue: func(key any) (any, bool) {
+			return "default", true
+		},
+	})
+	callback := func(ctx context.Context, key any, prev *Entry) (any, error) {
+		if key == "failing" {
+			return nil, errors.New("unavailable")
+		}
+		return "value", nil
+	}
+
+	now = func() time.Time { return fixedTime() }
+	entry, _, _ := cache.AsyncLoadOrStore("key", callback)
+	if entry.Source != SourceFreshFromCallback || !entry.CallbackInvoked {
+		t.Errorf("missing key got %v, %v, want %v and callback invoked", entry.Source, entry.CallbackInvoked, SourceFreshFromCallback)
+	}
+
+	entry, _, _ = cache.AsyncLoadOrStore("key", callback)
+	if entry.Source != SourceCached || entry.CallbackInvoked {
+		t.Errorf("fresh key got %v, %v, want %v and callback not invoked", entry.Source, entry.CallbackInvoked, SourceCached)
+	}
+
+	entry, _, _ = cache.AsyncLoadOrStore("failing", callback)
+	if entry.Source != SourceDefaultValue || !entry.CallbackInvoked {
+		t.Errorf("failing key got %v, %v, want %v and callback invoked", entry.Source, entry.CallbackInvoked, SourceDefaultValue)
+	}
+
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+	entry, refresh, _ := cache.AsyncLoadOrStore("key", callback)
+	if entry.Source != SourceStaleFallback || entry.CallbackInvoked {
+		t.Errorf("expired key got %v, %v, want %v and callback not invoked", entry.Source, entry.CallbackInvoked, SourceStaleFallback)
+	}
+	<-refresh.Done()
+}
@@ -0,0 +1,164 @@
+// Package lastcachetest provides helpers to test the code using lastcache deterministically,
+// without relying on sleeps.
+//
+//	clock := lastcachetest.NewClock(time.Now())
+//	cache := lastcache.New(lastcache.Config{GlobalTTL: time.Minute, Clock: clock})
+//	rec := &lastcachetest.Recorder{}
+//
+//	cache.AsyncLoadOrStore("key", rec.Async(loader))
+//	clock.Advance(2 * time.Minute) // expire all the keys
+//	cache.AsyncLoadOrStore("key", rec.Async(loader))
+//	lastcachetest.WaitForRefreshes(t, cache)
+//	rec.Count("key") // 2
+package lastcachetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+// DefaultWaitTimeout maximum time WaitForRefreshes waits for in-progress refreshes
+var DefaultWaitTimeout = 5 * time.Second
+
+// Clock is a fake lastcache.Clock which only moves when it's advanced
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a Clock set to t
+func NewClock(t time.Time) *Clock {
+	return &Clock{now: t}
+}
+
+// Now returns the current time of the clock
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Set sets the clock to t
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = t
+}
+
+// Call a recorded callback call
+type Call struct {
+	Key   any
+	Prev  *lastcache.Entry
+	Value any
+	Err   error
+}
+
+// Recorder intercepts the callbacks to record their calls
+// The zero value is ready to use
+type Recorder struct {
+	// Before if set, is called before the callback, e.g. to block the callback until the test is ready
+	Before func(ctx context.Context, key any)
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Sync wraps the SyncCallback to record its calls
+func (r *Recorder) Sync(callback lastcache.SyncCallback) lastcache.SyncCallback {
+	return func(ctx context.Context, key any, prev *lastcache.Entry) (any, bool, error) {
+		if r.Before != nil {
+			r.Before(ctx, key)
+		}
+		value, useStale, err := callback(ctx, key, prev)
+		r.record(Call{Key: key, Prev: prev, Value: value, Err: err})
+		return value, useStale, err
+	}
+}
+
+// Async wraps the AsyncCallback to record its calls
+func (r *Recorder) Async(callback lastcache.AsyncCallback) lastcache.AsyncCallback {
+	return func(ctx context.Context, key any, prev *lastcache.Entry) (any, error) {
+		if r.Before != nil {
+			r.Before(ctx, key)
+		}
+		value, err := callback(ctx, key, prev)
+		r.record(Call{Key: key, Prev: prev, Value: value, Err: err})
+		return value, err
+	}
+}
+
+// Calls returns the recorded calls in order
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Call(nil), r.calls...)
+}
+
+// Count returns number of the recorded calls for the key
+func (r *Recorder) Count(key any) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, call := range r.calls {
+		if call.Key == key {
+			n++
+		}
+	}
+	return n
+}
+
+// Reset removes the recorded calls
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = nil
+}
+
+func (r *Recorder) record(call Call) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, call)
+}
+
+// WaitForRefreshes blocks until all the in-progress background refreshes of the cache are completed
+// The test fails if they are not completed within DefaultWaitTimeout
+func WaitForRefreshes(tb testing.TB, cache *lastcache.Cache) {
+	tb.Helper()
+
+	timeout := time.NewTimer(DefaultWaitTimeout)
+	defer timeout.Stop()
+
+	for {
+		refreshes := cache.Refreshes()
+		if len(refreshes) == 0 {
+			return
+		}
+
+		for _, refresh := range refreshes {
+			select {
+			case <-refresh.Done():
+			case <-timeout.C:
+				tb.Fatalf("lastcachetest: %d refreshes are still in progress after %v", len(refreshes), DefaultWaitTimeout)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package lastcachetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewClock(start)
+
+	clock.Advance(time.Minute)
+	if got := clock.Now(); !got.Equal(start.Add(time.Minute)) {
+		t.Errorf("Now() got %v, want %v", got, start.Add(time.Minute))
+	}
+
+	clock.Set(start)
+	if got := clock.Now(); !got.Equal(start) {
+		t.Errorf("Now() got %v, want %v", got, start)
+	}
+}
+
+func TestWaitForRefreshes(t *testing.T) {
+	clock := NewClock(time.Unix(1000, 0))
+	cache := lastcache.New(lastcache.Config{
+		GlobalTTL: time.Minute,
+		Clock:     clock,
+	})
+
+	release := make(chan struct{})
+	rec := &Recorder{
+		Before: func(ctx context.Context, key any) {
+			<-release
+		},
+	}
+	callback := rec.Async(func(ctx context.Context, key any, prev *lastcache.Entry) (any, error) {
+		return "value", nil
+	})
+
+	cache.Set("key", "stale")
+	clock.Advance(2 * time.Minute)
+
+	entry, _, _ := cache.AsyncLoadOrStore("key", callback)
+	if !entry.Stale {
+		t.Errorf("entry Stale expected to be true, false returned")
+	}
+
+	close(release)
+	WaitForRefreshes(t, cache)
+
+	if got := rec.Count("key"); got != 1 {
+		t.Errorf("Count() got %v, want 1", got)
+	}
+
+	calls := rec.Calls()
+	if len(calls) != 1 || calls[0].Prev == nil || calls[0].Prev.Value != "stale" || calls[0].Value != "value" {
+		t.Errorf("Calls() got %+v, want one refresh call", calls)
+	}
+
+	entry, _ = cache.Get("key")
+	if entry.Value != "value" {
+		t.Errorf("Get() got %+v, want value", entry)
+	}
+}
+
+func TestRecorder_Sync(t *testing.T) {
+	rec := &Recorder{}
+	cache := lastcache.New(lastcache.Config{})
+
+	callback := rec.Sync(func(ctx context.Context, key any, prev *lastcache.Entry) (any, bool, error) {
+		return "value", false, nil
+	})
+	cache.LoadOrStore("key", callback)
+	cache.LoadOrStore("key", callback)
+
+	if got := rec.Count("key"); got != 1 {
+		t.Errorf("Count() got %v, want 1", got)
+	}
+
+	rec.Reset()
+	if got := rec.Calls(); len(got) != 0 {
+		t.Errorf("Calls() after Reset got %v, want none", got)
+	}
+}
@@ -0,0 +1,39 @@
+package lastcache
+
+import (
+	"context"
+	"time"
+)
+
+const defaultLeaseTTL = 30 * time.Second
+
+// Lease coordinates the background refreshes of the keys across multiple instances, see Config.Lease
+type Lease interface {
+	// TryAcquire tries to acquire the lease of the key for ttl, false is returned if it's held by another instance
+	TryAcquire(ctx context.Context, key any, ttl time.Duration) (bool, error)
+	// Release releases the lease of the key acquired by this instance
+	Release(ctx context.Context, key any) error
+}
+
+// acquireLease reports whether the key can be refreshed by this instance, and returns the function to release the lease
+func (c *Cache) acquireLease(ctx context.Context, key any) (release func(), acquired bool) {
+	if c.config.Lease == nil {
+		return func() {}, true
+	}
+
+	ttl := c.config.LeaseTTL
+	if ttl <= 0 {
+		ttl = defaultLeaseTTL
+	}
+	acquired, err := c.config.Lease.TryAcquire(ctx, key, ttl)
+	if err != nil {
+		// the refresh runs without the lease, since serving stale values forever is worse than duplicate refreshes
+		return func() {}, true
+	}
+	if !acquired {
+		return nil, false
+	}
+	return func() {
+		c.config.Lease.Release(c.context(), key)
+	}, true
+}
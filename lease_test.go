@@ -0,0 +1,94 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memoryLease Lease shared by the caches of a test
+type memoryLease struct {
+	mu       sync.Mutex
+	held     map[any]bool
+	err      error
+	released int32
+}
+
+func (l *memoryLease) TryAcquire(ctx context.Context, key any, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return false, l.err
+	}
+	if l.held[key] {
+		return false, nil
+	}
+	l.held[key] = true
+	return true, nil
+}
+
+func (l *memoryLease) Release(ctx context.Context, key any) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.held, key)
+	atomic.AddInt32(&l.released, 1)
+	return nil
+}
+
+func TestCache_Lease(t *testing.T) {
+	lease := &memoryLease{held: map[any]bool{}}
+	cache := New(Config{GlobalTTL: 10 * time.Millisecond, Lease: lease})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	// another instance holds the lease
+	lease.held["key"] = true
+	var calls int32
+	callback := func(ctx context.Context, key any, prev *Entry) (any, error) {
+		atomic.AddInt32(&calls, 1)
+		return "new_value", nil
+	}
+	entry, refresh, err := cache.AsyncLoadOrStore("key", callback)
+	if err != nil || !entry.Stale || refresh == nil {
+		t.Fatalf("AsyncLoadOrStore() got %+v, %v, want stale value with refresh", entry, err)
+	}
+	result, err := refresh.Result()
+	if !errors.Is(err, ErrLeaseHeld) || result.Value != "value" || !result.Stale {
+		t.Errorf("Result() got %+v, %v, want stale value with %v", result, err, ErrLeaseHeld)
+	}
+	if calls != 0 {
+		t.Errorf("callback called %v times, want 0", calls)
+	}
+
+	// the lease is released by the other instance
+	lease.Release(context.Background(), "key")
+	_, refresh, _ = cache.AsyncLoadOrStore("key", callback)
+	if result, err = refresh.Result(); err != nil || result.Value != "new_value" {
+		t.Errorf("Result() got %+v, %v, want new_value", result, err)
+	}
+	if lease.held["key"] || atomic.LoadInt32(&lease.released) != 2 {
+		t.Errorf("lease is not released after the refresh")
+	}
+}
+
+func TestCache_LeaseError(t *testing.T) {
+	lease := &memoryLease{held: map[any]bool{}, err: errors.New("redis is down")}
+	cache := New(Config{GlobalTTL: 10 * time.Millisecond, Lease: lease})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	// the refresh runs without the lease
+	_, refresh, _ := cache.AsyncLoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return "new_value", nil
+	})
+	if result, err := refresh.Result(); err != nil || result.Value != "new_value" {
+		t.Errorf("Result() got %+v, %v, want new_value", result, err)
+	}
+}
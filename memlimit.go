@@ -0,0 +1,10 @@
+//go:build go1.19
+
+package lastcache
+
+import "runtime/debug"
+
+// runtimeMemoryLimit returns the Go runtime soft memory limit (GOMEMLIMIT)
+func runtimeMemoryLimit() int64 {
+	return debug.SetMemoryLimit(-1)
+}
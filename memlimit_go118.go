@@ -0,0 +1,10 @@
+//go:build !go1.19
+
+package lastcache
+
+import "math"
+
+// runtimeMemoryLimit Go runtime soft memory limit is not supported before go1.19
+func runtimeMemoryLimit() int64 {
+	return math.MaxInt64
+}
@@ -0,0 +1,192 @@
+package lastcache
+
+import (
+	"container/list"
+	"math"
+	"sync"
+)
+
+// memoryTracker keeps the estimated size of the entries in least recently used order per priority
+type memoryTracker struct {
+	mu    sync.Mutex
+	total int64
+	items map[any]*list.Element
+	// lru lists of the keys by priority, lowest priority first
+	lru [priorities]list.List
+}
+
+type memoryItem struct {
+	key      any
+	size     int64
+	priority Priority
+}
+
+// add sets the size of the key and marks it as most recently used
+// priority is set if it's not nil, otherwise new keys get PriorityNormal and existing keys keep their priority
+// returns the keys to be evicted to keep the total size under max, lowest priority and least recently used first
+// If size is bigger than max, only the key itself is returned
+func (m *memoryTracker) add(key any, size, max int64, priority *Priority) []any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.items == nil {
+		m.items = make(map[any]*list.Element)
+	}
+
+	// a value bigger than max is not cached, and the other keys are kept
+	if size > max {
+		m.removeLocked(key)
+		return []any{key}
+	}
+
+	if el, ok := m.items[key]; ok {
+		item := el.Value.(*memoryItem)
+		m.total += size - item.size
+		item.size = size
+		if priority != nil && *priority != item.priority {
+			m.lru[item.priority.index()].Remove(el)
+			item.priority = *priority
+			m.items[key] = m.lru[item.priority.index()].PushBack(item)
+		} else {
+			m.lru[item.priority.index()].MoveToBack(el)
+		}
+	} else {
+		item := &memoryItem{key: key, size: size}
+		if priority != nil {
+			item.priority = *priority
+		}
+		m.items[key] = m.lru[item.priority.index()].PushBack(item)
+		m.total += size
+	}
+
+	// evicted keys will be removed by the caller
+	var evict []any
+	total := m.total
+	for i := range m.lru {
+		for el := m.lru[i].Front(); el != nil && total > max; el = el.Next() {
+			item := el.Value.(*memoryItem)
+			evict = append(evict, item.key)
+			total -= item.size
+		}
+	}
+	return evict
+}
+
+// setPriority moves the key to the list of the priority, false is returned if the key is not tracked
+func (m *memoryTracker) setPriority(key any, priority Priority) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return false
+	}
+	item := el.Value.(*memoryItem)
+	if item.priority != priority {
+		m.lru[item.priority.index()].Remove(el)
+		item.priority = priority
+		m.items[key] = m.lru[priority.index()].PushBack(item)
+	}
+	return true
+}
+
+// touch marks the key as most recently used
+func (m *memoryTracker) touch(key any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.lru[el.Value.(*memoryItem).priority.index()].MoveToBack(el)
+	}
+}
+
+func (m *memoryTracker) remove(key any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeLocked(key)
+}
+
+// removeLocked is remove with m.mu held
+func (m *memoryTracker) removeLocked(key any) {
+	if el, ok := m.items[key]; ok {
+		item := el.Value.(*memoryItem)
+		m.total -= item.size
+		m.lru[item.priority.index()].Remove(el)
+		delete(m.items, key)
+	}
+}
+
+// keys returns tracked keys in eviction order, lowest priority and least recently used first
+func (m *memoryTracker) keys() []any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]any, 0, len(m.items))
+	for i := range m.lru {
+		for el := m.lru[i].Front(); el != nil; el = el.Next() {
+			keys = append(keys, el.Value.(*memoryItem).key)
+		}
+	}
+	return keys
+}
+
+func (m *memoryTracker) size() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.total
+}
+
+// MemoryBytes returns the estimated memory used by the cached keys and values
+// Memory is tracked only if Config.MaxMemoryBytes or Config.MemoryCheckInterval is set, otherwise 0 will be returned
+func (c *Cache) MemoryBytes() int64 {
+	return c.memory.size()
+}
+
+// trackMemory records the size of the stored value and returns the least recently used keys to be evicted if needed
+func (c *Cache) trackMemory(key, storedValue any) []any {
+	if !c.memoryTracked() {
+		return nil
+	}
+
+	max := c.config.MaxMemoryBytes
+	if max <= 0 {
+		max = math.MaxInt64
+	}
+
+	var priority *Priority
+	if c.config.PriorityFunc != nil {
+		p := c.config.PriorityFunc(key)
+		priority = &p
+	}
+
+	return c.memory.add(key, c.sizeOf(key, storedValue), max, priority)
+}
+
+// memoryTracked either memory usage and access order of the keys should be tracked
+func (c *Cache) memoryTracked() bool {
+	return c.config.MaxMemoryBytes > 0 || c.config.MemoryCheckInterval > 0
+}
+
+func (c *Cache) sizeOf(key, storedValue any) int64 {
+	if c.config.SizeFunc != nil {
+		return c.config.SizeFunc(key, storedValue)
+	}
+	return EstimateSize(key) + EstimateSize(storedValue)
+}
+
+// compact rebuilds the map of the sizes, see Cache.Compact
+func (m *memoryTracker) compact() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.items == nil {
+		return
+	}
+	compacted := make(map[any]*list.Element, len(m.items))
+	for key, el := range m.items {
+		compacted[key] = el
+	}
+	m.items = compacted
+}
@@ -0,0 +1,97 @@
+package lastcache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache_MaxMemoryBytes(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL:      10 * time.Millisecond,
+		MaxMemoryBytes: 30,
+		SizeFunc: func(key, value any) int64 {
+			return int64(len(value.(string)))
+		},
+	})
+
+	now = func() time.Time { return fixedTime() }
+
+	cache.Set("key1", "0123456789")
+	cache.Set("key2", "0123456789")
+	cache.Set("key3", "0123456789")
+	if got := cache.MemoryBytes(); got != 30 {
+		t.Errorf("MemoryBytes() got = %v, want 30", got)
+	}
+
+	// key1 becomes the most recently used
+	cache.LoadOrStore("key1", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, false, nil
+	})
+
+	cache.Set("key4", "0123456789")
+	if _, ok := storedValue(cache, "key2"); ok {
+		t.Errorf("least recently used key2 expected to be evicted")
+	}
+	if _, ok := storedValue(cache, "key1"); !ok {
+		t.Errorf("recently used key1 expected to be kept")
+	}
+
+	cache.Set("large", "0123456789012345678901234567890123456789")
+	if _, ok := storedValue(cache, "large"); ok {
+		t.Errorf("value bigger than MaxMemoryBytes expected not to be cached")
+	}
+	// the other entries are not evicted by the oversized value
+	for _, key := range []string{"key1", "key3", "key4"} {
+		if _, ok := storedValue(cache, key); !ok {
+			t.Errorf("%s expected to be kept after the oversized value", key)
+		}
+	}
+	if got := cache.MemoryBytes(); got != 30 {
+		t.Errorf("MemoryBytes() got = %v, want 30", got)
+	}
+
+	// replacing a key by an oversized value removes it
+	cache.Set("key1", "0123456789012345678901234567890123456789")
+	if _, ok := storedValue(cache, "key1"); ok {
+		t.Errorf("key1 expected to be removed by the oversized value")
+	}
+	if got := cache.MemoryBytes(); got != 20 {
+		t.Errorf("MemoryBytes() got = %v, want 20", got)
+	}
+}
+
+func TestCache_MemoryTrackingConcurrentDelete(t *testing.T) {
+	now = time.Now
+	var cache *Cache
+	var once sync.Once
+	deleted := make(chan struct{})
+	cache = New(Config{GlobalTTL: time.Minute, MaxMemoryBytes: 1 << 20, KeyStats: true, SizeFunc: func(key, value any) int64 {
+		// the key is deleted concurrently while its store is being tracked
+		once.Do(func() {
+			go func() {
+				cache.Delete("key")
+				close(deleted)
+			}()
+			select {
+			case <-deleted:
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+		return 10
+	}})
+
+	cache.Set("key", "value")
+	<-deleted
+
+	if _, ok := storedValue(cache, "key"); ok {
+		t.Fatalf("key expected to be deleted")
+	}
+	if _, ok := cache.KeyStats("key"); ok {
+		t.Errorf("KeyStats() of the deleted key got true, want false")
+	}
+	if got := cache.MemoryBytes(); got != 0 {
+		t.Errorf("MemoryBytes() got = %v, want 0", got)
+	}
+}
@@ -0,0 +1,17 @@
+package lastcache
+
+// wrapSync applies Config.CallbackMiddleware to the callback, the first middleware is the outermost
+func (c *Cache) wrapSync(callback SyncCallback) SyncCallback {
+	for i := len(c.config.CallbackMiddleware) - 1; i >= 0; i-- {
+		callback = c.config.CallbackMiddleware[i](callback)
+	}
+	return callback
+}
+
+// wrapAsync applies Config.AsyncCallbackMiddleware to the callback, the first middleware is the outermost
+func (c *Cache) wrapAsync(callback AsyncCallback) AsyncCallback {
+	for i := len(c.config.AsyncCallbackMiddleware) - 1; i >= 0; i-- {
+		callback = c.config.AsyncCallbackMiddleware[i](callback)
+	}
+	return callback
+}
@@ -0,0 +1,50 @@
+package lastcache
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCache_CallbackMiddleware(t *testing.T) {
+	var calls []string
+	syncMiddleware := func(name string) func(next SyncCallback) SyncCallback {
+		return func(next SyncCallback) SyncCallback {
+			return func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+				calls = append(calls, name)
+				return next(ctx, key, prev)
+			}
+		}
+	}
+	cache := New(Config{
+		GlobalTTL:          time.Minute,
+		CallbackMiddleware: []func(next SyncCallback) SyncCallback{syncMiddleware("outer"), syncMiddleware("inner")},
+		AsyncCallbackMiddleware: []func(next AsyncCallback) AsyncCallback{
+			func(next AsyncCallback) AsyncCallback {
+				return func(ctx context.Context, key any, prev *Entry) (any, error) {
+					calls = append(calls, "async")
+					value, err := next(ctx, key, prev)
+					return value.(string) + " wrapped", err
+				}
+			},
+		},
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.LoadOrStore("sync", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		calls = append(calls, "callback")
+		return "value", false, nil
+	})
+	entry, _, _ := cache.AsyncLoadOrStore("async", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		calls = append(calls, "callback")
+		return "value", nil
+	})
+
+	if want := []string{"outer", "inner", "callback", "async", "callback"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls got %v, want %v", calls, want)
+	}
+	if entry.Value != "value wrapped" {
+		t.Errorf("AsyncLoadOrStore() got %+v, want the value of the middleware", entry)
+	}
+}
@@ -0,0 +1,34 @@
+// Package msgpackcodec provides a lastcache.Codec using MessagePack, which is compact and readable by most languages
+//
+// Importing the package registers the codec as "msgpack", so it can be used in snapshots
+//
+//	import _ "github.com/mbrostami/lastcache/msgpackcodec"
+//
+//	err := cache.Snapshot(file, "msgpack")
+package msgpackcodec
+
+import (
+	"github.com/mbrostami/lastcache"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Name the codec is registered by
+const Name = "msgpack"
+
+func init() {
+	lastcache.RegisterCodec(Name, Codec{})
+}
+
+// Codec lastcache.Codec implementation using MessagePack
+// Values stored as `any` will be decoded to their MessagePack representation (e.g. map[string]any, int8)
+type Codec struct{}
+
+// Marshal encodes v as MessagePack
+func (Codec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// Unmarshal decodes MessagePack data into v
+func (Codec) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
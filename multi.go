@@ -0,0 +1,212 @@
+package lastcache
+
+import (
+	"context"
+	"time"
+)
+
+// MultiRefresh is a handle to the background refreshes started by AsyncLoadOrStoreMulti
+type MultiRefresh struct {
+	done      chan struct{}
+	refreshes map[any]*Refresh
+}
+
+func newMultiRefresh(refreshes map[any]*Refresh) *MultiRefresh {
+	m := &MultiRefresh{
+		done:      make(chan struct{}),
+		refreshes: refreshes,
+	}
+	go func() {
+		for _, refresh := range refreshes {
+			<-refresh.Done()
+		}
+		close(m.done)
+	}()
+	return m
+}
+
+// Done returns a channel that is closed when the refreshes of all the keys are completed, failed or canceled
+func (m *MultiRefresh) Done() <-chan struct{} {
+	return m.done
+}
+
+// Keys returns the keys which are being refreshed
+func (m *MultiRefresh) Keys() []any {
+	keys := make([]any, 0, len(m.refreshes))
+	for key := range m.refreshes {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Result blocks until all the refreshes are completed and returns the refreshed entries and the errors by key
+// Each key is either in entries or in errs, see Refresh.Result
+func (m *MultiRefresh) Result() (entries map[any]Entry, errs map[any]error) {
+	<-m.done
+	entries = make(map[any]Entry, len(m.refreshes))
+	errs = make(map[any]error)
+	for key, refresh := range m.refreshes {
+		entry, err := refresh.Result()
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+		entries[key] = entry
+	}
+	return entries, errs
+}
+
+// Cancel cancels the refreshes, see Refresh.Cancel
+func (m *MultiRefresh) Cancel() {
+	for _, refresh := range m.refreshes {
+		refresh.Cancel()
+	}
+}
+
+// AsyncLoadOrStoreMulti loads the keys from cache with respect to the ttl, like AsyncLoadOrStore for a batch of keys
+//
+//  1. Fresh and stale entries are returned immediately, Entry.Stale reports the staleness of each key
+//  2. Missing keys are loaded by a single callback call, which the caller waits for
+//     2.1 If the callback returns error, it's returned as CallbackError of the missing keys without Config.DefaultValue
+//     2.2 Keys missing in the returned map, or with an error value, are not stored nor returned
+//  3. Expired keys are refreshed in background by a single callback call, and a MultiRefresh handle is returned
+//     to wait for them, otherwise it will be nil
+//     Keys which are already being refreshed are not refreshed again, but are waited for by the MultiRefresh
+func (c *Cache) AsyncLoadOrStoreMulti(keys []any, callback BatchRefreshFunc) (map[any]Entry, *MultiRefresh, error) {
+	return c.asyncLoadOrStoreMulti(c.context(), keys, callback)
+}
+
+// AsyncLoadOrStoreMultiWithCtx check AsyncLoadOrStoreMulti
+func (c *Cache) AsyncLoadOrStoreMultiWithCtx(ctx context.Context, keys []any, callback BatchRefreshFunc) (map[any]Entry, *MultiRefresh, error) {
+	return c.asyncLoadOrStoreMulti(ctx, keys, callback)
+}
+
+func (c *Cache) asyncLoadOrStoreMulti(ctx context.Context, keys []any, callback BatchRefreshFunc) (map[any]Entry, *MultiRefresh, error) {
+	if c.isClosed() {
+		return nil, nil, ErrClosed
+	}
+	keys, callerKeys, callback, err := c.tenantBatch(ctx, keys, callback)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the entries and the refreshes are returned by the keys of the caller
+	callerKey := func(key any) any {
+		if callerKeys == nil {
+			return key
+		}
+		return callerKeys[key]
+	}
+
+	entries := make(map[any]Entry, len(keys))
+	refreshes := make(map[any]*Refresh)
+	pending := make(map[any]batchItem)
+	seen := make(map[any]bool, len(keys))
+	var missing []any
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if c.IsDegraded() {
+			if entry, err := c.loadDegraded(key, callOptions{}); err == nil {
+				entries[callerKey(key)] = entry
+			}
+			continue
+		}
+
+		it, ok := c.loadItem(key)
+		if !ok {
+			if entry, ok := c.loadParent(key); ok {
+				c.recordHit(key)
+				entries[callerKey(key)] = entry
+				continue
+			}
+			c.recordMiss(key)
+			missing = append(missing, key)
+			continue
+		}
+
+		var entry Entry
+		if c.refreshDue(key, it) {
+			if !c.RefreshPaused() {
+				refresh, refreshCtx, started := c.startRefresh(ctx, key)
+				if started {
+					pending[key] = batchItem{ctx: refreshCtx, refresh: refresh}
+					entry.RefreshStatus = RefreshStarted
+				} else {
+					entry.RefreshStatus = RefreshCoalesced
+				}
+				refreshes[callerKey(key)] = refresh
+			} else {
+				entry.RefreshStatus = RefreshSkipped
+			}
+			if it.failures > 0 && c.exhausted(key) {
+				c.recordMiss(key)
+				continue
+			}
+			entry.Stale = true
+			entry.Source = SourceStaleFallback
+			c.recordStaleServe(key, c.now().Sub(it.expiresAt))
+			c.logStaleServe(key, c.now().Sub(it.expiresAt), it.err)
+		} else {
+			c.recordHit(key)
+		}
+		entry.Value, _ = c.itemValue(key, it)
+		entry.Version = it.version
+		if entry.Stale {
+			c.emit(EventStaleServe, key, entry.Value, nil)
+		}
+		entries[callerKey(key)] = entry
+	}
+
+	if len(pending) > 0 {
+		go c.refreshBatch(pending, callback)
+	}
+	var multi *MultiRefresh
+	if len(refreshes) > 0 {
+		multi = newMultiRefresh(refreshes)
+	}
+
+	if len(missing) == 0 {
+		return entries, multi, nil
+	}
+	values, err := c.loadMissing(ctx, missing, callback)
+	if err != nil {
+		var failed []any
+		for _, key := range missing {
+			if def, ok := c.defaultEntry(key, err); ok {
+				entries[callerKey(key)] = def
+			} else {
+				failed = append(failed, key)
+			}
+		}
+		if len(failed) == 0 {
+			return entries, multi, nil
+		}
+		return entries, multi, callbackError(failed, err)
+	}
+	for _, key := range missing {
+		if value, ok := values[key]; ok {
+			if _, isErr := value.(error); isErr {
+				continue
+			}
+			entries[callerKey(key)] = c.store(key, value)
+			c.recordStoredMiss(key)
+		}
+	}
+	return entries, multi, nil
+}
+
+// loadMissing calls the callback for the missing keys and records its latency
+func (c *Cache) loadMissing(ctx context.Context, keys []any, callback BatchRefreshFunc) (map[any]any, error) {
+	if err := c.acquireSync(ctx); err != nil {
+		return nil, err
+	}
+	defer c.releaseSync()
+
+	start := time.Now()
+	values, err := callback(ctx, keys)
+	c.recordCallback(nil, CallbackSync, time.Since(start), err)
+	return values, err
+}
@@ -0,0 +1,109 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache_AsyncLoadOrStoreMulti(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute})
+
+	var mu sync.Mutex
+	var calls [][]any
+	callback := func(ctx context.Context, keys []any) (map[any]any, error) {
+		mu.Lock()
+		sorted := append([]any(nil), keys...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].(string) < sorted[j].(string) })
+		calls = append(calls, sorted)
+		mu.Unlock()
+
+		values := make(map[any]any)
+		for _, key := range keys {
+			if key != "unknown" {
+				values[key] = "new " + key.(string)
+			}
+		}
+		return values, nil
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("stale1", "old")
+	cache.Set("stale2", "old")
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+	cache.Set("fresh", "old")
+
+	entries, refresh, err := cache.AsyncLoadOrStoreMulti([]any{"fresh", "stale1", "stale2", "missing", "unknown", "fresh"}, callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("entries got %+v, want 4 entries", entries)
+	}
+	if e := entries["fresh"]; e.Value != "old" || e.Stale {
+		t.Errorf("fresh got %+v", e)
+	}
+	if e := entries["stale1"]; e.Value != "old" || !e.Stale {
+		t.Errorf("stale1 got %+v", e)
+	}
+	if e := entries["missing"]; e.Value != "new missing" || e.Stale {
+		t.Errorf("missing got %+v", e)
+	}
+	if refresh == nil || len(refresh.Keys()) != 2 {
+		t.Fatalf("refresh got %+v, want 2 keys", refresh)
+	}
+
+	refreshed, errs := refresh.Result()
+	if len(errs) != 0 || refreshed["stale1"].Value != "new stale1" || refreshed["stale2"].Value != "new stale2" {
+		t.Errorf("Result() got %+v, %v", refreshed, errs)
+	}
+	if entry, _ := cache.Get("stale2"); entry.Value != "new stale2" || entry.Stale {
+		t.Errorf("Get(stale2) got %+v", entry)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 2 {
+		t.Fatalf("callback got %d calls, want 2", len(calls))
+	}
+	for _, keys := range calls {
+		if len(keys) == 2 && keys[0] == "missing" && keys[1] == "unknown" {
+			continue
+		}
+		if len(keys) == 2 && keys[0] == "stale1" && keys[1] == "stale2" {
+			continue
+		}
+		t.Errorf("callback got unexpected keys %v", keys)
+	}
+}
+
+func TestCache_AsyncLoadOrStoreMulti_Error(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute})
+	callbackErr := errors.New("failed")
+	callback := func(ctx context.Context, keys []any) (map[any]any, error) {
+		return nil, callbackErr
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("stale", "old")
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+
+	entries, refresh, err := cache.AsyncLoadOrStoreMulti([]any{"stale", "missing"}, callback)
+	if !errors.Is(err, callbackErr) || !errors.Is(err, ErrCallbackFailed) {
+		t.Errorf("err got %v, want the callback error", err)
+	}
+	if len(entries) != 1 || !entries["stale"].Stale {
+		t.Errorf("entries got %+v, want the stale entry", entries)
+	}
+
+	<-refresh.Done()
+	if _, errs := refresh.Result(); !errors.Is(errs["stale"], callbackErr) {
+		t.Errorf("Result() errs got %v, want the callback error", errs)
+	}
+	if entry, _ := cache.Get("stale"); entry.Value != "old" {
+		t.Errorf("Get(stale) got %+v, want the stale value", entry)
+	}
+}
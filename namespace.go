@@ -0,0 +1,122 @@
+package lastcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// NamespaceStats statistics of the keys of a namespace or tenant, see Config.StatsNamespace
+type NamespaceStats struct {
+	Hits           uint64
+	Misses         uint64
+	StaleServes    uint64
+	CallbackErrors uint64
+	// StaleAge sum of the ages of the stale values of the namespace served
+	StaleAge time.Duration
+	// ShadowChecks, ShadowMismatches and ShadowMismatchAge see Stats
+	ShadowChecks      uint64
+	ShadowMismatches  uint64
+	ShadowMismatchAge time.Duration
+}
+
+// Add returns the sum of the statistics
+func (s NamespaceStats) Add(o NamespaceStats) NamespaceStats {
+	return NamespaceStats{
+		Hits:           s.Hits + o.Hits,
+		Misses:         s.Misses + o.Misses,
+		StaleServes:    s.StaleServes + o.StaleServes,
+		CallbackErrors: s.CallbackErrors + o.CallbackErrors,
+		StaleAge:       s.StaleAge + o.StaleAge,
+
+		ShadowChecks:      s.ShadowChecks + o.ShadowChecks,
+		ShadowMismatches:  s.ShadowMismatches + o.ShadowMismatches,
+		ShadowMismatchAge: s.ShadowMismatchAge + o.ShadowMismatchAge,
+	}
+}
+
+// NamespaceMetrics can be implemented by Metrics to receive the activity per namespace, see Config.StatsNamespace
+// The methods are called along with the methods of Metrics for the keys which have a namespace
+type NamespaceMetrics interface {
+	NamespaceHit(namespace string)
+	NamespaceMiss(namespace string)
+	NamespaceStaleServe(namespace string)
+	NamespaceCallbackDone(namespace string, mode CallbackMode, duration time.Duration, err error)
+}
+
+type namespaceStats struct {
+	hits           uint64
+	misses         uint64
+	staleServes    uint64
+	callbackErrors uint64
+	staleAge       int64
+
+	shadowChecks      uint64
+	shadowMismatches  uint64
+	shadowMismatchAge int64
+}
+
+func (s *namespaceStats) snapshot(reset bool) NamespaceStats {
+	load, loadInt := atomic.LoadUint64, atomic.LoadInt64
+	if reset {
+		load = func(addr *uint64) uint64 { return atomic.SwapUint64(addr, 0) }
+		loadInt = func(addr *int64) int64 { return atomic.SwapInt64(addr, 0) }
+	}
+	return NamespaceStats{
+		Hits:           load(&s.hits),
+		Misses:         load(&s.misses),
+		StaleServes:    load(&s.staleServes),
+		CallbackErrors: load(&s.callbackErrors),
+		StaleAge:       time.Duration(loadInt(&s.staleAge)),
+
+		ShadowChecks:      load(&s.shadowChecks),
+		ShadowMismatches:  load(&s.shadowMismatches),
+		ShadowMismatchAge: time.Duration(loadInt(&s.shadowMismatchAge)),
+	}
+}
+
+// namespaceOf returns the namespace of the key by Config.StatsNamespace, or its tenant if Config.TenantFunc is set
+func (c *Cache) namespaceOf(key any) (string, bool) {
+	if c.config.StatsNamespace != nil {
+		return c.config.StatsNamespace(key), true
+	}
+	if c.config.TenantFunc != nil {
+		if tk, ok := key.(TenantKey); ok {
+			return tk.Tenant, true
+		}
+	}
+	return "", false
+}
+
+// namespaceStatsOf returns the statistics of the namespace of the key, nil if it has no namespace
+func (c *Cache) namespaceStatsOf(key any) (string, *namespaceStats) {
+	if key == nil {
+		return "", nil
+	}
+	namespace, ok := c.namespaceOf(key)
+	if !ok {
+		return "", nil
+	}
+	if v, ok := c.namespaceStats.Load(namespace); ok {
+		return namespace, v.(*namespaceStats)
+	}
+	v, _ := c.namespaceStats.LoadOrStore(namespace, &namespaceStats{})
+	return namespace, v.(*namespaceStats)
+}
+
+// namespacesStats returns the statistics per namespace, nil if there is none
+func (c *Cache) namespacesStats(reset bool) map[string]NamespaceStats {
+	var namespaces map[string]NamespaceStats
+	c.namespaceStats.Range(func(key, value any) bool {
+		if namespaces == nil {
+			namespaces = make(map[string]NamespaceStats)
+		}
+		namespaces[key.(string)] = value.(*namespaceStats).snapshot(reset)
+		return true
+	})
+	return namespaces
+}
+
+func (c *Cache) namespaceMetrics() NamespaceMetrics {
+	m, _ := c.config.Metrics.(NamespaceMetrics)
+	return m
+}
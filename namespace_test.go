@@ -0,0 +1,97 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type namespaceMetrics struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (m *namespaceMetrics) Hit(key any)        {}
+func (m *namespaceMetrics) Miss(key any)       {}
+func (m *namespaceMetrics) StaleServe(key any) {}
+func (m *namespaceMetrics) CallbackDone(key any, mode CallbackMode, duration time.Duration, err error) {
+}
+
+func (m *namespaceMetrics) NamespaceHit(namespace string)        { m.count("hit:" + namespace) }
+func (m *namespaceMetrics) NamespaceMiss(namespace string)       { m.count("miss:" + namespace) }
+func (m *namespaceMetrics) NamespaceStaleServe(namespace string) { m.count("stale:" + namespace) }
+func (m *namespaceMetrics) NamespaceCallbackDone(namespace string, mode CallbackMode, duration time.Duration, err error) {
+	if err != nil {
+		m.count("error:" + namespace)
+	}
+}
+
+func (m *namespaceMetrics) count(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[name]++
+}
+
+func TestCache_StatsNamespace(t *testing.T) {
+	metrics := &namespaceMetrics{counts: make(map[string]int)}
+	cache := New(Config{GlobalTTL: time.Minute, Metrics: metrics, StatsNamespace: func(key any) string {
+		return strings.SplitN(key.(string), ":", 2)[0]
+	}})
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		if strings.HasPrefix(key.(string), "order") {
+			return nil, true, errors.New("failed")
+		}
+		return "value", false, nil
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.LoadOrStore("user:1", callback)
+	cache.LoadOrStore("user:1", callback)
+	cache.Set("order:1", "value")
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+	cache.LoadOrStore("order:1", callback)
+
+	stats := cache.Stats()
+	want := map[string]NamespaceStats{
+		"user":  {Hits: 1, Misses: 1},
+		"order": {Misses: 1, StaleServes: 1, CallbackErrors: 1, StaleAge: time.Minute},
+	}
+	for namespace, s := range want {
+		if stats.Namespaces[namespace] != s {
+			t.Errorf("Stats() of %s got %+v, want %+v", namespace, stats.Namespaces[namespace], s)
+		}
+	}
+	for name, count := range map[string]int{"hit:user": 1, "miss:user": 1, "miss:order": 1, "stale:order": 1, "error:order": 1} {
+		if metrics.counts[name] != count {
+			t.Errorf("NamespaceMetrics got %d %s, want %d", metrics.counts[name], name, count)
+		}
+	}
+
+	if sum := stats.Add(stats); sum.Namespaces["user"].Hits != 2 {
+		t.Errorf("Stats.Add() got %+v, want the namespaces added", sum.Namespaces)
+	}
+	cache.ResetStats()
+	if stats := cache.Stats(); stats.Namespaces["user"] != (NamespaceStats{}) {
+		t.Errorf("Stats() after ResetStats got %+v", stats.Namespaces)
+	}
+}
+
+func TestCache_StatsByTenant(t *testing.T) {
+	now = func() time.Time { return fixedTime() }
+	cache := New(Config{TenantFunc: func(ctx context.Context) string {
+		tenant, _ := ctx.Value(tenantContextKey{}).(string)
+		return tenant
+	}})
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return "value", false, nil
+	}
+
+	cache.LoadOrStoreWithCtx(withTenant(context.Background(), "acme"), "key", callback)
+	cache.LoadOrStoreWithCtx(withTenant(context.Background(), "acme"), "key", callback)
+	if stats := cache.Stats(); stats.Namespaces["acme"] != (NamespaceStats{Hits: 1, Misses: 1}) {
+		t.Errorf("Stats() got %+v, want the stats of the tenant", stats.Namespaces)
+	}
+}
@@ -0,0 +1,58 @@
+package lastcache
+
+import "time"
+
+// CallOption overrides the behavior of a single LoadOrStore or AsyncLoadOrStore call
+type CallOption func(o *callOptions)
+
+type callOptions struct {
+	forceRefresh bool
+	noStale      bool
+	noExtend     bool
+	ttl          time.Duration
+}
+
+// WithForceRefresh the cached value is treated as expired, so the callback is called even if the entry is fresh
+// LoadOrStore waits for the callback, while AsyncLoadOrStore refreshes the key in background,
+// by Config.BatchRefresh if it's set
+func WithForceRefresh() CallOption {
+	return func(o *callOptions) {
+		o.forceRefresh = true
+	}
+}
+
+// WithNoStale the stale entry is never returned, the fresh entry or the error is returned instead
+// LoadOrStore returns the callback error regardless of useStale and Config.StaleTimeout,
+// and AsyncLoadOrStore waits for the background refresh of the expired key
+func WithNoStale() CallOption {
+	return func(o *callOptions) {
+		o.noStale = true
+	}
+}
+
+// WithTTL the value returned by the callback is stored with ttl instead of Config.GlobalTTL,
+// including the values of Config.BatchRefresh refreshing the keys of AsyncLoadOrStore
+func WithTTL(ttl time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithNoExtend the ttl of the stale entry is not extended by Config.ExtendTTL when the callback fails
+func WithNoExtend() CallOption {
+	return func(o *callOptions) {
+		o.noExtend = true
+	}
+}
+
+// newCallOptions applies opts, calls without options don't allocate
+func newCallOptions(opts []CallOption) callOptions {
+	if len(opts) == 0 {
+		return callOptions{}
+	}
+	o := new(callOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return *o
+}
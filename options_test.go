@@ -0,0 +1,85 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCache_WithForceRefresh(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "old")
+
+	entry, err := cache.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return "new", false, nil
+	}, WithForceRefresh())
+	if err != nil || entry.Value != "new" || !entry.CallbackInvoked {
+		t.Errorf("LoadOrStore() got %+v, %v, want the new value", entry, err)
+	}
+
+	entry, refresh, err := cache.AsyncLoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return "newer", nil
+	}, WithForceRefresh())
+	if err != nil || entry.Value != "new" || refresh == nil {
+		t.Fatalf("AsyncLoadOrStore() got %+v, %v, %v, want the cached value with a refresh", entry, refresh, err)
+	}
+	if entry, err = refresh.Result(); err != nil || entry.Value != "newer" {
+		t.Errorf("Result() got %+v, %v, want the newer value", entry, err)
+	}
+}
+
+func TestCache_WithNoStale(t *testing.T) {
+	cause := errors.New("unavailable")
+	cache := New(Config{GlobalTTL: time.Minute, ExtendTTL: time.Minute})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "old")
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+
+	entry, err := cache.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, true, cause
+	}, WithNoStale())
+	if !errors.Is(err, cause) || entry.Value != nil {
+		t.Errorf("LoadOrStore() got %+v, %v, want %v", entry, err, cause)
+	}
+
+	entry, refresh, err := cache.AsyncLoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return "new", nil
+	}, WithNoStale())
+	if err != nil || entry.Value != "new" || entry.Stale || refresh != nil {
+		t.Errorf("AsyncLoadOrStore() got %+v, %v, %v, want the refreshed value", entry, refresh, err)
+	}
+}
+
+func TestCache_WithTTL(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute})
+
+	now = func() time.Time { return fixedTime() }
+	cache.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return "value", false, nil
+	}, WithTTL(time.Hour))
+	if ttl := cache.TTL("key"); ttl != time.Hour {
+		t.Errorf("TTL() got %v, want %v", ttl, time.Hour)
+	}
+}
+
+func TestCache_WithNoExtend(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute, ExtendTTL: time.Minute})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "old")
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+
+	entry, err := cache.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, true, errors.New("unavailable")
+	}, WithNoExtend())
+	if err != nil || !entry.Stale {
+		t.Errorf("LoadOrStore() got %+v, %v, want the stale value", entry, err)
+	}
+	if ttl := cache.TTL("key"); ttl != -time.Minute {
+		t.Errorf("TTL() got %v, want the ttl not to be extended", ttl)
+	}
+}
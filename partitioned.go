@@ -0,0 +1,148 @@
+package lastcache
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ringReplicas number of the points of each node on the consistent hash ring
+const ringReplicas = 128
+
+// hashRing consistent hash ring, which maps the keys to nodes,
+// so adding or removing a node moves only the keys of that node
+type hashRing struct {
+	hashes []uint64
+	nodes  []int
+}
+
+// newHashRing returns a ring of the nodes identified by names
+func newHashRing(names []string) *hashRing {
+	r := &hashRing{}
+	for node, name := range names {
+		for i := 0; i < ringReplicas; i++ {
+			r.hashes = append(r.hashes, hashString(name+"#"+strconv.Itoa(i)))
+			r.nodes = append(r.nodes, node)
+		}
+	}
+	sort.Sort(r)
+	return r
+}
+
+func (r *hashRing) Len() int           { return len(r.hashes) }
+func (r *hashRing) Less(i, j int) bool { return r.hashes[i] < r.hashes[j] }
+func (r *hashRing) Swap(i, j int) {
+	r.hashes[i], r.hashes[j] = r.hashes[j], r.hashes[i]
+	r.nodes[i], r.nodes[j] = r.nodes[j], r.nodes[i]
+}
+
+// node returns the index of the node which owns the key
+func (r *hashRing) node(key any) int {
+	h := hashKey(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[i]
+}
+
+// Partitioned routes the keys to one of the partitions by consistent hashing
+// Each partition is a separate Cache with its own config, semaphores, locks and stats,
+// which reduces the contention, and allows partitions to be tuned separately
+type Partitioned struct {
+	partitions []*Cache
+	ring       *hashRing
+}
+
+// NewPartitioned returns a Partitioned with a partition per config
+// At least one config must be given
+func NewPartitioned(configs ...Config) *Partitioned {
+	if len(configs) == 0 {
+		panic("lastcache: NewPartitioned needs at least one config")
+	}
+
+	p := &Partitioned{partitions: make([]*Cache, len(configs))}
+	names := make([]string, len(configs))
+	for i, config := range configs {
+		p.partitions[i] = New(config)
+		names[i] = strconv.Itoa(i)
+	}
+	p.ring = newHashRing(names)
+	return p
+}
+
+// Partition returns the partition which owns the key
+func (p *Partitioned) Partition(key any) *Cache {
+	return p.partitions[p.ring.node(key)]
+}
+
+// Partitions returns all the partitions
+func (p *Partitioned) Partitions() []*Cache {
+	return append([]*Cache(nil), p.partitions...)
+}
+
+// Get see Cache.Get
+func (p *Partitioned) Get(key any) (Entry, error) {
+	return p.Partition(key).Get(key)
+}
+
+// Set see Cache.Set
+func (p *Partitioned) Set(key, value any) (prev any, replaced bool) {
+	return p.Partition(key).Set(key, value)
+}
+
+// Delete see Cache.Delete
+func (p *Partitioned) Delete(key any) {
+	p.Partition(key).Delete(key)
+}
+
+// LoadOrStore see Cache.LoadOrStore
+func (p *Partitioned) LoadOrStore(key any, callback SyncCallback, opts ...CallOption) (Entry, error) {
+	return p.Partition(key).LoadOrStore(key, callback, opts...)
+}
+
+// LoadOrStoreWithCtx see Cache.LoadOrStoreWithCtx
+func (p *Partitioned) LoadOrStoreWithCtx(ctx context.Context, key any, callback SyncCallback, opts ...CallOption) (Entry, error) {
+	return p.Partition(key).LoadOrStoreWithCtx(ctx, key, callback, opts...)
+}
+
+// AsyncLoadOrStore see Cache.AsyncLoadOrStore
+func (p *Partitioned) AsyncLoadOrStore(key any, callback AsyncCallback, opts ...CallOption) (Entry, *Refresh, error) {
+	return p.Partition(key).AsyncLoadOrStore(key, callback, opts...)
+}
+
+// AsyncLoadOrStoreWithCtx see Cache.AsyncLoadOrStoreWithCtx
+func (p *Partitioned) AsyncLoadOrStoreWithCtx(ctx context.Context, key any, callback AsyncCallback, opts ...CallOption) (Entry, *Refresh, error) {
+	return p.Partition(key).AsyncLoadOrStoreWithCtx(ctx, key, callback, opts...)
+}
+
+// Range calls f for the keys of all the partitions, one partition after another, see Cache.Range
+func (p *Partitioned) Range(f func(key, value any, ttl time.Duration) bool) {
+	next := true
+	for _, c := range p.partitions {
+		c.Range(func(key, value any, ttl time.Duration) bool {
+			next = f(key, value, ttl)
+			return next
+		})
+		if !next {
+			return
+		}
+	}
+}
+
+// Stats returns the sum of the statistics of the partitions, see Stats.Add
+func (p *Partitioned) Stats() Stats {
+	var s Stats
+	for _, c := range p.partitions {
+		s = s.Add(c.Stats())
+	}
+	return s
+}
+
+// Close closes all the partitions
+func (p *Partitioned) Close() {
+	for _, c := range p.partitions {
+		c.Close()
+	}
+}
@@ -0,0 +1,88 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHashRing(t *testing.T) {
+	ring := newHashRing([]string{"0", "1", "2", "3"})
+	counts := make([]int, 4)
+	for i := 0; i < 10000; i++ {
+		counts[ring.node(i)]++
+	}
+	for node, n := range counts {
+		if n < 1500 || n > 3500 {
+			t.Errorf("node %v got %v keys, want about 2500", node, n)
+		}
+	}
+
+	// adding a node moves only the keys which the new node owns
+	grown := newHashRing([]string{"0", "1", "2", "3", "4"})
+	for i := 0; i < 10000; i++ {
+		if n := grown.node(i); n != 4 && n != ring.node(i) {
+			t.Fatalf("key %v moved from %v to %v", i, ring.node(i), n)
+		}
+	}
+}
+
+func TestPartitioned(t *testing.T) {
+	p := NewPartitioned(Config{GlobalTTL: time.Minute}, Config{GlobalTTL: time.Hour})
+	defer p.Close()
+
+	for i := 0; i < 100; i++ {
+		p.Set(i, strconv.Itoa(i))
+	}
+	for i := 0; i < 100; i++ {
+		if entry, err := p.Partition(i).Get(i); err != nil || entry.Value != strconv.Itoa(i) {
+			t.Fatalf("key %v is not stored in its partition, got %+v, %v", i, entry, err)
+		}
+	}
+
+	n := 0
+	for _, c := range p.Partitions() {
+		c.Range(func(key, value any, ttl time.Duration) bool {
+			n++
+			return true
+		})
+	}
+	if n != 100 {
+		t.Errorf("partitions have %v keys, want 100", n)
+	}
+
+	p.Delete(1)
+	if _, err := p.Get(1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() err got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestPartitioned_Stats(t *testing.T) {
+	p := NewPartitioned(Config{}, Config{}, Config{})
+	defer p.Close()
+
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return key, false, nil
+	}
+	for i := 0; i < 30; i++ {
+		p.LoadOrStore(i, callback)
+		p.LoadOrStore(i, callback)
+	}
+
+	stats := p.Stats()
+	if stats.Hits != 30 || stats.Misses != 30 {
+		t.Errorf("Stats() got %v hits and %v misses, want 30 and 30", stats.Hits, stats.Misses)
+	}
+	if stats.SyncCallbackLatency.Count != 30 {
+		t.Errorf("SyncCallbackLatency.Count got %v, want 30", stats.SyncCallbackLatency.Count)
+	}
+	var counts uint64
+	for _, n := range stats.SyncCallbackLatency.Counts {
+		counts += n
+	}
+	if counts != 30 {
+		t.Errorf("SyncCallbackLatency.Counts sum got %v, want 30", counts)
+	}
+}
@@ -0,0 +1,272 @@
+// Package peers fetches the missing keys from their owner peer before calling the origin, like groupcache
+//
+// Each key is owned by one of the peers, chosen by consistent hashing.
+// On a local miss the owner is asked for the value, which loads it from the origin by Config.Getter at most once
+// across the fleet, so the origin load doesn't grow with the number of instances.
+// If the owner is unreachable, the value is loaded from the origin locally.
+//
+//	group, err := peers.New(cache, peers.Config{Self: "http://10.0.0.1:8080/peers", Peers: addrs, Getter: loadUser})
+//	mux.Handle("/peers/", http.StripPrefix("/peers", group.Handler()))
+//	entry, err := group.Get(ctx, "user:42")
+package peers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/mbrostami/lastcache"
+)
+
+const (
+	defaultCodec = "gob"
+
+	// ringReplicas number of the points of each peer on the consistent hash ring
+	ringReplicas = 128
+
+	getPath = "/get"
+)
+
+// ErrNoGetter is returned by New when Config.Getter is not set
+var ErrNoGetter = errors.New("peers: Config.Getter must be set")
+
+// OwnerError is returned when the owner peer failed to load the key from the origin
+type OwnerError struct {
+	Peer    string
+	Message string
+}
+
+func (e *OwnerError) Error() string {
+	return fmt.Sprintf("peers: owner %s failed: %s", e.Peer, e.Message)
+}
+
+// Config of the Group
+type Config struct {
+	// Self base URL of the handler of this instance, as it's listed in Peers
+	Self string
+
+	// Peers base URLs of the handlers of all the instances, including Self
+	// All the instances must have the same list, so they agree on the owners of the keys
+	Peers []string
+
+	// Getter loads the value of the key from the origin, it's called only by the owner of the key,
+	// or locally if the owner is unreachable
+	Getter lastcache.SyncCallback
+
+	// Client used to fetch the values from the peers
+	// Default is http.DefaultClient
+	Client *http.Client
+
+	// Codec name of the registered codec to encode the values, which must be the same on all the peers
+	// Default is "gob"
+	Codec string
+
+	// Token if set, the requests are authenticated by this bearer token, which must be the same on all the peers
+	Token string
+
+	// OnError is called when a peer is unreachable, before the value is loaded from the origin locally
+	OnError func(peer string, err error)
+}
+
+// response the value as it's sent by the owner
+type response struct {
+	Value any
+	Stale bool
+}
+
+// Group loads the keys through their owner peers
+type Group struct {
+	cache  *lastcache.Cache
+	config Config
+	codec  lastcache.Codec
+	ring   *ring
+}
+
+// New returns a Group which stores the loaded values in cache, Self is added to Peers if it's not listed
+func New(cache *lastcache.Cache, config Config) (*Group, error) {
+	if config.Getter == nil {
+		return nil, ErrNoGetter
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.Codec == "" {
+		config.Codec = defaultCodec
+	}
+	codec, ok := lastcache.LookupCodec(config.Codec)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", lastcache.ErrUnknownCodec, config.Codec)
+	}
+
+	peers := append([]string(nil), config.Peers...)
+	if !contains(peers, config.Self) {
+		peers = append(peers, config.Self)
+	}
+	return &Group{
+		cache:  cache,
+		config: config,
+		codec:  codec,
+		ring:   newRing(peers),
+	}, nil
+}
+
+// Owner returns the base URL of the peer which owns the key
+func (g *Group) Owner(key string) string {
+	return g.ring.peer(key)
+}
+
+// Get returns the cached value of the key, on a miss the value is loaded through the owner of the key
+// The loaded value is cached locally as well, with the stale-if-error semantics of Cache.LoadOrStore
+func (g *Group) Get(ctx context.Context, key string) (lastcache.Entry, error) {
+	owner := g.Owner(key)
+	if owner == g.config.Self {
+		return g.cache.LoadOrStoreWithCtx(ctx, key, g.config.Getter)
+	}
+
+	return g.cache.LoadOrStoreWithCtx(ctx, key, func(ctx context.Context, key any, prev *lastcache.Entry) (any, bool, error) {
+		value, err := g.fetch(ctx, owner, key.(string))
+		var ownerErr *OwnerError
+		if err == nil || errors.As(err, &ownerErr) || errors.Is(err, lastcache.ErrTombstone) {
+			return value, prev != nil, err
+		}
+
+		if g.config.OnError != nil {
+			g.config.OnError(owner, err)
+		}
+		return g.config.Getter(ctx, key, prev)
+	})
+}
+
+// fetch gets the value of the key from the owner
+func (g *Group) fetch(ctx context.Context, owner, key string) (any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, owner+getPath+"?key="+url.QueryEscape(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	if g.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.config.Token)
+	}
+
+	resp, err := g.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var r response
+		if err = g.codec.Unmarshal(body, &r); err != nil {
+			return nil, err
+		}
+		return r.Value, nil
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("peers: owner %s: %w", owner, lastcache.ErrTombstone)
+	case http.StatusBadGateway:
+		return nil, &OwnerError{Peer: owner, Message: string(body)}
+	default:
+		return nil, fmt.Errorf("peers: unexpected status %d", resp.StatusCode)
+	}
+}
+
+// Handler returns the handler which serves the keys owned by this instance to the peers
+// It should be mounted at the Config.Self base URL
+func (g *Group) Handler() http.Handler {
+	return http.HandlerFunc(g.handleGet)
+}
+
+func (g *Group) handleGet(w http.ResponseWriter, req *http.Request) {
+	if g.config.Token != "" {
+		want := []byte("Bearer " + g.config.Token)
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), want) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	if req.URL.Path != getPath || req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// keys are loaded locally even if this instance doesn't own them, e.g. while the peers are being changed,
+	// so the requests are never forwarded again
+	entry, err := g.cache.LoadOrStoreWithCtx(req.Context(), req.URL.Query().Get("key"), g.config.Getter)
+	if errors.Is(err, lastcache.ErrTombstone) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	body, err := g.codec.Marshal(response{Value: entry.Value, Stale: entry.Stale})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+// ring consistent hash ring of the peers
+// Unlike lastcache.Partitioned, the hash must be the same in all the processes, so it doesn't use a random seed
+type ring struct {
+	hashes []uint64
+	peers  []string
+}
+
+func newRing(peers []string) *ring {
+	r := &ring{}
+	for _, peer := range peers {
+		for i := 0; i < ringReplicas; i++ {
+			r.hashes = append(r.hashes, hash(peer+"#"+strconv.Itoa(i)))
+			r.peers = append(r.peers, peer)
+		}
+	}
+	sort.Sort(r)
+	return r
+}
+
+func (r *ring) Len() int           { return len(r.hashes) }
+func (r *ring) Less(i, j int) bool { return r.hashes[i] < r.hashes[j] }
+func (r *ring) Swap(i, j int) {
+	r.hashes[i], r.hashes[j] = r.hashes[j], r.hashes[i]
+	r.peers[i], r.peers[j] = r.peers[j], r.peers[i]
+}
+
+// peer returns the peer which owns the key
+func (r *ring) peer(key string) string {
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.peers[i]
+}
+
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package peers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+// newGroups returns n groups which fetch through each other
+func newGroups(t *testing.T, n int, config Config) []*Group {
+	t.Helper()
+	groups := make([]*Group, n)
+	servers := make([]*httptest.Server, n)
+	var addrs []string
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			groups[i].Handler().ServeHTTP(w, r)
+		}))
+		t.Cleanup(servers[i].Close)
+		addrs = append(addrs, servers[i].URL)
+	}
+	for i := range groups {
+		groupConfig := config
+		groupConfig.Self = addrs[i]
+		groupConfig.Peers = addrs
+		g, err := New(lastcache.New(lastcache.Config{GlobalTTL: time.Minute}), groupConfig)
+		if err != nil {
+			t.Fatalf("New() failed with err: %v", err)
+		}
+		groups[i] = g
+	}
+	return groups
+}
+
+func TestGroup_Get(t *testing.T) {
+	var calls int32
+	groups := newGroups(t, 3, Config{
+		Token: "secret",
+		Getter: func(ctx context.Context, key any, prev *lastcache.Entry) (any, bool, error) {
+			atomic.AddInt32(&calls, 1)
+			return "value_" + key.(string), false, nil
+		},
+	})
+
+	for i := 0; i < 10; i++ {
+		key := strconv.Itoa(i)
+		for _, g := range groups {
+			entry, err := g.Get(context.Background(), key)
+			if err != nil || entry.Value != "value_"+key {
+				t.Fatalf("Get() got %+v, %v, want value_%v", entry, err, key)
+			}
+		}
+	}
+	// the origin is called once per key across the group
+	if calls != 10 {
+		t.Errorf("Getter called %v times, want 10", calls)
+	}
+}
+
+// ownedKey returns a key with the prefix which is owned by the peer
+func ownedKey(g *Group, prefix, peer string) string {
+	for i := 0; ; i++ {
+		if key := prefix + strconv.Itoa(i); g.Owner(key) == peer {
+			return key
+		}
+	}
+}
+
+func TestGroup_Errors(t *testing.T) {
+	groups := newGroups(t, 2, Config{
+		Getter: func(ctx context.Context, key any, prev *lastcache.Entry) (any, bool, error) {
+			switch key.(string)[0] {
+			case 'd':
+				return nil, false, lastcache.ErrTombstone
+			case 'f':
+				return nil, false, errors.New("origin is down")
+			}
+			return "value", false, nil
+		},
+	})
+	g, owner := groups[0], groups[1].config.Self
+
+	if _, err := g.Get(context.Background(), ownedKey(g, "d", owner)); !errors.Is(err, lastcache.ErrTombstone) {
+		t.Errorf("Get() err got %v, want %v", err, lastcache.ErrTombstone)
+	}
+	var ownerErr *OwnerError
+	if _, err := g.Get(context.Background(), ownedKey(g, "f", owner)); !errors.As(err, &ownerErr) || ownerErr.Peer != owner {
+		t.Errorf("Get() err got %v, want OwnerError of %v", err, owner)
+	}
+}
+
+func TestGroup_UnreachableOwner(t *testing.T) {
+	var calls int32
+	var peerErr error
+	g, err := New(lastcache.New(lastcache.Config{}), Config{
+		Self:  "http://self",
+		Peers: []string{"http://self", "http://127.0.0.1:1"},
+		Getter: func(ctx context.Context, key any, prev *lastcache.Entry) (any, bool, error) {
+			atomic.AddInt32(&calls, 1)
+			return "value", false, nil
+		},
+		OnError: func(peer string, err error) {
+			peerErr = err
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() failed with err: %v", err)
+	}
+
+	key := ownedKey(g, "key", "http://127.0.0.1:1")
+	if entry, err := g.Get(context.Background(), key); err != nil || entry.Value != "value" {
+		t.Errorf("Get() got %+v, %v, want value", entry, err)
+	}
+	if calls != 1 || peerErr == nil {
+		t.Errorf("Getter called %v times with peer error %v, want the origin to be called locally", calls, peerErr)
+	}
+}
+
+func TestNew_NoGetter(t *testing.T) {
+	if _, err := New(lastcache.New(lastcache.Config{}), Config{}); !errors.Is(err, ErrNoGetter) {
+		t.Errorf("New() err got %v, want %v", err, ErrNoGetter)
+	}
+}
@@ -0,0 +1,49 @@
+package lastcache
+
+import (
+	"context"
+	"sync"
+)
+
+// Prefetch concurrently loads the keys by LoadOrStoreWithCtx, e.g. to warm a known working set ahead of a traffic spike
+// The number of concurrent callbacks is bounded by Config.AsyncSemaphore
+// Fresh keys are not loaded again, and expired keys are refreshed by the callback
+// If any of the keys fails, PrefetchError will be returned after all the keys are processed
+func (c *Cache) Prefetch(ctx context.Context, callback SyncCallback, keys ...any) error {
+	c.lazyInit()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+
+	_, size := c.semaphore.usage()
+	workers := make(chan struct{}, size)
+	for _, key := range keys {
+		select {
+		case workers <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+
+		wg.Add(1)
+		go func(key any) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+
+			if _, err := c.LoadOrStoreWithCtx(ctx, key, callback); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &PrefetchError{Errors: errs}
+	}
+	return nil
+}
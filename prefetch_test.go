@@ -0,0 +1,68 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache_Prefetch(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL:      time.Hour,
+		AsyncSemaphore: 2,
+	})
+
+	var running, maxRunning int64
+	err := cache.Prefetch(context.Background(), func(_ context.Context, key any, prev *Entry) (any, bool, error) {
+		n := atomic.AddInt64(&running, 1)
+		defer atomic.AddInt64(&running, -1)
+		for {
+			m := atomic.LoadInt64(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt64(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return fmt.Sprintf("value_%v", key), false, nil
+	}, "key1", "key2", "key3", "key4")
+	if err != nil {
+		t.Fatalf("failed with err: %v", err)
+	}
+
+	if maxRunning > 2 {
+		t.Errorf("concurrent callbacks got = %v, want at most 2", maxRunning)
+	}
+
+	for _, key := range []string{"key1", "key2", "key3", "key4"} {
+		entry, err := cache.Get(key)
+		if err != nil || entry.Value != "value_"+key {
+			t.Errorf("Get(%v) got %+v, %v", key, entry, err)
+		}
+	}
+}
+
+func TestCache_PrefetchError(t *testing.T) {
+	cache := New(Config{})
+
+	wantErr := errors.New("unavailable")
+	err := cache.Prefetch(context.Background(), func(_ context.Context, key any, prev *Entry) (any, bool, error) {
+		if key == "key2" {
+			return nil, false, wantErr
+		}
+		return "value", false, nil
+	}, "key1", "key2", "key3")
+
+	var prefetchErr *PrefetchError
+	if !errors.As(err, &prefetchErr) || len(prefetchErr.Errors) != 1 {
+		t.Fatalf("Prefetch() err got %v, want PrefetchError with 1 error", err)
+	}
+	if !errors.Is(err, wantErr) || !errors.Is(err, ErrCallbackFailed) {
+		t.Errorf("Prefetch() err got %v, want %v", err, wantErr)
+	}
+	if _, err := cache.Get("key3"); err != nil {
+		t.Errorf("Get(key3) failed with err: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package lastcache
+
+import "time"
+
+// PresetAggressiveSWR returns a Config which prefers serving stale values over waiting for the upstream
+// Expired entries are refreshed in background with up to 8 concurrent refreshes, spread over a tenth of ttl,
+// LoadOrStore serves the stale value after 100ms, and failing entries are served stale for as long as needed
+// The fields of the returned Config can be changed before passing it to New
+func PresetAggressiveSWR(ttl time.Duration) Config {
+	return Config{
+		GlobalTTL:      ttl,
+		ExtendTTL:      ttl,
+		StaleTimeout:   100 * time.Millisecond,
+		AsyncSemaphore: 8,
+		RefreshJitter:  ttl / 10,
+	}
+}
+
+// PresetConservative returns a Config which prefers fresh values and serves stale values only for a limited time
+// AsyncLoadOrStore waits up to 100ms for the fresh value, failing entries are retried every quarter of ttl
+// and stop being served after 10 failures, and the entries which keep failing for 10 ttls are deleted
+// The fields of the returned Config can be changed before passing it to New
+func PresetConservative(ttl time.Duration) Config {
+	return Config{
+		GlobalTTL:              ttl,
+		ExtendTTL:              ttl / 4,
+		HedgeDelay:             100 * time.Millisecond,
+		AsyncSemaphore:         1,
+		RefreshJitter:          ttl / 20,
+		MaxConsecutiveFailures: 10,
+		DeleteAfterFailures:    10,
+		DeleteAfterFailingFor:  10 * ttl,
+	}
+}
+
+// PresetReadHeavy returns a Config for many concurrent readers of a large number of keys
+// The storage is StorageSharded with 4 times the default shards to reduce the contention, which also applies to the
+// striped write locks, expired entries are refreshed in background
+// with up to 4 concurrent refreshes spread over a fifth of ttl, so the upstream isn't hit by all of them at once
+// The fields of the returned Config can be changed before passing it to New
+func PresetReadHeavy(ttl time.Duration) Config {
+	return Config{
+		GlobalTTL:      ttl,
+		ExtendTTL:      ttl,
+		AsyncSemaphore: 4,
+		Storage:        StorageSharded,
+		Shards:         4 * defaultShards,
+		RefreshJitter:  ttl / 5,
+	}
+}
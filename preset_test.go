@@ -0,0 +1,33 @@
+package lastcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPresets(t *testing.T) {
+	presets := map[string]func(ttl time.Duration) Config{
+		"aggressive":   PresetAggressiveSWR,
+		"conservative": PresetConservative,
+		"read-heavy":   PresetReadHeavy,
+	}
+	for name, preset := range presets {
+		t.Run(name, func(t *testing.T) {
+			now = func() time.Time { return fixedTime() }
+			config := preset(time.Minute)
+			if config.GlobalTTL != time.Minute || config.ExtendTTL <= 0 || config.RefreshJitter >= time.Minute {
+				t.Errorf("preset got %+v", config)
+			}
+
+			cache := New(config)
+			defer cache.Close()
+			entry, err := cache.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+				return "value", false, nil
+			})
+			if err != nil || entry.Value != "value" {
+				t.Errorf("LoadOrStore() got %+v, %v", entry, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package lastcache
+
+import (
+	"math"
+	"runtime/metrics"
+	"time"
+)
+
+const defaultMemoryPressureThreshold = 0.9
+
+// shedRatio portion of the least recently used entries to be evicted if there is no expired entry to shed
+const shedRatio = 10
+
+const heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+var heapInUse = func() int64 {
+	sample := []metrics.Sample{{Name: heapObjectsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(sample[0].Value.Uint64())
+}
+
+// watchMemoryPressure checks the heap usage every Config.MemoryCheckInterval until the cache context is done
+func (c *Cache) watchMemoryPressure() {
+	ticker := time.NewTicker(c.config.MemoryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if c.underMemoryPressure() {
+				c.shedMemory()
+			}
+		}
+	}
+}
+
+func (c *Cache) underMemoryPressure() bool {
+	limit := c.config.MemoryLimit
+	if limit <= 0 {
+		limit = runtimeMemoryLimit()
+	}
+	if limit == math.MaxInt64 { // no limit
+		return false
+	}
+
+	threshold := c.config.MemoryPressureThreshold
+	if threshold <= 0 || threshold > 1 {
+		threshold = defaultMemoryPressureThreshold
+	}
+
+	return heapInUse() >= int64(float64(limit)*threshold)
+}
+
+// shedMemory evicts the expired entries, lowest priority and least recently used first
+// If there is no expired entry, a portion of the lowest priority and least recently used entries will be evicted
+// returns number of evicted entries
+func (c *Cache) shedMemory() int {
+	keys := c.memory.keys()
+
+	evicted := 0
+	for _, key := range keys {
+		if c.checkIfExpired(key) {
+			c.evict(key)
+			evicted++
+		}
+	}
+	if evicted > 0 || len(keys) == 0 {
+		return evicted
+	}
+
+	n := len(keys)/shedRatio + 1
+	for _, key := range keys[:n] {
+		c.evict(key)
+	}
+	return n
+}
@@ -0,0 +1,62 @@
+package lastcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_UnderMemoryPressure(t *testing.T) {
+	defer func(f func() int64) { heapInUse = f }(heapInUse)
+
+	cache := &Cache{
+		config: Config{
+			MemoryLimit:             1000,
+			MemoryPressureThreshold: 0.5,
+		},
+	}
+
+	heapInUse = func() int64 { return 400 }
+	if cache.underMemoryPressure() {
+		t.Errorf("underMemoryPressure() got true, want false")
+	}
+
+	heapInUse = func() int64 { return 500 }
+	if !cache.underMemoryPressure() {
+		t.Errorf("underMemoryPressure() got false, want true")
+	}
+}
+
+func TestCache_ShedMemory(t *testing.T) {
+	cache := &Cache{
+		config: Config{
+			GlobalTTL:           10 * time.Millisecond,
+			MemoryCheckInterval: time.Hour,
+		},
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("expired1", "value")
+	cache.Set("expired2", "value")
+	now = func() time.Time { return fixedTime().Add(5 * time.Millisecond) }
+	cache.Set("fresh1", "value")
+	cache.Set("fresh2", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	if got := cache.shedMemory(); got != 2 {
+		t.Errorf("shedMemory() got = %v, want 2", got)
+	}
+	if _, ok := storedValue(cache, "expired1"); ok {
+		t.Errorf("expired1 expected to be evicted")
+	}
+
+	// no expired entries left, least recently used one is evicted
+	if got := cache.shedMemory(); got != 1 {
+		t.Errorf("shedMemory() got = %v, want 1", got)
+	}
+	if _, ok := storedValue(cache, "fresh1"); ok {
+		t.Errorf("fresh1 expected to be evicted")
+	}
+	if _, ok := storedValue(cache, "fresh2"); !ok {
+		t.Errorf("fresh2 expected to be kept")
+	}
+}
@@ -0,0 +1,49 @@
+package lastcache
+
+// Priority eviction priority of the entries, lower priority entries are evicted first by the memory limits
+type Priority int
+
+const (
+	// PriorityLow entries are evicted before the others
+	PriorityLow Priority = -1
+	// PriorityNormal default priority of the entries
+	PriorityNormal Priority = 0
+	// PriorityHigh entries are evicted only if there are no lower priority entries left to evict
+	PriorityHigh Priority = 1
+)
+
+// priorities number of the priority levels
+const priorities = 3
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// index returns the index of the priority in the lists of memoryTracker, out of range priorities are clamped
+func (p Priority) index() int {
+	switch {
+	case p < PriorityLow:
+		return 0
+	case p > PriorityHigh:
+		return priorities - 1
+	default:
+		return int(p - PriorityLow)
+	}
+}
+
+// SetPriority sets the eviction priority of the key, which is kept until the key is deleted or evicted
+// unless Config.PriorityFunc is set, which sets the priority every time the key is stored
+// Priorities are tracked only if Config.MaxMemoryBytes or Config.MemoryCheckInterval is set,
+// false is returned if they are not tracked or the key doesn't exist
+func (c *Cache) SetPriority(key any, priority Priority) bool {
+	return c.memory.setPriority(key, priority)
+}
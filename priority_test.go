@@ -0,0 +1,57 @@
+package lastcache
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCache_Priority(t *testing.T) {
+	cache := New(Config{
+		MaxMemoryBytes: 30,
+		SizeFunc: func(key, value any) int64 {
+			return int64(len(value.(string)))
+		},
+		PriorityFunc: func(key any) Priority {
+			if strings.HasPrefix(key.(string), "low") {
+				return PriorityLow
+			}
+			return PriorityNormal
+		},
+	})
+
+	cache.Set("normal", "0123456789")
+	cache.Set("low", "0123456789")
+	cache.Set("high", "0123456789")
+	if !cache.SetPriority("high", PriorityHigh) {
+		t.Fatal("SetPriority() got false, want true")
+	}
+	if cache.SetPriority("missing", PriorityHigh) {
+		t.Error("SetPriority() of missing key got true, want false")
+	}
+
+	// the low priority key is evicted even though it's not the least recently used
+	cache.Set("normal2", "0123456789")
+	if _, ok := storedValue(cache, "low"); ok {
+		t.Error("low priority key expected to be evicted")
+	}
+	if _, ok := storedValue(cache, "normal"); !ok {
+		t.Error("normal priority key expected to be kept")
+	}
+
+	// the high priority key is evicted only after the lower priority ones
+	cache.Set("normal3", "01234567890123456789")
+	if _, ok := storedValue(cache, "high"); !ok {
+		t.Error("high priority key expected to be kept")
+	}
+	for _, key := range []string{"normal", "normal2"} {
+		if _, ok := storedValue(cache, key); ok {
+			t.Errorf("%s expected to be evicted", key)
+		}
+	}
+
+	// PriorityFunc sets the priority again when the key is stored
+	cache.Set("high", "0123456789")
+	if p := cache.memory.items["high"].Value.(*memoryItem).priority; p != PriorityNormal {
+		t.Errorf("priority after Set got %v, want normal", p)
+	}
+}
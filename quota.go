@@ -0,0 +1,106 @@
+package lastcache
+
+import (
+	"math"
+	"sync"
+)
+
+// Quota limits the entries of a tenant, see Config.TenantQuota
+// Zero values are not limited
+type Quota struct {
+	// MaxEntries maximum number of the entries of the tenant
+	MaxEntries int
+	// MaxCost maximum total size of the entries of the tenant, estimated by Config.SizeFunc
+	MaxCost int64
+}
+
+// tenantTrackers keeps the sizes of the entries in least recently used order per tenant
+type tenantTrackers struct {
+	mu       sync.Mutex
+	trackers map[string]*memoryTracker
+}
+
+func (t *tenantTrackers) tracker(tenant string, create bool) *memoryTracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.trackers[tenant] == nil && create {
+		if t.trackers == nil {
+			t.trackers = make(map[string]*memoryTracker)
+		}
+		t.trackers[tenant] = &memoryTracker{}
+	}
+	return t.trackers[tenant]
+}
+
+func (t *tenantTrackers) remove(key any) {
+	if tk, ok := key.(TenantKey); ok {
+		if tracker := t.tracker(tk.Tenant, false); tracker != nil {
+			tracker.remove(key)
+		}
+	}
+}
+
+// trackQuota records the size of the stored entry of a tenant, and returns the least recently used entries of the tenant
+// which exceed its quota to be evicted
+func (c *Cache) trackQuota(key, storedValue any) []any {
+	if c.config.TenantQuota == nil {
+		return nil
+	}
+	tk, ok := key.(TenantKey)
+	if !ok {
+		return nil
+	}
+	quota := c.config.TenantQuota(tk.Tenant)
+	if quota.MaxEntries <= 0 && quota.MaxCost <= 0 {
+		return nil
+	}
+
+	max := quota.MaxCost
+	if max <= 0 {
+		max = math.MaxInt64
+	}
+
+	var priority *Priority
+	if c.config.PriorityFunc != nil {
+		p := c.config.PriorityFunc(key)
+		priority = &p
+	}
+
+	tracker := c.tenants.tracker(tk.Tenant, true)
+	evicted := tracker.add(key, c.sizeOf(key, storedValue), max, priority)
+	if quota.MaxEntries > 0 {
+		evicted = append(evicted, tracker.overflow(quota.MaxEntries)...)
+	}
+	return evicted
+}
+
+// touchQuota marks the entry of a tenant as most recently used
+func (c *Cache) touchQuota(key any) {
+	if c.config.TenantQuota == nil {
+		return
+	}
+	if tk, ok := key.(TenantKey); ok {
+		if tracker := c.tenants.tracker(tk.Tenant, false); tracker != nil {
+			tracker.touch(key)
+		}
+	}
+}
+
+// overflow returns the keys exceeding max entries in eviction order, lowest priority and least recently used first
+func (m *memoryTracker) overflow(max int) []any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := len(m.items) - max
+	if n <= 0 {
+		return nil
+	}
+	keys := make([]any, 0, n)
+	for i := range m.lru {
+		for el := m.lru[i].Front(); el != nil && len(keys) < n; el = el.Next() {
+			keys = append(keys, el.Value.(*memoryItem).key)
+		}
+	}
+	return keys
+}
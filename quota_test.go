@@ -0,0 +1,59 @@
+package lastcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCache_TenantQuota(t *testing.T) {
+	now = func() time.Time { return fixedTime() }
+	cache := New(Config{GlobalTTL: time.Minute, TenantQuota: func(tenant string) Quota {
+		if tenant == "noisy" {
+			return Quota{MaxEntries: 2}
+		}
+		return Quota{MaxCost: 100}
+	}, SizeFunc: func(key, value any) int64 {
+		if b, ok := value.([]byte); ok {
+			return int64(len(b))
+		}
+		return 10
+	}})
+	defer cache.Close()
+
+	cache.Set(TenantKey{Tenant: "quiet", Key: 1}, "value")
+	for i := 0; i < 4; i++ {
+		cache.Set(TenantKey{Tenant: "noisy", Key: i}, "value")
+		if i == 2 {
+			// the least recently used entry is evicted
+			cache.Get(TenantKey{Tenant: "noisy", Key: 1})
+		}
+	}
+
+	for key, want := range map[TenantKey]bool{
+		{Tenant: "quiet", Key: 1}: true,
+		{Tenant: "noisy", Key: 0}: false,
+		{Tenant: "noisy", Key: 1}: true,
+		{Tenant: "noisy", Key: 2}: false,
+		{Tenant: "noisy", Key: 3}: true,
+	} {
+		if _, err := cache.Get(key); (err == nil) != want {
+			t.Errorf("Get(%v) got err %v, want cached %v", key, err, want)
+		}
+	}
+
+	// the entries above the cost of the tenant are evicted
+	cache.Set(TenantKey{Tenant: "quiet", Key: 2}, make([]byte, 95))
+	if _, err := cache.Get(TenantKey{Tenant: "quiet", Key: 1}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() got err %v, want evicted by MaxCost", err)
+	}
+
+	// an entry bigger than the cost of the tenant is not cached, without evicting the others
+	cache.Set(TenantKey{Tenant: "quiet", Key: 3}, make([]byte, 1000))
+	if _, err := cache.Get(TenantKey{Tenant: "quiet", Key: 3}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() got err %v, want the oversized entry not cached", err)
+	}
+	if _, err := cache.Get(TenantKey{Tenant: "quiet", Key: 2}); err != nil {
+		t.Errorf("Get() got err %v, want kept after the oversized entry", err)
+	}
+}
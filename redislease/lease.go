@@ -0,0 +1,115 @@
+// Package redislease implements lastcache.Lease by Redis, so only one instance refreshes a key across the cluster
+//
+// Leases are acquired by SET NX PX with a random token, and released only if they still hold the token,
+// so a lease which is expired and acquired by another instance is not released by mistake.
+//
+//	cache := lastcache.New(lastcache.Config{Lease: redislease.New(redisClient, redislease.Config{})})
+package redislease
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultPrefix = "lastcache:lease:"
+
+// release deletes the lease only if it's still held by the token
+var release = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// Config of the Lease
+type Config struct {
+	// Prefix of the Redis keys of the leases, which should be unique per cache
+	// Default is "lastcache:lease:"
+	Prefix string
+
+	// KeyFunc returns the Redis key suffix of the cache key
+	// Default is fmt.Sprint(key)
+	KeyFunc func(key any) string
+}
+
+// Lease lastcache.Lease implementation by Redis
+type Lease struct {
+	client redis.UniversalClient
+	config Config
+
+	mu sync.Mutex
+	// tokens of the leases held by this instance, by Redis key
+	tokens map[string]string
+}
+
+var _ lastcache.Lease = (*Lease)(nil)
+
+// New returns a Lease which stores the leases in Redis by client
+func New(client redis.UniversalClient, config Config) *Lease {
+	if config.Prefix == "" {
+		config.Prefix = defaultPrefix
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = func(key any) string {
+			return fmt.Sprint(key)
+		}
+	}
+
+	return &Lease{
+		client: client,
+		config: config,
+		tokens: make(map[string]string),
+	}
+}
+
+// TryAcquire acquires the lease of the key for ttl, if it's not held by any instance
+func (l *Lease) TryAcquire(ctx context.Context, key any, ttl time.Duration) (bool, error) {
+	token, err := newToken()
+	if err != nil {
+		return false, err
+	}
+
+	redisKey := l.redisKey(key)
+	acquired, err := l.client.SetNX(ctx, redisKey, token, ttl).Result()
+	if err != nil || !acquired {
+		return false, err
+	}
+
+	l.mu.Lock()
+	l.tokens[redisKey] = token
+	l.mu.Unlock()
+	return true, nil
+}
+
+// Release releases the lease of the key, if it's still held by this instance
+func (l *Lease) Release(ctx context.Context, key any) error {
+	redisKey := l.redisKey(key)
+	l.mu.Lock()
+	token, ok := l.tokens[redisKey]
+	delete(l.tokens, redisKey)
+	l.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	return release.Run(ctx, l.client, []string{redisKey}, token).Err()
+}
+
+func (l *Lease) redisKey(key any) string {
+	return l.config.Prefix + l.config.KeyFunc(key)
+}
+
+func newToken() (string, error) {
+	var token [16]byte
+	if _, err := rand.Read(token[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token[:]), nil
+}
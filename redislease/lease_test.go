@@ -0,0 +1,62 @@
+package redislease
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newLeases(t *testing.T) (*miniredis.Miniredis, *Lease, *Lease) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, New(client, Config{}), New(client, Config{})
+}
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	_, instance1, instance2 := newLeases(t)
+
+	if ok, err := instance1.TryAcquire(ctx, 42, time.Minute); err != nil || !ok {
+		t.Fatalf("TryAcquire() got %v, %v, want acquired", ok, err)
+	}
+	if ok, err := instance2.TryAcquire(ctx, 42, time.Minute); err != nil || ok {
+		t.Errorf("TryAcquire() got %v, %v, want held by another instance", ok, err)
+	}
+
+	// only the holder can release the lease
+	if err := instance2.Release(ctx, 42); err != nil {
+		t.Errorf("Release() failed with err: %v", err)
+	}
+	if ok, _ := instance2.TryAcquire(ctx, 42, time.Minute); ok {
+		t.Errorf("lease is released by another instance")
+	}
+
+	if err := instance1.Release(ctx, 42); err != nil {
+		t.Errorf("Release() failed with err: %v", err)
+	}
+	if ok, err := instance2.TryAcquire(ctx, 42, time.Minute); err != nil || !ok {
+		t.Errorf("TryAcquire() got %v, %v, want acquired after release", ok, err)
+	}
+}
+
+func TestLease_Expired(t *testing.T) {
+	ctx := context.Background()
+	server, instance1, instance2 := newLeases(t)
+
+	instance1.TryAcquire(ctx, "key", time.Second)
+	server.FastForward(2 * time.Second)
+	if ok, err := instance2.TryAcquire(ctx, "key", time.Minute); err != nil || !ok {
+		t.Fatalf("TryAcquire() got %v, %v, want acquired after expiry", ok, err)
+	}
+
+	// the expired lease doesn't release the lease of the new holder
+	instance1.Release(ctx, "key")
+	if !server.Exists(defaultPrefix + "key") {
+		t.Errorf("lease of the new holder is released")
+	}
+}
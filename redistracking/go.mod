@@ -0,0 +1,15 @@
+module github.com/mbrostami/lastcache/redistracking
+
+go 1.18
+
+replace github.com/mbrostami/lastcache => ../
+
+require (
+	github.com/mbrostami/lastcache v0.0.0
+	github.com/redis/go-redis/v9 v9.9.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+)
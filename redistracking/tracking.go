@@ -0,0 +1,159 @@
+// Package redistracking keeps the lastcache entries which mirror Redis keys coherent by Redis client-side caching
+//
+// Redis tracks the keys by the prefixes in broadcasting mode, and pushes their invalidations to the
+// __redis__:invalidate channel of a dedicated connection (CLIENT TRACKING ON REDIRECT <id> BCAST), which is the
+// RESP2 compatible way of receiving the RESP3 invalidation push messages. The invalidated keys are deleted
+// (or expired) in the cache in near real-time, instead of waiting for their ttl.
+//
+//	tracker := redistracking.New(redisClient, cache, redistracking.Config{Prefixes: []string{"user:"}})
+//	go tracker.Run(ctx)
+package redistracking
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+	"github.com/redis/go-redis/v9"
+)
+
+// invalidateChannel the channel which the invalidation messages are published to
+const invalidateChannel = "__redis__:invalidate"
+
+// Config of the Tracker
+type Config struct {
+	// Prefixes of the Redis keys to be tracked, all the keys are tracked if it's empty
+	Prefixes []string
+
+	// KeyFunc returns the cache key of the invalidated Redis key
+	// Default is the Redis key as string
+	KeyFunc func(redisKey string) any
+
+	// Expire if set, the invalidated keys are expired instead of deleted, so their stale values can still be served
+	// until they're refreshed, see lastcache.Cache.Expire
+	Expire bool
+
+	// OnError is called when tracking can not be enabled again after the invalidation connection is reconnected
+	OnError func(err error)
+}
+
+// Tracker invalidates the entries of a cache when their Redis keys are modified
+type Tracker struct {
+	client *redis.Client
+	cache  *lastcache.Cache
+	config Config
+}
+
+// New returns a Tracker which invalidates the entries of cache by the invalidation messages of client
+func New(client *redis.Client, cache *lastcache.Cache, config Config) *Tracker {
+	if config.KeyFunc == nil {
+		config.KeyFunc = func(redisKey string) any {
+			return redisKey
+		}
+	}
+	return &Tracker{client: client, cache: cache, config: config}
+}
+
+// Run enables tracking and invalidates the entries until ctx is done
+// If the invalidation connection is reconnected all the entries of the cache are invalidated, since the invalidations
+// sent meanwhile are lost, so the cache should be dedicated to the mirrored keys
+func (t *Tracker) Run(ctx context.Context) error {
+	// the subscriber has a dedicated client, so every connection it makes is the invalidation connection
+	ids := make(chan int64, 1)
+	options := *t.client.Options()
+	options.OnConnect = func(ctx context.Context, cn *redis.Conn) error {
+		id, err := cn.ClientID(ctx).Result()
+		if err != nil {
+			return err
+		}
+		// only the id of the latest connection is kept
+		select {
+		case <-ids:
+		default:
+		}
+		ids <- id
+		return nil
+	}
+	subscriber := redis.NewClient(&options)
+	defer subscriber.Close()
+
+	pubsub := subscriber.Subscribe(ctx, invalidateChannel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	tracking := t.client.Conn()
+	defer tracking.Close()
+	if err := t.enable(ctx, tracking, <-ids); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case id := <-ids:
+			t.invalidateAll()
+			if err := t.enable(ctx, tracking, id); err != nil && t.config.OnError != nil {
+				t.config.OnError(err)
+			}
+		case msg, ok := <-messages:
+			if !ok {
+				return errors.New("redistracking: invalidation subscription is closed")
+			}
+			t.handle(msg)
+		}
+	}
+}
+
+// enable enables tracking of the prefixes, redirecting the invalidations to the connection of id
+func (t *Tracker) enable(ctx context.Context, tracking *redis.Conn, id int64) error {
+	args := []any{"client", "tracking", "on", "redirect", id, "bcast"}
+	for _, prefix := range t.config.Prefixes {
+		args = append(args, "prefix", prefix)
+	}
+	return tracking.Do(ctx, args...).Err()
+}
+
+// handle invalidates the keys of the invalidation message, or all the keys if Redis is flushed
+func (t *Tracker) handle(msg *redis.Message) {
+	if msg.Channel != invalidateChannel {
+		return
+	}
+	// a single key payload is not an array in RESP2
+	if msg.Payload != "" {
+		t.invalidate(msg.Payload)
+		return
+	}
+	// a flush is sent with a null payload
+	if msg.PayloadSlice == nil {
+		t.invalidateAll()
+		return
+	}
+	for _, redisKey := range msg.PayloadSlice {
+		t.invalidate(redisKey)
+	}
+}
+
+func (t *Tracker) invalidate(redisKey string) {
+	key := t.config.KeyFunc(redisKey)
+	if t.config.Expire {
+		t.cache.Expire(key)
+		return
+	}
+	t.cache.Delete(key)
+}
+
+func (t *Tracker) invalidateAll() {
+	t.cache.RangeEntries(func(key any, _ lastcache.Entry, _ time.Time) bool {
+		if t.config.Expire {
+			t.cache.Expire(key)
+		} else {
+			t.cache.Delete(key)
+		}
+		return true
+	})
+}
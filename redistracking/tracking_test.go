@@ -0,0 +1,59 @@
+package redistracking
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mbrostami/lastcache"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTracker(t *testing.T, config Config) (*Tracker, *lastcache.Cache) {
+	t.Helper()
+	cache := lastcache.New(lastcache.Config{})
+	t.Cleanup(cache.Close)
+	for _, key := range []string{"user:1", "user:2", "user:3"} {
+		cache.Set(key, strings.ToUpper(key))
+	}
+	return New(nil, cache, config), cache
+}
+
+func TestTracker_Handle(t *testing.T) {
+	tracker, cache := newTracker(t, Config{})
+
+	tracker.handle(&redis.Message{Channel: invalidateChannel, Payload: "user:1"})
+	tracker.handle(&redis.Message{Channel: invalidateChannel, PayloadSlice: []string{"user:2"}})
+	tracker.handle(&redis.Message{Channel: "other", Payload: "user:3"})
+
+	for key, want := range map[string]bool{"user:1": false, "user:2": false, "user:3": true} {
+		if _, err := cache.Get(key); (err == nil) != want {
+			t.Errorf("Get(%q) got err %v, want cached %v", key, err, want)
+		}
+	}
+
+	// flush invalidates all the keys
+	tracker.handle(&redis.Message{Channel: invalidateChannel})
+	if _, err := cache.Get("user:3"); !errors.Is(err, lastcache.ErrNotFound) {
+		t.Errorf("Get() after flush got err %v, want ErrNotFound", err)
+	}
+}
+
+func TestTracker_HandleExpire(t *testing.T) {
+	tracker, cache := newTracker(t, Config{
+		Expire: true,
+		KeyFunc: func(redisKey string) any {
+			return "user:" + strings.TrimPrefix(redisKey, "prefix:")
+		},
+	})
+
+	tracker.handle(&redis.Message{Channel: invalidateChannel, Payload: "prefix:1"})
+
+	entry, err := cache.Get("user:1")
+	if !errors.Is(err, lastcache.ErrExpired) || !entry.Stale || entry.Value != "USER:1" {
+		t.Errorf("Get() got %+v, %v, want expired USER:1", entry, err)
+	}
+	if entry, _ := cache.Get("user:2"); entry.Stale {
+		t.Errorf("Get() got stale entry of a key which is not invalidated")
+	}
+}
@@ -0,0 +1,208 @@
+package lastcache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Refresh is a handle to a background refresh started by AsyncLoadOrStore
+// It can be used in select loops through Done, and the refresh can be canceled with Cancel
+type Refresh struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	entry  Entry
+	err    error
+	// noStale the synchronous callback refused the stale value on its error, see SyncCallback
+	noStale bool
+}
+
+func newRefresh(ctx context.Context) (*Refresh, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Refresh{
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}, ctx
+}
+
+// Done returns a channel that is closed when the refresh is completed, failed or canceled
+// Since the channel is closed, it can be received from any number of times without blocking
+func (r *Refresh) Done() <-chan struct{} {
+	return r.done
+}
+
+// Result blocks until the refresh is completed and returns the refreshed entry
+// If the callback failed, CallbackError will be returned with an empty entry
+// If the refresh is canceled before calling the callback, context error will be returned
+func (r *Refresh) Result() (Entry, error) {
+	<-r.done
+	return r.entry, r.err
+}
+
+// Cancel cancels the context passed to the callback
+// If the callback has not started yet, it will not be called and Result returns context.Canceled
+// The refresh is shared between concurrent callers of the same key, so canceling affects all of them
+func (r *Refresh) Cancel() {
+	r.cancel()
+}
+
+func (r *Refresh) complete(entry Entry, err error) {
+	r.entry = entry
+	r.err = err
+	r.cancel()
+	close(r.done)
+}
+
+// WaitForFresh blocks until the current background refresh of the key is completed or ctx is done
+// If there is no refresh in progress, the cached entry will be returned as is
+// If the refresh fails, the callback error will be returned
+// ErrNotFound will be returned if the key doesn't exist
+func (c *Cache) WaitForFresh(ctx context.Context, key any) (Entry, error) {
+	key, err := c.TenantScope(ctx, key)
+	if err != nil {
+		return Entry{}, err
+	}
+	if refresh := c.inflightRefresh(key); refresh != nil {
+		select {
+		case <-refresh.Done():
+		case <-ctx.Done():
+			return Entry{}, ctx.Err()
+		}
+		return refresh.Result()
+	}
+
+	v, version, ok := c.loadWithVersion(key)
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+
+	entry := Entry{Value: v, Version: version}
+	if c.checkIfExpired(key) {
+		entry.Stale = true
+		entry.Source = SourceStaleFallback
+	}
+	return entry, nil
+}
+
+// RefreshStatus reports what happened to the background refresh of an expired entry by the call, see Entry.RefreshStatus
+type RefreshStatus int
+
+const (
+	// RefreshNone no background refresh is needed, e.g. the entry is fresh or the missing key is loaded by the call
+	RefreshNone RefreshStatus = iota
+	// RefreshStarted the call started a new background refresh
+	RefreshStarted
+	// RefreshCoalesced the call joined the background refresh which is already in progress for the key
+	RefreshCoalesced
+	// RefreshQueued the call started a new background refresh, which waits for a free slot of Config.AsyncSemaphore
+	RefreshQueued
+	// RefreshSkipped the entry is expired but no refresh is started, see PauseRefresh and SetDegraded
+	RefreshSkipped
+)
+
+func (s RefreshStatus) String() string {
+	switch s {
+	case RefreshNone:
+		return "none"
+	case RefreshStarted:
+		return "started"
+	case RefreshCoalesced:
+		return "coalesced"
+	case RefreshQueued:
+		return "queued"
+	case RefreshSkipped:
+		return "skipped"
+	default:
+		return "unknown"
+	}
+}
+
+// refreshStatus returns the status of a refresh returned by startRefresh
+func (c *Cache) refreshStatus(started bool) RefreshStatus {
+	if !started {
+		return RefreshCoalesced
+	}
+	if held, size := c.semaphore.usage(); c.config.BatchRefresh == nil && held >= size {
+		return RefreshQueued
+	}
+	return RefreshStarted
+}
+
+// PauseRefresh stops starting background refreshes, e.g. during deploys of the upstream service
+// Expired entries are served as stale without a Refresh handle in the meantime, while missing keys are still loaded
+// and LoadOrStore is not affected. The refreshes which are already in progress are not canceled
+func (c *Cache) PauseRefresh() {
+	atomic.StoreInt32(&c.refreshPaused, 1)
+}
+
+// ResumeRefresh resumes the background refreshes paused by PauseRefresh
+// The expired entries are refreshed by their next load
+func (c *Cache) ResumeRefresh() {
+	atomic.StoreInt32(&c.refreshPaused, 0)
+}
+
+// RefreshPaused reports whether the background refreshes are paused by PauseRefresh
+func (c *Cache) RefreshPaused() bool {
+	return atomic.LoadInt32(&c.refreshPaused) == 1
+}
+
+// startRefresh returns the in-progress refresh of the key, or registers a new one
+// The context of the new refresh is derived from ctx by Config.RefreshContextMode
+// started is true only if a new refresh is registered and the caller is responsible to run it
+func (c *Cache) startRefresh(ctx context.Context, key any) (refresh *Refresh, refreshCtx context.Context, started bool) {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+
+	if refresh = c.inflight[key]; refresh != nil {
+		return refresh, nil, false
+	}
+
+	if c.inflight == nil {
+		c.inflight = make(map[any]*Refresh)
+	}
+	refresh, refreshCtx = newRefresh(c.refreshContext(ctx))
+	c.inflight[key] = refresh
+	return refresh, refreshCtx, true
+}
+
+func (c *Cache) untrackRefresh(key any, refresh *Refresh) {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+
+	if c.inflight[key] == refresh {
+		delete(c.inflight, key)
+	}
+}
+
+func (c *Cache) inflightRefresh(key any) *Refresh {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+
+	return c.inflight[key]
+}
+
+// Refreshes returns the background refreshes which are in progress
+func (c *Cache) Refreshes() []*Refresh {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+
+	refreshes := make([]*Refresh, 0, len(c.inflight))
+	for _, refresh := range c.inflight {
+		refreshes = append(refreshes, refresh)
+	}
+	return refreshes
+}
+
+// refreshDue returns true if the item is expired and its background refresh is due, considering Config.RefreshJitter
+func (c *Cache) refreshDue(key any, it *item) bool {
+	t := c.now()
+	if !t.After(it.expiresAt) {
+		return false
+	}
+	if c.config.RefreshJitter <= 0 {
+		return true
+	}
+	// the offset is derived from the key and the version, so it's fixed per stored value without storing it
+	offset := (hashKey(key) ^ it.version*0x9E3779B97F4A7C15) % uint64(c.config.RefreshJitter)
+	return t.After(it.expiresAt.Add(time.Duration(offset)))
+}
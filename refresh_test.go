@@ -0,0 +1,484 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRefresh_Result(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	entry, refresh, err := cache.AsyncLoadOrStore("key", func(_ context.Context, key any, prev *Entry) (any, error) {
+		return "new_value", nil
+	})
+	if err != nil {
+		t.Errorf("failed with err: %v", err)
+	}
+	if !entry.Stale || refresh == nil {
+		t.Fatalf("expected stale entry with refresh handle, got %+v, %v", entry, refresh)
+	}
+
+	select {
+	case <-refresh.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("refresh is not done")
+	}
+
+	got, err := refresh.Result()
+	if err != nil {
+		t.Errorf("failed with err: %v", err)
+	}
+	if got.Value != "new_value" || got.Stale {
+		t.Errorf("Result() got %+v, want new_value", got)
+	}
+
+	// calling Result again must not block
+	if got, _ = refresh.Result(); got.Value != "new_value" {
+		t.Errorf("Result() got %+v, want new_value", got)
+	}
+}
+
+func TestRefresh_ResultWithError(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	_, refresh, _ := cache.AsyncLoadOrStore("key", func(_ context.Context, key any, prev *Entry) (any, error) {
+		return nil, errors.New("unavailable")
+	})
+
+	got, err := refresh.Result()
+	if err == nil {
+		t.Errorf("want err, got nil")
+	}
+	if got.Value != nil {
+		t.Errorf("Result() got %+v, want empty entry", got)
+	}
+}
+
+func TestRefresh_Cancel(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL:      10 * time.Millisecond,
+		AsyncSemaphore: 1,
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key1", "value1")
+	cache.Set("key2", "value2")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	_, r1, _ := cache.AsyncLoadOrStore("key1", func(_ context.Context, key any, prev *Entry) (any, error) {
+		close(started)
+		<-release
+		return "new_value1", nil
+	})
+	<-started
+
+	called := false
+	_, r2, _ := cache.AsyncLoadOrStore("key2", func(_ context.Context, key any, prev *Entry) (any, error) {
+		called = true
+		return "new_value2", nil
+	})
+
+	// second refresh is waiting for the semaphore
+	r2.Cancel()
+	if _, err := r2.Result(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Result() err got %v, want %v", err, context.Canceled)
+	}
+
+	close(release)
+	if _, err := r1.Result(); err != nil {
+		t.Errorf("failed with err: %v", err)
+	}
+
+	if called {
+		t.Errorf("canceled refresh callback should not be called")
+	}
+}
+
+func TestCache_WaitForFresh(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	if _, err := cache.WaitForFresh(context.Background(), "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("WaitForFresh() err got %v, want %v", err, ErrNotFound)
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+
+	entry, err := cache.WaitForFresh(context.Background(), "key")
+	if err != nil || entry.Value != "value" || entry.Stale {
+		t.Errorf("WaitForFresh() got %+v, %v, want value", entry, err)
+	}
+
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	release := make(chan struct{})
+	entry, _, _ = cache.AsyncLoadOrStore("key", func(_ context.Context, key any, prev *Entry) (any, error) {
+		<-release
+		return "new_value", nil
+	})
+	if !entry.Stale {
+		t.Errorf("entry Stale expected to be true, false returned")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err = cache.WaitForFresh(ctx, "key"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitForFresh() err got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	entry, err = cache.WaitForFresh(context.Background(), "key")
+	if err != nil || entry.Value != "new_value" || entry.Stale {
+		t.Errorf("WaitForFresh() got %+v, %v, want new_value", entry, err)
+	}
+}
+
+func TestCache_AsyncLoadOrStoreSharedRefresh(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL:      10 * time.Millisecond,
+		AsyncSemaphore: 2,
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	release := make(chan struct{})
+	nrCalls := 0
+	callback := func(_ context.Context, key any, prev *Entry) (any, error) {
+		nrCalls++
+		<-release
+		return "new_value", nil
+	}
+
+	refreshes := make([]*Refresh, 3)
+	for i := range refreshes {
+		_, refreshes[i], _ = cache.AsyncLoadOrStore("key", callback)
+		if refreshes[i] != refreshes[0] {
+			t.Errorf("concurrent callers expected to share the same refresh")
+		}
+	}
+
+	close(release)
+	for _, refresh := range refreshes {
+		entry, err := refresh.Result()
+		if err != nil || entry.Value != "new_value" {
+			t.Errorf("Result() got %+v, %v, want new_value", entry, err)
+		}
+	}
+
+	if nrCalls != 1 {
+		t.Errorf("Number of AsyncCallback calls got = %v, want 1", nrCalls)
+	}
+}
+
+func TestRefresh_DoneIsClosed(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	_, refresh, _ := cache.AsyncLoadOrStore("key", func(_ context.Context, key any, prev *Entry) (any, error) {
+		return nil, errors.New("unavailable")
+	})
+
+	// every receive after completion returns immediately, so select loops don't leak goroutines
+	for i := 0; i < 3; i++ {
+		select {
+		case <-refresh.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("receive %d from Done() blocked", i)
+		}
+		if _, err := refresh.Result(); err == nil {
+			t.Errorf("want err, got nil")
+		}
+	}
+}
+
+func TestCache_RefreshJitter(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL:      time.Minute,
+		RefreshJitter:  time.Minute,
+		AsyncSemaphore: 100,
+	})
+
+	now = func() time.Time { return fixedTime() }
+	for i := 0; i < 100; i++ {
+		cache.Set(i, "value")
+	}
+
+	// halfway through the jitter some of the entries are due
+	now = func() time.Time { return fixedTime().Add(90 * time.Second) }
+	due := 0
+	var refreshes []*Refresh
+	for i := 0; i < 100; i++ {
+		entry, refresh, err := cache.AsyncLoadOrStore(i, func(ctx context.Context, key any, prev *Entry) (any, error) {
+			return "new", nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Stale != (refresh != nil) {
+			t.Errorf("entry %d got stale %v with refresh %v", i, entry.Stale, refresh)
+		}
+		if refresh != nil {
+			due++
+			refreshes = append(refreshes, refresh)
+		}
+	}
+	for _, refresh := range refreshes {
+		refresh.Result()
+	}
+	if due < 20 || due > 80 {
+		t.Errorf("got %d due refreshes, want about half of them", due)
+	}
+
+	// all of them are due after the jitter
+	now = func() time.Time { return fixedTime().Add(2*time.Minute + time.Second) }
+	for i := 0; i < 100; i++ {
+		it, _ := cache.loadItem(i)
+		if !cache.refreshDue(i, it) && it.expiresAt.Before(fixedTime().Add(2*time.Minute)) {
+			t.Errorf("entry %d is not due after the jitter", i)
+		}
+	}
+}
+
+func TestCache_PauseRefresh(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute})
+	var calls int
+	callback := func(ctx context.Context, key any, prev *Entry) (any, error) {
+		calls++
+		return "new", nil
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "old")
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+
+	cache.PauseRefresh()
+	if !cache.RefreshPaused() {
+		t.Fatal("RefreshPaused() got false, want true")
+	}
+	entry, refresh, err := cache.AsyncLoadOrStore("key", callback)
+	if err != nil || entry.Value != "old" || !entry.Stale || refresh != nil {
+		t.Errorf("AsyncLoadOrStore() got %+v, %v, %v, want the stale value without refresh", entry, refresh, err)
+	}
+	if entry, _, err = cache.AsyncLoadOrStore("missing", callback); err != nil || entry.Value != "new" {
+		t.Errorf("AsyncLoadOrStore(missing) got %+v, %v, want the loaded value", entry, err)
+	}
+	if calls != 1 {
+		t.Errorf("callback got %d calls, want 1", calls)
+	}
+
+	cache.ResumeRefresh()
+	_, refresh, _ = cache.AsyncLoadOrStore("key", callback)
+	if refresh == nil {
+		t.Fatal("AsyncLoadOrStore() got nil refresh, want the refresh to be resumed")
+	}
+	if entry, err = refresh.Result(); err != nil || entry.Value != "new" {
+		t.Errorf("Result() got %+v, %v, want the new value", entry, err)
+	}
+}
+
+func TestCache_RefreshStatus(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute, AsyncSemaphore: 1})
+	release := make(chan struct{})
+	callback := func(ctx context.Context, key any, prev *Entry) (any, error) {
+		<-release
+		return "new", nil
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key1", "old")
+	cache.Set("key2", "old")
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+
+	entry, refresh1, _ := cache.AsyncLoadOrStore("key1", callback)
+	if entry.RefreshStatus != RefreshStarted {
+		t.Errorf("first call got %v, want %v", entry.RefreshStatus, RefreshStarted)
+	}
+	if entry, _, _ = cache.AsyncLoadOrStore("key1", callback); entry.RefreshStatus != RefreshCoalesced {
+		t.Errorf("second call got %v, want %v", entry.RefreshStatus, RefreshCoalesced)
+	}
+
+	// wait for the first refresh to hold the only semaphore slot
+	for i := 0; ; i++ {
+		if held, _ := cache.semaphore.usage(); held > 0 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("the first refresh didn't start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	entry, refresh2, _ := cache.AsyncLoadOrStore("key2", callback)
+	if entry.RefreshStatus != RefreshQueued {
+		t.Errorf("call of another key got %v, want %v", entry.RefreshStatus, RefreshQueued)
+	}
+	close(release)
+	<-refresh1.Done()
+	<-refresh2.Done()
+
+	if entry, _, _ = cache.AsyncLoadOrStore("key1", callback); entry.RefreshStatus != RefreshNone {
+		t.Errorf("fresh call got %v, want %v", entry.RefreshStatus, RefreshNone)
+	}
+
+	now = func() time.Time { return fixedTime().Add(4 * time.Minute) }
+	cache.PauseRefresh()
+	if entry, _, _ = cache.AsyncLoadOrStore("key1", callback); entry.RefreshStatus != RefreshSkipped {
+		t.Errorf("paused call got %v, want %v", entry.RefreshStatus, RefreshSkipped)
+	}
+}
+
+func TestCache_CrossModeDeduplication(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute})
+	var calls int32
+	release := make(chan struct{})
+	asyncCallback := func(ctx context.Context, key any, prev *Entry) (any, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "async", nil
+	}
+	syncCallback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "sync", false, nil
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "old")
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+
+	// LoadOrStore joins the background refresh
+	_, refresh, _ := cache.AsyncLoadOrStore("key", asyncCallback)
+	done := make(chan Entry)
+	go func() {
+		entry, _ := cache.LoadOrStore("key", syncCallback)
+		done <- entry
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	<-refresh.Done()
+	entry := <-done
+	if entry.Value != "async" || entry.CallbackInvoked || entry.RefreshStatus != RefreshCoalesced {
+		t.Errorf("LoadOrStore got %+v, want the joined refresh result", entry)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Errorf("callbacks called %d times, want 1", calls)
+	}
+
+	// AsyncLoadOrStore joins the LoadOrStore in progress
+	release = make(chan struct{})
+	now = func() time.Time { return fixedTime().Add(4 * time.Minute) }
+	go func() {
+		entry, _ := cache.LoadOrStore("key", syncCallback)
+		done <- entry
+	}()
+	for i := 0; cache.inflightRefresh("key") == nil; i++ {
+		if i == 100 {
+			t.Fatal("LoadOrStore didn't start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	entry, refresh, _ = cache.AsyncLoadOrStore("key", asyncCallback)
+	if !entry.Stale || entry.RefreshStatus != RefreshCoalesced {
+		t.Errorf("AsyncLoadOrStore got %+v, want stale coalesced entry", entry)
+	}
+	close(release)
+	<-done
+	if entry, err := refresh.Result(); err != nil || entry.Value != "sync" {
+		t.Errorf("Result() got %+v, %v, want the LoadOrStore value", entry, err)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 2 {
+		t.Errorf("callbacks called %d times, want 2", calls)
+	}
+}
+
+func TestCache_CrossModeDeduplicationCanceled(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute})
+	release := make(chan struct{})
+	syncCallback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		select {
+		case <-release:
+			return "sync", false, nil
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "old")
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan Entry)
+	go func() {
+		entry, _ := cache.LoadOrStoreWithCtx(ctx, "key", syncCallback)
+		done <- entry
+	}()
+	for i := 0; cache.inflightRefresh("key") == nil; i++ {
+		if i == 100 {
+			t.Fatal("LoadOrStore didn't start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_, refresh, _ := cache.AsyncLoadOrStore("key", nil)
+
+	// the callback is not canceled by the context of its caller, which would fail the joined refresh
+	cancel()
+	close(release)
+	if entry := <-done; entry.Value != "sync" {
+		t.Errorf("LoadOrStoreWithCtx got %+v, want the callback value", entry)
+	}
+	if entry, err := refresh.Result(); err != nil || entry.Value != "sync" {
+		t.Errorf("Result() got %+v, %v, want the LoadOrStore value", entry, err)
+	}
+}
+
+func TestCache_CrossModeDeduplicationStale(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute, StaleTimeout: 10 * time.Millisecond})
+	release := make(chan struct{})
+	callback := func(ctx context.Context, key any, prev *Entry) (any, error) {
+		<-release
+		return "new", nil
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "old")
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+
+	_, refresh, _ := cache.AsyncLoadOrStore("key", callback)
+	defer func() {
+		close(release)
+		<-refresh.Done()
+	}()
+	entry, err := cache.LoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		t.Error("callback is called while a refresh is in progress")
+		return nil, false, nil
+	})
+	if err != nil || !entry.Stale || entry.Value != "old" || entry.RefreshStatus != RefreshCoalesced {
+		t.Errorf("LoadOrStore got %+v, %v, want stale entry after StaleTimeout", entry, err)
+	}
+}
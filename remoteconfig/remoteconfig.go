@@ -0,0 +1,168 @@
+// Package remoteconfig caches remote configuration or feature flags, polled from a URL or a callback
+//
+// The source is polled in background, and the last good value is served when polling or decoding fails.
+// OnChange is called when a poll produces a different value.
+//
+//	flags := remoteconfig.New(remoteconfig.URL(nil, "https://config.example.com/flags.json"), remoteconfig.JSON[remoteconfig.Values](), remoteconfig.Options{})
+//	defer flags.Close()
+//	values, err := flags.Get(ctx)
+//	enabled := values.Bool("new_checkout", false)
+package remoteconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+const (
+	defaultPollInterval = 30 * time.Second
+	configKey           = "config"
+)
+
+// Source returns the raw configuration
+type Source func(ctx context.Context) ([]byte, error)
+
+// DecodeFunc decodes the raw configuration
+type DecodeFunc[T any] func(data []byte) (T, error)
+
+// URL returns a Source which fetches the url by client, http.DefaultClient is used if client is nil
+func URL(client *http.Client, url string) Source {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("remoteconfig: unexpected status %d from %s", resp.StatusCode, url)
+		}
+		return io.ReadAll(resp.Body)
+	}
+}
+
+// JSON returns a DecodeFunc which decodes JSON into T
+func JSON[T any]() DecodeFunc[T] {
+	return func(data []byte) (T, error) {
+		var v T
+		err := json.Unmarshal(data, &v)
+		return v, err
+	}
+}
+
+// Options of the Remote configuration
+type Options struct {
+	// PollInterval interval of polling the source
+	// Default is 30s
+	PollInterval time.Duration
+
+	// OnError if set, is called when polling or decoding fails while the last good value is served
+	OnError func(err error)
+}
+
+// Remote configuration of type T
+type Remote[T any] struct {
+	source  Source
+	decode  DecodeFunc[T]
+	options Options
+	cache   *lastcache.Cache
+	stop    func()
+}
+
+type snapshot[T any] struct {
+	raw   []byte
+	value T
+}
+
+// New starts polling the source in background, Close must be called to stop polling
+func New[T any](source Source, decode DecodeFunc[T], options Options) *Remote[T] {
+	if options.PollInterval <= 0 {
+		options.PollInterval = defaultPollInterval
+	}
+
+	r := &Remote[T]{
+		source:  source,
+		decode:  decode,
+		options: options,
+		// polling keeps the value fresh, the value never expires on its own
+		cache: lastcache.New(lastcache.Config{GlobalTTL: 100 * 365 * 24 * time.Hour}),
+	}
+	r.stop = r.cache.Schedule(configKey, lastcache.Every(options.PollInterval), func(ctx context.Context, _ any, prev *lastcache.Entry) (any, error) {
+		value, err := r.load(ctx)
+		if err != nil && r.options.OnError != nil {
+			r.options.OnError(err)
+		}
+		return value, err
+	})
+	return r
+}
+
+// Get returns the current configuration
+// If the first poll is not finished yet, the source is fetched synchronously
+func (r *Remote[T]) Get(ctx context.Context) (T, error) {
+	entry, err := r.cache.LoadOrStoreWithCtx(ctx, configKey, func(ctx context.Context, _ any, prev *lastcache.Entry) (any, bool, error) {
+		value, err := r.load(ctx)
+		return value, prev != nil, err
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return entry.Value.(snapshot[T]).value, nil
+}
+
+// OnChange calls f in a goroutine whenever a poll produces a different configuration
+// The returned function stops the notifications
+func (r *Remote[T]) OnChange(f func(old, new T)) (stop func()) {
+	var last snapshot[T]
+	if entry, err := r.cache.Get(configKey); err == nil {
+		last = entry.Value.(snapshot[T])
+	}
+
+	updates, unsubscribe := r.cache.Subscribe(configKey)
+	go func() {
+		for entry := range updates {
+			current, ok := entry.Value.(snapshot[T])
+			if !ok || bytes.Equal(current.raw, last.raw) {
+				continue
+			}
+			f(last.value, current.value)
+			last = current
+		}
+	}()
+	return unsubscribe
+}
+
+// Close stops polling
+func (r *Remote[T]) Close() {
+	r.stop()
+	r.cache.Close()
+}
+
+func (r *Remote[T]) load(ctx context.Context) (any, error) {
+	raw, err := r.source(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := r.decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("remoteconfig: decode: %w", err)
+	}
+	return snapshot[T]{raw: raw, value: value}, nil
+}
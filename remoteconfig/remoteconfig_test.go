@@ -0,0 +1,117 @@
+package remoteconfig
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSource struct {
+	mu   sync.Mutex
+	data string
+	err  error
+}
+
+func (s *fakeSource) fetch(context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return []byte(s.data), s.err
+}
+
+func (s *fakeSource) set(data string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data, s.err = data, err
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition is not met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRemote(t *testing.T) {
+	source := &fakeSource{data: `{"enabled": true, "limit": 10}`}
+	var mu sync.Mutex
+	var errs []error
+	remote := New(source.fetch, JSON[Values](), Options{
+		PollInterval: time.Millisecond,
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+	defer remote.Close()
+
+	values, err := remote.Get(context.Background())
+	if err != nil || !values.Bool("enabled", false) || values.Int("limit", 0) != 10 {
+		t.Fatalf("Get() got %v, %v", values, err)
+	}
+
+	changes := make(chan [2]Values, 10)
+	stop := remote.OnChange(func(old, new Values) {
+		changes <- [2]Values{old, new}
+	})
+	defer stop()
+
+	source.set(`{"enabled": false, "limit": 10}`, nil)
+	select {
+	case change := <-changes:
+		if !change[0].Bool("enabled", false) || change[1].Bool("enabled", true) {
+			t.Errorf("OnChange() got %v", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("change is not notified")
+	}
+
+	// failed polls keep the last good value
+	source.set(`broken`, nil)
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(errs) > 0
+	})
+	source.set("", errors.New("unavailable"))
+	if values, err = remote.Get(context.Background()); err != nil || values.Bool("enabled", true) {
+		t.Errorf("Get() got %v, %v, want the last good value", values, err)
+	}
+}
+
+func TestURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"timeout": "1m30s", "name": "lastcache", "ratio": 0.5}`))
+	}))
+	defer ts.Close()
+
+	remote := New(URL(nil, ts.URL), JSON[Values](), Options{})
+	defer remote.Close()
+
+	values, err := remote.Get(context.Background())
+	if err != nil {
+		t.Fatalf("failed with err: %v", err)
+	}
+	if got := values.Duration("timeout", 0); got != 90*time.Second {
+		t.Errorf("Duration() got = %v, want 1m30s", got)
+	}
+	if got := values.String("name", ""); got != "lastcache" {
+		t.Errorf("String() got = %v, want lastcache", got)
+	}
+	if got := values.Float("ratio", 0); got != 0.5 {
+		t.Errorf("Float() got = %v, want 0.5", got)
+	}
+	if got := values.Bool("missing", true); !got {
+		t.Errorf("Bool() got = %v, want default true", got)
+	}
+}
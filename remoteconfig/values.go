@@ -0,0 +1,54 @@
+package remoteconfig
+
+import "time"
+
+// Values generic key/value configuration, e.g. feature flags decoded from a JSON object
+type Values map[string]any
+
+// Bool returns the value of the name if it's a bool, otherwise def
+func (v Values) Bool(name string, def bool) bool {
+	if b, ok := v[name].(bool); ok {
+		return b
+	}
+	return def
+}
+
+// String returns the value of the name if it's a string, otherwise def
+func (v Values) String(name string, def string) string {
+	if s, ok := v[name].(string); ok {
+		return s
+	}
+	return def
+}
+
+// Float returns the value of the name if it's a number, otherwise def
+func (v Values) Float(name string, def float64) float64 {
+	switch n := v[name].(type) {
+	case float64:
+		return n
+	case int:
+		return float64(n)
+	}
+	return def
+}
+
+// Int returns the value of the name if it's a number, otherwise def
+func (v Values) Int(name string, def int) int {
+	switch n := v[name].(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
+	}
+	return def
+}
+
+// Duration returns the value of the name if it's a duration string (e.g. "1m30s"), otherwise def
+func (v Values) Duration(name string, def time.Duration) time.Duration {
+	if s, ok := v[name].(string); ok {
+		if d, err := time.ParseDuration(s); err == nil {
+			return d
+		}
+	}
+	return def
+}
@@ -0,0 +1,388 @@
+// Package replication streams the mutations of a cache to peer instances over HTTP,
+// so warm data is shared across the replicas, and a freshly started replica can bootstrap from a peer's snapshot
+//
+// Stored, refreshed and deleted keys are sent to the peers in batches, and applied there with their original expiry.
+// Replication is best effort: changes which can't be delivered are reported by Config.OnError and dropped.
+//
+//	r, err := replication.New(cache, replication.Config{Peers: []string{"http://cache-1:8080/replication"}})
+//	mux.Handle("/replication/", http.StripPrefix("/replication", r.Handler()))
+//	r.Bootstrap(ctx)
+package replication
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+const (
+	defaultCodec         = "gob"
+	defaultFlushInterval = 100 * time.Millisecond
+	defaultMaxBatch      = 1000
+
+	replicatePath = "/replicate"
+	snapshotPath  = "/snapshot"
+	statsPath     = "/stats"
+)
+
+// ErrEventsDisabled is returned by New when the events of the cache are disabled
+var ErrEventsDisabled = errors.New("replication: Config.EventsBuffer of the cache must be set")
+
+// Config of the Replicator
+type Config struct {
+	// Peers base URLs of the handlers of the peers
+	Peers []string
+
+	// Client used to send the changes to the peers
+	// Default is http.DefaultClient
+	Client *http.Client
+
+	// Codec name of the registered codec to encode the changes, which must be the same on all the peers
+	// Default is "gob"
+	Codec string
+
+	// Token if set, the requests are authenticated by this bearer token, which must be the same on all the peers
+	Token string
+
+	// FlushInterval maximum time to wait for more changes before sending a batch
+	// Default is 100ms
+	FlushInterval time.Duration
+
+	// MaxBatch maximum number of the changes in a batch
+	// Default is 1000
+	MaxBatch int
+
+	// OnError is called when a batch can not be sent to a peer
+	OnError func(peer string, err error)
+}
+
+// change a replicated mutation as it's encoded in the batches
+type change struct {
+	Key       any
+	Value     any
+	ExpiresAt time.Time
+	Deleted   bool
+}
+
+// Replicator sends the mutations of the cache to the peers, and applies the mutations received from them
+type Replicator struct {
+	cache  *lastcache.Cache
+	config Config
+	codec  lastcache.Codec
+
+	mu sync.Mutex
+	// applying number of the deletes received from the peers per key, whose events must not be sent back
+	applying map[any]int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New returns a Replicator which consumes the events of the cache, so Config.EventsBuffer of the cache must be set
+// and the events must not be consumed by others
+// Values restored from snapshots or received from peers (EventRestore) and evictions are not replicated
+func New(cache *lastcache.Cache, config Config) (*Replicator, error) {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.Codec == "" {
+		config.Codec = defaultCodec
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultFlushInterval
+	}
+	if config.MaxBatch <= 0 {
+		config.MaxBatch = defaultMaxBatch
+	}
+
+	codec, ok := lastcache.LookupCodec(config.Codec)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", lastcache.ErrUnknownCodec, config.Codec)
+	}
+	events := cache.Events()
+	if events == nil {
+		return nil, ErrEventsDisabled
+	}
+
+	r := &Replicator{
+		cache:    cache,
+		config:   config,
+		codec:    codec,
+		applying: make(map[any]int),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.run(events)
+	return r, nil
+}
+
+// Close stops the replication, the pending changes are sent before Close returns
+func (r *Replicator) Close() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *Replicator) run(events <-chan lastcache.Event) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.config.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []change
+	for {
+		select {
+		case <-r.stop:
+			r.send(batch)
+			return
+		case <-ticker.C:
+			r.send(batch)
+			batch = batch[:0]
+		case event := <-events:
+			c, ok := r.changeOf(event)
+			if !ok {
+				continue
+			}
+			if batch = append(batch, c); len(batch) >= r.config.MaxBatch {
+				r.send(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// changeOf returns the change to be replicated for the event
+func (r *Replicator) changeOf(event lastcache.Event) (change, bool) {
+	switch event.Type {
+	case lastcache.EventSet, lastcache.EventRefresh:
+		return change{Key: event.Key, Value: event.Value, ExpiresAt: time.Now().Add(r.cache.TTL(event.Key))}, true
+	case lastcache.EventDelete:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if n := r.applying[event.Key]; n > 0 {
+			if n == 1 {
+				delete(r.applying, event.Key)
+			} else {
+				r.applying[event.Key] = n - 1
+			}
+			return change{}, false
+		}
+		return change{Key: event.Key, Deleted: true}, true
+	}
+	return change{}, false
+}
+
+// send sends the batch to all the peers concurrently
+func (r *Replicator) send(batch []change) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var body bytes.Buffer
+	for _, c := range batch {
+		if err := writeChange(&body, r.codec, c); err != nil {
+			r.onError("", err)
+			return
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, peer := range r.config.Peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			if err := r.post(peer, body.Bytes()); err != nil {
+				r.onError(peer, err)
+			}
+		}(peer)
+	}
+	wg.Wait()
+}
+
+func (r *Replicator) post(peer string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, peer+replicatePath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	r.authorize(req)
+
+	resp, err := r.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("replication: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Bootstrap restores the snapshot of the first available peer, e.g. on startup so the cache doesn't start cold
+// Returns the number of restored entries, or the error of the last peer if no snapshot could be restored
+func (r *Replicator) Bootstrap(ctx context.Context) (int, error) {
+	err := errors.New("replication: no peers")
+	for _, peer := range r.config.Peers {
+		var n int
+		if n, err = r.restoreFrom(ctx, peer); err == nil {
+			return n, nil
+		}
+	}
+	return 0, err
+}
+
+func (r *Replicator) restoreFrom(ctx context.Context, peer string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer+snapshotPath, nil)
+	if err != nil {
+		return 0, err
+	}
+	r.authorize(req)
+
+	resp, err := r.config.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("replication: unexpected status %d", resp.StatusCode)
+	}
+	return r.cache.Restore(resp.Body)
+}
+
+// Handler returns the handler which receives the changes and serves the snapshots to the peers,
+// and the statistics of the cache as JSON to clusterstats
+// It should be mounted at the base URL which is given to the peers in Config.Peers
+func (r *Replicator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(replicatePath, r.handleReplicate)
+	mux.HandleFunc(snapshotPath, r.handleSnapshot)
+	mux.HandleFunc(statsPath, r.handleStats)
+	return r.authenticate(mux)
+}
+
+func (r *Replicator) handleReplicate(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body := bufio.NewReader(req.Body)
+	for {
+		c, err := readChange(body, r.codec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.apply(c)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *Replicator) handleSnapshot(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if err := r.cache.Snapshot(w, r.config.Codec); err != nil {
+		r.onError("", err)
+	}
+}
+
+func (r *Replicator) handleStats(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.cache.Stats())
+}
+
+// apply applies the change received from a peer
+func (r *Replicator) apply(c change) {
+	if !c.Deleted {
+		r.cache.RestoreRecord(lastcache.SnapshotRecord{Key: c.Key, Value: c.Value, ExpiresAt: c.ExpiresAt})
+		return
+	}
+
+	if _, err := r.cache.Get(c.Key); errors.Is(err, lastcache.ErrNotFound) {
+		return
+	}
+	r.mu.Lock()
+	r.applying[c.Key]++
+	r.mu.Unlock()
+	r.cache.Delete(c.Key)
+}
+
+func (r *Replicator) authorize(req *http.Request) {
+	if r.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.config.Token)
+	}
+}
+
+func (r *Replicator) authenticate(next http.Handler) http.Handler {
+	if r.config.Token == "" {
+		return next
+	}
+	want := []byte("Bearer " + r.config.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), want) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (r *Replicator) onError(peer string, err error) {
+	if r.config.OnError != nil {
+		r.config.OnError(peer, err)
+	}
+}
+
+// writeChange writes the change encoded by codec, prefixed by its length as uvarint
+func writeChange(w io.Writer, codec lastcache.Codec, c change) error {
+	data, err := codec.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	var size [binary.MaxVarintLen64]byte
+	if _, err = w.Write(size[:binary.PutUvarint(size[:], uint64(len(data)))]); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// readChange reads a change written by writeChange, io.EOF is returned if there is no more change
+func readChange(r *bufio.Reader, codec lastcache.Codec) (change, error) {
+	var c change
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return c, err
+	}
+
+	data := make([]byte, size)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return c, err
+	}
+	err = codec.Unmarshal(data, &c)
+	return c, err
+}
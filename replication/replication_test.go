@@ -0,0 +1,144 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+type node struct {
+	cache      *lastcache.Cache
+	replicator *Replicator
+	server     *httptest.Server
+	requests   int32
+}
+
+// newNodes returns n nodes which replicate to each other
+func newNodes(t *testing.T, n int, config Config) []*node {
+	t.Helper()
+	nodes := make([]*node, n)
+	handlers := make([]http.Handler, n)
+	for i := range nodes {
+		i := i
+		nodes[i] = &node{cache: lastcache.New(lastcache.Config{GlobalTTL: time.Minute, EventsBuffer: 100})}
+		nodes[i].server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&nodes[i].requests, 1)
+			handlers[i].ServeHTTP(w, r)
+		}))
+	}
+	for i, nd := range nodes {
+		peerConfig := config
+		peerConfig.FlushInterval = time.Millisecond
+		for j, peer := range nodes {
+			if j != i {
+				peerConfig.Peers = append(peerConfig.Peers, peer.server.URL)
+			}
+		}
+		r, err := New(nd.cache, peerConfig)
+		if err != nil {
+			t.Fatalf("New() failed with err: %v", err)
+		}
+		nd.replicator = r
+		handlers[i] = r.Handler()
+	}
+	t.Cleanup(func() {
+		for _, nd := range nodes {
+			nd.replicator.Close()
+			nd.server.Close()
+			nd.cache.Close()
+		}
+	})
+	return nodes
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition is not met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReplicator(t *testing.T) {
+	nodes := newNodes(t, 3, Config{})
+
+	nodes[0].cache.Set("key", "value")
+	for _, nd := range nodes[1:] {
+		waitFor(t, func() bool {
+			entry, err := nd.cache.Get("key")
+			return err == nil && entry.Value == "value"
+		})
+		if ttl := nd.cache.TTL("key"); ttl <= 50*time.Second {
+			t.Errorf("TTL() got %v, want the original expiry", ttl)
+		}
+	}
+
+	nodes[1].cache.Delete("key")
+	for _, nd := range []*node{nodes[0], nodes[2]} {
+		waitFor(t, func() bool {
+			_, err := nd.cache.Get("key")
+			return errors.Is(err, lastcache.ErrNotFound)
+		})
+	}
+
+	// received changes are not sent back
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&nodes[1].requests); n != 1 {
+		t.Errorf("node 1 got %v requests, want 1", n)
+	}
+}
+
+func TestReplicator_Bootstrap(t *testing.T) {
+	nodes := newNodes(t, 1, Config{Token: "secret"})
+	nodes[0].cache.Set("key", "value")
+
+	cache := lastcache.New(lastcache.Config{EventsBuffer: 10})
+	defer cache.Close()
+
+	unauthorized, _ := New(cache, Config{Peers: []string{nodes[0].server.URL}})
+	if _, err := unauthorized.Bootstrap(context.Background()); err == nil {
+		t.Errorf("Bootstrap() without token got no error")
+	}
+	unauthorized.Close()
+
+	r, _ := New(cache, Config{Peers: []string{"http://127.0.0.1:1", nodes[0].server.URL}, Token: "secret"})
+	defer r.Close()
+	if n, err := r.Bootstrap(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Bootstrap() got %v, %v, want 1 entry", n, err)
+	}
+	if entry, err := cache.Get("key"); err != nil || entry.Value != "value" {
+		t.Errorf("Get() got %+v, %v, want value", entry, err)
+	}
+}
+
+func TestNew_EventsDisabled(t *testing.T) {
+	if _, err := New(lastcache.New(lastcache.Config{}), Config{}); !errors.Is(err, ErrEventsDisabled) {
+		t.Errorf("New() err got %v, want %v", err, ErrEventsDisabled)
+	}
+}
+
+func TestReplicator_Stats(t *testing.T) {
+	nodes := newNodes(t, 1, Config{})
+	nodes[0].cache.Set("key", "value")
+	nodes[0].cache.LoadOrStore("key", nil)
+
+	resp, err := http.Get(nodes[0].server.URL + statsPath)
+	if err != nil {
+		t.Fatalf("GET /stats failed with err: %v", err)
+	}
+	defer resp.Body.Close()
+	var stats lastcache.Stats
+	if err = json.NewDecoder(resp.Body).Decode(&stats); err != nil || stats.Hits != 1 {
+		t.Errorf("GET /stats got %+v, %v, want 1 hit", stats, err)
+	}
+}
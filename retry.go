@@ -0,0 +1,54 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 10 * time.Second
+)
+
+// callAsyncWithRetry calls the callback and retries up to Config.RefreshRetries times on failure
+// The wait between the attempts grows exponentially, with a random jitter of up to half of the backoff
+// ErrTombstone and context errors are not retried
+func (c *Cache) callAsyncWithRetry(ctx context.Context, key any, callback AsyncCallback) (any, error) {
+	backoff := c.config.RefreshRetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	maxBackoff := c.config.RefreshRetryMaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		value, err := c.callAsync(ctx, key, c.prevEntry(key), callback, CallbackAsync)
+		if err == nil || attempt >= c.config.RefreshRetries || !retryable(ctx, err) {
+			return value, err
+		}
+
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return value, err
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func retryable(ctx context.Context, err error) bool {
+	if errors.Is(err, ErrTombstone) || ctx.Err() != nil {
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,82 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCache_AsyncRefreshRetry(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL:           10 * time.Millisecond,
+		RefreshRetries:      2,
+		RefreshRetryBackoff: time.Millisecond,
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+	nrCalls := 0
+	_, refresh, _ := cache.AsyncLoadOrStore("key", func(_ context.Context, key any, prev *Entry) (any, error) {
+		nrCalls++
+		if nrCalls < 3 {
+			return nil, errors.New("unavailable")
+		}
+		return "new_value", nil
+	})
+
+	entry, err := refresh.Result()
+	if err != nil || entry.Value != "new_value" {
+		t.Errorf("Result() got %+v, %v, want new_value", entry, err)
+	}
+	if nrCalls != 3 {
+		t.Errorf("Number of AsyncCallback calls got = %v, want 3", nrCalls)
+	}
+}
+
+func TestCache_AsyncRefreshRetryExhausted(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{
+			name:      "retries exhausted",
+			err:       errors.New("unavailable"),
+			wantCalls: 3,
+		},
+		{
+			name:      "tombstone is not retried",
+			err:       ErrTombstone,
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := New(Config{
+				GlobalTTL:           10 * time.Millisecond,
+				RefreshRetries:      2,
+				RefreshRetryBackoff: time.Millisecond,
+			})
+
+			now = func() time.Time { return fixedTime() }
+			cache.Set("key", "value")
+			now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+
+			nrCalls := 0
+			_, refresh, _ := cache.AsyncLoadOrStore("key", func(_ context.Context, key any, prev *Entry) (any, error) {
+				nrCalls++
+				return nil, tt.err
+			})
+
+			if _, err := refresh.Result(); !errors.Is(err, tt.err) {
+				t.Errorf("Result() err got %v, want %v", err, tt.err)
+			}
+			if nrCalls != tt.wantCalls {
+				t.Errorf("Number of AsyncCallback calls got = %v, want %v", nrCalls, tt.wantCalls)
+			}
+		})
+	}
+}
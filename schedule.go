@@ -0,0 +1,219 @@
+package lastcache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the next refresh time after t
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// Every returns a Schedule which refreshes in fixed intervals
+// It panics if interval is not positive, like time.NewTicker
+func Every(interval time.Duration) Schedule {
+	if interval <= 0 {
+		panic("lastcache: non-positive interval for Every")
+	}
+	return every(interval)
+}
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// cronSchedule standard 5 fields cron schedule (minute hour day-of-month month day-of-week)
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny the day fields start with *, otherwise a day matches if either of them matches
+	domAny, dowAny bool
+}
+
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Cron parses a standard 5 fields cron expression (minute hour day-of-month month day-of-week)
+// Each field supports `*`, numbers, ranges (1-5), lists (1,3,5) and steps (*/15, 0-30/5, 5/15 from 5 to the max)
+// Both 0 and 7 are Sunday in day-of-week. If both day-of-month and day-of-week are restricted (not starting with *),
+// a day matches if either of them matches, as in standard cron
+// The schedule is evaluated in the location of the given time
+func Cron(expr string) (Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("lastcache: cron expression %q must have %d fields", expr, len(cronFields))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		bits[i], err = parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("lastcache: cron %s field %q: %w", cronFields[i].name, field, err)
+		}
+	}
+
+	// 7 is Sunday as well as 0
+	dow := bits[4]
+	if dow&(1<<7) != 0 {
+		dow = dow&^(1<<7) | 1
+	}
+	return cronSchedule{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: dow,
+		domAny: strings.HasPrefix(fields[2], "*"), dowAny: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step, stepped := 1, false
+		if i := strings.Index(part, "/"); i >= 0 {
+			stepped = true
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+			part = part[:i]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", bounds[0])
+			}
+			to = from
+			if len(bounds) == 1 && stepped {
+				// a single value with step starts the range, e.g. 5/15
+				to = max
+			}
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", bounds[1])
+				}
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("out of range [%d-%d]", min, max)
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first matching minute after t
+func (s cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// the schedule repeats at most every 4 years (leap years)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of t matches day-of-month and day-of-week
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Schedule refreshes the key by callback immediately and then on the given schedule, independent of reads
+// This keeps rarely read but latency critical keys always warm
+// The failed refreshes are ignored and the stale value is kept
+// Scheduled refreshes stop when the returned function is called or the cache is closed
+// The stop function blocks until the running refresh, if any, is returned
+func (c *Cache) Schedule(key any, schedule Schedule, callback AsyncCallback) (stop func()) {
+	ctx, cancel := context.WithCancel(c.context())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.runSchedule(ctx, key, schedule, callback)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (c *Cache) runSchedule(ctx context.Context, key any, schedule Schedule, callback AsyncCallback) {
+	for {
+		c.scheduledRefresh(ctx, key, callback)
+
+		next := schedule.Next(c.now())
+		if next.IsZero() {
+			return
+		}
+
+		timer := time.NewTimer(next.Sub(c.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Cache) scheduledRefresh(ctx context.Context, key any, callback AsyncCallback) {
+	if c.IsDegraded() || c.RefreshPaused() {
+		return
+	}
+	if !c.semaphore.acquire(ctx.Done()) {
+		return
+	}
+	defer c.semaphore.release()
+
+	release, acquired := c.acquireLease(ctx, key)
+	if !acquired {
+		return
+	}
+	defer release()
+
+	newValue, err := c.callAsyncWithRetry(ctx, key, callback)
+	if err != nil {
+		if !c.isTombstone(key, err) {
+			c.storeErr(key, err)
+		}
+		return
+	}
+	c.store(key, newValue)
+}
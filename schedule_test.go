@@ -0,0 +1,148 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		from    time.Time
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			expr: "*/15 * * * *",
+			from: time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC),
+			want: time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC),
+		},
+		{
+			expr: "0 3 * * *",
+			from: time.Date(2024, 1, 1, 10, 7, 0, 0, time.UTC),
+			want: time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			expr: "30 9 * * 1-5",
+			from: time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC), // Friday
+			want: time.Date(2024, 1, 8, 9, 30, 0, 0, time.UTC), // Monday
+		},
+		{
+			expr: "0 0 29 2 *",
+			from: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC),
+			want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			expr: "0,30 8-9 1 * *",
+			from: time.Date(2024, 1, 1, 8, 30, 0, 0, time.UTC),
+			want: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			expr: "5/15 * * * *",
+			from: time.Date(2024, 1, 1, 10, 7, 0, 0, time.UTC),
+			want: time.Date(2024, 1, 1, 10, 20, 0, 0, time.UTC),
+		},
+		{
+			expr: "0 0 * * 7",
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), // Monday
+			want: time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC), // Sunday
+		},
+		{
+			// either the 15th or a Monday
+			expr: "0 0 15 * 1",
+			from: time.Date(2024, 1, 9, 0, 0, 0, 0, time.UTC), // Tuesday
+			want: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			expr: "0 0 20 * 1",
+			from: time.Date(2024, 1, 9, 0, 0, 0, 0, time.UTC),
+			want: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), // Monday
+		},
+		{
+			expr: "0 0 */10 * 1",
+			from: time.Date(2024, 1, 9, 0, 0, 0, 0, time.UTC),
+			want: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), // both, since day-of-month starts with *
+		},
+		{
+			expr:    "* * *",
+			wantErr: true,
+		},
+		{
+			expr:    "60 * * * *",
+			wantErr: true,
+		},
+		{
+			expr:    "*/0 * * * *",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := Cron(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Cron() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := schedule.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCache_Schedule(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: time.Hour,
+	})
+	defer cache.Close()
+
+	var calls int64
+	refreshed := make(chan struct{}, 10)
+	stop := cache.Schedule("key", Every(time.Millisecond), func(ctx context.Context, key any, prev *Entry) (any, error) {
+		n := atomic.AddInt64(&calls, 1)
+		select {
+		case refreshed <- struct{}{}:
+		default:
+		}
+		return n, nil
+	})
+
+	<-refreshed
+	<-refreshed
+	stop()
+
+	entry, err := cache.Get("key")
+	if err != nil || entry.Value.(int64) < 1 {
+		t.Errorf("Get() got %+v, %v, want scheduled value", entry, err)
+	}
+}
+
+func TestEvery_NonPositive(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Every(0) expected to panic")
+		}
+	}()
+	Every(0)
+}
+
+func TestCache_ScheduleTombstone(t *testing.T) {
+	now = time.Now
+	cache := New(Config{GlobalTTL: time.Minute})
+	defer cache.Close()
+	cache.Set("key", "value")
+
+	stop := cache.Schedule("key", Every(time.Hour), func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return nil, ErrTombstone
+	})
+	stop()
+
+	if _, err := cache.Get("key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() got err %v, want the key deleted by ErrTombstone", err)
+	}
+}
@@ -0,0 +1,84 @@
+package lastcache
+
+import "sync"
+
+// limiter is a semaphore whose size can be changed while it's held
+type limiter struct {
+	mu   sync.Mutex
+	size int
+	held int
+	// wake is closed to wake up the waiters when a slot is released or the size is changed
+	wake chan struct{}
+}
+
+func newLimiter(size int) *limiter {
+	return &limiter{size: size}
+}
+
+// acquire waits for a free slot, false is returned if done is closed meanwhile
+// A nil done waits forever
+func (l *limiter) acquire(done <-chan struct{}) bool {
+	for {
+		l.mu.Lock()
+		if l.held < l.size {
+			l.held++
+			l.mu.Unlock()
+			return true
+		}
+		if l.wake == nil {
+			l.wake = make(chan struct{})
+		}
+		wake := l.wake
+		l.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-done:
+			return false
+		}
+	}
+}
+
+func (l *limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.held--
+	l.broadcast()
+}
+
+// resize changes the number of the slots, the holders of the slots above the new size are not affected
+// but new holders wait until the number of the holders is below the new size
+func (l *limiter) resize(size int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.size = size
+	l.broadcast()
+}
+
+// usage returns the number of the held slots and the size
+func (l *limiter) usage() (held, size int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.held, l.size
+}
+
+func (l *limiter) broadcast() {
+	if l.wake != nil {
+		close(l.wake)
+		l.wake = nil
+	}
+}
+
+// SetAsyncSemaphore changes the number of the background callbacks allowed at the same time, see Config.AsyncSemaphore
+// It can be used to throttle the refresh pressure on a struggling upstream during an incident without recreating the cache
+// The running callbacks are not affected when it's decreased, and if n <= 0 the default will be used
+func (c *Cache) SetAsyncSemaphore(n int) {
+	c.lazyInit()
+	if n <= 0 {
+		n = defaultSemaphore
+	}
+	c.semaphore.resize(n)
+}
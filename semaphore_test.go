@@ -0,0 +1,89 @@
+package lastcache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(1)
+	if !l.acquire(nil) {
+		t.Fatal("acquire() got false, want true")
+	}
+
+	done := make(chan struct{})
+	close(done)
+	if l.acquire(done) {
+		t.Error("acquire() of a full limiter got true, want false when done")
+	}
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- l.acquire(nil)
+	}()
+	l.resize(2)
+	if !<-acquired {
+		t.Error("acquire() after resize got false, want true")
+	}
+
+	l.resize(1)
+	l.release()
+	if held, size := l.usage(); held != 1 || size != 1 {
+		t.Errorf("usage() got %d, %d, want 1, 1", held, size)
+	}
+	go func() {
+		acquired <- l.acquire(nil)
+	}()
+	l.release()
+	if !<-acquired {
+		t.Error("acquire() after release got false, want true")
+	}
+}
+
+func TestCache_SetAsyncSemaphore(t *testing.T) {
+	cache := New(Config{GlobalTTL: time.Minute, AsyncSemaphore: 1})
+	cache.SetAsyncSemaphore(3)
+
+	var running, maxRunning int32
+	release := make(chan struct{})
+	callback := func(ctx context.Context, key any, prev *Entry) (any, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		return "new", nil
+	}
+
+	now = func() time.Time { return fixedTime() }
+	keys := []any{"key1", "key2", "key3", "key4"}
+	for _, key := range keys {
+		cache.Set(key, "old")
+	}
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+
+	var refreshes []*Refresh
+	for _, key := range keys {
+		_, refresh, _ := cache.AsyncLoadOrStore(key, callback)
+		refreshes = append(refreshes, refresh)
+	}
+	for i := 0; atomic.LoadInt32(&running) < 3; i++ {
+		if i == 100 {
+			t.Fatalf("running callbacks got %d, want 3", atomic.LoadInt32(&running))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for _, refresh := range refreshes {
+		<-refresh.Done()
+	}
+	if max := atomic.LoadInt32(&maxRunning); max != 3 {
+		t.Errorf("max running callbacks got %d, want 3", max)
+	}
+}
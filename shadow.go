@@ -0,0 +1,139 @@
+package lastcache
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// noWait is closed, so acquiring the semaphore by it doesn't wait for a free slot
+var noWait = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// shadowSampled reports whether a fresh hit should be compared with the callback, see Config.ShadowRate
+func (c *Cache) shadowSampled() bool {
+	return c.config.ShadowRate > 0 && rand.Float64() < c.config.ShadowRate
+}
+
+// shadowSync compares the cached value of the fresh hit with the value of the SyncCallback in background
+func (c *Cache) shadowSync(ctx context.Context, key, cached any, callback SyncCallback) {
+	c.shadow(ctx, key, cached, func(ctx context.Context, prev *Entry) (any, error) {
+		value, _, err := c.wrapSync(callback)(ctx, key, prev)
+		return value, err
+	})
+}
+
+// shadowAsync compares the cached value of the fresh hit with the value of the AsyncCallback in background
+func (c *Cache) shadowAsync(ctx context.Context, key, cached any, callback AsyncCallback) {
+	c.shadow(ctx, key, cached, func(ctx context.Context, prev *Entry) (any, error) {
+		return c.wrapAsync(callback)(ctx, key, prev)
+	})
+}
+
+// shadow calls the callback in background if a slot of Config.AsyncSemaphore is free, so the comparisons never delay
+// the refreshes. The result of the callback is only compared and not stored, failed callbacks are not compared
+// The callback gets the values of ctx, with the cancellation of the cache context as it outlives the caller
+func (c *Cache) shadow(ctx context.Context, key, cached any, call func(ctx context.Context, prev *Entry) (any, error)) {
+	if !c.semaphore.acquire(noWait) {
+		return
+	}
+	prev := c.prevEntry(key)
+	if ctx != c.context() {
+		ctx = detachedContext{Context: c.context(), values: ctx}
+	}
+	go func() {
+		defer c.semaphore.release()
+
+		start := time.Now()
+		actual, err := call(ctx, prev)
+		c.stats.shadowLatency.observe(time.Since(start))
+		if err != nil {
+			return
+		}
+		if v, ok := actual.(noStore); ok {
+			actual = v.value
+		}
+		// the cached value has diverged from the upstream at some point since it's stored
+		var age time.Duration
+		if prev != nil {
+			age = prev.Age
+		}
+		c.recordShadow(key, !c.shadowEqual(cached, actual), age)
+	}()
+}
+
+func (c *Cache) shadowEqual(cached, actual any) bool {
+	if c.config.ShadowEqual != nil {
+		return c.config.ShadowEqual(cached, actual)
+	}
+	return reflect.DeepEqual(cached, actual)
+}
+
+// recordShadow records the result of a shadow check, age is the age of the cached value
+func (c *Cache) recordShadow(key any, mismatch bool, age time.Duration) {
+	atomic.AddUint64(&c.stats.shadowChecks, 1)
+	if mismatch {
+		atomic.AddUint64(&c.stats.shadowMismatches, 1)
+		atomic.AddInt64(&c.stats.shadowMismatchAge, int64(age))
+	}
+	namespace, ns := c.namespaceStatsOf(key)
+	if ns != nil {
+		atomic.AddUint64(&ns.shadowChecks, 1)
+		if mismatch {
+			atomic.AddUint64(&ns.shadowMismatches, 1)
+			atomic.AddInt64(&ns.shadowMismatchAge, int64(age))
+		}
+	}
+	if m, ok := c.config.Metrics.(ShadowMetrics); ok {
+		m.ShadowCheck(key, namespace, mismatch, age)
+	}
+}
+
+// ShadowMetrics can be implemented by Metrics to receive the results of the shadow checks, see Config.ShadowRate
+type ShadowMetrics interface {
+	// ShadowCheck is called after each shadow check, namespace is empty if the key has no namespace
+	// age is the time since the cached value is stored, which is the upper bound of how long it has diverged
+	ShadowCheck(key any, namespace string, mismatch bool, age time.Duration)
+}
+
+// shadowMismatchRate returns the fraction of the mismatches of the shadow checks
+func shadowMismatchRate(checks, mismatches uint64) float64 {
+	if checks == 0 {
+		return 0
+	}
+	return float64(mismatches) / float64(checks)
+}
+
+// shadowMismatchAge returns the average age of the cached values of the mismatches
+func shadowMismatchAge(mismatches uint64, age time.Duration) time.Duration {
+	if mismatches == 0 {
+		return 0
+	}
+	return age / time.Duration(mismatches)
+}
+
+// ShadowMismatchRate returns the fraction of the shadow checks whose cached value differed from the callback
+func (s Stats) ShadowMismatchRate() float64 {
+	return shadowMismatchRate(s.ShadowChecks, s.ShadowMismatches)
+}
+
+// ShadowMismatchAvgAge returns the average age of the cached values which differed from the callback
+// It estimates how long the cached values stay accurate, which the ttl can be tuned by
+func (s Stats) ShadowMismatchAvgAge() time.Duration {
+	return shadowMismatchAge(s.ShadowMismatches, s.ShadowMismatchAge)
+}
+
+// ShadowMismatchRate see Stats.ShadowMismatchRate
+func (s NamespaceStats) ShadowMismatchRate() float64 {
+	return shadowMismatchRate(s.ShadowChecks, s.ShadowMismatches)
+}
+
+// ShadowMismatchAvgAge see Stats.ShadowMismatchAvgAge
+func (s NamespaceStats) ShadowMismatchAvgAge() time.Duration {
+	return shadowMismatchAge(s.ShadowMismatches, s.ShadowMismatchAge)
+}
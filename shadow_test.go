@@ -0,0 +1,138 @@
+package lastcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func waitShadowChecks(t *testing.T, cache *Cache, n uint64) Stats {
+	t.Helper()
+	for i := 0; ; i++ {
+		stats := cache.Stats()
+		if stats.ShadowChecks >= n {
+			return stats
+		}
+		if i == 100 {
+			t.Fatalf("got %d shadow checks, want %d", stats.ShadowChecks, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCache_ShadowRate(t *testing.T) {
+	now = func() time.Time { return fixedTime() }
+	cache := New(Config{GlobalTTL: time.Minute, ShadowRate: 1})
+	defer cache.Close()
+	upstream := make(chan string, 3)
+	upstream <- "v1"
+	upstream <- "v1"
+	upstream <- "v2"
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return <-upstream, false, nil
+	}
+
+	cache.LoadOrStore("key", callback)
+	// the fresh hits are compared in background
+	cache.LoadOrStore("key", callback)
+	waitShadowChecks(t, cache, 1)
+	entry, _, _ := cache.AsyncLoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return <-upstream, nil
+	})
+	stats := waitShadowChecks(t, cache, 2)
+
+	if stats.ShadowMismatches != 1 {
+		t.Errorf("ShadowMismatches got %d, want 1", stats.ShadowMismatches)
+	}
+	if entry.Value != "v1" || stats.Hits != 2 {
+		t.Errorf("shadow checks changed the cache, got %+v, %+v", entry, stats)
+	}
+	if entry, _ := cache.Get("key"); entry.Value != "v1" {
+		t.Errorf("Get() got %v, want the value not replaced by the shadow check", entry.Value)
+	}
+}
+
+func TestCache_ShadowEqual(t *testing.T) {
+	now = func() time.Time { return fixedTime() }
+	cache := New(Config{GlobalTTL: time.Minute, ShadowRate: 1, ShadowEqual: func(cached, actual any) bool {
+		return true
+	}})
+	defer cache.Close()
+	calls := 0
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		calls++
+		return calls, false, nil
+	}
+
+	cache.LoadOrStore("key", callback)
+	cache.LoadOrStore("key", callback)
+	if stats := waitShadowChecks(t, cache, 1); stats.ShadowMismatches != 0 {
+		t.Errorf("ShadowMismatches got %d, want 0 by ShadowEqual", stats.ShadowMismatches)
+	}
+}
+
+type shadowMetrics struct {
+	namespaceMetrics
+	checks chan string
+}
+
+func (m *shadowMetrics) ShadowCheck(key any, namespace string, mismatch bool, age time.Duration) {
+	m.checks <- fmt.Sprintf("%v %s %v %v", key, namespace, mismatch, age)
+}
+
+func TestCache_ShadowDriftMetrics(t *testing.T) {
+	metrics := &shadowMetrics{namespaceMetrics: namespaceMetrics{counts: make(map[string]int)}, checks: make(chan string, 1)}
+	cache := New(Config{GlobalTTL: time.Minute, ShadowRate: 1, Metrics: metrics, StatsNamespace: func(key any) string {
+		return "users"
+	}})
+	defer cache.Close()
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "old")
+	now = func() time.Time { return fixedTime().Add(30 * time.Second) }
+	cache.AsyncLoadOrStore("key", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return "new", nil
+	})
+
+	if check := <-metrics.checks; check != "key users true 30s" {
+		t.Errorf("ShadowCheck() got %s", check)
+	}
+	stats := cache.Stats()
+	if stats.ShadowMismatchRate() != 1 || stats.ShadowMismatchAvgAge() != 30*time.Second {
+		t.Errorf("Stats() got rate %v, age %v", stats.ShadowMismatchRate(), stats.ShadowMismatchAvgAge())
+	}
+	ns := stats.Namespaces["users"]
+	if ns.ShadowChecks != 1 || ns.ShadowMismatchRate() != 1 || ns.ShadowMismatchAvgAge() != 30*time.Second {
+		t.Errorf("Stats() of the namespace got %+v", ns)
+	}
+	if (Stats{}).ShadowMismatchRate() != 0 || (Stats{}).ShadowMismatchAvgAge() != 0 {
+		t.Errorf("empty Stats got shadow drift")
+	}
+}
+
+func TestCache_ShadowContext(t *testing.T) {
+	now = func() time.Time { return fixedTime() }
+	cache := New(Config{GlobalTTL: time.Minute, ShadowRate: 1})
+	defer cache.Close()
+	type tenantKey struct{}
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		// a callback reading the tenant of ctx returns the same value for the shadow check
+		return ctx.Value(tenantKey{}), false, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), tenantKey{}, "tenant"))
+	cache.LoadOrStoreWithCtx(ctx, "key", callback)
+	cache.LoadOrStoreWithCtx(ctx, "key", callback)
+	// the shadow check outlives the caller
+	cancel()
+	stats := waitShadowChecks(t, cache, 1)
+
+	if stats.ShadowMismatches != 0 {
+		t.Errorf("ShadowMismatches got %d, want 0 by the values of the caller context", stats.ShadowMismatches)
+	}
+	if stats.ShadowCallbackLatency.Count != 1 || stats.SyncCallbackLatency.Count != 1 {
+		t.Errorf("ShadowCallbackLatency count got %d, SyncCallbackLatency count got %d, want 1 each",
+			stats.ShadowCallbackLatency.Count, stats.SyncCallbackLatency.Count)
+	}
+}
@@ -0,0 +1,159 @@
+package lastcache
+
+import (
+	"container/list"
+	"reflect"
+	"unsafe"
+)
+
+// EstimateSize returns the approximate memory footprint of v in bytes using reflection
+// Pointers are followed once, and shared memory is counted only once per call
+func EstimateSize(v any) int64 {
+	if v == nil {
+		return 0
+	}
+	visited := make(map[uintptr]struct{})
+	return estimateSize(reflect.ValueOf(v), visited)
+}
+
+func estimateSize(v reflect.Value, visited map[uintptr]struct{}) int64 {
+	size := int64(v.Type().Size())
+	return size + estimateIndirectSize(v, visited)
+}
+
+// estimateIndirectSize returns the size of the memory referenced by v, excluding v itself
+func estimateIndirectSize(v reflect.Value, visited map[uintptr]struct{}) int64 {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Ptr:
+		if v.IsNil() || seen(v.Pointer(), visited) {
+			return 0
+		}
+		return estimateSize(v.Elem(), visited)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return estimateSize(v.Elem(), visited)
+	case reflect.Slice:
+		if v.IsNil() || seen(v.Pointer(), visited) {
+			return 0
+		}
+		size := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			size += estimateIndirectSize(v.Index(i), visited)
+		}
+		return size
+	case reflect.Array:
+		var size int64
+		for i := 0; i < v.Len(); i++ {
+			size += estimateIndirectSize(v.Index(i), visited)
+		}
+		return size
+	case reflect.Map:
+		if v.IsNil() || seen(v.Pointer(), visited) {
+			return 0
+		}
+		var size int64
+		iter := v.MapRange()
+		for iter.Next() {
+			size += estimateSize(iter.Key(), visited) + estimateSize(iter.Value(), visited)
+		}
+		return size
+	case reflect.Struct:
+		var size int64
+		for i := 0; i < v.NumField(); i++ {
+			size += estimateIndirectSize(v.Field(i), visited)
+		}
+		return size
+	default:
+		return 0
+	}
+}
+
+func seen(p uintptr, visited map[uintptr]struct{}) bool {
+	if _, ok := visited[p]; ok {
+		return true
+	}
+	visited[p] = struct{}{}
+	return false
+}
+
+// MemoryUsage approximate memory in bytes consumed by a group of entries
+type MemoryUsage struct {
+	Entries int
+	// Keys size of the keys, it's included in Values if Config.SizeFunc is set
+	Keys int64
+	// Values size of the values as they're stored, e.g. compressed, estimated by Config.SizeFunc if it's set
+	Values int64
+	// Overhead size of the internal structures of the entries, e.g. the records, the lru and per-key statistics
+	Overhead int64
+}
+
+// Total returns the sum of the sizes
+func (u MemoryUsage) Total() int64 {
+	return u.Keys + u.Values + u.Overhead
+}
+
+func (u *MemoryUsage) add(v MemoryUsage) {
+	u.Entries += v.Entries
+	u.Keys += v.Keys
+	u.Values += v.Values
+	u.Overhead += v.Overhead
+}
+
+// MemoryReport approximate memory consumed by the cache, see Cache.EstimateMemory
+type MemoryReport struct {
+	MemoryUsage
+	// Namespaces usage per namespace, nil if no namespace func is given
+	Namespaces map[string]MemoryUsage
+}
+
+var (
+	interfaceSize = int64(unsafe.Sizeof(any(nil)))
+	// entryOverhead the record of an entry and its map entry
+	entryOverhead = int64(unsafe.Sizeof(item{})) + 2*interfaceSize
+	// trackedOverhead the lru element of an entry and its map entry, see memoryTracker
+	trackedOverhead = int64(unsafe.Sizeof(list.Element{})+unsafe.Sizeof(memoryItem{})) + 2*interfaceSize
+	// keyStatsOverhead the per-key statistics of an entry and its map entry
+	keyStatsOverhead = int64(unsafe.Sizeof(keyStats{})) + 2*interfaceSize
+)
+
+// EstimateMemory returns the approximate memory consumed by the keys, values and internal structures of the entries,
+// for capacity planning or exposing as a gauge
+// If namespace is not nil, the usage is broken down by the namespace it returns for each key, e.g. the key prefix
+// It estimates every entry by EstimateSize or Config.SizeFunc, so it's O(N) and should not be called in hot paths
+func (c *Cache) EstimateMemory(namespace func(key any) string) MemoryReport {
+	var report MemoryReport
+	if namespace != nil {
+		report.Namespaces = make(map[string]MemoryUsage)
+	}
+
+	tracked := c.memoryTracked()
+	c.storage().Range(func(key any, it *item) bool {
+		usage := MemoryUsage{Entries: 1, Overhead: entryOverhead}
+		if c.config.SizeFunc != nil {
+			usage.Values = c.config.SizeFunc(key, it.value)
+		} else {
+			usage.Keys = EstimateSize(key)
+			usage.Values = EstimateSize(it.value)
+		}
+		if tracked {
+			usage.Overhead += trackedOverhead
+		}
+		if _, ok := c.keyStats.Load(key); ok {
+			usage.Overhead += keyStatsOverhead
+		}
+
+		report.add(usage)
+		if namespace != nil {
+			ns := namespace(key)
+			nsUsage := report.Namespaces[ns]
+			nsUsage.add(usage)
+			report.Namespaces[ns] = nsUsage
+		}
+		return true
+	})
+	return report
+}
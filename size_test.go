@@ -0,0 +1,95 @@
+package lastcache
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestEstimateSize(t *testing.T) {
+	type value struct {
+		Name  string
+		Items []int64
+	}
+	shared := &value{Name: "shared"}
+	// the headers are measured, so the sizes are right on 32-bit platforms as well
+	stringSize := int64(unsafe.Sizeof(""))
+	sliceSize := int64(unsafe.Sizeof([]byte(nil)))
+	pointerSize := int64(unsafe.Sizeof(shared))
+	valueSize := int64(unsafe.Sizeof(value{}))
+
+	tests := []struct {
+		name  string
+		value any
+		want  int64
+	}{
+		{
+			name:  "nil",
+			value: nil,
+			want:  0,
+		},
+		{
+			name:  "int64",
+			value: int64(1),
+			want:  8,
+		},
+		{
+			name:  "string",
+			value: "value",
+			want:  stringSize + 5,
+		},
+		{
+			name:  "byte slice",
+			value: make([]byte, 10, 20),
+			want:  sliceSize + 20,
+		},
+		{
+			name:  "struct",
+			value: value{Name: "name", Items: []int64{1, 2}},
+			want:  valueSize + 4 + 16,
+		},
+		{
+			name:  "shared pointers counted once",
+			value: []*value{shared, shared},
+			want:  sliceSize + 2*pointerSize + valueSize + 6,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateSize(tt.value); got != tt.want {
+				t.Errorf("EstimateSize() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCache_EstimateMemory(t *testing.T) {
+	cache := New(Config{KeyStats: true})
+	cache.Set("user:1", "alice")
+	cache.Set("user:2", "bob")
+	cache.Set("order:1", int64(1))
+
+	report := cache.EstimateMemory(func(key any) string {
+		return strings.SplitN(key.(string), ":", 2)[0]
+	})
+	if report.Entries != 3 {
+		t.Errorf("Entries got %d, want 3", report.Entries)
+	}
+	users := report.Namespaces["user"]
+	if users.Entries != 2 || users.Keys != EstimateSize("user:1")+EstimateSize("user:2") ||
+		users.Values != EstimateSize("alice")+EstimateSize("bob") || users.Overhead != 2*(entryOverhead+keyStatsOverhead) {
+		t.Errorf("user namespace got %+v", users)
+	}
+	if orders := report.Namespaces["order"]; orders.Entries != 1 || orders.Values != 8 {
+		t.Errorf("order namespace got %+v", orders)
+	}
+	if report.Total() != users.Total()+report.Namespaces["order"].Total() {
+		t.Errorf("Total() got %d, want the sum of the namespaces", report.Total())
+	}
+
+	sized := New(Config{SizeFunc: func(key, value any) int64 { return 100 }})
+	sized.Set("key", "value")
+	if report = sized.EstimateMemory(nil); report.Keys != 0 || report.Values != 100 || report.Namespaces != nil {
+		t.Errorf("EstimateMemory() with SizeFunc got %+v", report)
+	}
+}
@@ -0,0 +1,242 @@
+package lastcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	snapshotMagic          = "lastcache-snapshot-v1"
+	encryptedSnapshotMagic = "lastcache-snapshot-v1-aesgcm"
+)
+
+// SnapshotRecord a cached entry as it's stored in snapshots
+type SnapshotRecord struct {
+	Key       any
+	Value     any
+	ExpiresAt time.Time
+}
+
+// Snapshot writes all the entries including the expired ones to w, encoded by the codec registered by codecName
+//
+// The snapshot starts with the "lastcache-snapshot-v1" and the codec name lines,
+// followed by SnapshotRecords, each encoded by the codec and prefixed by its length as uvarint,
+// so it can be consumed by other languages if the codec supports it (e.g. JSON)
+//
+// If Config.Encryption is set, the snapshot starts with "lastcache-snapshot-v1-aesgcm", the codec name and the key id lines,
+// and each record is encrypted by AES-GCM, prefixed by its random nonce
+func (c *Cache) Snapshot(w io.Writer, codecName string) error {
+	codec, ok := LookupCodec(codecName)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownCodec, codecName)
+	}
+
+	bw := bufio.NewWriter(w)
+	fc, err := c.writeHeader(bw, snapshotMagic, encryptedSnapshotMagic, codecName)
+	if err != nil {
+		return err
+	}
+
+	c.storage().Range(func(key any, it *item) bool {
+		var value any
+		if value, err = c.decompress(it.value); err != nil {
+			return false
+		}
+		err = writeRecord(bw, codec, fc, SnapshotRecord{Key: key, Value: value, ExpiresAt: it.expiresAt})
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Restore reads a snapshot written by Snapshot and stores its entries with their original expiry,
+// so expired entries are restored as stale and can still be served while they are refreshed
+// The codec is looked up by the name stored in the snapshot
+// Returns the number of restored entries
+func (c *Cache) Restore(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	codec, fc, err := c.readHeader(br, snapshotMagic, encryptedSnapshotMagic)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for {
+		var record SnapshotRecord
+		err := readRecord(br, codec, fc, &record)
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		c.RestoreRecord(record)
+		n++
+	}
+}
+
+// RestoreRecord stores the value of the record with its original expiry, the same as Restore does for each record
+// EventRestore is emitted instead of EventSet, so restored values can be told apart, e.g. to not replicate them again
+func (c *Cache) RestoreRecord(record SnapshotRecord) {
+	c.restore(record.Key, record.Value, record.ExpiresAt)
+}
+
+// restore stores the value with the given expiry
+func (c *Cache) restore(key, value any, expiresAt time.Time) {
+	mu := c.lock(key)
+	mu.Lock()
+	it := &item{
+		value:     c.compress(value),
+		expiresAt: expiresAt,
+		version:   atomic.AddUint64(&c.version, 1),
+	}
+	c.storage().Store(key, it)
+	c.logStore(key, value, expiresAt)
+	evicted := c.trackSet(key, it.value)
+	mu.Unlock()
+
+	c.afterSet(key, value, it.version, EventRestore, evicted)
+}
+
+// writeHeader writes the magic and codec name lines, followed by the key id line if Config.Encryption is set
+// returns the cipher to encrypt the records if Config.Encryption is set
+func (c *Cache) writeHeader(w io.Writer, magic, encryptedMagic, codecName string) (*frameCipher, error) {
+	if c.config.Encryption == nil {
+		_, err := fmt.Fprintf(w, "%s\n%s\n", magic, codecName)
+		return nil, err
+	}
+
+	keyID, fc, err := encryptionCipher(c.config.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	_, err = fmt.Fprintf(w, "%s\n%s\n%s\n", encryptedMagic, codecName, keyID)
+	return fc, err
+}
+
+// readHeader reads the header written by writeHeader
+// returns the codec of the records, and the cipher if they are encrypted
+func (c *Cache) readHeader(r *bufio.Reader, magic, encryptedMagic string) (Codec, *frameCipher, error) {
+	line, err := readLine(r)
+	if err != nil || (line != magic && line != encryptedMagic) {
+		return nil, nil, ErrInvalidSnapshot
+	}
+
+	name, err := readLine(r)
+	if err != nil {
+		return nil, nil, ErrInvalidSnapshot
+	}
+	codec, ok := LookupCodec(name)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnknownCodec, name)
+	}
+
+	if line != encryptedMagic {
+		return codec, nil, nil
+	}
+	keyID, err := readLine(r)
+	if err != nil {
+		return nil, nil, ErrInvalidSnapshot
+	}
+	fc, err := decryptionCipher(c.config.Encryption, keyID)
+	return codec, fc, err
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	return strings.TrimSuffix(line, "\n"), err
+}
+
+// writeRecord writes the record encoded by codec and encrypted by fc if it's not nil, prefixed by its length
+func writeRecord(w io.Writer, codec Codec, fc *frameCipher, record any) error {
+	data, err := codec.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if fc != nil {
+		if data, err = fc.seal(data); err != nil {
+			return err
+		}
+	}
+
+	var size [binary.MaxVarintLen64]byte
+	if _, err = w.Write(size[:binary.PutUvarint(size[:], uint64(len(data)))]); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// readRecord reads a record written by writeRecord into record, io.EOF is returned if there is no more record
+func readRecord(r *bufio.Reader, codec Codec, fc *frameCipher, record any) error {
+	data, err := readFrame(r)
+	if err != nil {
+		return err
+	}
+	if fc != nil {
+		if data, err = fc.open(data); err != nil {
+			return err
+		}
+	}
+
+	if err = codec.Unmarshal(data, record); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	return nil
+}
+
+// errTruncatedFrame is returned when the data ends in the middle of a frame, e.g. the last write is interrupted by a crash
+var errTruncatedFrame = fmt.Errorf("%w: truncated frame", ErrInvalidSnapshot)
+
+const (
+	// maxFrameSize the biggest frame which is read, bigger sizes are corrupt
+	maxFrameSize = 1 << 30
+	// frameChunkSize the frames bigger than it are read in chunks
+	frameChunkSize = 64 << 10
+)
+
+// readFrame reads a length prefixed frame, io.EOF is returned only if there is no more frame
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, errTruncatedFrame
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("%w: frame of %d bytes", ErrInvalidSnapshot, size)
+	}
+
+	// the big frames are read in chunks, so a corrupt size bigger than the remaining data doesn't allocate all of it
+	var data []byte
+	if size <= frameChunkSize {
+		data = make([]byte, size)
+		_, err = io.ReadFull(r, data)
+	} else {
+		buf := bytes.NewBuffer(make([]byte, 0, frameChunkSize))
+		_, err = io.CopyN(buf, r, int64(size))
+		data = buf.Bytes()
+	}
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return nil, errTruncatedFrame
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	return data, nil
+}
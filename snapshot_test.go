@@ -0,0 +1,110 @@
+package lastcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCache_SnapshotRestore(t *testing.T) {
+	for _, codecName := range []string{"json", "gob"} {
+		t.Run(codecName, func(t *testing.T) {
+			now = func() time.Time { return fixedTime() }
+			cache := New(Config{GlobalTTL: 10 * time.Millisecond})
+			cache.Set("expired", "stale_value")
+			now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+			cache.Set("fresh", "value")
+
+			var buf bytes.Buffer
+			if err := cache.Snapshot(&buf, codecName); err != nil {
+				t.Fatalf("Snapshot() failed with err: %v", err)
+			}
+
+			restored := New(Config{GlobalTTL: 10 * time.Millisecond})
+			n, err := restored.Restore(&buf)
+			if err != nil || n != 2 {
+				t.Fatalf("Restore() got %v, %v, want 2 entries", n, err)
+			}
+
+			if entry, err := restored.Get("fresh"); err != nil || entry.Value != "value" {
+				t.Errorf("Get(fresh) got %+v, %v, want value", entry, err)
+			}
+			// expiry is restored, so expired entries are served as stale
+			if entry, err := restored.Get("expired"); !errors.Is(err, ErrExpired) || entry.Value != "stale_value" {
+				t.Errorf("Get(expired) got %+v, %v, want stale_value", entry, err)
+			}
+			if ttl := restored.TTL("fresh"); ttl != 10*time.Millisecond {
+				t.Errorf("TTL(fresh) got = %v, want 10ms", ttl)
+			}
+		})
+	}
+}
+
+type upperCodec struct {
+	JSONCodec
+}
+
+func TestCache_SnapshotRegisteredCodec(t *testing.T) {
+	RegisterCodec("test-upper", upperCodec{})
+	if _, ok := LookupCodec("test-upper"); !ok {
+		t.Fatalf("registered codec is not found")
+	}
+
+	cache := New(Config{})
+	cache.Set("key", "value")
+
+	var buf bytes.Buffer
+	if err := cache.Snapshot(&buf, "test-upper"); err != nil {
+		t.Fatalf("Snapshot() failed with err: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), snapshotMagic+"\ntest-upper\n") {
+		t.Errorf("snapshot header got %q", buf.String())
+	}
+
+	if err := cache.Snapshot(&buf, "missing"); !errors.Is(err, ErrUnknownCodec) {
+		t.Errorf("Snapshot() err got %v, want %v", err, ErrUnknownCodec)
+	}
+}
+
+func uvarint(v uint64) string {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return string(buf[:binary.PutUvarint(buf, v)])
+}
+
+func TestCache_RestoreInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{name: "not a snapshot", data: "garbage", wantErr: ErrInvalidSnapshot},
+		{name: "unknown codec", data: snapshotMagic + "\nmissing\n", wantErr: ErrUnknownCodec},
+		{name: "truncated record", data: snapshotMagic + "\njson\n\x10{}", wantErr: ErrInvalidSnapshot},
+		{name: "huge record", data: snapshotMagic + "\njson\n" + uvarint(1<<62) + "{}", wantErr: ErrInvalidSnapshot},
+		{name: "truncated big record", data: snapshotMagic + "\njson\n" + uvarint(1<<20) + "{}", wantErr: ErrInvalidSnapshot},
+		{name: "corrupt size", data: snapshotMagic + "\njson\n" + strings.Repeat("\xff", 11), wantErr: ErrInvalidSnapshot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(Config{}).Restore(strings.NewReader(tt.data)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Restore() err got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCache_RestoreRecord(t *testing.T) {
+	cache := New(Config{EventsBuffer: 1})
+	expiresAt := time.Now().Add(time.Hour)
+	cache.RestoreRecord(SnapshotRecord{Key: "key", Value: "value", ExpiresAt: expiresAt})
+
+	if entry, err := cache.Get("key"); err != nil || entry.Value != "value" {
+		t.Errorf("Get() got %+v, %v, want value", entry, err)
+	}
+	if event := <-cache.Events(); event.Type != EventRestore || event.Key != "key" {
+		t.Errorf("event got %+v, want restore of key", event)
+	}
+}
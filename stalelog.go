@@ -0,0 +1,40 @@
+package lastcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// StaleLog record of a stale value served because the refresh of the key failed, see Config.StaleLogger
+type StaleLog struct {
+	Key any
+	// Age time since the value has expired
+	Age time.Duration
+	// Err the refresh error
+	Err error
+	// Count number of the stale serves of the key because of errors, including the ones sampled out
+	Count uint64
+	Time  time.Time
+}
+
+// logStaleServe passes the stale serve of the key to Config.StaleLogger, sampled by Config.StaleLogSampling per key
+func (c *Cache) logStaleServe(key any, age time.Duration, err error) {
+	if c.config.StaleLogger == nil || err == nil {
+		return
+	}
+
+	v, ok := c.staleLogs.Load(key)
+	if !ok {
+		v, _ = c.staleLogs.LoadOrStore(key, new(uint64))
+	}
+	count := atomic.AddUint64(v.(*uint64), 1)
+
+	sampling := uint64(1)
+	if c.config.StaleLogSampling > 1 {
+		sampling = uint64(c.config.StaleLogSampling)
+	}
+	if (count-1)%sampling != 0 {
+		return
+	}
+	c.config.StaleLogger(StaleLog{Key: key, Age: age, Err: err, Count: count, Time: c.now()})
+}
@@ -0,0 +1,54 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCache_StaleLogger(t *testing.T) {
+	var logs []StaleLog
+	cache := New(Config{
+		GlobalTTL:        time.Minute,
+		StaleLogSampling: 3,
+		StaleLogger: func(l StaleLog) {
+			logs = append(logs, l)
+		},
+	})
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+
+	now = func() time.Time { return fixedTime().Add(90 * time.Second) }
+	failing := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, true, errors.New("failed")
+	}
+	for i := 0; i < 4; i++ {
+		cache.LoadOrStore("key", failing)
+	}
+	if len(logs) != 2 || logs[0].Count != 1 || logs[1].Count != 4 {
+		t.Fatalf("logs got %+v, want the 1st and 4th stale serves", logs)
+	}
+	if logs[0].Key != "key" || logs[0].Age != 30*time.Second || logs[0].Err == nil {
+		t.Errorf("log got %+v, want key, 30s age and the error", logs[0])
+	}
+
+	// stale serves of AsyncLoadOrStore are logged only if the last refresh failed
+	cache.Set("async", "value")
+	now = func() time.Time { return fixedTime().Add(3 * time.Minute) }
+	_, refresh, _ := cache.AsyncLoadOrStore("async", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return nil, errors.New("failed")
+	})
+	refresh.Result()
+	if len(logs) != 2 {
+		t.Fatalf("logs got %+v, want no log before the refresh fails", logs)
+	}
+	_, refresh, _ = cache.AsyncLoadOrStore("async", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return "value", nil
+	})
+	if len(logs) != 3 || logs[2].Key != "async" || logs[2].Err == nil {
+		t.Errorf("logs got %+v, want the async stale serve", logs)
+	}
+	refresh.Result()
+}
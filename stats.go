@@ -0,0 +1,496 @@
+package lastcache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLatencyBuckets upper bounds of the callback latency histogram buckets
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// CallbackMode how the callback is called
+type CallbackMode int
+
+const (
+	// CallbackSync the callback is called while the caller is waiting (LoadOrStore, or AsyncLoadOrStore on miss)
+	CallbackSync CallbackMode = iota
+	// CallbackAsync the callback is called in background to refresh a stale key
+	CallbackAsync
+)
+
+func (m CallbackMode) String() string {
+	if m == CallbackAsync {
+		return "async"
+	}
+	return "sync"
+}
+
+// Metrics hooks to export the cache activity to a metrics system
+// The methods are called synchronously, so they should not block
+type Metrics interface {
+	// Hit is called when a fresh value is served from the cache
+	Hit(key any)
+	// Miss is called when the value is not in the cache or is expired, and the callback is called to load it
+	Miss(key any)
+	// StaleServe is called when a stale value is served
+	StaleServe(key any)
+	// CallbackDone is called after each callback call, key is nil for Config.BatchRefresh calls
+	CallbackDone(key any, mode CallbackMode, duration time.Duration, err error)
+}
+
+// Histogram cumulative latency histogram
+type Histogram struct {
+	// Buckets upper bounds of the buckets
+	Buckets []time.Duration
+	// Counts number of observations per bucket, the last one counts the observations bigger than the last bucket
+	Counts []uint64
+	// Count total number of observations
+	Count uint64
+	// Sum total duration of observations
+	Sum time.Duration
+}
+
+// Mean returns the average of the observations
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Add returns the sum of the histograms
+// An empty histogram takes the buckets of the other one, otherwise histograms with different buckets can't be added,
+// and h is returned as is with false
+func (h Histogram) Add(o Histogram) (Histogram, bool) {
+	if o.Count == 0 && len(o.Buckets) == 0 {
+		return h, true
+	}
+	if h.Count == 0 && len(h.Buckets) == 0 {
+		h.Buckets = append([]time.Duration(nil), o.Buckets...)
+		h.Counts = make([]uint64, len(o.Counts))
+	}
+	if !sameBuckets(h.Buckets, o.Buckets) || len(h.Counts) != len(o.Counts) {
+		return h, false
+	}
+	sum := Histogram{
+		Buckets: h.Buckets,
+		Counts:  append([]uint64(nil), h.Counts...),
+		Count:   h.Count + o.Count,
+		Sum:     h.Sum + o.Sum,
+	}
+	for i := range o.Counts {
+		sum.Counts[i] += o.Counts[i]
+	}
+	return sum, true
+}
+
+func sameBuckets(a, b []time.Duration) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Stats cache statistics since the cache is created
+type Stats struct {
+	Hits           uint64
+	Misses         uint64
+	StaleServes    uint64
+	CallbackErrors uint64
+
+	// StaleAge sum of the ages of the stale values served, i.e. the time since they had expired
+	// This is the staleness consumed from Config.StaleBudget
+	StaleAge time.Duration
+
+	// SyncCallbackLatency latency of the callbacks called while caller is waiting
+	SyncCallbackLatency Histogram
+	// AsyncCallbackLatency latency of the background refresh callbacks
+	AsyncCallbackLatency Histogram
+
+	// ShadowChecks number of the fresh hits compared with the callback, see Config.ShadowRate
+	ShadowChecks uint64
+	// ShadowMismatches number of the shadow checks whose cached value differed from the callback
+	ShadowMismatches uint64
+	// ShadowMismatchAge sum of the ages of the cached values which differed from the callback
+	ShadowMismatchAge time.Duration
+	// ShadowCallbackLatency latency of the callbacks of the shadow checks
+	ShadowCallbackLatency Histogram
+
+	// Namespaces statistics per namespace or tenant, see Config.StatsNamespace
+	Namespaces map[string]NamespaceStats
+}
+
+// Add returns the sum of the statistics, e.g. to aggregate the statistics of multiple caches
+// Latency histograms are added by Histogram.Add, the ones of s are kept if their buckets are different
+func (s Stats) Add(o Stats) Stats {
+	syncLatency, _ := s.SyncCallbackLatency.Add(o.SyncCallbackLatency)
+	asyncLatency, _ := s.AsyncCallbackLatency.Add(o.AsyncCallbackLatency)
+	shadowLatency, _ := s.ShadowCallbackLatency.Add(o.ShadowCallbackLatency)
+	return Stats{
+		Hits:                  s.Hits + o.Hits,
+		Misses:                s.Misses + o.Misses,
+		StaleServes:           s.StaleServes + o.StaleServes,
+		CallbackErrors:        s.CallbackErrors + o.CallbackErrors,
+		StaleAge:              s.StaleAge + o.StaleAge,
+		SyncCallbackLatency:   syncLatency,
+		AsyncCallbackLatency:  asyncLatency,
+		ShadowChecks:          s.ShadowChecks + o.ShadowChecks,
+		ShadowMismatches:      s.ShadowMismatches + o.ShadowMismatches,
+		ShadowMismatchAge:     s.ShadowMismatchAge + o.ShadowMismatchAge,
+		ShadowCallbackLatency: shadowLatency,
+		Namespaces:            addNamespaces(s.Namespaces, o.Namespaces),
+	}
+}
+
+func addNamespaces(a, b map[string]NamespaceStats) map[string]NamespaceStats {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	sum := make(map[string]NamespaceStats, len(a))
+	for namespace, s := range a {
+		sum[namespace] = s
+	}
+	for namespace, s := range b {
+		sum[namespace] = sum[namespace].Add(s)
+	}
+	return sum
+}
+
+type histogram struct {
+	buckets []time.Duration
+	counts  []uint64
+	count   uint64
+	sum     int64
+}
+
+func newHistogram(buckets []time.Duration) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)+1),
+	}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(h.buckets) && d > h.buckets[i] {
+		i++
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+// reset resets the histogram and returns the observations before the reset
+func (h *histogram) reset() Histogram {
+	s := Histogram{
+		Buckets: append([]time.Duration(nil), h.buckets...),
+		Counts:  make([]uint64, len(h.counts)),
+		Count:   atomic.SwapUint64(&h.count, 0),
+		Sum:     time.Duration(atomic.SwapInt64(&h.sum, 0)),
+	}
+	for i := range h.counts {
+		s.Counts[i] = atomic.SwapUint64(&h.counts[i], 0)
+	}
+	return s
+}
+
+func (h *histogram) snapshot() Histogram {
+	s := Histogram{
+		Buckets: append([]time.Duration(nil), h.buckets...),
+		Counts:  make([]uint64, len(h.counts)),
+		Count:   atomic.LoadUint64(&h.count),
+		Sum:     time.Duration(atomic.LoadInt64(&h.sum)),
+	}
+	for i := range h.counts {
+		s.Counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	return s
+}
+
+type stats struct {
+	hits           uint64
+	misses         uint64
+	staleServes    uint64
+	callbackErrors uint64
+	staleAge       int64
+	syncLatency    *histogram
+	asyncLatency   *histogram
+	window         window
+
+	// shadowChecks and shadowMismatches see Config.ShadowRate
+	shadowChecks      uint64
+	shadowMismatches  uint64
+	shadowMismatchAge int64
+	shadowLatency     *histogram
+}
+
+func newStats(buckets []time.Duration) *stats {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	return &stats{
+		syncLatency:   newHistogram(buckets),
+		asyncLatency:  newHistogram(buckets),
+		shadowLatency: newHistogram(buckets),
+	}
+}
+
+// Stats returns the cache statistics
+func (c *Cache) Stats() Stats {
+	c.lazyInit()
+
+	return Stats{
+		Hits:                  atomic.LoadUint64(&c.stats.hits),
+		Misses:                atomic.LoadUint64(&c.stats.misses),
+		StaleServes:           atomic.LoadUint64(&c.stats.staleServes),
+		CallbackErrors:        atomic.LoadUint64(&c.stats.callbackErrors),
+		StaleAge:              time.Duration(atomic.LoadInt64(&c.stats.staleAge)),
+		SyncCallbackLatency:   c.stats.syncLatency.snapshot(),
+		AsyncCallbackLatency:  c.stats.asyncLatency.snapshot(),
+		ShadowChecks:          atomic.LoadUint64(&c.stats.shadowChecks),
+		ShadowMismatches:      atomic.LoadUint64(&c.stats.shadowMismatches),
+		ShadowMismatchAge:     time.Duration(atomic.LoadInt64(&c.stats.shadowMismatchAge)),
+		ShadowCallbackLatency: c.stats.shadowLatency.snapshot(),
+		Namespaces:            c.namespacesStats(false),
+	}
+}
+
+// ResetStats returns the cache statistics and resets them to zero
+// This can be used by reporters which need the delta since the last report
+// Each counter is reset atomically, so no observation is lost or counted twice between two calls
+func (c *Cache) ResetStats() Stats {
+	c.lazyInit()
+
+	return Stats{
+		Hits:                  atomic.SwapUint64(&c.stats.hits, 0),
+		Misses:                atomic.SwapUint64(&c.stats.misses, 0),
+		StaleServes:           atomic.SwapUint64(&c.stats.staleServes, 0),
+		CallbackErrors:        atomic.SwapUint64(&c.stats.callbackErrors, 0),
+		StaleAge:              time.Duration(atomic.SwapInt64(&c.stats.staleAge, 0)),
+		SyncCallbackLatency:   c.stats.syncLatency.reset(),
+		AsyncCallbackLatency:  c.stats.asyncLatency.reset(),
+		ShadowChecks:          atomic.SwapUint64(&c.stats.shadowChecks, 0),
+		ShadowMismatches:      atomic.SwapUint64(&c.stats.shadowMismatches, 0),
+		ShadowMismatchAge:     time.Duration(atomic.SwapInt64(&c.stats.shadowMismatchAge, 0)),
+		ShadowCallbackLatency: c.stats.shadowLatency.reset(),
+		Namespaces:            c.namespacesStats(true),
+	}
+}
+
+func (c *Cache) recordHit(key any) {
+	c.lazyInit()
+	atomic.AddUint64(&c.stats.hits, 1)
+	atomic.AddUint64(&c.stats.window.bucket(c.now()).hits, 1)
+	if s := c.keyStatsOf(key); s != nil {
+		atomic.AddUint64(&s.hits, 1)
+	}
+	namespace, ns := c.namespaceStatsOf(key)
+	if ns != nil {
+		atomic.AddUint64(&ns.hits, 1)
+	}
+	if c.config.Metrics != nil {
+		c.config.Metrics.Hit(key)
+		if m := c.namespaceMetrics(); m != nil && ns != nil {
+			m.NamespaceHit(namespace)
+		}
+	}
+}
+
+func (c *Cache) recordMiss(key any) {
+	c.lazyInit()
+	atomic.AddUint64(&c.stats.misses, 1)
+	atomic.AddUint64(&c.stats.window.bucket(c.now()).misses, 1)
+	if s := c.keyStatsOf(key); s != nil {
+		atomic.AddUint64(&s.misses, 1)
+	}
+	namespace, ns := c.namespaceStatsOf(key)
+	if ns != nil {
+		atomic.AddUint64(&ns.misses, 1)
+	}
+	if c.config.Metrics != nil {
+		c.config.Metrics.Miss(key)
+		if m := c.namespaceMetrics(); m != nil && ns != nil {
+			m.NamespaceMiss(namespace)
+		}
+	}
+}
+
+// recordStoredMiss records the miss of a missing key in its statistics after it's loaded and stored
+// The statistics of a key are created by its first store, so recordMiss can't count its first miss
+func (c *Cache) recordStoredMiss(key any) {
+	if s := c.keyStatsOf(key); s != nil {
+		atomic.AddUint64(&s.misses, 1)
+	}
+}
+
+// recordStaleServe records a stale serve of the value which has expired age ago
+func (c *Cache) recordStaleServe(key any, age time.Duration) {
+	c.lazyInit()
+	// the entries refreshed by WithForceRefresh are served as stale before they expire
+	if age < 0 {
+		age = 0
+	}
+	atomic.AddUint64(&c.stats.staleServes, 1)
+	atomic.AddInt64(&c.stats.staleAge, int64(age))
+	atomic.AddUint64(&c.stats.window.bucket(c.now()).staleServes, 1)
+	if s := c.keyStatsOf(key); s != nil {
+		atomic.AddUint64(&s.staleServes, 1)
+		atomic.AddInt64(&s.staleAge, int64(age))
+	}
+	namespace, ns := c.namespaceStatsOf(key)
+	if ns != nil {
+		atomic.AddUint64(&ns.staleServes, 1)
+		atomic.AddInt64(&ns.staleAge, int64(age))
+	}
+	if c.config.Metrics != nil {
+		c.config.Metrics.StaleServe(key)
+		if m := c.namespaceMetrics(); m != nil && ns != nil {
+			m.NamespaceStaleServe(namespace)
+		}
+	}
+}
+
+func (c *Cache) recordCallback(key any, mode CallbackMode, d time.Duration, err error) {
+	c.lazyInit()
+	if mode == CallbackAsync {
+		c.stats.asyncLatency.observe(d)
+	} else {
+		c.stats.syncLatency.observe(d)
+	}
+	b := c.stats.window.bucket(c.now())
+	atomic.AddUint64(&b.callbacks, 1)
+	if err != nil {
+		atomic.AddUint64(&c.stats.callbackErrors, 1)
+		atomic.AddUint64(&b.callbackErr, 1)
+	}
+	if s := c.keyStatsOf(key); s != nil {
+		atomic.StoreInt64(&s.lastRefreshDuration, int64(d))
+		if err != nil {
+			atomic.AddUint64(&s.refreshFailures, 1)
+		}
+	}
+	namespace, ns := c.namespaceStatsOf(key)
+	if ns != nil && err != nil {
+		atomic.AddUint64(&ns.callbackErrors, 1)
+	}
+	if c.config.Metrics != nil {
+		c.config.Metrics.CallbackDone(key, mode, d, err)
+		if m := c.namespaceMetrics(); m != nil && ns != nil {
+			m.NamespaceCallbackDone(namespace, mode, d, err)
+		}
+	}
+}
+
+// callSync calls the SyncCallback and records its latency
+func (c *Cache) callSync(ctx context.Context, key any, prev *Entry, callback SyncCallback) (any, bool, error) {
+	if err := c.acquireSync(ctx); err != nil {
+		return nil, false, err
+	}
+	defer c.releaseSync()
+
+	start := time.Now()
+	value, useStale, err := c.wrapSync(callback)(ctx, key, prev)
+	c.recordCallback(key, CallbackSync, time.Since(start), err)
+	return value, useStale, err
+}
+
+// callAsync calls the AsyncCallback and records its latency
+func (c *Cache) callAsync(ctx context.Context, key any, prev *Entry, callback AsyncCallback, mode CallbackMode) (any, error) {
+	if mode == CallbackSync {
+		if err := c.acquireSync(ctx); err != nil {
+			return nil, err
+		}
+		defer c.releaseSync()
+	}
+
+	start := time.Now()
+	value, err := c.wrapAsync(callback)(ctx, key, prev)
+	c.recordCallback(key, mode, time.Since(start), err)
+	return value, err
+}
+
+// KeyStats statistics of a single key, see Config.KeyStats
+type KeyStats struct {
+	Hits            uint64
+	Misses          uint64
+	StaleServes     uint64
+	RefreshFailures uint64
+	// LastRefreshDuration duration of the last callback call of the key
+	LastRefreshDuration time.Duration
+	// StaleAge sum of the ages of the stale values of the key served
+	StaleAge time.Duration
+	// StaleBudgetRemaining Config.KeyStaleBudget minus StaleAge, negative if the budget is exceeded
+	// It's 0 if Config.KeyStaleBudget is not set
+	StaleBudgetRemaining time.Duration
+}
+
+type keyStats struct {
+	hits                uint64
+	misses              uint64
+	staleServes         uint64
+	refreshFailures     uint64
+	lastRefreshDuration int64
+	staleAge            int64
+}
+
+// KeyStats returns the statistics of the key, false will be returned if Config.KeyStats is not enabled
+// or the key doesn't exist in the cache
+// Per-key statistics are kept as long as the key exists, and removed when it's deleted or evicted
+func (c *Cache) KeyStats(key any) (KeyStats, bool) {
+	v, ok := c.keyStats.Load(key)
+	if !ok {
+		return KeyStats{}, false
+	}
+
+	s := v.(*keyStats)
+	ks := KeyStats{
+		Hits:                atomic.LoadUint64(&s.hits),
+		Misses:              atomic.LoadUint64(&s.misses),
+		StaleServes:         atomic.LoadUint64(&s.staleServes),
+		RefreshFailures:     atomic.LoadUint64(&s.refreshFailures),
+		LastRefreshDuration: time.Duration(atomic.LoadInt64(&s.lastRefreshDuration)),
+		StaleAge:            time.Duration(atomic.LoadInt64(&s.staleAge)),
+	}
+	if c.config.KeyStaleBudget > 0 {
+		ks.StaleBudgetRemaining = c.config.KeyStaleBudget - ks.StaleAge
+	}
+	return ks, true
+}
+
+// keyStatsOf returns the statistics of an existing key
+func (c *Cache) keyStatsOf(key any) *keyStats {
+	if !c.config.KeyStats {
+		return nil
+	}
+	v, ok := c.keyStats.Load(key)
+	if !ok {
+		return nil
+	}
+	return v.(*keyStats)
+}
+
+// trackKeyStats starts tracking the statistics of a stored key
+func (c *Cache) trackKeyStats(key any) {
+	if c.config.KeyStats {
+		c.keyStats.LoadOrStore(key, &keyStats{})
+	}
+}
@@ -0,0 +1,205 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testMetrics struct {
+	mu        sync.Mutex
+	events    []string
+	callbacks []CallbackMode
+}
+
+func (m *testMetrics) Hit(key any)        { m.add("hit") }
+func (m *testMetrics) Miss(key any)       { m.add("miss") }
+func (m *testMetrics) StaleServe(key any) { m.add("stale") }
+func (m *testMetrics) CallbackDone(key any, mode CallbackMode, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.callbacks = append(m.callbacks, mode)
+}
+
+func (m *testMetrics) add(event string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+}
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]time.Duration{time.Millisecond, 10 * time.Millisecond})
+	h.observe(500 * time.Microsecond)
+	h.observe(time.Millisecond)
+	h.observe(5 * time.Millisecond)
+	h.observe(time.Second)
+
+	got := h.snapshot()
+	want := Histogram{
+		Buckets: []time.Duration{time.Millisecond, 10 * time.Millisecond},
+		Counts:  []uint64{2, 1, 1},
+		Count:   4,
+		Sum:     500*time.Microsecond + time.Millisecond + 5*time.Millisecond + time.Second,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot() got = %+v, want %+v", got, want)
+	}
+	if got.Mean() != want.Sum/4 {
+		t.Errorf("Mean() got = %v, want %v", got.Mean(), want.Sum/4)
+	}
+}
+
+func TestHistogram_Add(t *testing.T) {
+	h := newHistogram([]time.Duration{time.Millisecond})
+	h.observe(time.Microsecond)
+	h.observe(time.Second)
+	a := h.snapshot()
+
+	sum, ok := Histogram{}.Add(a)
+	if !ok || !reflect.DeepEqual(sum, a) {
+		t.Errorf("Add() to empty histogram got = %+v, %v, want %+v", sum, ok, a)
+	}
+	sum, ok = sum.Add(a)
+	if want := []uint64{2, 2}; !ok || sum.Count != 4 || !reflect.DeepEqual(sum.Counts, want) {
+		t.Errorf("Add() got = %+v, %v, want counts %v", sum, ok, want)
+	}
+
+	other := newHistogram([]time.Duration{time.Second})
+	other.observe(time.Millisecond)
+	sum, ok = a.Add(other.snapshot())
+	if ok || !reflect.DeepEqual(sum, a) {
+		t.Errorf("Add() of different buckets got = %+v, %v, want %+v, false", sum, ok, a)
+	}
+}
+
+func TestCache_Stats(t *testing.T) {
+	metrics := &testMetrics{}
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+		Metrics:   metrics,
+	})
+
+	now = func() time.Time { return fixedTime() }
+
+	syncCallback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, true, errors.New("unavailable")
+	}
+	asyncCallback := func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return "value", nil
+	}
+
+	cache.LoadOrStore("key", syncCallback)       // miss, callback error
+	cache.AsyncLoadOrStore("key", asyncCallback) // miss
+	cache.AsyncLoadOrStore("key", asyncCallback) // hit
+
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+	cache.LoadOrStore("key", syncCallback) // miss, callback error, stale serve
+	_, refresh, _ := cache.AsyncLoadOrStore("other", asyncCallback)
+	if refresh != nil {
+		t.Fatalf("refresh is not expected for missing key")
+	}
+
+	cache.Set("key", "value")
+	now = func() time.Time { return fixedTime().Add(22 * time.Millisecond) }
+	_, refresh, _ = cache.AsyncLoadOrStore("key", asyncCallback) // stale serve
+	<-refresh.Done()
+
+	got := cache.Stats()
+	if got.Hits != 1 || got.Misses != 4 || got.StaleServes != 2 || got.CallbackErrors != 2 {
+		t.Errorf("Stats() got = %+v", got)
+	}
+	if got.SyncCallbackLatency.Count != 4 || got.AsyncCallbackLatency.Count != 1 {
+		t.Errorf("Stats() latency counts got sync %v, async %v, want 4, 1",
+			got.SyncCallbackLatency.Count, got.AsyncCallbackLatency.Count)
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	wantEvents := []string{"miss", "miss", "hit", "miss", "stale", "miss", "stale"}
+	if !reflect.DeepEqual(metrics.events, wantEvents) {
+		t.Errorf("Metrics events got = %v, want %v", metrics.events, wantEvents)
+	}
+	wantCallbacks := []CallbackMode{CallbackSync, CallbackSync, CallbackSync, CallbackSync, CallbackAsync}
+	if !reflect.DeepEqual(metrics.callbacks, wantCallbacks) {
+		t.Errorf("Metrics callbacks got = %v, want %v", metrics.callbacks, wantCallbacks)
+	}
+}
+
+func TestCache_KeyStats(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+		KeyStats:  true,
+	})
+
+	now = func() time.Time { return fixedTime() }
+
+	failing := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return nil, true, errors.New("unavailable")
+	}
+
+	cache.LoadOrStore("missing", failing)
+	if _, ok := cache.KeyStats("missing"); ok {
+		t.Errorf("KeyStats() of missing key got true, want false")
+	}
+
+	// the first miss is counted once the key is stored
+	cache.LoadOrStore("loaded", func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return "value", false, nil
+	})
+	cache.AsyncLoadOrStore("async", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return "value", nil
+	})
+	for _, key := range []string{"loaded", "async"} {
+		if got, ok := cache.KeyStats(key); !ok || got.Misses != 1 {
+			t.Errorf("KeyStats() of %s after the first miss got = %+v, %v, want 1 miss", key, got, ok)
+		}
+	}
+
+	cache.Set("key", "value")
+	cache.LoadOrStore("key", failing) // hit
+
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+	cache.LoadOrStore("key", failing) // miss, refresh failure, stale serve
+
+	got, ok := cache.KeyStats("key")
+	if !ok {
+		t.Fatalf("KeyStats() got false, want true")
+	}
+	if got.Hits != 1 || got.Misses != 1 || got.StaleServes != 1 || got.RefreshFailures != 1 {
+		t.Errorf("KeyStats() got = %+v", got)
+	}
+
+	cache.Delete("key")
+	if _, ok = cache.KeyStats("key"); ok {
+		t.Errorf("KeyStats() of deleted key got true, want false")
+	}
+}
+
+func TestCache_ResetStats(t *testing.T) {
+	cache := New(Config{})
+
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return "value", false, nil
+	}
+	cache.LoadOrStore("key", callback)
+	cache.LoadOrStore("key", callback)
+
+	got := cache.ResetStats()
+	if got.Hits != 1 || got.Misses != 1 || got.SyncCallbackLatency.Count != 1 {
+		t.Errorf("ResetStats() got = %+v", got)
+	}
+
+	cache.LoadOrStore("key", callback)
+
+	got = cache.ResetStats()
+	if got.Hits != 1 || got.Misses != 0 || got.SyncCallbackLatency.Count != 0 {
+		t.Errorf("ResetStats() after reset got = %+v", got)
+	}
+
+	if got = cache.Stats(); got.Hits != 0 {
+		t.Errorf("Stats() after reset got = %+v", got)
+	}
+}
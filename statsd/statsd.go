@@ -0,0 +1,192 @@
+// Package statsd implements lastcache.Metrics by emitting StatsD metrics over UDP, for services without Prometheus scraping
+//
+// The metrics are buffered and sent in packets of up to Config.MaxPacketSize bytes, at least every Config.FlushInterval.
+// Tags are written in the DogStatsD format ("|#key:value"), plain StatsD servers should be used without tags.
+//
+//	metrics, err := statsd.New(statsd.Config{Addr: "127.0.0.1:8125", Tags: []string{"service:users"}})
+//	defer metrics.Close()
+//	cache := lastcache.New(lastcache.Config{Metrics: metrics})
+//
+// The emitted metrics, prefixed by Config.Prefix:
+//
+//	hit                    counter of the fresh values served
+//	miss                   counter of the callback loads on miss
+//	stale_serve            counter of the stale values served
+//	callback.sync          timer of the callbacks called while the caller is waiting
+//	callback.async         timer of the background refresh callbacks
+//	callback.sync.error    counter of the failed sync callbacks
+//	callback.async.error   counter of the failed background refresh callbacks
+package statsd
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+const (
+	defaultAddr          = "127.0.0.1:8125"
+	defaultPrefix        = "lastcache."
+	defaultFlushInterval = time.Second
+	// defaultMaxPacketSize fits in the MTU of most networks without fragmentation
+	defaultMaxPacketSize = 1432
+)
+
+// Config of the Emitter
+type Config struct {
+	// Addr UDP address of the StatsD server
+	// Default is "127.0.0.1:8125"
+	Addr string
+
+	// Prefix of the metric names
+	// Default is "lastcache."
+	Prefix string
+
+	// Tags added to all the metrics as "key:value" in the DogStatsD format
+	Tags []string
+
+	// FlushInterval maximum time the metrics are buffered before being sent
+	// Default is 1s
+	FlushInterval time.Duration
+
+	// MaxPacketSize maximum size of the UDP packets
+	// Default is 1432
+	MaxPacketSize int
+
+	// OnError is called when the metrics can not be sent
+	OnError func(err error)
+}
+
+// Emitter sends the metrics of the cache to a StatsD server
+type Emitter struct {
+	config Config
+	conn   net.Conn
+	// suffix type independent suffix of the lines, the tags
+	suffix string
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+var _ lastcache.Metrics = (*Emitter)(nil)
+
+// New returns an Emitter which sends the metrics to Config.Addr
+func New(config Config) (*Emitter, error) {
+	if config.Addr == "" {
+		config.Addr = defaultAddr
+	}
+	if config.Prefix == "" {
+		config.Prefix = defaultPrefix
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultFlushInterval
+	}
+	if config.MaxPacketSize <= 0 {
+		config.MaxPacketSize = defaultMaxPacketSize
+	}
+
+	conn, err := net.Dial("udp", config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	e := &Emitter{
+		config: config,
+		conn:   conn,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if len(config.Tags) > 0 {
+		e.suffix = "|#" + strings.Join(config.Tags, ",")
+	}
+	go e.run()
+	return e, nil
+}
+
+// Hit implements lastcache.Metrics
+func (e *Emitter) Hit(key any) {
+	e.emit("hit", "1", "c")
+}
+
+// Miss implements lastcache.Metrics
+func (e *Emitter) Miss(key any) {
+	e.emit("miss", "1", "c")
+}
+
+// StaleServe implements lastcache.Metrics
+func (e *Emitter) StaleServe(key any) {
+	e.emit("stale_serve", "1", "c")
+}
+
+// CallbackDone implements lastcache.Metrics
+func (e *Emitter) CallbackDone(key any, mode lastcache.CallbackMode, duration time.Duration, err error) {
+	name := "callback." + mode.String()
+	e.emit(name, strconv.FormatFloat(float64(duration)/float64(time.Millisecond), 'f', -1, 64), "ms")
+	if err != nil {
+		e.emit(name+".error", "1", "c")
+	}
+}
+
+// Close sends the buffered metrics and closes the connection
+func (e *Emitter) Close() error {
+	close(e.stop)
+	<-e.done
+	return e.conn.Close()
+}
+
+func (e *Emitter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			e.Flush()
+			return
+		case <-ticker.C:
+			e.Flush()
+		}
+	}
+}
+
+// Flush sends the buffered metrics
+func (e *Emitter) Flush() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.flush()
+}
+
+// emit buffers a metric line, the buffer is sent first if the line doesn't fit in the packet
+func (e *Emitter) emit(name, value, typ string) {
+	line := e.config.Prefix + name + ":" + value + "|" + typ + e.suffix
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.buf.Len() > 0 && e.buf.Len()+1+len(line) > e.config.MaxPacketSize {
+		e.flush()
+	}
+	if e.buf.Len() > 0 {
+		e.buf.WriteByte('\n')
+	}
+	e.buf.WriteString(line)
+}
+
+// flush sends the buffer, must be called with mu held
+func (e *Emitter) flush() {
+	if e.buf.Len() == 0 {
+		return
+	}
+	_, err := e.conn.Write(e.buf.Bytes())
+	e.buf.Reset()
+	if err != nil && e.config.OnError != nil {
+		e.config.OnError(err)
+	}
+}
@@ -0,0 +1,95 @@
+package statsd
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+func listen(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func receive(t *testing.T, conn *net.UDPConn) []string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 64*1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func TestEmitter(t *testing.T) {
+	conn := listen(t)
+	e, err := New(Config{Addr: conn.LocalAddr().String(), Prefix: "app.", Tags: []string{"env:test"}, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	e.Hit("key")
+	e.Miss("key")
+	e.StaleServe("key")
+	e.CallbackDone("key", lastcache.CallbackAsync, 1500*time.Microsecond, errors.New("failed"))
+	e.Flush()
+
+	want := []string{
+		"app.hit:1|c|#env:test",
+		"app.miss:1|c|#env:test",
+		"app.stale_serve:1|c|#env:test",
+		"app.callback.async:1.5|ms|#env:test",
+		"app.callback.async.error:1|c|#env:test",
+	}
+	got := receive(t, conn)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestEmitter_MaxPacketSize(t *testing.T) {
+	conn := listen(t)
+	e, err := New(Config{Addr: conn.LocalAddr().String(), MaxPacketSize: 40, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.Hit(nil)
+	e.Hit(nil)
+	e.Hit(nil)
+	if got := receive(t, conn); len(got) != 2 || got[0] != "lastcache.hit:1|c" {
+		t.Errorf("first packet got %q, want 2 hits", got)
+	}
+	e.Close()
+	if got := receive(t, conn); len(got) != 1 {
+		t.Errorf("Close() sent %q, want the remaining hit", got)
+	}
+}
+
+func TestEmitter_Cache(t *testing.T) {
+	conn := listen(t)
+	e, err := New(Config{Addr: conn.LocalAddr().String(), FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	cache := lastcache.New(lastcache.Config{Metrics: e})
+	cache.Set("key", "value")
+	cache.LoadOrStore("key", nil)
+
+	if got := receive(t, conn); len(got) != 1 || got[0] != "lastcache.hit:1|c" {
+		t.Errorf("got %q, want a hit", got)
+	}
+}
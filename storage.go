@@ -0,0 +1,418 @@
+package lastcache
+
+import (
+	"hash/maphash"
+	"math"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultShards = 256
+
+// StorageType the map implementation which holds the entries, see Config.Storage
+type StorageType int
+
+const (
+	// StorageSyncMap stores the entries in a sync.Map, which suits read mostly workloads
+	StorageSyncMap StorageType = iota
+	// StorageSharded stores the entries in maps sharded by the hash of the key, each guarded by a RWMutex
+	// It's faster for write heavy workloads and millions of keys, since there is no double bookkeeping
+	// like in sync.Map, and entries are not boxed into interfaces
+	// Keys of types other than strings, numbers and bools are hashed by reflection, which is slower but doesn't allocate:
+	// pointers and channels by their address, structs and arrays by their fields and elements
+	StorageSharded
+)
+
+// storage holds the records of the keys
+type storage interface {
+	Load(key any) (*item, bool)
+	Store(key any, it *item)
+	Delete(key any)
+	// Range calls f for each key without holding any lock, so f can modify the storage
+	Range(f func(key any, it *item) bool)
+	// Compact rebuilds the internal maps to release the capacity retained after deletions
+	// The caller must block the writes meanwhile
+	Compact()
+}
+
+func newStorage(storageType StorageType, shards int) storage {
+	if storageType == StorageSharded {
+		return newShardedStorage(shards)
+	}
+	return newSyncMapStorage()
+}
+
+type syncMapStorage struct {
+	// m holds *sync.Map, which is replaced by Compact
+	m atomic.Value
+}
+
+func newSyncMapStorage() *syncMapStorage {
+	s := &syncMapStorage{}
+	s.m.Store(&sync.Map{})
+	return s
+}
+
+func (s *syncMapStorage) load() *sync.Map {
+	return s.m.Load().(*sync.Map)
+}
+
+func (s *syncMapStorage) Load(key any) (*item, bool) {
+	v, ok := s.load().Load(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(*item), true
+}
+
+func (s *syncMapStorage) Store(key any, it *item) {
+	s.load().Store(key, it)
+}
+
+func (s *syncMapStorage) Delete(key any) {
+	s.load().Delete(key)
+}
+
+func (s *syncMapStorage) Range(f func(key any, it *item) bool) {
+	s.load().Range(func(key, v any) bool {
+		return f(key, v.(*item))
+	})
+}
+
+func (s *syncMapStorage) Compact() {
+	compacted := &sync.Map{}
+	s.load().Range(func(key, v any) bool {
+		compacted.Store(key, v)
+		return true
+	})
+	s.m.Store(compacted)
+}
+
+type shard struct {
+	mu    sync.RWMutex
+	items map[any]*item
+}
+
+type shardedStorage struct {
+	shards []shard
+}
+
+func newShardedStorage(shards int) *shardedStorage {
+	s := &shardedStorage{shards: make([]shard, shards)}
+	for i := range s.shards {
+		s.shards[i].items = make(map[any]*item)
+	}
+	return s
+}
+
+func (s *shardedStorage) shard(key any) *shard {
+	return &s.shards[hashKey(key)%uint64(len(s.shards))]
+}
+
+func (s *shardedStorage) Load(key any) (*item, bool) {
+	sh := s.shard(key)
+	sh.mu.RLock()
+	it, ok := sh.items[key]
+	sh.mu.RUnlock()
+	return it, ok
+}
+
+func (s *shardedStorage) Store(key any, it *item) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	sh.items[key] = it
+	sh.mu.Unlock()
+}
+
+func (s *shardedStorage) Delete(key any) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	delete(sh.items, key)
+	sh.mu.Unlock()
+}
+
+func (s *shardedStorage) Compact() {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		compacted := make(map[any]*item, len(sh.items))
+		for key, it := range sh.items {
+			compacted[key] = it
+		}
+		sh.items = compacted
+		sh.mu.Unlock()
+	}
+}
+
+type keyItem struct {
+	key any
+	it  *item
+}
+
+func (s *shardedStorage) Range(f func(key any, it *item) bool) {
+	var items []keyItem
+	for i := range s.shards {
+		sh := &s.shards[i]
+		items = items[:0]
+		sh.mu.RLock()
+		for key, it := range sh.items {
+			items = append(items, keyItem{key: key, it: it})
+		}
+		sh.mu.RUnlock()
+
+		for _, ki := range items {
+			if !f(ki.key, ki.it) {
+				return
+			}
+		}
+	}
+}
+
+// item is the stored record of a key, it's never modified after it's stored
+// so the value, expiry, version and error of a key are always read consistently
+type item struct {
+	// value as it's stored, i.e. compressed
+	value     any
+	expiresAt time.Time
+	version   uint64
+	// storedAt time the value is stored, zero if it's unknown e.g. restored from a snapshot
+	storedAt time.Time
+	// err last callback error since the value is stored
+	err error
+	// failures number of the consecutive callback failures since the value is stored
+	failures int
+	// failingSince time of the first of the consecutive callback failures
+	failingSince time.Time
+}
+
+var hashSeed = maphash.MakeSeed()
+
+// hashKey returns the hash of the key, equal keys have equal hashes
+func hashKey(key any) uint64 {
+	switch k := key.(type) {
+	case string:
+		return hashString(k)
+	case int:
+		return mix(uint64(k))
+	case int8:
+		return mix(uint64(k))
+	case int16:
+		return mix(uint64(k))
+	case int32:
+		return mix(uint64(k))
+	case int64:
+		return mix(uint64(k))
+	case uint:
+		return mix(uint64(k))
+	case uint8:
+		return mix(uint64(k))
+	case uint16:
+		return mix(uint64(k))
+	case uint32:
+		return mix(uint64(k))
+	case uint64:
+		return mix(k)
+	case uintptr:
+		return mix(uint64(k))
+	case float64:
+		return hashFloat(k)
+	case float32:
+		return hashFloat(float64(k))
+	case bool:
+		if k {
+			return 1
+		}
+		return 0
+	case nil:
+		return 0
+	}
+	return hashValue(reflect.ValueOf(key))
+}
+
+// hashValue returns the hash of the other comparable types without allocating
+// Pointers, channels and unsafe pointers are hashed by their address, since they're compared by it,
+// so changing the pointed value doesn't move the key
+func hashValue(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.String:
+		return hashString(v.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return mix(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return mix(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return hashFloat(v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return combineHash(hashFloat(real(c)), hashFloat(imag(c)))
+	case reflect.Bool:
+		if v.Bool() {
+			return 1
+		}
+		return 0
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		return mix(uint64(v.Pointer()))
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return hashValue(v.Elem())
+	case reflect.Array:
+		var h uint64
+		for i := 0; i < v.Len(); i++ {
+			h = combineHash(h, hashValue(v.Index(i)))
+		}
+		return h
+	case reflect.Struct:
+		var h uint64
+		for i := 0; i < v.NumField(); i++ {
+			h = combineHash(h, hashValue(v.Field(i)))
+		}
+		return h
+	}
+	// not comparable, e.g. func, map or slice, which can't be stored as a key anyway
+	return 0
+}
+
+func hashFloat(f float64) uint64 {
+	if f == 0 { // -0 == 0
+		return 0
+	}
+	return mix(math.Float64bits(f))
+}
+
+// combineHash returns the hash of the sequence of the hashes h and x
+func combineHash(h, x uint64) uint64 {
+	return mix(h*0x100000001b3 ^ x)
+}
+
+func hashString(s string) uint64 {
+	var h maphash.Hash
+	h.SetSeed(hashSeed)
+	h.WriteString(s)
+	return h.Sum64()
+}
+
+// mix spreads the bits of integer keys, so sequential keys don't land on adjacent stripes only
+func mix(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// Compact rebuilds the internal maps to release the memory retained after mass deletions,
+// e.g. after a large invalidation sweep, since Go maps don't shrink when keys are deleted
+// Writes are blocked while compacting, reads are not blocked
+func (c *Cache) Compact() {
+	c.lazyInit()
+	for i := range c.locks {
+		c.locks[i].Lock()
+	}
+	c.items.Compact()
+	for i := range c.locks {
+		c.locks[i].Unlock()
+	}
+
+	c.memory.compact()
+}
+
+// lock returns the striped lock of the key, which serializes the writes of the key
+func (c *Cache) lock(key any) *sync.Mutex {
+	c.lazyInit()
+	return &c.locks[hashKey(key)%uint64(len(c.locks))]
+}
+
+// loadItem returns the stored record of the key
+func (c *Cache) loadItem(key any) (*item, bool) {
+	return c.storage().Load(key)
+}
+
+func (c *Cache) storage() storage {
+	c.lazyInit()
+	return c.items
+}
+
+// updateItem replaces the record of the key by a modified copy, if the key exists
+// the lock of the key must be held
+func (c *Cache) updateItem(key any, update func(it *item)) {
+	it, ok := c.loadItem(key)
+	if !ok {
+		return
+	}
+	updated := *it
+	update(&updated)
+	c.items.Store(key, &updated)
+
+	if !updated.expiresAt.Equal(it.expiresAt) {
+		if value, err := c.decompress(updated.value); err == nil {
+			c.logStore(key, value, updated.expiresAt)
+		}
+	}
+}
+
+// updateTTL sets the expiry of the key to ttl from now, if the key exists
+func (c *Cache) updateTTL(key any, ttl time.Duration) {
+	mu := c.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	c.updateItem(key, func(it *item) {
+		it.expiresAt = c.now().Add(ttl)
+	})
+}
+
+// storeErr records the last callback error of the key, if the key exists
+// The key is deleted if it has failed too many times, see Config.DeleteAfterFailures, and true is returned
+func (c *Cache) storeErr(key any, err error) bool {
+	mu := c.lock(key)
+	mu.Lock()
+
+	var failed bool
+	c.updateItem(key, func(it *item) {
+		if it.failures == 0 {
+			it.failingSince = c.now()
+		}
+		it.err = err
+		it.failures++
+		failed = c.failedOut(it)
+	})
+	if !failed {
+		mu.Unlock()
+		return false
+	}
+	c.delete(key)
+	mu.Unlock()
+
+	c.afterDelete(key, EventDelete)
+	return true
+}
+
+// failedOut returns true if the item has failed Config.DeleteAfterFailures times over Config.DeleteAfterFailingFor
+func (c *Cache) failedOut(it *item) bool {
+	if c.config.DeleteAfterFailures <= 0 || it.failures < c.config.DeleteAfterFailures {
+		return false
+	}
+	return c.now().Sub(it.failingSince) >= c.config.DeleteAfterFailingFor
+}
+
+// exhausted returns true if the key has failed Config.MaxConsecutiveFailures consecutive refreshes
+func (c *Cache) exhausted(key any) bool {
+	if c.config.MaxConsecutiveFailures <= 0 {
+		return false
+	}
+	it, ok := c.loadItem(key)
+	return ok && it.failures >= c.config.MaxConsecutiveFailures
+}
+
+// extendStale extends the expiry of the stale key by Config.ExtendTTL, unless the key is exhausted
+func (c *Cache) extendStale(key any) {
+	if c.config.ExtendTTL <= 0 || c.exhausted(key) {
+		return
+	}
+	c.updateTTL(key, c.config.ExtendTTL)
+}
@@ -0,0 +1,57 @@
+package lastcache
+
+import "fmt"
+
+const (
+	mmapMagic = "lastcache-mmap-v1"
+
+	defaultMmapCodec       = "gob"
+	defaultMmapInitialSize = 1 << 20
+)
+
+// MmapOptions options of the memory-mapped storage, see OpenMmap
+type MmapOptions struct {
+	// Codec name of the registered codec to serialize the keys and values
+	// Default is "gob"
+	Codec string
+
+	// InitialSize initial size of the file in bytes, the file grows by doubling its size when it's full
+	// Default is 1MB
+	InitialSize int64
+
+	// OnError is called when a value can not be written to the file (e.g. it can't be encoded by the codec
+	// or the file can't grow), the value is kept on the Go heap in that case
+	OnError func(err error)
+}
+
+// OpenMmap returns new Cache which keeps the serialized keys and values in a memory-mapped file at path,
+// with only an index of the entries on the Go heap, so very large caches don't put pressure on the garbage collector
+// The entries in the file are loaded on open, so they survive restarts
+//
+// Values are decoded by the codec on each read, so it's slower than the in-memory storages,
+// and the concrete types of the values must be supported by the codec (e.g. registered by gob.Register)
+// The file is append-only, Cache.Compact rewrites it to release the space of the overwritten and deleted entries
+// Config.Storage and Config.CompressThreshold are ignored, and the file is closed by Cache.Close
+//
+// Memory-mapped storage is supported on linux, darwin and freebsd
+func OpenMmap(path string, options MmapOptions, config Config) (*Cache, error) {
+	if options.Codec == "" {
+		options.Codec = defaultMmapCodec
+	}
+	if options.InitialSize <= 0 {
+		options.InitialSize = defaultMmapInitialSize
+	}
+	codec, ok := LookupCodec(options.Codec)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, options.Codec)
+	}
+
+	s, err := openMmapStorage(path, codec, options)
+	if err != nil {
+		return nil, err
+	}
+
+	config.CompressThreshold = 0
+	// versions are assigned to the loaded entries on open
+	return newCache(&Cache{config: config, items: s, version: s.version}), nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd
+
+package lastcache
+
+import "errors"
+
+// mmapStorage is not supported on this platform, see OpenMmap
+type mmapStorage struct {
+	storage
+	version uint64
+}
+
+func openMmapStorage(path string, codec Codec, options MmapOptions) (*mmapStorage, error) {
+	return nil, errors.New("lastcache: memory-mapped storage is not supported on this platform")
+}
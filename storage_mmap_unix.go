@@ -0,0 +1,365 @@
+//go:build linux || darwin || freebsd
+
+package lastcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var errNotMapped = errors.New("lastcache: memory-mapped file is not mapped")
+
+// mmapStorage keeps the records of the keys in an append-only memory-mapped file, with an in-memory index
+type mmapStorage struct {
+	path      string
+	codec     Codec
+	codecName string
+	onError   func(err error)
+
+	mu    sync.RWMutex
+	file  *os.File
+	data  []byte
+	end   int
+	index map[any]*mmapEntry
+	// version number of the entries loaded on open
+	version uint64
+}
+
+// mmapEntry index entry of a key, which points to its encoded walRecord in the file
+type mmapEntry struct {
+	offset int
+	size   int
+	// inline holds the value if it couldn't be written to the file
+	inline       any
+	isInline     bool
+	expiresAt    time.Time
+	version      uint64
+	err          error
+	failures     int
+	failingSince time.Time
+	storedAt     time.Time
+}
+
+func openMmapStorage(path string, codec Codec, options MmapOptions) (*mmapStorage, error) {
+	s := &mmapStorage{
+		path:      path,
+		codec:     codec,
+		codecName: options.Codec,
+		onError:   options.OnError,
+		index:     make(map[any]*mmapEntry),
+	}
+	if err := s.open(path, options.InitialSize); err != nil {
+		return nil, err
+	}
+
+	if s.end == 0 {
+		s.end = copy(s.data, s.header())
+		return s, nil
+	}
+	if err := s.load(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// open maps the file at path, which is created with size bytes if it's smaller
+// s.end is set to 0 if the file is new
+func (s *mmapStorage) open(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.end = -1
+	if info.Size() == 0 {
+		s.end = 0
+	}
+	if info.Size() > size {
+		size = info.Size()
+	} else if err = f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.data = f, data
+	return nil
+}
+
+func (s *mmapStorage) header() string {
+	return fmt.Sprintf("%s\n%s\n", mmapMagic, s.codecName)
+}
+
+// load builds the index from the records of the file
+// Scanning stops at the first empty or invalid record, which is the end of the written records
+// ErrInvalidSnapshot is returned if the size of a record exceeds the file
+func (s *mmapStorage) load() error {
+	header := s.header()
+	if !bytes.HasPrefix(s.data, []byte(mmapMagic+"\n")) {
+		return ErrInvalidSnapshot
+	}
+	if !bytes.HasPrefix(s.data, []byte(header)) {
+		return fmt.Errorf("%w: file is not encoded by %q", ErrUnknownCodec, s.codecName)
+	}
+
+	offset := len(header)
+	for offset < len(s.data) {
+		size, n := binary.Uvarint(s.data[offset:])
+		if n <= 0 || size == 0 {
+			break
+		}
+		// the records are written within the file, so a bigger size is corrupt, it's checked before the conversion
+		// to int which can overflow
+		if size > uint64(len(s.data)-offset-n) {
+			return fmt.Errorf("%w: record of %d bytes at offset %d exceeds the file", ErrInvalidSnapshot, size, offset)
+		}
+		record, err := s.decode(offset+n, int(size))
+		if err != nil {
+			break
+		}
+
+		if record.Deleted {
+			delete(s.index, record.Key)
+		} else {
+			s.version++
+			s.index[record.Key] = &mmapEntry{
+				offset:    offset + n,
+				size:      int(size),
+				expiresAt: record.ExpiresAt,
+				version:   s.version,
+			}
+		}
+		offset += n + int(size)
+	}
+	s.end = offset
+	return nil
+}
+
+func (s *mmapStorage) decode(offset, size int) (walRecord, error) {
+	var record walRecord
+	err := s.codec.Unmarshal(s.data[offset:offset+size], &record)
+	return record, err
+}
+
+func (s *mmapStorage) Load(key any) (*item, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.index[key]
+	if !ok {
+		return nil, false
+	}
+	it := &item{expiresAt: entry.expiresAt, version: entry.version, err: entry.err, failures: entry.failures, failingSince: entry.failingSince, storedAt: entry.storedAt, value: entry.inline}
+	if entry.isInline {
+		return it, true
+	}
+	if s.data == nil {
+		return nil, false
+	}
+
+	record, err := s.decode(entry.offset, entry.size)
+	if err != nil {
+		s.reportError(err)
+		return nil, false
+	}
+	it.value = record.Value
+	return it, true
+}
+
+func (s *mmapStorage) Store(key any, it *item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return
+	}
+
+	entry := &mmapEntry{expiresAt: it.expiresAt, version: it.version, err: it.err, failures: it.failures, failingSince: it.failingSince, storedAt: it.storedAt}
+	// records which only differ by the error are not written again
+	if prev, ok := s.index[key]; ok && it.expiresAt.Equal(prev.expiresAt) && it.version == prev.version {
+		prev.err, prev.failures, prev.failingSince = it.err, it.failures, it.failingSince
+		return
+	}
+
+	offset, size, err := s.append(walRecord{Key: key, Value: it.value, ExpiresAt: it.expiresAt})
+	if err != nil {
+		s.reportError(err)
+		entry.inline, entry.isInline = it.value, true
+	}
+	entry.offset, entry.size = offset, size
+	s.index[key] = entry
+}
+
+func (s *mmapStorage) Delete(key any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.index[key]; !ok || s.file == nil {
+		return
+	}
+	delete(s.index, key)
+	if _, _, err := s.append(walRecord{Key: key, Deleted: true}); err != nil {
+		s.reportError(err)
+	}
+}
+
+// append writes the record at the end of the file, s.mu must be held
+// returns the offset and size of the encoded record
+func (s *mmapStorage) append(record walRecord) (int, int, error) {
+	if s.data == nil {
+		return 0, 0, errNotMapped
+	}
+	data, err := s.codec.Marshal(record)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(data)))
+	if err = s.grow(s.end + n + len(data)); err != nil {
+		return 0, 0, err
+	}
+
+	// the length is written last, so a partially written record is ignored on load
+	offset := s.end + n
+	copy(s.data[offset:], data)
+	copy(s.data[s.end:], prefix[:n])
+	s.end = offset + len(data)
+	return offset, len(data), nil
+}
+
+// grow remaps the file, doubling its size until it fits size bytes, s.mu must be held
+func (s *mmapStorage) grow(size int) error {
+	if size <= len(s.data) {
+		return nil
+	}
+	newSize := len(s.data)
+	for newSize < size {
+		newSize *= 2
+	}
+
+	if err := s.file.Truncate(int64(newSize)); err != nil {
+		return err
+	}
+	if err := syscall.Munmap(s.data); err != nil {
+		return err
+	}
+	// if the file can't be mapped again, the storage keeps only the inline values
+	s.data = nil
+	data, err := syscall.Mmap(int(s.file.Fd()), 0, newSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	s.data = data
+	return nil
+}
+
+// Range calls f for the keys which exist when Range is called
+func (s *mmapStorage) Range(f func(key any, it *item) bool) {
+	s.mu.RLock()
+	keys := make([]any, 0, len(s.index))
+	for key := range s.index {
+		keys = append(keys, key)
+	}
+	s.mu.RUnlock()
+
+	for _, key := range keys {
+		if it, ok := s.Load(key); ok && !f(key, it) {
+			return
+		}
+	}
+}
+
+// Compact rewrites the file by the records of the existing keys
+func (s *mmapStorage) Compact() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data == nil {
+		return
+	}
+
+	compacted := &mmapStorage{
+		path:      s.path,
+		codec:     s.codec,
+		codecName: s.codecName,
+		onError:   s.onError,
+		index:     make(map[any]*mmapEntry, len(s.index)),
+	}
+	tmp := s.path + ".tmp"
+	os.Remove(tmp)
+	if err := compacted.open(tmp, int64(len(s.data))); err != nil {
+		s.reportError(err)
+		return
+	}
+	compacted.end = copy(compacted.data, compacted.header())
+
+	for key, entry := range s.index {
+		moved := *entry
+		if !entry.isInline {
+			var prefix [binary.MaxVarintLen64]byte
+			n := binary.PutUvarint(prefix[:], uint64(entry.size))
+			moved.offset = compacted.end + n
+			copy(compacted.data[compacted.end:], prefix[:n])
+			copy(compacted.data[moved.offset:], s.data[entry.offset:entry.offset+entry.size])
+			compacted.end = moved.offset + entry.size
+		}
+		compacted.index[key] = &moved
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		compacted.Close()
+		os.Remove(tmp)
+		s.reportError(err)
+		return
+	}
+	s.close()
+	s.file, s.data, s.end, s.index = compacted.file, compacted.data, compacted.end, compacted.index
+}
+
+// Close unmaps and closes the file, the storage is empty after Close
+func (s *mmapStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.index = make(map[any]*mmapEntry)
+	return s.close()
+}
+
+// close unmaps and closes the file, s.mu must be held
+func (s *mmapStorage) close() error {
+	if s.file == nil {
+		return nil
+	}
+	var err error
+	if s.data != nil {
+		err = syscall.Munmap(s.data)
+		s.data = nil
+	}
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file = nil
+	return err
+}
+
+func (s *mmapStorage) reportError(err error) {
+	if s.onError != nil {
+		s.onError(err)
+	}
+}
@@ -0,0 +1,127 @@
+//go:build linux || darwin || freebsd
+
+package lastcache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenMmap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.mmap")
+
+	cache, err := OpenMmap(path, MmapOptions{InitialSize: 64}, Config{GlobalTTL: time.Minute})
+	if err != nil {
+		t.Fatalf("OpenMmap() failed with err: %v", err)
+	}
+	large := strings.Repeat("x", 1000) // file grows
+	for i := 0; i < 100; i++ {
+		cache.Set(i, i)
+	}
+	cache.Set("large", large)
+	cache.Delete(42)
+	if entry, err := cache.Get(1); err != nil || entry.Value != 1 {
+		t.Errorf("Get() got %+v, %v, want 1", entry, err)
+	}
+	cache.Close()
+
+	reopened, err := OpenMmap(path, MmapOptions{}, Config{GlobalTTL: time.Minute})
+	if err != nil {
+		t.Fatalf("OpenMmap() failed with err: %v", err)
+	}
+	defer reopened.Close()
+	if entry, err := reopened.Get("large"); err != nil || entry.Value != large {
+		t.Errorf("Get(large) got %v, want the stored value", err)
+	}
+	if entry, err := reopened.Get(99); err != nil || entry.Value != 99 {
+		t.Errorf("Get(99) got %+v, %v, want 99", entry, err)
+	}
+	if _, err := reopened.Get(42); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(42) err got %v, want %v", err, ErrNotFound)
+	}
+
+	// versions of the loaded entries are not reused
+	loaded, _ := reopened.Get(99)
+	reopened.Set("new", 1)
+	if entry, _ := reopened.Get("new"); entry.Version <= loaded.Version {
+		t.Errorf("Version got %v, want bigger than %v", entry.Version, loaded.Version)
+	}
+}
+
+func TestOpenMmap_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.mmap")
+
+	cache, err := OpenMmap(path, MmapOptions{}, Config{GlobalTTL: time.Minute})
+	if err != nil {
+		t.Fatalf("OpenMmap() failed with err: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		cache.Set("key", i)
+	}
+	s := cache.items.(*mmapStorage)
+	before := s.end
+	cache.Compact()
+	if s.end >= before {
+		t.Errorf("Compact() end got %v, want less than %v", s.end, before)
+	}
+	cache.Set("key2", "value2")
+	cache.Close()
+
+	reopened, err := OpenMmap(path, MmapOptions{}, Config{GlobalTTL: time.Minute})
+	if err != nil {
+		t.Fatalf("OpenMmap() failed with err: %v", err)
+	}
+	defer reopened.Close()
+	if entry, err := reopened.Get("key"); err != nil || entry.Value != 999 {
+		t.Errorf("Get(key) got %+v, %v, want 999", entry, err)
+	}
+	if entry, err := reopened.Get("key2"); err != nil || entry.Value != "value2" {
+		t.Errorf("Get(key2) got %+v, %v, want value2", entry, err)
+	}
+}
+
+func TestOpenMmap_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	invalid := filepath.Join(dir, "invalid")
+	os.WriteFile(invalid, []byte("not a cache file"), 0o600)
+	if _, err := OpenMmap(invalid, MmapOptions{}, Config{}); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("OpenMmap() err got %v, want %v", err, ErrInvalidSnapshot)
+	}
+
+	path := filepath.Join(dir, "cache.mmap")
+	cache, err := OpenMmap(path, MmapOptions{Codec: "json"}, Config{})
+	if err != nil {
+		t.Fatalf("OpenMmap() failed with err: %v", err)
+	}
+	cache.Close()
+	if _, err := OpenMmap(path, MmapOptions{Codec: "gob"}, Config{}); !errors.Is(err, ErrUnknownCodec) {
+		t.Errorf("OpenMmap() err got %v, want %v", err, ErrUnknownCodec)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.mmap")
+	os.WriteFile(corrupt, []byte(mmapMagic+"\njson\n"+uvarint(1<<63)+"{}"), 0o600)
+	if _, err := OpenMmap(corrupt, MmapOptions{Codec: "json"}, Config{}); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("OpenMmap() of a corrupt record size err got %v, want %v", err, ErrInvalidSnapshot)
+	}
+
+	// values which can't be encoded are kept in memory
+	var encodeErr error
+	cache, err = OpenMmap(filepath.Join(dir, "inline.mmap"), MmapOptions{OnError: func(err error) { encodeErr = err }}, Config{})
+	if err != nil {
+		t.Fatalf("OpenMmap() failed with err: %v", err)
+	}
+	defer cache.Close()
+	type unregistered struct{ V int }
+	cache.Set("key", unregistered{V: 1})
+	if encodeErr == nil {
+		t.Errorf("OnError is not called")
+	}
+	if entry, err := cache.Get("key"); err != nil || entry.Value != (unregistered{V: 1}) {
+		t.Errorf("Get() got %+v, %v, want the inline value", entry, err)
+	}
+}
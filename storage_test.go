@@ -0,0 +1,276 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHashKey(t *testing.T) {
+	type compositeKey struct {
+		tenant string
+		id     int
+	}
+	tests := []struct {
+		name string
+		a, b any
+	}{
+		{name: "string", a: "key", b: string([]byte("key"))},
+		{name: "int", a: 42, b: 42},
+		{name: "zero float", a: 0.0, b: math.Copysign(0, -1)},
+		{name: "struct", a: compositeKey{"t", 1}, b: compositeKey{"t", 1}},
+		{name: "nil", a: nil, b: nil},
+		{name: "tenant key", a: TenantKey{"t", "key"}, b: TenantKey{"t", string([]byte("key"))}},
+		{name: "array", a: [2]float64{0, 1}, b: [2]float64{math.Copysign(0, -1), 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.a != tt.b {
+				t.Fatalf("keys expected to be equal")
+			}
+			if hashKey(tt.a) != hashKey(tt.b) {
+				t.Errorf("hashKey() of equal keys got %v and %v", hashKey(tt.a), hashKey(tt.b))
+			}
+		})
+	}
+}
+
+func TestHashKey_Pointer(t *testing.T) {
+	type user struct {
+		Name string
+	}
+	cache := New(Config{GlobalTTL: time.Minute, Storage: StorageSharded})
+	defer cache.Close()
+
+	key := &user{Name: "a"}
+	cache.Set(key, "value")
+	// pointer keys are compared by address, so the pointed value can change
+	key.Name = "b"
+	if entry, err := cache.Get(key); err != nil || entry.Value != "value" {
+		t.Errorf("Get() got %+v, %v, want the entry of the pointer", entry, err)
+	}
+}
+
+func TestHashKey_Allocations(t *testing.T) {
+	key := any(TenantKey{Tenant: "tenant", Key: "key"})
+	if allocs := testing.AllocsPerRun(100, func() { hashKey(key) }); allocs != 0 {
+		t.Errorf("hashKey() of a struct key got %v allocations, want 0", allocs)
+	}
+}
+
+func TestCache_UpdateTTLAfterDelete(t *testing.T) {
+	cache := New(Config{})
+
+	cache.Set("key", "value")
+	cache.Delete("key")
+	cache.updateTTL("key", time.Minute)
+	cache.storeErr("key", ErrExpired)
+
+	if _, ok := cache.loadItem("key"); ok {
+		t.Errorf("deleted key must not be recreated by ttl or error updates")
+	}
+	if ttl := cache.TTL("key"); ttl != 0 {
+		t.Errorf("TTL() got = %v, want 0", ttl)
+	}
+}
+
+func TestCache_ConcurrentSetDeleteConsistency(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: time.Minute,
+		ExtendTTL: time.Minute,
+	})
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				cache.Set(i, "value")
+				cache.updateTTL(i, time.Minute)
+				cache.Delete(i)
+			}
+		}(i)
+	}
+
+	for n := 0; n < 1000; n++ {
+		cache.RangeEntries(func(key any, e Entry, expiresAt time.Time) bool {
+			if expiresAt.IsZero() || e.Version == 0 {
+				t.Errorf("key %v has value without expiry or version", key)
+			}
+			return true
+		})
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestStorage(t *testing.T) {
+	backends := map[string]storage{
+		"sync map": newStorage(StorageSyncMap, defaultShards),
+		"sharded":  newStorage(StorageSharded, defaultShards),
+	}
+	for name, s := range backends {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				s.Store(i, &item{value: i, version: uint64(i + 1)})
+			}
+
+			if it, ok := s.Load(42); !ok || it.value != 42 {
+				t.Errorf("Load() got %+v, %v, want 42", it, ok)
+			}
+
+			s.Delete(42)
+			if _, ok := s.Load(42); ok {
+				t.Errorf("deleted key is loaded")
+			}
+
+			// f is allowed to modify the storage
+			n := 0
+			s.Range(func(key any, it *item) bool {
+				s.Delete(key)
+				n++
+				return true
+			})
+			if n != 99 {
+				t.Errorf("Range() visited %v keys, want 99", n)
+			}
+			if _, ok := s.Load(1); ok {
+				t.Errorf("key is not deleted in Range")
+			}
+		})
+	}
+}
+
+func TestCache_ShardedStorage(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: time.Minute,
+		Storage:   StorageSharded,
+	})
+
+	entry, err := cache.LoadOrStore("key", func(_ context.Context, key any, prev *Entry) (any, bool, error) {
+		return "value", false, nil
+	})
+	if err != nil || entry.Value != "value" {
+		t.Fatalf("LoadOrStore() got %+v, %v, want value", entry, err)
+	}
+
+	if ttl := cache.TTL("key"); ttl <= 0 {
+		t.Errorf("TTL() got = %v, want positive ttl", ttl)
+	}
+
+	cache.Delete("key")
+	if _, err := cache.Get("key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() err got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func benchmarkStorage(b *testing.B, storageType StorageType) {
+	s := newStorage(storageType, defaultShards)
+	keys := make([]string, 1<<16)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key_%d", i)
+		s.Store(keys[i], &item{value: i})
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i&(len(keys)-1)]
+			if i%10 == 0 {
+				s.Store(key, &item{value: i})
+			} else {
+				s.Load(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkStorage_SyncMap(b *testing.B) {
+	benchmarkStorage(b, StorageSyncMap)
+}
+
+func BenchmarkStorage_Sharded(b *testing.B) {
+	benchmarkStorage(b, StorageSharded)
+}
+
+func TestCache_Compact(t *testing.T) {
+	for _, storageType := range []StorageType{StorageSyncMap, StorageSharded} {
+		cache := New(Config{
+			GlobalTTL:      time.Minute,
+			Storage:        storageType,
+			MaxMemoryBytes: 1 << 30,
+		})
+
+		for i := 0; i < 1000; i++ {
+			cache.Set(i, i)
+		}
+		for i := 0; i < 990; i++ {
+			cache.Delete(i)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1000; i < 1100; i++ {
+				cache.Set(i, i)
+			}
+		}()
+		cache.Compact()
+		wg.Wait()
+
+		for i := 990; i < 1100; i++ {
+			entry, err := cache.Get(i)
+			if err != nil || entry.Value != i {
+				t.Errorf("storage %v: Get(%v) got %+v, %v", storageType, i, entry, err)
+			}
+		}
+		if _, err := cache.Get(1); !errors.Is(err, ErrNotFound) {
+			t.Errorf("storage %v: deleted key is restored by Compact", storageType)
+		}
+		if keys := cache.memory.keys(); len(keys) != 110 {
+			t.Errorf("storage %v: tracked keys got = %v, want 110", storageType, len(keys))
+		}
+	}
+}
+
+func TestCache_Shards(t *testing.T) {
+	tests := []struct {
+		name   string
+		shards int
+		want   int
+	}{
+		{name: "default", shards: 0, want: defaultShards},
+		{name: "configured", shards: 4, want: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := New(Config{Storage: StorageSharded, Shards: tt.shards})
+			cache.Set("key", "value")
+
+			if got := len(cache.locks); got != tt.want {
+				t.Errorf("locks got = %v, want %v", got, tt.want)
+			}
+			if got := len(cache.items.(*shardedStorage).shards); got != tt.want {
+				t.Errorf("shards got = %v, want %v", got, tt.want)
+			}
+			if _, err := cache.Get("key"); err != nil {
+				t.Errorf("failed with err: %v", err)
+			}
+		})
+	}
+}
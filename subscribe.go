@@ -0,0 +1,71 @@
+package lastcache
+
+import "sync"
+
+type subscriber struct {
+	mu     sync.Mutex
+	ch     chan Entry
+	closed bool
+}
+
+// Subscribe returns a channel which receives an Entry whenever the value of the key is stored or refreshed
+// If the key is deleted, an Entry with ErrNotFound as Err will be sent
+// The channel only keeps the latest event, slow receivers will miss intermediate updates
+// The returned function must be called to unsubscribe, which closes the channel
+func (c *Cache) Subscribe(key any) (<-chan Entry, func()) {
+	sub := &subscriber{ch: make(chan Entry, 1)}
+
+	c.subscribersMu.Lock()
+	if c.subscribers == nil {
+		c.subscribers = make(map[any]map[*subscriber]struct{})
+	}
+	if c.subscribers[key] == nil {
+		c.subscribers[key] = make(map[*subscriber]struct{})
+	}
+	c.subscribers[key][sub] = struct{}{}
+	c.subscribersMu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			c.subscribersMu.Lock()
+			delete(c.subscribers[key], sub)
+			if len(c.subscribers[key]) == 0 {
+				delete(c.subscribers, key)
+			}
+			c.subscribersMu.Unlock()
+
+			sub.mu.Lock()
+			sub.closed = true
+			close(sub.ch)
+			sub.mu.Unlock()
+		})
+	}
+}
+
+func (c *Cache) notify(key any, entry Entry) {
+	c.subscribersMu.Lock()
+	defer c.subscribersMu.Unlock()
+
+	for sub := range c.subscribers[key] {
+		e := entry
+		e.Value = c.clone(entry.Value)
+		sub.send(e)
+	}
+}
+
+// send never blocks, the pending event is replaced if the receiver didn't consume it yet
+func (s *subscriber) send(entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case <-s.ch:
+	default:
+	}
+	s.ch <- entry
+}
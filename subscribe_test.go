@@ -0,0 +1,66 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCache_Subscribe(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: 10 * time.Millisecond,
+	})
+
+	ch, unsubscribe := cache.Subscribe("key")
+
+	now = func() time.Time { return fixedTime() }
+	cache.Set("key", "value")
+	cache.Set("other", "value")
+
+	if entry := <-ch; entry.Value != "value" {
+		t.Errorf("Subscribe() got %+v, want value", entry)
+	}
+
+	now = func() time.Time { return fixedTime().Add(11 * time.Millisecond) }
+	_, refresh, _ := cache.AsyncLoadOrStore("key", func(_ context.Context, key any, prev *Entry) (any, error) {
+		return "new_value", nil
+	})
+	<-refresh.Done()
+
+	if entry := <-ch; entry.Value != "new_value" {
+		t.Errorf("Subscribe() got %+v, want new_value", entry)
+	}
+
+	cache.Delete("key")
+	if entry := <-ch; !errors.Is(entry.Err, ErrNotFound) {
+		t.Errorf("Subscribe() got %+v, want %v", entry, ErrNotFound)
+	}
+
+	unsubscribe()
+	unsubscribe()
+	cache.Set("key", "value")
+	if _, ok := <-ch; ok {
+		t.Errorf("channel expected to be closed after unsubscribe")
+	}
+}
+
+func TestCache_SubscribeKeepsLatest(t *testing.T) {
+	cache := New(Config{})
+
+	ch, unsubscribe := cache.Subscribe("key")
+	defer unsubscribe()
+
+	cache.Set("key", "value1")
+	cache.Set("key", "value2")
+
+	if entry := <-ch; entry.Value != "value2" {
+		t.Errorf("Subscribe() got %+v, want value2", entry)
+	}
+
+	select {
+	case entry := <-ch:
+		t.Errorf("unexpected event %+v", entry)
+	default:
+	}
+}
@@ -0,0 +1,84 @@
+package lastcache
+
+import "context"
+
+// TenantKey the key of an entry of a tenant, see Config.TenantFunc
+// Range, events and the other APIs without a context expose the keys of the tenants in this form
+type TenantKey struct {
+	Tenant string
+	Key    any
+}
+
+// TenantScope returns the key of the tenant of ctx, which can be used by the APIs without a context, e.g. Get or Delete
+// ErrNoTenant is returned if Config.TenantFunc is set but ctx has no tenant, the key is returned as is if it's not set
+func (c *Cache) TenantScope(ctx context.Context, key any) (any, error) {
+	if c.config.TenantFunc == nil {
+		return key, nil
+	}
+	tenant := c.config.TenantFunc(ctx)
+	if tenant == "" {
+		return nil, ErrNoTenant
+	}
+	return TenantKey{Tenant: tenant, Key: key}, nil
+}
+
+// tenantSync returns the key of the tenant of ctx, and the callback which is called by the key of the caller
+func (c *Cache) tenantSync(ctx context.Context, key any, callback SyncCallback) (any, SyncCallback, error) {
+	if c.config.TenantFunc == nil {
+		return key, callback, nil
+	}
+	scoped, err := c.TenantScope(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return scoped, func(ctx context.Context, _ any, prev *Entry) (any, bool, error) {
+		return callback(ctx, key, prev)
+	}, nil
+}
+
+// tenantAsync is tenantSync for AsyncCallback
+func (c *Cache) tenantAsync(ctx context.Context, key any, callback AsyncCallback) (any, AsyncCallback, error) {
+	if c.config.TenantFunc == nil {
+		return key, callback, nil
+	}
+	scoped, err := c.TenantScope(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return scoped, func(ctx context.Context, _ any, prev *Entry) (any, error) {
+		return callback(ctx, key, prev)
+	}, nil
+}
+
+// tenantBatch returns the keys of the tenant of ctx and the keys of the caller by them, and the callback which is called
+// by the keys of the caller and returns the values by the keys of the tenant
+func (c *Cache) tenantBatch(ctx context.Context, keys []any, callback BatchRefreshFunc) ([]any, map[any]any, BatchRefreshFunc, error) {
+	if c.config.TenantFunc == nil {
+		return keys, nil, callback, nil
+	}
+	tenant := c.config.TenantFunc(ctx)
+	if tenant == "" {
+		return nil, nil, nil, ErrNoTenant
+	}
+	scoped := make([]any, len(keys))
+	callerKeys := make(map[any]any, len(keys))
+	for i, key := range keys {
+		scoped[i] = TenantKey{Tenant: tenant, Key: key}
+		callerKeys[scoped[i]] = key
+	}
+	return scoped, callerKeys, func(ctx context.Context, keys []any) (map[any]any, error) {
+		unscoped := make([]any, len(keys))
+		for i, key := range keys {
+			unscoped[i] = callerKeys[key]
+		}
+		values, err := callback(ctx, unscoped)
+		if values == nil {
+			return nil, err
+		}
+		scopedValues := make(map[any]any, len(values))
+		for key, value := range values {
+			scopedValues[TenantKey{Tenant: tenant, Key: key}] = value
+		}
+		return scopedValues, err
+	}, nil
+}
@@ -0,0 +1,120 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type tenantContextKey struct{}
+
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+func TestCache_TenantFunc(t *testing.T) {
+	now = func() time.Time { return fixedTime() }
+	cache := New(Config{GlobalTTL: time.Minute, TenantFunc: func(ctx context.Context) string {
+		tenant, _ := ctx.Value(tenantContextKey{}).(string)
+		return tenant
+	}})
+	defer cache.Close()
+
+	callback := func(tenant string) SyncCallback {
+		return func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+			if key != "user:1" {
+				t.Errorf("callback got key %v, want the key of the caller", key)
+			}
+			return tenant, false, nil
+		}
+	}
+
+	acme, globex := withTenant(context.Background(), "acme"), withTenant(context.Background(), "globex")
+	cache.LoadOrStoreWithCtx(acme, "user:1", callback("acme"))
+	entry, err := cache.LoadOrStoreWithCtx(globex, "user:1", callback("globex"))
+	if err != nil || entry.Value != "globex" {
+		t.Errorf("LoadOrStoreWithCtx() got %+v, %v, want the entry of globex", entry, err)
+	}
+	entry, _, err = cache.AsyncLoadOrStoreWithCtx(acme, "user:1", func(ctx context.Context, key any, prev *Entry) (any, error) {
+		return nil, errors.New("not expected")
+	})
+	if err != nil || entry.Value != "acme" {
+		t.Errorf("AsyncLoadOrStoreWithCtx() got %+v, %v, want the entry of acme", entry, err)
+	}
+
+	if _, err := cache.LoadOrStoreWithCtx(context.Background(), "user:1", callback("")); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("LoadOrStoreWithCtx() without tenant got err %v, want ErrNoTenant", err)
+	}
+	if _, err := cache.LoadOrStore("user:1", callback("")); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("LoadOrStore() got err %v, want ErrNoTenant", err)
+	}
+
+	key, err := cache.TenantScope(acme, "user:1")
+	if err != nil || key != (TenantKey{Tenant: "acme", Key: "user:1"}) {
+		t.Fatalf("TenantScope() got %v, %v", key, err)
+	}
+	cache.Delete(key)
+	if _, err := cache.Get(key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete got err %v, want ErrNotFound", err)
+	}
+	if _, err := cache.Get(TenantKey{Tenant: "globex", Key: "user:1"}); err != nil {
+		t.Errorf("Get() of the other tenant got err %v", err)
+	}
+}
+
+func TestCache_TenantFuncMulti(t *testing.T) {
+	now = func() time.Time { return fixedTime() }
+	cache := New(Config{GlobalTTL: time.Minute, TenantFunc: func(ctx context.Context) string {
+		tenant, _ := ctx.Value(tenantContextKey{}).(string)
+		return tenant
+	}})
+	defer cache.Close()
+
+	callback := func(tenant string) BatchRefreshFunc {
+		return func(ctx context.Context, keys []any) (map[any]any, error) {
+			values := make(map[any]any)
+			for _, key := range keys {
+				if key != "user:1" && key != "user:2" {
+					t.Errorf("callback got key %v, want the keys of the caller", key)
+				}
+				values[key] = tenant
+			}
+			return values, nil
+		}
+	}
+
+	acme, globex := withTenant(context.Background(), "acme"), withTenant(context.Background(), "globex")
+	cache.AsyncLoadOrStoreMultiWithCtx(acme, []any{"user:1", "user:2"}, callback("acme"))
+	entries, _, err := cache.AsyncLoadOrStoreMultiWithCtx(globex, []any{"user:1"}, callback("globex"))
+	if err != nil || entries["user:1"].Value != "globex" {
+		t.Errorf("AsyncLoadOrStoreMultiWithCtx() got %+v, %v, want the entry of globex", entries, err)
+	}
+
+	// the entries of acme are served by the keys of the caller
+	entries, _, err = cache.AsyncLoadOrStoreMultiWithCtx(acme, []any{"user:1", "user:2"}, callback("not expected"))
+	if err != nil || entries["user:1"].Value != "acme" || entries["user:2"].Value != "acme" {
+		t.Errorf("AsyncLoadOrStoreMultiWithCtx() got %+v, %v, want the entries of acme", entries, err)
+	}
+	if _, err := cache.Get(TenantKey{Tenant: "acme", Key: "user:2"}); err != nil {
+		t.Errorf("Get() of the tenant key got err %v", err)
+	}
+
+	// the expired entries are refreshed by the keys of the caller, and stored by the keys of the tenant
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+	_, multi, _ := cache.AsyncLoadOrStoreMultiWithCtx(acme, []any{"user:1"}, callback("acme refreshed"))
+	if multi == nil {
+		t.Fatalf("AsyncLoadOrStoreMultiWithCtx() of the expired key got no refresh")
+	}
+	refreshed, errs := multi.Result()
+	if len(errs) != 0 || refreshed["user:1"].Value != "acme refreshed" {
+		t.Errorf("Result() got %+v, %v, want the refreshed entry of acme", refreshed, errs)
+	}
+	if entry, _ := cache.Get(TenantKey{Tenant: "globex", Key: "user:1"}); entry.Value != "globex" {
+		t.Errorf("Get() of globex got %+v, want its own entry", entry)
+	}
+
+	if _, _, err := cache.AsyncLoadOrStoreMulti([]any{"user:1"}, callback("")); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("AsyncLoadOrStoreMulti() got err %v, want ErrNoTenant", err)
+	}
+}
@@ -0,0 +1,204 @@
+// Package tokencache caches access tokens (e.g. OAuth client credentials) until they expire
+//
+// The lifetime of a token is derived from its expires_in. The token is refreshed in background
+// once RefreshAt (80% by default) of its lifetime has passed, while the current token is served.
+// If the refresh fails, the current token is served only as long as it's still valid.
+//
+//	tokens := tokencache.New(tokencache.Config{})
+//	token, err := tokens.Token(ctx, "api", fetchToken)
+package tokencache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mbrostami/lastcache"
+)
+
+const (
+	defaultRefreshAt = 0.8
+	defaultLeeway    = 10 * time.Second
+	// minLifetime the lifetime of the tokens which expire sooner, so they're not fetched on every call
+	minLifetime = time.Second
+	// tokenTTL the ttl of the tokens in lastcache, they don't expire by lastcache since their lifetime is checked by Token
+	tokenTTL = 100 * 365 * 24 * time.Hour
+)
+
+// ErrExpired is returned when there is no valid token, wrapping the refresh error
+var ErrExpired = errors.New("tokencache: token expired")
+
+// expiredError matches ErrExpired by errors.Is, and unwraps to the fetch error
+type expiredError struct {
+	err error
+}
+
+func (e *expiredError) Error() string {
+	return ErrExpired.Error() + ": " + e.err.Error()
+}
+
+func (e *expiredError) Unwrap() error {
+	return e.err
+}
+
+func (e *expiredError) Is(target error) bool {
+	return target == ErrExpired
+}
+
+// Token an access token and its lifetime
+type Token struct {
+	Value string
+	// ExpiresIn lifetime of the token from the time it's fetched
+	ExpiresIn time.Duration
+}
+
+// FetchFunc fetches a new token
+type FetchFunc func(ctx context.Context) (Token, error)
+
+// Config of the token Cache
+type Config struct {
+	// RefreshAt fraction of the token lifetime after which the token is refreshed in background
+	// If not set or not in (0, 1) range 0.8 will be used
+	RefreshAt float64
+
+	// Leeway the token is considered expired this long before its actual expiry, to account for clock skew and latency
+	// Default is 10s, it takes at most half of the lifetime of the tokens which expire sooner
+	Leeway time.Duration
+
+	// OnRefreshError if set, is called when a background refresh fails
+	OnRefreshError func(key string, err error)
+}
+
+// Cache of the tokens by key, e.g. audience or scope
+// The fetches of a key are shared by its concurrent callers as the refreshes of lastcache
+type Cache struct {
+	config Config
+	cache  *lastcache.Cache
+	// now can be replaced in tests
+	now func() time.Time
+}
+
+type cachedToken struct {
+	token     Token
+	refreshAt time.Time
+	expiresAt time.Time
+}
+
+// New returns a token Cache
+func New(config Config) *Cache {
+	if config.RefreshAt <= 0 || config.RefreshAt >= 1 {
+		config.RefreshAt = defaultRefreshAt
+	}
+	if config.Leeway <= 0 {
+		config.Leeway = defaultLeeway
+	}
+	return &Cache{
+		config: config,
+		cache:  lastcache.New(lastcache.Config{GlobalTTL: tokenTTL}),
+		now:    time.Now,
+	}
+}
+
+// Token returns a valid token of the key
+// A token past its RefreshAt is refreshed in background, an expired token is refreshed before returning
+func (c *Cache) Token(ctx context.Context, key string, fetch FetchFunc) (Token, error) {
+	if cached, ok := c.load(key); ok {
+		now := c.now()
+		if now.Before(cached.refreshAt) {
+			return cached.token, nil
+		}
+		if now.Before(cached.expiresAt) {
+			c.refreshInBackground(key, fetch)
+			return cached.token, nil
+		}
+	}
+
+	return c.fetch(ctx, key, fetch)
+}
+
+// Invalidate drops the token of the key, e.g. when the token is rejected by the server
+func (c *Cache) Invalidate(key string) {
+	c.cache.Delete(key)
+}
+
+// Close stops the background processes
+func (c *Cache) Close() {
+	c.cache.Close()
+}
+
+func (c *Cache) load(key string) (cachedToken, bool) {
+	// lastcache expiry is not used, since the lifetime is derived from each token
+	entry, err := c.cache.Get(key)
+	if err != nil && !errors.Is(err, lastcache.ErrExpired) {
+		return cachedToken{}, false
+	}
+	return entry.Value.(cachedToken), true
+}
+
+// fetch fetches the token synchronously, concurrent callers of the same key share the fetched token
+func (c *Cache) fetch(ctx context.Context, key string, fetch FetchFunc) (Token, error) {
+	// a missing key is stored as an expired token, so its fetch is registered as the refresh of the key
+	// which the concurrent callers join
+	c.cache.GetOrSet(key, cachedToken{})
+	entry, err := c.cache.LoadOrStoreWithCtx(ctx, key, func(ctx context.Context, _ any, prev *lastcache.Entry) (any, bool, error) {
+		// the token might be fetched by a concurrent caller meanwhile
+		if prev != nil {
+			if cached, ok := prev.Value.(cachedToken); ok && c.now().Before(cached.expiresAt) {
+				return cached, false, nil
+			}
+		}
+		cached, err := c.fetchToken(ctx, fetch)
+		return cached, false, err
+	}, lastcache.WithForceRefresh(), lastcache.WithNoStale())
+	if err != nil {
+		return Token{}, &expiredError{err: fetchError(err)}
+	}
+	return entry.Value.(cachedToken).token, nil
+}
+
+// refreshInBackground refreshes the token by a background refresh of lastcache, which is shared by the concurrent callers
+func (c *Cache) refreshInBackground(key string, fetch FetchFunc) {
+	entry, refresh, _ := c.cache.AsyncLoadOrStore(key, func(ctx context.Context, _ any, _ *lastcache.Entry) (any, error) {
+		return c.fetchToken(ctx, fetch)
+	}, lastcache.WithForceRefresh())
+	if refresh == nil || entry.RefreshStatus != lastcache.RefreshStarted || c.config.OnRefreshError == nil {
+		return
+	}
+
+	go func() {
+		if _, err := refresh.Result(); err != nil {
+			c.config.OnRefreshError(key, fetchError(err))
+		}
+	}()
+}
+
+func (c *Cache) fetchToken(ctx context.Context, fetch FetchFunc) (cachedToken, error) {
+	fetchedAt := c.now()
+	token, err := fetch(ctx)
+	if err != nil {
+		return cachedToken{}, err
+	}
+
+	leeway := c.config.Leeway
+	if leeway > token.ExpiresIn/2 {
+		leeway = token.ExpiresIn / 2
+	}
+	lifetime := token.ExpiresIn - leeway
+	if lifetime < minLifetime {
+		lifetime = minLifetime
+	}
+	return cachedToken{
+		token:     token,
+		refreshAt: fetchedAt.Add(time.Duration(float64(lifetime) * c.config.RefreshAt)),
+		expiresAt: fetchedAt.Add(lifetime),
+	}, nil
+}
+
+// fetchError returns the error of FetchFunc wrapped by lastcache
+func fetchError(err error) error {
+	var cbErr *lastcache.CallbackError
+	if errors.As(err, &cbErr) {
+		return cbErr.Err
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package tokencache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type tokenServer struct {
+	mu    sync.Mutex
+	calls int
+	err   error
+}
+
+func (s *tokenServer) fetch(context.Context) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.err != nil {
+		return Token{}, s.err
+	}
+	return Token{Value: fmt.Sprintf("token_%d", s.calls), ExpiresIn: 110 * time.Second}, nil
+}
+
+func (s *tokenServer) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+func (s *tokenServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls
+}
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition is not met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCache_Token(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	server := &tokenServer{}
+	var mu sync.Mutex
+	var refreshErrs []error
+	tokens := New(Config{OnRefreshError: func(_ string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		refreshErrs = append(refreshErrs, err)
+	}})
+	tokens.now = clock.Now
+	defer tokens.Close()
+
+	// lifetime is 100s with the default leeway, refreshed after 80s
+	token, err := tokens.Token(context.Background(), "api", server.fetch)
+	if err != nil || token.Value != "token_1" {
+		t.Fatalf("Token() got %+v, %v, want token_1", token, err)
+	}
+
+	clock.Advance(50 * time.Second)
+	if token, _ = tokens.Token(context.Background(), "api", server.fetch); token.Value != "token_1" || server.count() != 1 {
+		t.Errorf("Token() got %+v with %d fetches, want cached token_1", token, server.count())
+	}
+
+	// past the refresh point the current token is served while refreshing
+	clock.Advance(40 * time.Second)
+	if token, _ = tokens.Token(context.Background(), "api", server.fetch); token.Value != "token_1" {
+		t.Errorf("Token() got %+v, want token_1 while refreshing", token)
+	}
+	waitFor(t, func() bool {
+		token, _ := tokens.Token(context.Background(), "api", server.fetch)
+		return token.Value == "token_2"
+	})
+
+	// failed refresh keeps serving the token while it's valid
+	server.setErr(errors.New("unavailable"))
+	clock.Advance(90 * time.Second)
+	if token, err = tokens.Token(context.Background(), "api", server.fetch); err != nil || token.Value != "token_2" {
+		t.Errorf("Token() got %+v, %v, want token_2", token, err)
+	}
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(refreshErrs) > 0
+	})
+
+	// expired token is never served
+	clock.Advance(20 * time.Second)
+	if _, err = tokens.Token(context.Background(), "api", server.fetch); !errors.Is(err, ErrExpired) || !errors.Is(err, server.err) {
+		t.Errorf("Token() err got %v, want %v", err, ErrExpired)
+	}
+}
+
+func TestCache_Invalidate(t *testing.T) {
+	server := &tokenServer{}
+	tokens := New(Config{})
+	defer tokens.Close()
+
+	tokens.Token(context.Background(), "api", server.fetch)
+	tokens.Invalidate("api")
+	if token, err := tokens.Token(context.Background(), "api", server.fetch); err != nil || token.Value != "token_2" {
+		t.Errorf("Token() got %+v, %v, want token_2", token, err)
+	}
+}
+
+func TestCache_TokenConcurrentFetch(t *testing.T) {
+	tokens := New(Config{})
+	defer tokens.Close()
+
+	var calls int32
+	fetch := func(context.Context) (Token, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return Token{Value: "token", ExpiresIn: time.Minute}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := tokens.Token(context.Background(), "api", fetch); err != nil || token.Value != "token" {
+				t.Errorf("Token() got %+v, %v, want token", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("fetch called %d times, want 1", n)
+	}
+}
+
+func TestCache_TokenShortLifetime(t *testing.T) {
+	server := &tokenServer{}
+	tokens := New(Config{Leeway: 5 * time.Minute})
+	defer tokens.Close()
+
+	// the leeway is longer than the lifetime of the token, which is still cached
+	tokens.Token(context.Background(), "api", server.fetch)
+	if token, err := tokens.Token(context.Background(), "api", server.fetch); err != nil || token.Value != "token_1" || server.count() != 1 {
+		t.Errorf("Token() got %+v, %v with %d fetches, want cached token_1", token, err, server.count())
+	}
+}
@@ -0,0 +1,323 @@
+package lastcache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	walMagic          = "lastcache-wal-v1"
+	encryptedWALMagic = "lastcache-wal-v1-aesgcm"
+
+	defaultWALCodec           = "gob"
+	defaultWALSyncInterval    = time.Second
+	defaultWALCompactInterval = 10 * time.Minute
+)
+
+// ErrWALOpen is returned by OpenWAL when the cache already has an open WAL
+var ErrWALOpen = errors.New("lastcache: WAL is already open")
+
+// WALOptions options of the write-ahead log, see Cache.OpenWAL
+type WALOptions struct {
+	// Codec name of the registered codec to encode the records
+	// Default is "gob"
+	Codec string
+
+	// SyncInterval interval to fsync the log file
+	// Writes are flushed to the file on each mutation, so they survive a process crash,
+	// but they might be lost on a machine crash if they are not synced yet
+	// Default is 1s
+	SyncInterval time.Duration
+
+	// CompactInterval interval to rewrite the log by the current entries of the cache,
+	// which drops the overwritten and deleted keys from the log
+	// Default is 10m
+	CompactInterval time.Duration
+
+	// OnError is called when the log can not be written, synced or compacted
+	// The cache keeps working without persisting the mutations until the log can be written again
+	OnError func(err error)
+}
+
+// WAL append-only log of the cache mutations, which can be replayed after a restart
+// to recover the state of the cache since its last compaction, see Cache.OpenWAL
+type WAL struct {
+	cache   *Cache
+	path    string
+	codec   Codec
+	options WALOptions
+
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+	fc   *frameCipher
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// walRecord a mutation as it's stored in the log
+type walRecord struct {
+	Key       any
+	Value     any
+	ExpiresAt time.Time
+	Deleted   bool
+}
+
+// OpenWAL replays the log at path into the cache if it exists, and logs the following mutations of the cache
+// (Set, Delete, refreshes, evictions, ...) to it, so the entries can be recovered after a crash
+// without the cost of frequent full snapshots
+//
+// The log is compacted on open and then every WALOptions.CompactInterval.
+// A record which is partially written by a crash is ignored on replay.
+// Records are encrypted if Config.Encryption is set, the same as snapshots
+//
+// Only one WAL can be open per cache, ErrWALOpen is returned otherwise
+func (c *Cache) OpenWAL(path string, options WALOptions) (*WAL, error) {
+	if options.Codec == "" {
+		options.Codec = defaultWALCodec
+	}
+	if options.SyncInterval <= 0 {
+		options.SyncInterval = defaultWALSyncInterval
+	}
+	if options.CompactInterval <= 0 {
+		options.CompactInterval = defaultWALCompactInterval
+	}
+	codec, ok := LookupCodec(options.Codec)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, options.Codec)
+	}
+
+	w := &WAL{
+		cache:   c,
+		path:    path,
+		codec:   codec,
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	c.walMu.Lock()
+	if c.wal != nil {
+		c.walMu.Unlock()
+		return nil, ErrWALOpen
+	}
+	c.wal = w
+	c.walMu.Unlock()
+
+	// records are not written until the log is compacted, which includes the replayed and the concurrently stored entries
+	err := c.replay(path)
+	if err == nil {
+		w.mu.Lock()
+		err = w.compact()
+		w.mu.Unlock()
+	}
+	if err != nil {
+		c.walMu.Lock()
+		c.wal = nil
+		c.walMu.Unlock()
+		return nil, err
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// replay stores the mutations of the log at path, if it exists
+func (c *Cache) replay(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	codec, fc, err := c.readHeader(r, walMagic, encryptedWALMagic)
+	if err != nil {
+		return err
+	}
+	for {
+		var record walRecord
+		err := readRecord(r, codec, fc, &record)
+		if errors.Is(err, io.EOF) || errors.Is(err, errTruncatedFrame) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !record.Deleted {
+			c.restore(record.Key, record.Value, record.ExpiresAt)
+			continue
+		}
+		mu := c.lock(record.Key)
+		mu.Lock()
+		c.delete(record.Key)
+		mu.Unlock()
+		c.afterDelete(record.Key, EventDelete)
+	}
+}
+
+// Compact rewrites the log by the current entries of the cache
+// Mutations of the cache are blocked while compacting
+func (w *WAL) Compact() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return ErrClosed
+	}
+	return w.compact()
+}
+
+// compact writes the entries of the cache to a new file and replaces the log by it, w.mu must be held
+func (w *WAL) compact() error {
+	tmp := w.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	fc, err := w.cache.writeHeader(bw, walMagic, encryptedWALMagic, w.options.Codec)
+	if err == nil {
+		w.cache.storage().Range(func(key any, it *item) bool {
+			var value any
+			if value, err = w.cache.decompress(it.value); err != nil {
+				return false
+			}
+			err = writeRecord(bw, w.codec, fc, walRecord{Key: key, Value: value, ExpiresAt: it.expiresAt})
+			return err == nil
+		})
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, w.path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.file, w.w, w.fc = f, bw, fc
+	return nil
+}
+
+// append writes the record to the log, the lock of the key must be held so the records of a key are in order
+func (w *WAL) append(record walRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return
+	}
+	err := writeRecord(w.w, w.codec, w.fc, record)
+	if err == nil {
+		err = w.w.Flush()
+	}
+	if err != nil {
+		w.onError(err)
+	}
+}
+
+func (w *WAL) run() {
+	defer close(w.done)
+
+	syncTicker := time.NewTicker(w.options.SyncInterval)
+	defer syncTicker.Stop()
+	compactTicker := time.NewTicker(w.options.CompactInterval)
+	defer compactTicker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-syncTicker.C:
+			if err := w.Sync(); err != nil && !errors.Is(err, ErrClosed) {
+				w.onError(err)
+			}
+		case <-compactTicker.C:
+			if err := w.Compact(); err != nil && !errors.Is(err, ErrClosed) {
+				w.onError(err)
+			}
+		}
+	}
+}
+
+// Sync commits the written records to the disk
+func (w *WAL) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return ErrClosed
+	}
+	return w.file.Sync()
+}
+
+// Close syncs and closes the log, the following mutations of the cache are not logged anymore
+func (w *WAL) Close() error {
+	w.cache.walMu.Lock()
+	if w.cache.wal == w {
+		w.cache.wal = nil
+	}
+	w.cache.walMu.Unlock()
+
+	w.mu.Lock()
+	if w.file == nil {
+		w.mu.Unlock()
+		return nil
+	}
+	err := w.file.Sync()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	w.mu.Unlock()
+
+	close(w.stop)
+	<-w.done
+	return err
+}
+
+func (w *WAL) onError(err error) {
+	if w.options.OnError != nil {
+		w.options.OnError(err)
+	}
+}
+
+// openWAL returns the open WAL of the cache, if any
+func (c *Cache) openWAL() *WAL {
+	c.walMu.RLock()
+	defer c.walMu.RUnlock()
+	return c.wal
+}
+
+// logStore logs the value of the key, the lock of the key must be held
+func (c *Cache) logStore(key, value any, expiresAt time.Time) {
+	if w := c.openWAL(); w != nil {
+		w.append(walRecord{Key: key, Value: value, ExpiresAt: expiresAt})
+	}
+}
+
+// logDelete logs the deletion of the key, the lock of the key must be held
+func (c *Cache) logDelete(key any) {
+	if w := c.openWAL(); w != nil {
+		w.append(walRecord{Key: key, Deleted: true})
+	}
+}
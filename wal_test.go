@@ -0,0 +1,131 @@
+package lastcache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache_WALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.wal")
+
+	cache := New(Config{GlobalTTL: time.Minute})
+	cache.Set("existing", "value")
+	wal, err := cache.OpenWAL(path, WALOptions{})
+	if err != nil {
+		t.Fatalf("OpenWAL() failed with err: %v", err)
+	}
+	if _, err = cache.OpenWAL(path, WALOptions{}); !errors.Is(err, ErrWALOpen) {
+		t.Errorf("OpenWAL() err got %v, want %v", err, ErrWALOpen)
+	}
+	cache.Set("key1", "value1")
+	cache.Set("key2", "value2")
+	cache.Set("key1", "value1_updated")
+	cache.Delete("key2")
+	// the process crashes without closing the log
+
+	recovered := New(Config{GlobalTTL: time.Minute})
+	recoveredWAL, err := recovered.OpenWAL(path, WALOptions{})
+	if err != nil {
+		t.Fatalf("OpenWAL() failed with err: %v", err)
+	}
+	defer recoveredWAL.Close()
+	wal.Close()
+
+	want := map[any]any{"existing": "value", "key1": "value1_updated"}
+	for key, value := range want {
+		if entry, err := recovered.Get(key); err != nil || entry.Value != value {
+			t.Errorf("Get(%v) got %+v, %v, want %v", key, entry, err, value)
+		}
+	}
+	if _, err = recovered.Get("key2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(key2) err got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestCache_WALTruncatedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.wal")
+
+	cache := New(Config{GlobalTTL: time.Minute})
+	wal, err := cache.OpenWAL(path, WALOptions{Codec: "json"})
+	if err != nil {
+		t.Fatalf("OpenWAL() failed with err: %v", err)
+	}
+	cache.Set("key1", "value1")
+	if err = wal.Close(); err != nil {
+		t.Fatalf("Close() failed with err: %v", err)
+	}
+	// mutations are not logged after close
+	cache.Set("key2", "value2")
+
+	// the last record is partially written
+	data, _ := os.ReadFile(path)
+	var buf bytes.Buffer
+	writeRecord(&buf, JSONCodec{}, nil, walRecord{Key: "key3", Value: "value3"})
+	data = append(data, buf.Bytes()[:buf.Len()-1]...)
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	recovered := New(Config{GlobalTTL: time.Minute})
+	recoveredWAL, err := recovered.OpenWAL(path, WALOptions{})
+	if err != nil {
+		t.Fatalf("OpenWAL() failed with err: %v", err)
+	}
+	defer recoveredWAL.Close()
+	if entry, err := recovered.Get("key1"); err != nil || entry.Value != "value1" {
+		t.Errorf("Get(key1) got %+v, %v, want value1", entry, err)
+	}
+	if _, err = recovered.Get("key2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(key2) err got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestCache_WALCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.wal")
+	key := StaticKey(bytes.Repeat([]byte{1}, 32))
+
+	cache := New(Config{GlobalTTL: time.Minute, Encryption: key})
+	wal, err := cache.OpenWAL(path, WALOptions{})
+	if err != nil {
+		t.Fatalf("OpenWAL() failed with err: %v", err)
+	}
+	defer wal.Close()
+	for i := 0; i < 100; i++ {
+		cache.Set("key", i)
+	}
+	before, _ := os.Stat(path)
+	if err = wal.Compact(); err != nil {
+		t.Fatalf("Compact() failed with err: %v", err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Errorf("Compact() size got %v, want less than %v", after.Size(), before.Size())
+	}
+	cache.Set("key2", "secret_value")
+
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, []byte("secret_value")) {
+		t.Errorf("log is not encrypted")
+	}
+
+	copied := path + ".copy"
+	if err = os.WriteFile(copied, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	recovered := New(Config{GlobalTTL: time.Minute, Encryption: key})
+	recoveredWAL, err := recovered.OpenWAL(copied, WALOptions{})
+	if err != nil {
+		t.Fatalf("OpenWAL() failed with err: %v", err)
+	}
+	defer recoveredWAL.Close()
+	if entry, err := recovered.Get("key"); err != nil || entry.Value != 99 {
+		t.Errorf("Get(key) got %+v, %v, want 99", entry, err)
+	}
+	if entry, err := recovered.Get("key2"); err != nil || entry.Value != "secret_value" {
+		t.Errorf("Get(key2) got %+v, %v, want secret_value", entry, err)
+	}
+}
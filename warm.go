@@ -0,0 +1,74 @@
+package lastcache
+
+import (
+	"context"
+	"sync"
+)
+
+// WarmFunc returns the initial key/value pairs to be stored in the cache
+type WarmFunc func(ctx context.Context) (map[any]any, error)
+
+// WarmProgressFunc is called after each warmed up key is stored
+type WarmProgressFunc func(loaded, total int)
+
+type warmer struct {
+	once   sync.Once
+	done   chan struct{}
+	loaded int
+	err    error
+}
+
+// Warm waits until the warmup by Config.WarmFunc is finished or ctx is done,
+// so services can block readiness on a warm cache
+// The warmup is started by New in background, or by the first call of Warm if the cache is not created by New
+// It returns the number of stored keys and the WarmFunc error, or the context error if the warmup timed out
+// If WarmFunc is not set, Warm returns immediately
+func (c *Cache) Warm(ctx context.Context) (loaded int, err error) {
+	if c.config.WarmFunc == nil {
+		return 0, nil
+	}
+
+	c.startWarm()
+	select {
+	case <-c.warm.done:
+		return c.warm.loaded, c.warm.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (c *Cache) startWarm() {
+	c.warm.once.Do(func() {
+		c.warm.done = make(chan struct{})
+		go func() {
+			defer close(c.warm.done)
+			c.warm.loaded, c.warm.err = c.runWarm()
+		}()
+	})
+}
+
+func (c *Cache) runWarm() (loaded int, err error) {
+	ctx := c.context()
+	if c.config.WarmTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.WarmTimeout)
+		defer cancel()
+	}
+
+	pairs, err := c.config.WarmFunc(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for key, value := range pairs {
+		if err = ctx.Err(); err != nil {
+			return loaded, err
+		}
+		c.Set(key, value)
+		loaded++
+		if c.config.WarmProgress != nil {
+			c.config.WarmProgress(loaded, len(pairs))
+		}
+	}
+	return loaded, nil
+}
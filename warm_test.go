@@ -0,0 +1,99 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache_Warm(t *testing.T) {
+	var mu sync.Mutex
+	var progress []int
+	cache := New(Config{
+		GlobalTTL: time.Hour,
+		WarmFunc: func(ctx context.Context) (map[any]any, error) {
+			return map[any]any{"key1": "value1", "key2": "value2"}, nil
+		},
+		WarmProgress: func(loaded, total int) {
+			mu.Lock()
+			defer mu.Unlock()
+			if total != 2 {
+				t.Errorf("WarmProgress() total got = %v, want 2", total)
+			}
+			progress = append(progress, loaded)
+		},
+	})
+	defer cache.Close()
+
+	loaded, err := cache.Warm(context.Background())
+	if err != nil || loaded != 2 {
+		t.Fatalf("Warm() got %v, %v, want 2, nil", loaded, err)
+	}
+
+	for _, key := range []string{"key1", "key2"} {
+		if _, err := cache.Get(key); err != nil {
+			t.Errorf("Get(%v) failed with err: %v", key, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(progress) != 2 || progress[1] != 2 {
+		t.Errorf("WarmProgress() calls got = %v, want [1 2]", progress)
+	}
+}
+
+func TestCache_WarmError(t *testing.T) {
+	wantErr := errors.New("unavailable")
+	cache := New(Config{
+		WarmFunc: func(ctx context.Context) (map[any]any, error) {
+			return nil, wantErr
+		},
+	})
+	defer cache.Close()
+
+	if _, err := cache.Warm(context.Background()); !errors.Is(err, wantErr) {
+		t.Errorf("Warm() err got %v, want %v", err, wantErr)
+	}
+}
+
+func TestCache_WarmTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	cache := New(Config{
+		WarmTimeout: time.Millisecond,
+		WarmFunc: func(ctx context.Context) (map[any]any, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+	defer cache.Close()
+
+	if _, err := cache.Warm(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Warm() err got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// waiting is bounded by ctx as well
+	blocking := New(Config{
+		WarmFunc: func(ctx context.Context) (map[any]any, error) {
+			<-release
+			return nil, nil
+		},
+	})
+	defer blocking.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := blocking.Warm(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Warm() err got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestCache_WarmWithoutWarmFunc(t *testing.T) {
+	cache := New(Config{})
+	if loaded, err := cache.Warm(context.Background()); loaded != 0 || err != nil {
+		t.Errorf("Warm() got %v, %v, want 0, nil", loaded, err)
+	}
+}
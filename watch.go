@@ -0,0 +1,53 @@
+package lastcache
+
+import "context"
+
+// KeyUpdate an update of a key pushed by the upstream, see Watcher
+type KeyUpdate struct {
+	Key   any
+	Value any
+	// Delete if set, the key is deleted and Value is ignored
+	Delete bool
+	// Expire if set, the key is expired so its stale value is served until it's refreshed, Value is ignored
+	Expire bool
+}
+
+// Watcher pushes the updates of the upstream to the cache, e.g. a Kafka topic consumer, webhooks or an etcd watch
+type Watcher interface {
+	// Watch returns the channel of the updates, it should be closed when ctx is done or the watch ends
+	Watch(ctx context.Context) <-chan KeyUpdate
+}
+
+// WatcherFunc adapts a function to Watcher
+type WatcherFunc func(ctx context.Context) <-chan KeyUpdate
+
+// Watch calls f(ctx)
+func (f WatcherFunc) Watch(ctx context.Context) <-chan KeyUpdate {
+	return f(ctx)
+}
+
+// watch applies the updates of Config.Watcher until the channel is closed or the cache context is done
+func (c *Cache) watch(updates <-chan KeyUpdate) {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			c.applyUpdate(update)
+		}
+	}
+}
+
+func (c *Cache) applyUpdate(update KeyUpdate) {
+	switch {
+	case update.Delete:
+		c.Delete(update.Key)
+	case update.Expire:
+		c.Expire(update.Key)
+	default:
+		c.Set(update.Key, update.Value)
+	}
+}
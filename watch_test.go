@@ -0,0 +1,51 @@
+package lastcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCache_Watcher(t *testing.T) {
+	now = time.Now
+	updates := make(chan KeyUpdate)
+	watched := make(chan context.Context, 1)
+	cache := New(Config{GlobalTTL: time.Hour, Watcher: WatcherFunc(func(ctx context.Context) <-chan KeyUpdate {
+		watched <- ctx
+		return updates
+	})})
+	defer cache.Close()
+	cache.Set("deleted", "value")
+	cache.Set("expired", "value")
+
+	updates <- KeyUpdate{Key: "replaced", Value: "pushed"}
+	updates <- KeyUpdate{Key: "deleted", Delete: true}
+	updates <- KeyUpdate{Key: "expired", Expire: true}
+	// the previous updates are applied once the next one is received
+	updates <- KeyUpdate{Key: "last", Value: "value"}
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if _, err := cache.Get("last"); err == nil {
+			break
+		}
+	}
+
+	if entry, err := cache.Get("replaced"); err != nil || entry.Value != "pushed" {
+		t.Errorf("Get() got %+v, %v, want pushed value", entry, err)
+	}
+	if _, err := cache.Get("deleted"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() got err %v, want ErrNotFound", err)
+	}
+	if entry, err := cache.Get("expired"); !errors.Is(err, ErrExpired) || entry.Value != "value" {
+		t.Errorf("Get() got %+v, %v, want expired value", entry, err)
+	}
+
+	// the watch context is canceled by Close
+	ctx := <-watched
+	cache.Close()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Errorf("watch context is not canceled by Close")
+	}
+}
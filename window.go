@@ -0,0 +1,109 @@
+package lastcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// MaxStatsWindow maximum window supported by WindowStats
+const MaxStatsWindow = 5 * time.Minute
+
+// windowBuckets number of one-second buckets kept for windowed statistics
+const windowBuckets = int64(MaxStatsWindow / time.Second)
+
+// WindowStats statistics of a recent time window
+type WindowStats struct {
+	Window      time.Duration
+	Hits        uint64
+	Misses      uint64
+	StaleServes uint64
+	// Callbacks number of the callback calls, sync and async
+	Callbacks uint64
+	// CallbackErrors number of the failed callback calls
+	CallbackErrors uint64
+}
+
+// Requests returns total number of loads in the window
+func (w WindowStats) Requests() uint64 {
+	return w.Hits + w.Misses + w.StaleServes
+}
+
+// HitRatio returns the fraction of the loads served fresh from the cache
+func (w WindowStats) HitRatio() float64 {
+	return ratio(w.Hits, w.Requests())
+}
+
+// StaleRatio returns the fraction of the loads served stale
+func (w WindowStats) StaleRatio() float64 {
+	return ratio(w.StaleServes, w.Requests())
+}
+
+// CallbackErrorRatio returns the fraction of the callback calls which failed
+func (w WindowStats) CallbackErrorRatio() float64 {
+	return ratio(w.CallbackErrors, w.Callbacks)
+}
+
+func ratio(n, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+type windowBucket struct {
+	second      int64
+	hits        uint64
+	misses      uint64
+	staleServes uint64
+	callbacks   uint64
+	callbackErr uint64
+}
+
+// window ring of per-second buckets
+// Counters are updated without locking, so the counts around a bucket rotation are approximate
+type window struct {
+	buckets [windowBuckets]windowBucket
+}
+
+func (w *window) bucket(t time.Time) *windowBucket {
+	sec := t.Unix()
+	b := &w.buckets[sec%windowBuckets]
+	if old := atomic.LoadInt64(&b.second); old != sec && atomic.CompareAndSwapInt64(&b.second, old, sec) {
+		atomic.StoreUint64(&b.hits, 0)
+		atomic.StoreUint64(&b.misses, 0)
+		atomic.StoreUint64(&b.staleServes, 0)
+		atomic.StoreUint64(&b.callbacks, 0)
+		atomic.StoreUint64(&b.callbackErr, 0)
+	}
+	return b
+}
+
+func (w *window) stats(t time.Time, d time.Duration) WindowStats {
+	if d <= 0 || d > MaxStatsWindow {
+		d = MaxStatsWindow
+	}
+
+	s := WindowStats{Window: d}
+	last := t.Unix()
+	first := last - int64(d/time.Second) + 1
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		sec := atomic.LoadInt64(&b.second)
+		if sec < first || sec > last {
+			continue
+		}
+		s.Hits += atomic.LoadUint64(&b.hits)
+		s.Misses += atomic.LoadUint64(&b.misses)
+		s.StaleServes += atomic.LoadUint64(&b.staleServes)
+		s.Callbacks += atomic.LoadUint64(&b.callbacks)
+		s.CallbackErrors += atomic.LoadUint64(&b.callbackErr)
+	}
+	return s
+}
+
+// WindowStats returns the statistics of the last d duration (up to MaxStatsWindow) with one second resolution
+// This can be used to react to the recent behavior of the cache, e.g. HitRatio of the last minute
+func (c *Cache) WindowStats(d time.Duration) WindowStats {
+	c.lazyInit()
+	return c.stats.window.stats(c.now(), d)
+}
@@ -0,0 +1,47 @@
+package lastcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCache_WindowStats(t *testing.T) {
+	cache := New(Config{
+		GlobalTTL: time.Hour,
+	})
+
+	callback := func(ctx context.Context, key any, prev *Entry) (any, bool, error) {
+		return "value", false, nil
+	}
+
+	now = func() time.Time { return fixedTime() }
+	cache.LoadOrStore("key", callback) // miss
+	cache.LoadOrStore("key", callback) // hit
+
+	now = func() time.Time { return fixedTime().Add(2 * time.Minute) }
+	cache.LoadOrStore("key", callback)  // hit
+	cache.LoadOrStore("key", callback)  // hit
+	cache.LoadOrStore("key2", callback) // miss
+
+	got := cache.WindowStats(time.Minute)
+	if got.Hits != 2 || got.Misses != 1 || got.Requests() != 3 {
+		t.Errorf("WindowStats(1m) got = %+v", got)
+	}
+	if ratio := got.HitRatio(); ratio < 0.66 || ratio > 0.67 {
+		t.Errorf("HitRatio() got = %v, want 2/3", ratio)
+	}
+
+	got = cache.WindowStats(5 * time.Minute)
+	if got.Hits != 3 || got.Misses != 2 {
+		t.Errorf("WindowStats(5m) got = %+v", got)
+	}
+
+	// buckets are reused after the max window
+	now = func() time.Time { return fixedTime().Add(MaxStatsWindow) }
+	cache.LoadOrStore("key", callback) // hit
+	got = cache.WindowStats(MaxStatsWindow)
+	if got.Hits != 3 || got.Misses != 1 || got.StaleRatio() != 0 {
+		t.Errorf("WindowStats(max) got = %+v", got)
+	}
+}